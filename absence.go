@@ -0,0 +1,112 @@
+package bloomtree
+
+import "sort"
+
+// WithSmallestAbsenceProofs proves the absence of an element with the zero index whose chunk adds the fewest
+// bytes to the proof, instead of the first zero index. Batch proofs prefer chunks already opened for other
+// elements of the batch, or chunks whose paths share the most hashes with them, which can cut the size of
+// absence proofs considerably. If several zero indices are proven, see WithAbsentIndices, they are picked one
+// after another given the chunks picked before, so zero indices in the same or adjacent chunks, whose paths
+// share their parents, are preferred over the first zero indices spread over the tree.
+// Proofs verify as before, the verifier does not need the option.
+func WithSmallestAbsenceProofs() Option {
+	return func(c *config) error {
+		c.smallestAbsence = true
+		return nil
+	}
+}
+
+// proofCover tracks the chunks opened by a proof, and the nodes of the tree they cover,
+// to compute the cost of opening more chunks.
+type proofCover struct {
+	bt      *BloomTree
+	covered map[uint64]bool
+}
+
+func newProofCover(bt *BloomTree) *proofCover {
+	return &proofCover{bt: bt, covered: make(map[uint64]bool)}
+}
+
+// open marks the chunk and its ancestors as covered.
+func (c *proofCover) open(chunk uint64) {
+	leafNum := uint64(c.bt.nodeCount()+1) / 2
+	root := uint64(c.bt.nodeCount() - 1)
+	for node := chunk; !c.covered[node]; node = leafNum + node/2 {
+		c.covered[node] = true
+		if node == root {
+			break
+		}
+	}
+}
+
+// cost returns the number of bytes opening the chunk adds to the proof: its hash, its words and
+// the proof hashes it needs, less the proof hash it makes redundant.
+func (c *proofCover) cost(chunk uint64) int {
+	if c.covered[chunk] {
+		return 0
+	}
+	words := len(c.bt.leafWords(c.bt.bf.BitArray().Bytes(), int(chunk)))
+	bytes := 32 + 8*words
+	if c.bt.cfg.blindingKey != nil {
+		bytes += 32 * words
+	}
+	leafNum := uint64(c.bt.nodeCount()+1) / 2
+	root := uint64(c.bt.nodeCount() - 1)
+	for node := chunk; node != root && !c.covered[node]; node = leafNum + node/2 {
+		if c.covered[node^1] {
+			// the sibling was a proof hash of the covered path and can be computed now
+			bytes -= 32
+			break
+		}
+		bytes += 32
+	}
+	return bytes
+}
+
+// smallestAbsence returns the zero index among the element indices whose chunk costs the fewest bytes,
+// together with its proof type. Ties are broken by the position among the element indices.
+func (bt *BloomTree) smallestAbsence(elemIndices []uint, cover *proofCover) (uint64, ProofType) {
+	bf := bt.bf.BitArray()
+	best, bestCost := -1, 0
+	for i, v := range elemIndices {
+		if bf.Test(v) {
+			continue
+		}
+		if cost := cover.cost(bt.chunkIndex(uint64(v))); best == -1 || cost < bestCost {
+			best, bestCost = i, cost
+		}
+	}
+	return uint64(elemIndices[best]), Absence(uint8(best))
+}
+
+// smallestAbsences returns up to n zero indices among the element indices whose chunks add the fewest bytes to
+// the proof, together with their positions in increasing order. Every index is picked given the chunks of the
+// indices picked before it, ties are broken by the position among the element indices.
+func (bt *BloomTree) smallestAbsences(elemIndices []uint, n int, cover *proofCover) ([]uint64, []uint8) {
+	bf := bt.bf.BitArray()
+	picked := make([]bool, len(elemIndices))
+	var positions []uint8
+	for len(positions) < n {
+		best, bestCost := -1, 0
+		for i, v := range elemIndices {
+			if picked[i] || bf.Test(v) {
+				continue
+			}
+			if cost := cover.cost(bt.chunkIndex(uint64(v))); best == -1 || cost < bestCost {
+				best, bestCost = i, cost
+			}
+		}
+		if best == -1 {
+			break
+		}
+		picked[best] = true
+		cover.open(bt.chunkIndex(uint64(elemIndices[best])))
+		positions = append(positions, uint8(best))
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	indices := make([]uint64, len(positions))
+	for i, position := range positions {
+		indices[i] = uint64(elemIndices[position])
+	}
+	return indices, positions
+}
@@ -0,0 +1,165 @@
+package bloomtree
+
+import (
+	"testing"
+)
+
+func batchBytes(p *BatchMultiProof) int {
+	var n int
+	for _, c := range p.Costs {
+		n += c.Bytes
+	}
+	return n
+}
+
+func TestSmallestAbsenceProofs(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	var present [][]byte
+	for i := 0; i < 40; i++ {
+		present = append(present, []byte{byte(i)})
+	}
+	dbf := generateDBF(200, seed, present...)
+	plain, err := NewBloomTree(dbf, WithChunkSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallest, err := NewBloomTree(dbf, WithChunkSize(128), WithSmallestAbsenceProofs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Root() != smallest.Root() {
+		t.Fatal("the option must not change the root")
+	}
+
+	// single absence proofs verify without the option
+	for i := 100; i < 120; i++ {
+		elem := []byte{byte(i)}
+		proof, err := smallest.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.ProofType.IsPresence() {
+			continue
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), proof, smallest.Root(), dbf, WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify the absence proof of element %v", elem)
+		}
+	}
+
+	// absent elements of a batch prefer the chunks opened for the other elements
+	var smaller int
+	for i := 100; i < 140; i++ {
+		elems := append(append([][]byte(nil), present[i%40:i%40+3]...), []byte{byte(i)}, []byte{byte(i + 100)})
+		plainProof, err := plain.GenerateCompactMultiProofBatch(elems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := smallest.GenerateCompactMultiProofBatch(elems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batchBytes(proof) > batchBytes(plainProof) {
+			t.Fatalf("the batch of %v has %d bytes, but %d without the option", elems, batchBytes(proof), batchBytes(plainProof))
+		}
+		if batchBytes(proof) < batchBytes(plainProof) {
+			smaller++
+		}
+		verified, err := VerifyCompactMultiProofBatch(elems, []byte(seed), proof, smallest.Root(), dbf, WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify the batch of %v", elems)
+		}
+	}
+	if smaller == 0 {
+		t.Fatal("expected some batches to get smaller")
+	}
+}
+
+func TestProofCoverCost(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height := 0
+	for n := tree.nodeCount() + 1; n > 2; n /= 2 {
+		height++
+	}
+	cover := newProofCover(tree)
+	if cost := cover.cost(4); cost != 32+8+32*height {
+		t.Fatalf("expected cost %d of the first chunk, but got %d", 32+8+32*height, cost)
+	}
+	cover.open(4)
+	var tests = []struct {
+		chunk uint64
+		cost  int
+	}{
+		{chunk: 4, cost: 0},
+		// the sibling replaces its proof hash
+		{chunk: 5, cost: 32 + 8 - 32},
+		// a cousin needs its sibling and replaces the proof hash of its parent
+		{chunk: 6, cost: 32 + 8 + 32 - 32},
+		// the subtree of chunks 0 to 3 replaces the proof hash of its sibling subtree
+		{chunk: 0, cost: 32 + 8 + 2*32 - 32},
+	}
+	for _, test := range tests {
+		if cost := cover.cost(test.chunk); cost != test.cost {
+			t.Fatalf("expected cost %d of chunk %d, but got %d", test.cost, test.chunk, cost)
+		}
+	}
+}
+
+func TestSmallestAbsentIndices(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(2000, seed, []byte{1})
+	plain, err := NewBloomTree(dbf, WithAbsentIndices(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallest, err := NewBloomTree(dbf, WithAbsentIndices(2), WithSmallestAbsenceProofs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// zero indices in adjacent chunks share their parents, which are proven only once
+	var smaller int
+	for i := 0; i < 200; i++ {
+		elem := []byte{2, byte(i)}
+		plainProof, err := plain.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := smallest.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof.AbsentIndices) != len(plainProof.AbsentIndices) {
+			t.Fatalf("expected %d absent indices of element %v, but got %d", len(plainProof.AbsentIndices), elem, len(proof.AbsentIndices))
+		}
+		if proof.binarySize() > plainProof.binarySize() {
+			t.Fatalf("the proof of %v has %d bytes, but %d without the option", elem, proof.binarySize(), plainProof.binarySize())
+		}
+		if proof.binarySize() < plainProof.binarySize() {
+			smaller++
+		}
+		if err := proof.CheckOrder(); err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), proof, smallest.Root(), dbf, WithMinAbsentIndices(len(plainProof.AbsentIndices)))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify the absence proof of element %v", elem)
+		}
+	}
+	if smaller == 0 {
+		t.Fatal("expected some proofs to get smaller")
+	}
+}
@@ -0,0 +1,109 @@
+package bloomtree
+
+import (
+	"container/heap"
+	"sync/atomic"
+)
+
+// WithAccessStats counts how often every chunk appears in generated proofs, so operators of disk-backed
+// trees can keep the hottest chunks and their paths in memory, see TopChunks. The counters take 8 bytes
+// per leaf, and are shared by the snapshots and frozen views of the tree.
+func WithAccessStats() Option {
+	return func(c *config) error {
+		c.accessStats = true
+		return nil
+	}
+}
+
+// ChunkAccess is the number of generated proofs that opened a chunk.
+type ChunkAccess struct {
+	Chunk uint64
+	Count uint64
+}
+
+// accessStats holds the proof count of every leaf of a tree, updated atomically.
+type accessStats struct {
+	counts []uint64
+}
+
+// recordAccess counts a proof of the chunks at the given sorted indices. Every chunk is counted once per proof.
+func (bt *BloomTree) recordAccess(chunkIndices []uint64) {
+	if bt.access == nil {
+		return
+	}
+	for i, c := range chunkIndices {
+		if i > 0 && c == chunkIndices[i-1] {
+			continue
+		}
+		bt.recordChunk(c)
+	}
+}
+
+// recordChunk counts a proof of the chunk.
+func (bt *BloomTree) recordChunk(c uint64) {
+	if bt.access != nil && c < uint64(len(bt.access.counts)) {
+		atomic.AddUint64(&bt.access.counts[c], 1)
+	}
+}
+
+// TopChunks returns the n chunks opened by the most proofs, the most accessed first and chunks with the same
+// count by index. Chunks no proof opened are left out. The nodes worth keeping in memory besides the chunks
+// are their ancestors, which every proof of the chunk passes. TopChunks returns nil for trees built without
+// WithAccessStats.
+func (bt *BloomTree) TopChunks(n int) []ChunkAccess {
+	if bt.access == nil || n <= 0 {
+		return nil
+	}
+	// top is a min-heap of the n most accessed chunks seen so far
+	top := make(accessHeap, 0, n)
+	for i := range bt.access.counts {
+		count := atomic.LoadUint64(&bt.access.counts[i])
+		if count == 0 {
+			continue
+		}
+		access := ChunkAccess{Chunk: uint64(i), Count: count}
+		if len(top) < n {
+			heap.Push(&top, access)
+		} else if top.less(top[0], access) {
+			top[0] = access
+			heap.Fix(&top, 0)
+		}
+	}
+	chunks := make([]ChunkAccess, len(top))
+	for i := len(chunks) - 1; i >= 0; i-- {
+		chunks[i] = heap.Pop(&top).(ChunkAccess)
+	}
+	return chunks
+}
+
+// ResetAccessStats sets the access counts of all chunks to zero, e.g. to track a new window of traffic.
+func (bt *BloomTree) ResetAccessStats() {
+	if bt.access == nil {
+		return
+	}
+	for i := range bt.access.counts {
+		atomic.StoreUint64(&bt.access.counts[i], 0)
+	}
+}
+
+// accessHeap orders chunk accesses from the least accessed, and chunks with the same count from the
+// highest index.
+type accessHeap []ChunkAccess
+
+func (h accessHeap) less(a, b ChunkAccess) bool {
+	if a.Count != b.Count {
+		return a.Count < b.Count
+	}
+	return a.Chunk > b.Chunk
+}
+
+func (h accessHeap) Len() int            { return len(h) }
+func (h accessHeap) Less(i, j int) bool  { return h.less(h[i], h[j]) }
+func (h accessHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *accessHeap) Push(x interface{}) { *h = append(*h, x.(ChunkAccess)) }
+func (h *accessHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,92 @@
+package bloomtree
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTopChunks(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	plain, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.GenerateCompactMultiProof([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if top := plain.TopChunks(3); top != nil {
+		t.Fatalf("expected no statistics without WithAccessStats, but got %v", top)
+	}
+
+	tree, err := NewBloomTree(dbf, WithAccessStats())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top := tree.TopChunks(3); len(top) != 0 {
+		t.Fatalf("expected no accessed chunks before the first proof, but got %v", top)
+	}
+	// counts maps the chunks to the expected number of proofs opening them
+	counts := make(map[uint64]uint64)
+	count := func(elems ...[]byte) {
+		chunks := make(map[uint64]bool)
+		for _, elem := range elems {
+			indices, _ := dbf.Proof(elem)
+			for _, i := range indices {
+				chunks[tree.chunkIndex(i)] = true
+			}
+		}
+		for c := range chunks {
+			counts[c]++
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := tree.GenerateCompactMultiProof([]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+		count([]byte{1})
+	}
+	if _, err := tree.GenerateCompactMultiProofBatch([][]byte{{1}, {2}}); err != nil {
+		t.Fatal(err)
+	}
+	count([]byte{1}, []byte{2})
+	// proofs of snapshots count towards the statistics of the tree
+	snapshot, err := tree.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snapshot.GenerateCompactMultiProof([]byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	count([]byte{2})
+
+	var expected []ChunkAccess
+	for c, n := range counts {
+		expected = append(expected, ChunkAccess{Chunk: c, Count: n})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Count != expected[j].Count {
+			return expected[i].Count > expected[j].Count
+		}
+		return expected[i].Chunk < expected[j].Chunk
+	})
+	for _, n := range []int{1, 2, len(expected), len(expected) + 5} {
+		want := expected
+		if n < len(want) {
+			want = want[:n]
+		}
+		if top := tree.TopChunks(n); !reflect.DeepEqual(top, want) {
+			t.Fatalf("expected top %d chunks %v, but got %v", n, want, top)
+		}
+	}
+	if top := tree.TopChunks(0); top != nil {
+		t.Fatalf("expected no chunks for n = 0, but got %v", top)
+	}
+
+	tree.ResetAccessStats()
+	if top := tree.TopChunks(3); len(top) != 0 {
+		t.Fatalf("expected no accessed chunks after a reset, but got %v", top)
+	}
+}
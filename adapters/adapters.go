@@ -0,0 +1,189 @@
+// Package adapters implements the bloomtree.BloomFilter interface for popular bloom filter libraries, so trees
+// can be built from existing filters without reimplementing proofs and index mapping.
+//
+// BitsAndBlooms adapts github.com/bits-and-blooms/bloom/v3 filters, Willf adapts github.com/willf/bloom filters,
+// and NewSeeded returns a simple seeded double-hashing filter. Filters of other libraries can be adapted with New,
+// given their bits and a function mapping elements to their indices.
+//
+// The libraries do not seed their hash functions, so their adapters ignore the seed passed to MapElementToBF.
+// Stateless verifiers need the index function of the filter, e.g. BitsAndBloomsIndices for verifier.Params.
+package adapters
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	bitsandblooms "github.com/bits-and-blooms/bloom/v3"
+	"github.com/willf/bitset"
+	willf "github.com/willf/bloom"
+)
+
+// IndexFunc maps an element to its bloom filter indices, in the order of the hash functions.
+// It has the signature of verifier.IndexFunc.
+type IndexFunc func(element, seed []byte) []uint
+
+// Filter adapts a bloom filter to bloomtree.BloomFilter, and to bloomtree.ExtensibleBloomFilter if elements
+// can be added to it.
+type Filter struct {
+	k       uint
+	seed    []byte
+	bits    func() *bitset.BitSet
+	indices IndexFunc
+	add     func(elem []byte)
+	// copied is set if bits returns a copy of the bits of the filter.
+	copied bool
+}
+
+// New adapts a bloom filter with k hash functions. bits returns the bits of the filter itself, so bits set by a
+// tree with SetBits or Update are set on the filter, indices maps elements to their indices with the given seed,
+// and add adds an element to the filter, it may be nil.
+func New(k uint, seed []byte, bits func() *bitset.BitSet, indices IndexFunc, add func(elem []byte)) *Filter {
+	return &Filter{k: k, seed: seed, bits: bits, indices: indices, add: add}
+}
+
+// NewCopied is New for filters whose bits can only be returned as a copy. Trees of such filters reject SetBits,
+// and Update adds elements with add, which must not be nil for trees to be updated.
+func NewCopied(k uint, seed []byte, bits func() *bitset.BitSet, indices IndexFunc, add func(elem []byte)) *Filter {
+	f := New(k, seed, bits, indices, add)
+	f.copied = true
+	return f
+}
+
+// Proof returns all indices of a present element, or its first index pointing to a zero bit.
+func (f *Filter) Proof(elem []byte) ([]uint64, bool) {
+	bits := f.bits()
+	var ret []uint64
+	for _, v := range f.GetElementIndices(elem) {
+		if !bits.Test(v) {
+			return []uint64{uint64(v)}, false
+		}
+		ret = append(ret, uint64(v))
+	}
+	return ret, true
+}
+
+// BitArray returns the bits of the filter, or a copy of them if the filter was adapted with NewCopied.
+func (f *Filter) BitArray() *bitset.BitSet {
+	return f.bits()
+}
+
+// BitsCopied returns whether BitArray returns a copy of the bits, see bloomtree.CopiedBitsFilter.
+func (f *Filter) BitsCopied() bool {
+	return f.copied
+}
+
+// MapElementToBF returns the indices of the element in a filter with the given seed.
+func (f *Filter) MapElementToBF(elem, seed []byte) []uint {
+	return f.indices(elem, seed)
+}
+
+// NumOfHashes returns the number of hash functions.
+func (f *Filter) NumOfHashes() uint {
+	return f.k
+}
+
+// GetElementIndices returns the indices of the element.
+func (f *Filter) GetElementIndices(elem []byte) []uint {
+	return f.indices(elem, f.seed)
+}
+
+// Add adds the element to the filter. It panics if the filter was adapted without an add function.
+func (f *Filter) Add(elem []byte) {
+	f.add(elem)
+}
+
+// BitsAndBlooms adapts a filter of github.com/bits-and-blooms/bloom/v3. Its bits are of another bitset package
+// and copied on every call of BitArray, so later changes to the filter are seen by the adapter, and trees add
+// elements to it with Add.
+func BitsAndBlooms(b *bitsandblooms.BloomFilter) *Filter {
+	return NewCopied(b.K(), nil, func() *bitset.BitSet {
+		return copyWords(b.BitSet().Bytes(), b.Cap())
+	}, BitsAndBloomsIndices(b.Cap(), b.K()), func(elem []byte) {
+		b.Add(elem)
+	})
+}
+
+// BitsAndBloomsIndices returns the index function of github.com/bits-and-blooms/bloom/v3 filters with m bits
+// and k hash functions.
+func BitsAndBloomsIndices(m, k uint) IndexFunc {
+	return func(element, seed []byte) []uint {
+		return modulo(bitsandblooms.Locations(element, k), m)
+	}
+}
+
+// Willf adapts a filter of github.com/willf/bloom. The library does not expose its bits, so they are decoded
+// from its binary encoding on every call of BitArray, which is slow for large filters, and trees add elements
+// to it with Add.
+func Willf(b *willf.BloomFilter) *Filter {
+	return NewCopied(b.K(), nil, func() *bitset.BitSet {
+		var buf bytes.Buffer
+		// the encoding holds m and k, followed by the encoded bitset; encoding into memory only fails on a bug
+		if _, err := b.WriteTo(&buf); err != nil {
+			panic(fmt.Sprintf("encoding willf bloom filter: %v", err))
+		}
+		bits := &bitset.BitSet{}
+		if _, err := bits.ReadFrom(bytes.NewReader(buf.Bytes()[16:])); err != nil {
+			panic(fmt.Sprintf("decoding willf bloom filter: %v", err))
+		}
+		return bits
+	}, WillfIndices(b.Cap(), b.K()), func(elem []byte) {
+		b.Add(elem)
+	})
+}
+
+// WillfIndices returns the index function of github.com/willf/bloom filters with m bits and k hash functions.
+func WillfIndices(m, k uint) IndexFunc {
+	return func(element, seed []byte) []uint {
+		return modulo(willf.Locations(element, k), m)
+	}
+}
+
+// NewSeeded returns an empty seeded double-hashing bloom filter of m bits and k hash functions. Index i of an
+// element is h1 + i*h2 modulo m, where h1 and h2 are the first two little-endian uint64 of the SHA-512/256 hash
+// of the little-endian uint64 length of the seed, the seed and the element.
+func NewSeeded(m, k uint, seed []byte) *Filter {
+	bits := bitset.New(m)
+	indices := SeededIndices(m, k)
+	seed = append([]byte(nil), seed...)
+	return New(k, seed, func() *bitset.BitSet {
+		return bits
+	}, indices, func(elem []byte) {
+		for _, v := range indices(elem, seed) {
+			bits.Set(v)
+		}
+	})
+}
+
+// SeededIndices returns the index function of filters returned by NewSeeded with m bits and k hash functions.
+func SeededIndices(m, k uint) IndexFunc {
+	return func(element, seed []byte) []uint {
+		data := make([]byte, 8, 8+len(seed)+len(element))
+		binary.LittleEndian.PutUint64(data, uint64(len(seed)))
+		data = append(data, seed...)
+		data = append(data, element...)
+		h := sha512.Sum512_256(data)
+		h1, h2 := binary.LittleEndian.Uint64(h[:8]), binary.LittleEndian.Uint64(h[8:16])
+		indices := make([]uint, k)
+		for i := range indices {
+			indices[i] = uint((h1 + uint64(i)*h2) % uint64(m))
+		}
+		return indices
+	}
+}
+
+func modulo(locations []uint64, m uint) []uint {
+	indices := make([]uint, len(locations))
+	for i, v := range locations {
+		indices[i] = uint(v % uint64(m))
+	}
+	return indices
+}
+
+// copyWords returns a bitset of m bits holding a copy of the words.
+func copyWords(words []uint64, m uint) *bitset.BitSet {
+	bits := bitset.New(m)
+	copy(bits.Bytes(), words)
+	return bits
+}
@@ -0,0 +1,131 @@
+package adapters
+
+import (
+	"testing"
+
+	bitsandblooms "github.com/bits-and-blooms/bloom/v3"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+	willf "github.com/willf/bloom"
+)
+
+func TestAdapters(t *testing.T) {
+	seed := []byte("secret seed")
+	bb := bitsandblooms.New(1000, 4)
+	wf := willf.New(1000, 4)
+	var tests = []struct {
+		name    string
+		filter  *Filter
+		test    func(elem []byte) bool
+		indices IndexFunc
+	}{
+		{name: "bits-and-blooms", filter: BitsAndBlooms(bb), test: bb.Test, indices: BitsAndBloomsIndices(1000, 4)},
+		{name: "willf", filter: Willf(wf), test: wf.Test, indices: WillfIndices(1000, 4)},
+		{name: "seeded", filter: NewSeeded(1000, 4, seed), indices: SeededIndices(1000, 4)},
+	}
+	for _, test := range tests {
+		for i := 0; i < 50; i++ {
+			test.filter.Add([]byte{byte(i)})
+		}
+		if n := test.filter.BitArray().Len(); n != 1000 {
+			t.Fatalf("%s: expected 1000 bits, but got %d", test.name, n)
+		}
+		tree, err := bloomtree.NewBloomTree(test.filter, bloomtree.WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := verifier.Params{M: 1000, K: 4, ChunkSize: 128, Indices: verifier.IndexFunc(test.indices)}
+		for i := 0; i < 100; i++ {
+			elem := []byte{byte(i)}
+			_, present := test.filter.Proof(elem)
+			if test.test != nil && present != test.test(elem) {
+				t.Fatalf("%s: the adapter and the library disagree on element %v", test.name, elem)
+			}
+			if i < 50 && !present {
+				t.Fatalf("%s: expected element %v to be present", test.name, elem)
+			}
+			proof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := bloomtree.VerifyCompactMultiProof(elem, seed, proof, tree.Root(), test.filter, bloomtree.WithChunkSize(128))
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("%s: failed to verify the proof of element %v", test.name, elem)
+			}
+			verifiedPresent, err := verifier.Verify(elem, seed, proof, tree.Root(), params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verifiedPresent != present {
+				t.Fatalf("%s: expected presence %t of element %v, but got %t", test.name, present, elem, verifiedPresent)
+			}
+		}
+	}
+}
+
+func TestSeededIndices(t *testing.T) {
+	indices := SeededIndices(1000, 5)
+	a := indices([]byte("Foo"), []byte("seed"))
+	if len(a) != 5 {
+		t.Fatalf("expected 5 indices, but got %d", len(a))
+	}
+	for _, v := range a {
+		if v >= 1000 {
+			t.Fatalf("index %d exceeds the filter", v)
+		}
+	}
+	b := indices([]byte("Foo"), []byte("other seed"))
+	same := true
+	for i := range a {
+		same = same && a[i] == b[i]
+	}
+	if same {
+		t.Fatal("expected other indices with another seed")
+	}
+	// the length of the seed separates it from the element
+	c := indices([]byte("dFoo"), []byte("see"))
+	same = true
+	for i := range a {
+		same = same && a[i] == c[i]
+	}
+	if same {
+		t.Fatal("expected other indices when moving bytes between seed and element")
+	}
+}
+
+func TestAdapterUpdate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		filter *Filter
+		copied bool
+	}{
+		{name: "bits-and-blooms", filter: BitsAndBlooms(bitsandblooms.New(1000, 4)), copied: true},
+		{name: "willf", filter: Willf(willf.New(1000, 4)), copied: true},
+		{name: "seeded", filter: NewSeeded(1000, 4, []byte("secret seed"))},
+	}
+	for _, test := range tests {
+		tree, err := bloomtree.NewBloomTree(test.filter, bloomtree.WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tree.Root()
+		if err := tree.Update([]byte("zzz")); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if _, present := test.filter.Proof([]byte("zzz")); !present || tree.Root() == root {
+			t.Fatalf("%s: expected the update to reach the filter and the root", test.name)
+		}
+		rebuilt, err := bloomtree.NewBloomTree(test.filter, bloomtree.WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rebuilt.Root() != tree.Root() {
+			t.Fatalf("%s: expected the updated root to match a rebuilt tree", test.name)
+		}
+		if err := tree.SetBits([]uint64{7}); (err != nil) != test.copied {
+			t.Fatalf("%s: expected SetBits to fail only for copied bits, got %v", test.name, err)
+		}
+	}
+}
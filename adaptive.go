@@ -0,0 +1,146 @@
+package bloomtree
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// NewAdaptiveBloomTree creates a bloom tree whose chunk size adapts to the density of the bloom filter.
+// The filter is split into chunks of maxChunkSize bits, and chunks that are denser than the filter as a
+// whole are halved until they reach minChunkSize. The word range of every chunk is committed in its leaf.
+func NewAdaptiveBloomTree(b BloomFilter, minChunkSize, maxChunkSize int, opts ...Option) (*BloomTree, error) {
+	if err := checkAdaptiveChunkSizes(minChunkSize, maxChunkSize); err != nil {
+		return nil, err
+	}
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.store != nil {
+		return nil, errors.New("adaptive trees cannot be built into a node store")
+	}
+	if cfg.blindingKey != nil {
+		return nil, errors.New("adaptive trees cannot be blinded")
+	}
+	if cfg.evm {
+		return nil, errors.New("adaptive trees cannot use the EVM layout")
+	}
+	if cfg.wordTrees {
+		return nil, errors.New("adaptive trees cannot have word trees")
+	}
+	if cfg.sparse {
+		return nil, errors.New("adaptive trees cannot be sparse")
+	}
+	bfAsInt, err := bloomFilterWords(b)
+	if err != nil {
+		return nil, err
+	}
+	bounds := adaptiveBounds(bfAsInt, minChunkSize/64, maxChunkSize/64)
+	leafs := make([][32]byte, len(bounds))
+	parallelRange(cfg.workers, 0, len(bounds), func(first, last int) {
+		for i := first; i < last; i++ {
+			start, end := bounds[i], adaptiveChunkEnd(bounds, i, len(bfAsInt))
+			leafs[i] = cfg.hash.adaptiveLeaf(cfg.chunkSize, uint64(i), start, end, bfAsInt[start:end]...)
+		}
+	})
+	bt := &BloomTree{
+		bf:         b,
+		nodes:      buildNodes(leafs, cfg),
+		bounds:     bounds,
+		cfg:        cfg,
+		provenance: cfg.newProvenance(len(bounds)),
+	}
+	if cfg.chunkChecksums {
+		bt.checksums = bt.chunkChecksums(bfAsInt)
+	}
+	return bt, nil
+}
+
+// VerifyAdaptiveCompactMultiProof verifies a proof generated by a tree built with NewAdaptiveBloomTree.
+// The chunk sizes must match the ones used to build the tree.
+func VerifyAdaptiveCompactMultiProof(element, seedValue []byte, multiproof *CompactMultiProof, root [32]byte, bf BloomFilter,
+	minChunkSize, maxChunkSize int, opts ...Option) (bool, error) {
+	if err := checkAdaptiveChunkSizes(minChunkSize, maxChunkSize); err != nil {
+		return false, err
+	}
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	bfAsInt := bf.BitArray().Bytes()
+	if len(bfAsInt) == 0 {
+		return false, errors.New("there was no bloom filter provided")
+	}
+	bounds := adaptiveBounds(bfAsInt, minChunkSize/64, maxChunkSize/64)
+	treeLeafs := core.LeafNum(len(bounds))
+	treeLength := (treeLeafs * 2) - 1
+	chunkIndicesFn := func(elemIndices []uint) []uint64 {
+		chunkIndices := make([]uint64, len(elemIndices))
+		for i, v := range elemIndices {
+			chunkIndices[i] = adaptiveChunkIndex(bounds, uint64(v))
+		}
+		return chunkIndices
+	}
+	return verifyCompactMultiProof(element, seedValue, multiproof, root, bf, treeLength, chunkIndicesFn, cfg)
+}
+
+func checkAdaptiveChunkSizes(minChunkSize, maxChunkSize int) error {
+	if minChunkSize <= 0 || minChunkSize%64 != 0 || maxChunkSize%64 != 0 {
+		return errors.New("The chunk size must be divisible by 64")
+	}
+	if minChunkSize > maxChunkSize {
+		return errors.New("the minimum chunk size must not exceed the maximum chunk size")
+	}
+	return nil
+}
+
+// adaptiveBounds splits the words of a bloom filter into chunks of minWords to maxWords words and
+// returns the first word of every chunk.
+func adaptiveBounds(words []uint64, minWords, maxWords int) []uint64 {
+	total := popcount(words)
+	var bounds []uint64
+	var split func(start, n int)
+	split = func(start, n int) {
+		region := words[start : start+n]
+		// a region is denser than the filter if popcount(region)/len(region) > total/len(words)
+		denser := popcount(region)*uint64(len(words)) > total*uint64(len(region))
+		if n/2 < minWords || !denser {
+			bounds = append(bounds, uint64(start))
+			return
+		}
+		split(start, n/2)
+		split(start+n/2, n-n/2)
+	}
+	for start := 0; start < len(words); start += maxWords {
+		n := maxWords
+		if len(words)-start < n {
+			n = len(words) - start
+		}
+		split(start, n)
+	}
+	return bounds
+}
+
+func adaptiveChunkEnd(bounds []uint64, i, numWords int) uint64 {
+	if i+1 < len(bounds) {
+		return bounds[i+1]
+	}
+	return uint64(numWords)
+}
+
+// adaptiveChunkIndex returns the leaf index of the chunk holding the given bloom filter index.
+func adaptiveChunkIndex(bounds []uint64, index uint64) uint64 {
+	word := index / 64
+	return uint64(sort.Search(len(bounds), func(i int) bool { return bounds[i] > word }) - 1)
+}
+
+func popcount(words []uint64) uint64 {
+	var count uint64
+	for _, w := range words {
+		count += uint64(bits.OnesCount64(w))
+	}
+	return count
+}
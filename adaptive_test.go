@@ -0,0 +1,130 @@
+package bloomtree
+
+import (
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestAdaptiveBounds(t *testing.T) {
+	var tests = []struct {
+		words    []uint64
+		minWords int
+		maxWords int
+		bounds   []uint64
+	}{
+		{
+			words:    []uint64{0, 0, 0, 0, 0, 0, 0, 0},
+			minWords: 1,
+			maxWords: 4,
+			bounds:   []uint64{0, 4},
+		},
+		{
+			words:    []uint64{^uint64(0), 1, 0, 0, 0, 0, 0, 0},
+			minWords: 1,
+			maxWords: 4,
+			bounds:   []uint64{0, 1, 2, 4},
+		},
+		{
+			words:    []uint64{0, 0, 0, 0, 0, 0, 0xff, 0xff, 0},
+			minWords: 2,
+			maxWords: 8,
+			bounds:   []uint64{0, 4, 6, 8},
+		},
+	}
+
+	for _, test := range tests {
+		bounds := adaptiveBounds(test.words, test.minWords, test.maxWords)
+		if len(bounds) != len(test.bounds) {
+			t.Fatalf("expected bounds %v, but got %v", test.bounds, bounds)
+		}
+		for i := range bounds {
+			if bounds[i] != test.bounds[i] {
+				t.Fatalf("expected bounds %v, but got %v", test.bounds, bounds)
+			}
+		}
+	}
+}
+
+func TestAdaptiveChunkIndex(t *testing.T) {
+	bounds := []uint64{0, 1, 2, 4}
+	var tests = []struct {
+		index uint64
+		chunk uint64
+	}{
+		{index: 0, chunk: 0},
+		{index: 63, chunk: 0},
+		{index: 64, chunk: 1},
+		{index: 191, chunk: 2},
+		{index: 256, chunk: 3},
+		{index: 1000, chunk: 3},
+	}
+
+	for _, test := range tests {
+		if chunk := adaptiveChunkIndex(bounds, test.index); chunk != test.chunk {
+			t.Fatalf("expected index %d in chunk %d, but got %d", test.index, test.chunk, chunk)
+		}
+	}
+}
+
+func TestAdaptiveProofs(t *testing.T) {
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, [][]byte{{0}, {1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}...)
+	// make the first part of the filter dense
+	var dense []int
+	for i := 0; i < 128; i++ {
+		dense = append(dense, i)
+	}
+	dbf.SetIndices(dense)
+	tree, err := NewAdaptiveBloomTree(dbf, 64, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.bounds[1] != 1 {
+		t.Fatalf("expected the dense region to use the minimum chunk size, got bounds %v", tree.bounds)
+	}
+
+	var tests = []struct {
+		element []byte
+		present bool
+	}{
+		{element: []byte{1}, present: true},
+		{element: []byte{8}, present: true},
+		{element: []byte{9}, present: false},
+		{element: []byte{17}, present: false},
+	}
+
+	for _, test := range tests {
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if CheckProofType(multiproof.ProofType) != test.present {
+			t.Fatalf("unexpected proof type %d for element %v", multiproof.ProofType, test.element)
+		}
+		verified, err := VerifyAdaptiveCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf, 64, 512)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify proof for element %v", test.element)
+		}
+	}
+}
+
+func TestAdaptiveChunkSizes(t *testing.T) {
+	dbf := DBF.NewDbf(200, 0.2, []byte("secret seed"))
+	var tests = []struct {
+		minChunkSize int
+		maxChunkSize int
+	}{
+		{minChunkSize: 0, maxChunkSize: 64},
+		{minChunkSize: 65, maxChunkSize: 128},
+		{minChunkSize: 128, maxChunkSize: 64},
+	}
+
+	for _, test := range tests {
+		if _, err := NewAdaptiveBloomTree(dbf, test.minChunkSize, test.maxChunkSize); err == nil {
+			t.Fatalf("expected error for chunk sizes %d and %d", test.minChunkSize, test.maxChunkSize)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package anchor batches bloom tree roots and anchors them on a blockchain, so clients can check that a root
+// was published at a given block, and not only by the server serving its proofs.
+//
+// An Anchorer queues roots with Add, sends them in batches with Flush, and records a Receipt for every root
+// once its transaction has enough confirmations, which Poll checks. The chain is reached through the Chain
+// interface, and the roots are encoded with a Format, e.g. as Ethereum calldata or as an EIP-4844 blob.
+//
+// A Bundle combines the proof of an element with the signed attestation and the anchor receipt of its root,
+// so a client can check all of them with a single call.
+package anchor
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Chain sends payloads to a blockchain and reports their inclusion.
+type Chain interface {
+	// Submit sends a transaction with the payload and returns its hash.
+	Submit(ctx context.Context, payload []byte) ([32]byte, error)
+	// Status returns the number of the block including the transaction and its number of confirmations.
+	// The confirmations are zero while the transaction is pending.
+	Status(ctx context.Context, tx [32]byte) (block uint64, confirmations uint64, err error)
+}
+
+// Receipt records that a root was anchored by a confirmed transaction.
+type Receipt struct {
+	// Root is the anchored root.
+	Root [32]byte
+	// Format is the name of the format of the payload.
+	Format string
+	// Tx is the hash of the transaction.
+	Tx [32]byte
+	// Block is the number of the block including the transaction.
+	Block uint64
+	// Payload is the payload of the transaction, holding the root at Position.
+	Payload []byte
+	// Position is the index of the root among the roots of the payload.
+	Position int
+}
+
+// Verify returns an error unless the payload of the receipt anchors the root. Clients still have to check
+// that the transaction with the hash Tx was included in Block with the same payload, e.g. with a light client.
+func (r *Receipt) Verify(root [32]byte) error {
+	if r.Root != root {
+		return fmt.Errorf("the receipt is for root %x, not %x", r.Root, root)
+	}
+	format, err := ParseFormat(r.Format)
+	if err != nil {
+		return err
+	}
+	roots, err := format.Decode(r.Payload)
+	if err != nil {
+		return err
+	}
+	if r.Position < 0 || r.Position >= len(roots) || roots[r.Position] != root {
+		return fmt.Errorf("the payload does not hold root %x at position %d", root, r.Position)
+	}
+	return nil
+}
+
+type receiptJSON struct {
+	Root     string `json:"root"`
+	Format   string `json:"format"`
+	Tx       string `json:"tx"`
+	Block    uint64 `json:"block"`
+	Payload  string `json:"payload"`
+	Position int    `json:"position"`
+}
+
+// MarshalJSON encodes the receipt with hex encoded hashes and payload.
+func (r *Receipt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(receiptJSON{
+		Root:     hex.EncodeToString(r.Root[:]),
+		Format:   r.Format,
+		Tx:       hex.EncodeToString(r.Tx[:]),
+		Block:    r.Block,
+		Payload:  hex.EncodeToString(r.Payload),
+		Position: r.Position,
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a receipt.
+func (r *Receipt) UnmarshalJSON(data []byte) error {
+	var aux receiptJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	root, err := decodeHash(aux.Root)
+	if err != nil {
+		return fmt.Errorf("decoding root: %w", err)
+	}
+	tx, err := decodeHash(aux.Tx)
+	if err != nil {
+		return fmt.Errorf("decoding tx: %w", err)
+	}
+	payload, err := hex.DecodeString(aux.Payload)
+	if err != nil {
+		return fmt.Errorf("decoding payload: %w", err)
+	}
+	*r = Receipt{
+		Root:     root,
+		Format:   aux.Format,
+		Tx:       tx,
+		Block:    aux.Block,
+		Payload:  payload,
+		Position: aux.Position,
+	}
+	return nil
+}
+
+func decodeHash(s string) ([32]byte, error) {
+	var h [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(b) != len(h) {
+		return h, fmt.Errorf("a hash has %d bytes, but got %d", len(h), len(b))
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// batch is a submitted payload awaiting confirmation.
+type batch struct {
+	tx      [32]byte
+	roots   [][32]byte
+	payload []byte
+}
+
+// Anchorer batches roots and anchors them on a chain. It is safe for concurrent use.
+type Anchorer struct {
+	chain         Chain
+	format        Format
+	confirmations uint64
+
+	mu        sync.Mutex
+	pending   [][32]byte
+	queued    map[[32]byte]bool
+	submitted []batch
+	receipts  map[[32]byte]*Receipt
+}
+
+// New returns an anchorer sending roots to the chain in the given format. A root counts as anchored once
+// its transaction has the given number of confirmations, at least one.
+func New(chain Chain, format Format, confirmations uint64) *Anchorer {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	return &Anchorer{
+		chain:         chain,
+		format:        format,
+		confirmations: confirmations,
+		queued:        make(map[[32]byte]bool),
+		receipts:      make(map[[32]byte]*Receipt),
+	}
+}
+
+// Add queues the root for the next Flush. Roots that are queued, submitted or anchored already are ignored.
+func (a *Anchorer) Add(root [32]byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.queued[root] {
+		return
+	}
+	a.queued[root] = true
+	a.pending = append(a.pending, root)
+}
+
+// Pending returns the number of queued roots that were not submitted yet.
+func (a *Anchorer) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// Flush submits the queued roots, in as many transactions as the format requires, and returns the hashes
+// of the transactions. Roots whose transaction failed stay queued for the next Flush.
+func (a *Anchorer) Flush(ctx context.Context) ([][32]byte, error) {
+	a.mu.Lock()
+	roots := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	var txs [][32]byte
+	for len(roots) > 0 {
+		n := len(roots)
+		if n > a.format.MaxRoots() {
+			n = a.format.MaxRoots()
+		}
+		payload, err := a.format.Encode(roots[:n])
+		if err == nil {
+			var tx [32]byte
+			if tx, err = a.chain.Submit(ctx, payload); err == nil {
+				a.mu.Lock()
+				a.submitted = append(a.submitted, batch{tx: tx, roots: roots[:n], payload: payload})
+				a.mu.Unlock()
+				txs = append(txs, tx)
+				roots = roots[n:]
+				continue
+			}
+		}
+		a.mu.Lock()
+		a.pending = append(append([][32]byte(nil), roots...), a.pending...)
+		a.mu.Unlock()
+		return txs, fmt.Errorf("anchoring %d roots: %w", n, err)
+	}
+	return txs, nil
+}
+
+// Poll checks the submitted transactions, records the receipts of the roots of every confirmed transaction,
+// and returns the number of newly anchored roots.
+func (a *Anchorer) Poll(ctx context.Context) (int, error) {
+	a.mu.Lock()
+	submitted := append([]batch(nil), a.submitted...)
+	a.mu.Unlock()
+
+	var anchored int
+	for _, b := range submitted {
+		block, confirmations, err := a.chain.Status(ctx, b.tx)
+		if err != nil {
+			return anchored, fmt.Errorf("checking transaction %x: %w", b.tx, err)
+		}
+		if confirmations < a.confirmations {
+			continue
+		}
+		a.mu.Lock()
+		for i, root := range b.roots {
+			a.receipts[root] = &Receipt{
+				Root:     root,
+				Format:   a.format.Name(),
+				Tx:       b.tx,
+				Block:    block,
+				Payload:  b.payload,
+				Position: i,
+			}
+		}
+		for i := range a.submitted {
+			if a.submitted[i].tx == b.tx {
+				a.submitted = append(a.submitted[:i], a.submitted[i+1:]...)
+				break
+			}
+		}
+		a.mu.Unlock()
+		anchored += len(b.roots)
+	}
+	return anchored, nil
+}
+
+// Receipt returns the receipt of an anchored root.
+func (a *Anchorer) Receipt(root [32]byte) (*Receipt, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.receipts[root]
+	return r, ok
+}
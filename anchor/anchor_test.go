@@ -0,0 +1,126 @@
+package anchor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// testChain includes every transaction in the next block and confirms it once per mined block.
+type testChain struct {
+	block    uint64
+	included map[[32]byte]uint64
+	payloads map[[32]byte][]byte
+	fail     bool
+}
+
+func newTestChain() *testChain {
+	return &testChain{included: make(map[[32]byte]uint64), payloads: make(map[[32]byte][]byte)}
+}
+
+func (c *testChain) Submit(ctx context.Context, payload []byte) ([32]byte, error) {
+	if c.fail {
+		return [32]byte{}, errors.New("submission failed")
+	}
+	var tx [32]byte
+	tx[0] = byte(len(c.payloads) + 1)
+	c.included[tx] = c.block + 1
+	c.payloads[tx] = payload
+	return tx, nil
+}
+
+func (c *testChain) Status(ctx context.Context, tx [32]byte) (uint64, uint64, error) {
+	block, ok := c.included[tx]
+	if !ok {
+		return 0, 0, errors.New("unknown transaction")
+	}
+	if block > c.block {
+		return 0, 0, nil
+	}
+	return block, c.block - block + 1, nil
+}
+
+func TestAnchorer(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain()
+	a := New(chain, Calldata, 2)
+	roots := generateRoots(Calldata.MaxRoots() + 1)
+	for _, root := range roots {
+		a.Add(root)
+	}
+	a.Add(roots[0])
+	if a.Pending() != len(roots) {
+		t.Fatalf("expected %d pending roots, but got %d", len(roots), a.Pending())
+	}
+
+	// failed submissions keep the roots queued
+	chain.fail = true
+	if _, err := a.Flush(ctx); err == nil {
+		t.Fatal("expected error for a failed submission")
+	}
+	if a.Pending() != len(roots) {
+		t.Fatalf("expected %d pending roots, but got %d", len(roots), a.Pending())
+	}
+	chain.fail = false
+	txs, err := a.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 || a.Pending() != 0 {
+		t.Fatalf("expected 2 transactions and no pending roots, but got %d and %d", len(txs), a.Pending())
+	}
+
+	for _, test := range []struct {
+		blocks   uint64
+		anchored int
+	}{
+		{blocks: 0, anchored: 0},
+		{blocks: 1, anchored: 0},
+		{blocks: 1, anchored: len(roots)},
+		{blocks: 1, anchored: 0},
+	} {
+		chain.block += test.blocks
+		anchored, err := a.Poll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if anchored != test.anchored {
+			t.Fatalf("expected %d anchored roots at block %d, but got %d", test.anchored, chain.block, anchored)
+		}
+	}
+
+	last := roots[len(roots)-1]
+	receipt, ok := a.Receipt(last)
+	if !ok {
+		t.Fatal("missing receipt")
+	}
+	if receipt.Block != 1 || receipt.Tx != txs[1] || receipt.Position != 0 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	if err := receipt.Verify(last); err != nil {
+		t.Fatal(err)
+	}
+	if err := receipt.Verify(roots[0]); err == nil {
+		t.Fatal("expected error for the receipt of another root")
+	}
+
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Receipt
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(last); err != nil {
+		t.Fatal(err)
+	}
+	decoded.Position = 1
+	if err := decoded.Verify(last); err == nil {
+		t.Fatal("expected error for a wrong position")
+	}
+	if _, ok := a.Receipt([32]byte{1: 0xff}); ok {
+		t.Fatal("expected no receipt for a root that was not added")
+	}
+}
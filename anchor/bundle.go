@@ -0,0 +1,168 @@
+package anchor
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// InclusionVerifier checks that a transaction with the given payload was included in a block of a chain the
+// caller trusts, e.g. with a light client following the headers of the chain. The inclusion proof is specific
+// to the chain, e.g. a block header together with a Merkle-Patricia proof of the transaction.
+type InclusionVerifier interface {
+	VerifyInclusion(tx [32]byte, payload []byte, block uint64, proof []byte) error
+}
+
+// Bundle combines everything needed to check the presence or absence of an element without trusting the
+// server: the proof of the element, the signed attestation of the root, and the receipt anchoring the root
+// on a chain together with the proof that its transaction was included in its block.
+type Bundle struct {
+	// Element is the proven element.
+	Element []byte
+	// Proof is the proof of the element, carrying the words of its chunks.
+	Proof *bloomtree.CompactMultiProof
+	// Attestation is the root the proof was generated against, with the parameters of its tree.
+	Attestation bloomtree.RootAttestation
+	// Signature is the ed25519 signature of the attestation by the publisher of the tree.
+	Signature []byte
+	// Receipt anchors the root of the attestation.
+	Receipt *Receipt
+	// Inclusion proves that the transaction of the receipt was included in its block.
+	Inclusion []byte
+}
+
+// NewBundle returns the bundle of the proof of the element, signing the attestation with the key.
+func NewBundle(element []byte, proof *bloomtree.CompactMultiProof, attestation bloomtree.RootAttestation,
+	key ed25519.PrivateKey, receipt *Receipt, inclusion []byte) (*Bundle, error) {
+	if receipt == nil {
+		return nil, errors.New("the bundle needs the receipt anchoring the root")
+	}
+	if receipt.Root != attestation.Root {
+		return nil, fmt.Errorf("the receipt anchors root %x, not %x", receipt.Root, attestation.Root)
+	}
+	signature, err := attestation.Sign(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Element:     append([]byte(nil), element...),
+		Proof:       proof,
+		Attestation: attestation,
+		Signature:   signature,
+		Receipt:     receipt,
+		Inclusion:   append([]byte(nil), inclusion...),
+	}, nil
+}
+
+// Verify checks the signature of the attestation with the public key of the publisher, the receipt and the
+// inclusion of its transaction, and the proof of the element against the root, and returns whether the
+// element is present. The seed is the seed of the bloom filter. An error is returned if any check fails,
+// including without an inclusion verifier, as the receipt alone does not show that the root was anchored.
+func (b *Bundle) Verify(seed []byte, key ed25519.PublicKey, inclusion InclusionVerifier) (bool, error) {
+	if b.Proof == nil || b.Receipt == nil {
+		return false, errors.New("the bundle is incomplete")
+	}
+	if inclusion == nil {
+		return false, errors.New("an inclusion verifier is needed to check the anchor of the root")
+	}
+	if !b.Attestation.VerifySignature(key, b.Signature) {
+		return false, errors.New("invalid signature of the root attestation")
+	}
+	if err := b.Receipt.Verify(b.Attestation.Root); err != nil {
+		return false, err
+	}
+	if err := inclusion.VerifyInclusion(b.Receipt.Tx, b.Receipt.Payload, b.Receipt.Block, b.Inclusion); err != nil {
+		return false, fmt.Errorf("verifying the inclusion of transaction %x: %w", b.Receipt.Tx, err)
+	}
+	return verifier.Verify(b.Element, seed, b.Proof, b.Attestation.Root, verifier.Params{
+		M:         b.Attestation.FilterBits,
+		K:         uint(b.Attestation.NumOfHashes),
+		ChunkSize: int(b.Attestation.ChunkSize),
+		Hash:      b.Attestation.Hash,
+	})
+}
+
+type bundleJSON struct {
+	Element     string                       `json:"element"`
+	Proof       *bloomtree.CompactMultiProof `json:"proof"`
+	Attestation attestationJSON              `json:"attestation"`
+	Signature   string                       `json:"signature"`
+	Receipt     *Receipt                     `json:"receipt"`
+	Inclusion   string                       `json:"inclusion"`
+}
+
+// attestationJSON is the JSON form of a root attestation, with the fields of its canonical JSON.
+type attestationJSON struct {
+	Root        string `json:"root"`
+	ChunkSize   uint64 `json:"chunkSize"`
+	Hash        string `json:"hash"`
+	NumOfHashes uint64 `json:"numOfHashes"`
+	FilterBits  uint64 `json:"filterBits"`
+}
+
+// MarshalJSON encodes the bundle with hex encoded bytes.
+func (b *Bundle) MarshalJSON() ([]byte, error) {
+	a := b.Attestation
+	return json.Marshal(bundleJSON{
+		Element: hex.EncodeToString(b.Element),
+		Proof:   b.Proof,
+		Attestation: attestationJSON{
+			Root:        hex.EncodeToString(a.Root[:]),
+			ChunkSize:   a.ChunkSize,
+			Hash:        a.Hash.String(),
+			NumOfHashes: a.NumOfHashes,
+			FilterBits:  a.FilterBits,
+		},
+		Signature: hex.EncodeToString(b.Signature),
+		Receipt:   b.Receipt,
+		Inclusion: hex.EncodeToString(b.Inclusion),
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a bundle.
+func (b *Bundle) UnmarshalJSON(data []byte) error {
+	var aux bundleJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	element, err := hex.DecodeString(aux.Element)
+	if err != nil {
+		return fmt.Errorf("decoding element: %w", err)
+	}
+	root, err := decodeHash(aux.Attestation.Root)
+	if err != nil {
+		return fmt.Errorf("decoding root: %w", err)
+	}
+	hash, err := bloomtree.ParseHash(aux.Attestation.Hash)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(aux.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	inclusion, err := hex.DecodeString(aux.Inclusion)
+	if err != nil {
+		return fmt.Errorf("decoding inclusion proof: %w", err)
+	}
+	*b = Bundle{
+		Element: element,
+		Proof:   aux.Proof,
+		Attestation: bloomtree.RootAttestation{
+			Root:        root,
+			ChunkSize:   aux.Attestation.ChunkSize,
+			Hash:        hash,
+			NumOfHashes: aux.Attestation.NumOfHashes,
+			FilterBits:  aux.Attestation.FilterBits,
+		},
+		Signature: signature,
+		Receipt:   aux.Receipt,
+		Inclusion: inclusion,
+	}
+	return nil
+}
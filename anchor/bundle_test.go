@@ -0,0 +1,138 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// testInclusion accepts the transactions of the test chain, given their payload as inclusion proof.
+type testInclusion struct {
+	chain *testChain
+}
+
+func (v testInclusion) VerifyInclusion(tx [32]byte, payload []byte, block uint64, proof []byte) error {
+	if v.chain.included[tx] != block || !bytes.Equal(v.chain.payloads[tx], payload) || !bytes.Equal(proof, payload) {
+		return errors.New("the transaction was not included")
+	}
+	return nil
+}
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	seed := []byte("secret seed")
+	dbf := DBF.NewDbf(200, 0.2, seed)
+	dbf.Add([]byte{1})
+	tree, err := bloomtree.NewBloomTree(dbf, bloomtree.WithChunkSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain()
+	a := New(chain, Blob, 1)
+	a.Add(tree.Root())
+	if _, err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	chain.block++
+	if _, err := a.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	receipt, ok := a.Receipt(tree.Root())
+	if !ok {
+		t.Fatal("missing receipt")
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inclusion := testInclusion{chain: chain}
+
+	for _, test := range []struct {
+		element []byte
+		present bool
+	}{
+		{element: []byte{1}, present: true},
+		{element: []byte{42}, present: false},
+	} {
+		proof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle, err := NewBundle(test.element, proof, tree.Attestation(), key, receipt, receipt.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Bundle
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		present, err := decoded.Verify(seed, pub, inclusion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present != test.present {
+			t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+		}
+	}
+
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name   string
+		key    ed25519.PublicKey
+		tamper func(b *Bundle)
+	}{
+		{name: "other key", key: otherPub, tamper: func(b *Bundle) {}},
+		{name: "other attestation", key: pub, tamper: func(b *Bundle) { b.Attestation.FilterBits++ }},
+		{name: "missing inclusion", key: pub, tamper: func(b *Bundle) { b.Inclusion = nil }},
+		{name: "other block", key: pub, tamper: func(b *Bundle) {
+			r := *b.Receipt
+			r.Block++
+			b.Receipt = &r
+		}},
+		{name: "other element", key: pub, tamper: func(b *Bundle) { b.Element = []byte{42} }},
+		{name: "missing receipt", key: pub, tamper: func(b *Bundle) { b.Receipt = nil }},
+	}
+	for _, test := range tests {
+		bundle, err := NewBundle([]byte{1}, proof, tree.Attestation(), key, receipt, receipt.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(bundle)
+		if _, err := bundle.Verify(seed, test.key, inclusion); err == nil {
+			t.Fatalf("expected error for %s", test.name)
+		}
+	}
+
+	other := *receipt
+	other.Root[0] ^= 1
+	if _, err := NewBundle([]byte{1}, proof, tree.Attestation(), key, &other, nil); err == nil {
+		t.Fatal("expected error for the receipt of another root")
+	}
+	if _, err := NewBundle([]byte{1}, proof, tree.Attestation(), key, nil, nil); err == nil {
+		t.Fatal("expected error without a receipt")
+	}
+	bundle, err := NewBundle([]byte{1}, proof, tree.Attestation(), key, receipt, receipt.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.Verify(seed, pub, nil); err == nil {
+		t.Fatal("expected error without an inclusion verifier")
+	}
+}
@@ -0,0 +1,175 @@
+package anchor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Format encodes a batch of roots into the payload of a transaction.
+type Format interface {
+	// Name identifies the format in receipts.
+	Name() string
+	// MaxRoots is the maximum number of roots of a payload.
+	MaxRoots() int
+	// Encode returns the payload anchoring the roots.
+	Encode(roots [][32]byte) ([]byte, error)
+	// Decode returns the roots anchored by the payload.
+	Decode(payload []byte) ([][32]byte, error)
+}
+
+var (
+	// Calldata formats roots as the calldata of a call to anchor(bytes32[]) of an Ethereum contract.
+	Calldata Format = calldata{}
+	// Blob formats roots as an EIP-4844 blob, as posted by OP-stack batchers. Every field element holds a zero
+	// byte and 31 bytes of the payload, which is the big-endian uint32 number of roots followed by the roots.
+	Blob Format = blob{}
+)
+
+var formats = map[string]Format{
+	Calldata.Name(): Calldata,
+	Blob.Name():     Blob,
+}
+
+// ParseFormat returns the format with the given name, as returned by Format.Name.
+func ParseFormat(name string) (Format, error) {
+	if f, ok := formats[name]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown anchor format %q", name)
+}
+
+// anchorSelector is the function selector of anchor(bytes32[]).
+var anchorSelector = selector("anchor(bytes32[])")
+
+func selector(signature string) [4]byte {
+	k := sha3.NewLegacyKeccak256()
+	k.Write([]byte(signature))
+	var ret [4]byte
+	copy(ret[:], k.Sum(nil))
+	return ret
+}
+
+type calldata struct{}
+
+func (calldata) Name() string {
+	return "calldata"
+}
+
+// MaxRoots keeps the calldata well below the 128 KiB transaction size limit of most clients.
+func (calldata) MaxRoots() int {
+	return 2048
+}
+
+func (calldata) Encode(roots [][32]byte) ([]byte, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no roots to anchor")
+	}
+	if len(roots) > Calldata.MaxRoots() {
+		return nil, fmt.Errorf("%d roots exceed the maximum of %d", len(roots), Calldata.MaxRoots())
+	}
+	payload := make([]byte, 4+64, 4+64+32*len(roots))
+	copy(payload, anchorSelector[:])
+	// the head holds the offset of the array, the tail its length and elements
+	payload[4+31] = 32
+	binary.BigEndian.PutUint64(payload[4+56:], uint64(len(roots)))
+	for _, root := range roots {
+		payload = append(payload, root[:]...)
+	}
+	return payload, nil
+}
+
+func (calldata) Decode(payload []byte) ([][32]byte, error) {
+	if len(payload) < 4+64 || !bytes.Equal(payload[:4], anchorSelector[:]) {
+		return nil, errors.New("the payload is no call of anchor(bytes32[])")
+	}
+	var offset [32]byte
+	offset[31] = 32
+	if !bytes.Equal(payload[4:36], offset[:]) {
+		return nil, errors.New("unexpected array offset")
+	}
+	if !isZero(payload[36:60]) {
+		return nil, errors.New("the number of roots is too large")
+	}
+	n := binary.BigEndian.Uint64(payload[60:68])
+	if n == 0 || uint64(len(payload)-68) != 32*n {
+		return nil, fmt.Errorf("the payload has %d bytes for %d roots", len(payload)-68, n)
+	}
+	return splitRoots(payload[68:]), nil
+}
+
+// blobSize is the number of bytes of a blob, 4096 field elements of 32 bytes.
+const blobSize = 4096 * 32
+
+type blob struct{}
+
+func (blob) Name() string {
+	return "blob"
+}
+
+// MaxRoots is the number of roots fitting into the 31 usable bytes of every field element.
+func (blob) MaxRoots() int {
+	return (4096*31 - 4) / 32
+}
+
+func (blob) Encode(roots [][32]byte) ([]byte, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no roots to anchor")
+	}
+	if len(roots) > Blob.MaxRoots() {
+		return nil, fmt.Errorf("%d roots exceed the maximum of %d", len(roots), Blob.MaxRoots())
+	}
+	data := make([]byte, 4, 4+32*len(roots))
+	binary.BigEndian.PutUint32(data, uint32(len(roots)))
+	for _, root := range roots {
+		data = append(data, root[:]...)
+	}
+	payload := make([]byte, blobSize)
+	// the high byte of every field element stays zero, so it is below the BLS12-381 modulus
+	for i := 0; len(data) > 0; i++ {
+		data = data[copy(payload[32*i+1:32*i+32], data):]
+	}
+	return payload, nil
+}
+
+func (blob) Decode(payload []byte) ([][32]byte, error) {
+	if len(payload) != blobSize {
+		return nil, fmt.Errorf("a blob has %d bytes, but the payload has %d", blobSize, len(payload))
+	}
+	data := make([]byte, 0, 4096*31)
+	for i := 0; i < 4096; i++ {
+		if payload[32*i] != 0 {
+			return nil, fmt.Errorf("field element %d has a non-zero high byte", i)
+		}
+		data = append(data, payload[32*i+1:32*i+32]...)
+	}
+	n := binary.BigEndian.Uint32(data)
+	if n == 0 || int(n) > Blob.MaxRoots() {
+		return nil, fmt.Errorf("invalid number of roots %d", n)
+	}
+	end := 4 + 32*int(n)
+	if !isZero(data[end:]) {
+		return nil, errors.New("trailing data after the roots")
+	}
+	return splitRoots(data[4:end]), nil
+}
+
+func splitRoots(data []byte) [][32]byte {
+	roots := make([][32]byte, len(data)/32)
+	for i := range roots {
+		copy(roots[i][:], data[32*i:])
+	}
+	return roots
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
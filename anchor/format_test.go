@@ -0,0 +1,108 @@
+package anchor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func generateRoots(n int) [][32]byte {
+	roots := make([][32]byte, n)
+	for i := range roots {
+		roots[i][0] = byte(i)
+		roots[i][31] = byte(i >> 8)
+	}
+	return roots
+}
+
+func TestFormats(t *testing.T) {
+	for _, format := range []Format{Calldata, Blob} {
+		for _, n := range []int{1, 3, format.MaxRoots()} {
+			roots := generateRoots(n)
+			payload, err := format.Encode(roots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := format.Decode(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded) != n {
+				t.Fatalf("%s: expected %d roots, but got %d", format.Name(), n, len(decoded))
+			}
+			for i := range roots {
+				if decoded[i] != roots[i] {
+					t.Fatalf("%s: root %d changed", format.Name(), i)
+				}
+			}
+		}
+		if _, err := format.Encode(nil); err == nil {
+			t.Fatalf("%s: expected error for no roots", format.Name())
+		}
+		if _, err := format.Encode(generateRoots(format.MaxRoots() + 1)); err == nil {
+			t.Fatalf("%s: expected error for too many roots", format.Name())
+		}
+		parsed, err := ParseFormat(format.Name())
+		if err != nil || parsed != format {
+			t.Fatalf("failed to parse format %s: %v", format.Name(), err)
+		}
+	}
+	if _, err := ParseFormat("unknown"); err == nil {
+		t.Fatal("expected error for an unknown format")
+	}
+}
+
+func TestCalldata(t *testing.T) {
+	payload, err := Calldata.Encode(generateRoots(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// selector of anchor(bytes32[]), offset 32, length 1, root
+	expected := "f8303b0c" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000000"
+	if got := hex.EncodeToString(payload); got != expected {
+		t.Fatalf("expected calldata %s, but got %s", expected, got)
+	}
+	for _, invalid := range [][]byte{
+		payload[:len(payload)-1],
+		append([]byte{0, 0, 0, 0}, payload[4:]...),
+		append(append([]byte(nil), payload...), make([]byte, 32)...),
+	} {
+		if _, err := Calldata.Decode(invalid); err == nil {
+			t.Fatalf("expected error for calldata %x", invalid)
+		}
+	}
+}
+
+func TestBlob(t *testing.T) {
+	payload, err := Blob.Encode(generateRoots(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != blobSize {
+		t.Fatalf("expected %d bytes, but got %d", blobSize, len(payload))
+	}
+	for i := 0; i < 4096; i++ {
+		if payload[32*i] != 0 {
+			t.Fatalf("field element %d has a non-zero high byte", i)
+		}
+	}
+	if !bytes.Equal(payload[1:5], []byte{0, 0, 0, 2}) {
+		t.Fatalf("unexpected root count %x", payload[1:5])
+	}
+	invalid := append([]byte(nil), payload...)
+	invalid[32] = 1
+	if _, err := Blob.Decode(invalid); err == nil {
+		t.Fatal("expected error for a non-zero high byte")
+	}
+	invalid = append([]byte(nil), payload...)
+	invalid[blobSize-1] = 1
+	if _, err := Blob.Decode(invalid); err == nil {
+		t.Fatal("expected error for trailing data")
+	}
+	if _, err := Blob.Decode(payload[:100]); err == nil {
+		t.Fatal("expected error for a short blob")
+	}
+}
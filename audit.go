@@ -0,0 +1,279 @@
+package bloomtree
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Sources of the nodes of an audit proof.
+const (
+	// AuditSourceChunk marks a leaf holding a proven bit, whose hash the proof carries in Chunks.
+	AuditSourceChunk = "chunk"
+	// AuditSourceProof marks a sibling hash the proof carries in Proof.
+	AuditSourceProof = "proof"
+	// AuditSourceComputed marks an internal node hashed from its two children in the layer below.
+	AuditSourceComputed = "computed"
+)
+
+// AuditProof is the verbose form of a compact multiproof, so auditors can follow its hash path by hand. It lists
+// the proven bits of the bloom filter and the chunks holding them, and every node of the path layer by layer,
+// from the leafs up to the root, with its position and where its hash comes from. NewAuditProof and Compact
+// convert between both forms without loss, so production systems keep exchanging compact proofs.
+//
+// The node at index i of layer l+1 is the hash of the nodes at index 2i and 2i+1 of layer l, see the core
+// package. The leaf of a chunk is the hash of its index and words, see Hash.SizedChunk, or of its word
+// commitments for blinded trees, see Hash.BlindedChunk.
+type AuditProof struct {
+	ProofType     ProofType `json:"proofType"`
+	AbsentIndices []int     `json:"absentIndices,omitempty"`
+	ChunkSize     int       `json:"chunkSize"`
+	// Hash is the name of the hash function of the tree.
+	Hash   string       `json:"hash"`
+	Bits   []AuditBit   `json:"bits"`
+	Layers []AuditLayer `json:"layers"`
+	// Root is the hex encoded root computed from the path, which the auditor compares with the published root.
+	Root string `json:"root"`
+}
+
+// AuditBit is a bit of the bloom filter proven by an audit proof, in the order of the chunks of the compact proof.
+type AuditBit struct {
+	// Index is the index of the bit in the bloom filter.
+	Index uint64 `json:"index"`
+	// Chunk is the index of the chunk holding the bit, i.e. of its leaf.
+	Chunk uint64 `json:"chunk"`
+	// Set tells whether the bit is set in the bloom filter the proof was converted with.
+	Set bool `json:"set"`
+}
+
+// AuditLayer holds the nodes of a layer of the path of an audit proof, ordered by their index.
+type AuditLayer struct {
+	// Layer is the number of the layer, the leafs are layer 0 and the root is the single node of the last layer.
+	Layer int         `json:"layer"`
+	Nodes []AuditNode `json:"nodes"`
+}
+
+// AuditNode is a node of the path of an audit proof.
+type AuditNode struct {
+	// Index is the index of the node within its layer.
+	Index uint64 `json:"index"`
+	// Node is the index of the node in the layout of the whole tree, where the leafs come first.
+	Node uint64 `json:"node"`
+	// Hash is the hex encoded hash of the node.
+	Hash string `json:"hash"`
+	// Source tells where the hash comes from, one of the AuditSource constants.
+	Source string `json:"source"`
+	// Words are the hex encoded bloom filter words of a chunk, if the proof carries them.
+	Words []string `json:"words,omitempty"`
+	// WordCommitments are the hex encoded word commitments of a chunk of a blinded tree.
+	WordCommitments []string `json:"wordCommitments,omitempty"`
+	// Provenance is the provenance of a chunk of a tree built with WithProvenance.
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// auditNode is a node of a layer of the path while an audit proof is built.
+type auditNode struct {
+	index uint64
+	hash  [32]byte
+}
+
+// NewAuditProof converts the compact proof of an element into its audit form, taking the proven bits from the
+// bloom filter like VerifyCompactMultiProof, with the same options. The root of the audit proof is computed
+// from the path, the conversion does not check it against any root. Proofs of adaptive trees, of empty
+// bloom filters and batch proofs have no audit form.
+func NewAuditProof(element, seedValue []byte, multiproof *CompactMultiProof, bf BloomFilter, opts ...Option) (*AuditProof, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if multiproof.ChunkSize != 0 && multiproof.ChunkSize != cfg.chunkSize {
+		return nil, chunkSizeMismatch(multiproof.ChunkSize, cfg.chunkSize)
+	}
+	if isEmptyFilter(bf) {
+		return nil, ErrEmptyFilter
+	}
+	treeLength, err := filterTreeLength(bf, cfg.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	indices, err := provenIndices(bf.MapElementToBF(element, seedValue), multiproof.ProofType, multiproof.AbsentIndices, bf, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	chunkIndices := cfg.chunkIndices(indices)
+	if len(chunkIndices) != len(multiproof.Chunks) {
+		return nil, invalidProof(ReasonChunkCount, "the proof has %d chunks, but %d bits are proven", len(multiproof.Chunks), len(chunkIndices))
+	}
+	leafNum := uint64(treeLength+1) / 2
+	if err := checkIndices(chunkIndices, leafNum); err != nil {
+		return nil, err
+	}
+
+	audit := &AuditProof{
+		ProofType: multiproof.ProofType,
+		ChunkSize: cfg.chunkSize,
+		Hash:      cfg.hash.String(),
+	}
+	for _, v := range multiproof.AbsentIndices {
+		audit.AbsentIndices = append(audit.AbsentIndices, int(v))
+	}
+	for i, v := range indices {
+		audit.Bits = append(audit.Bits, AuditBit{Index: uint64(v), Chunk: chunkIndices[i], Set: bf.BitArray().Test(v)})
+	}
+	var layer []auditNode
+	for i, index := range chunkIndices {
+		if i == 0 || index != chunkIndices[i-1] {
+			layer = append(layer, auditNode{index: index, hash: multiproof.Chunks[i]})
+		} else if multiproof.Chunks[i] != multiproof.Chunks[i-1] {
+			return nil, invalidProof(ReasonChunkMismatch, "the proof has different hashes of chunk %d", index)
+		}
+	}
+	hashes := multiproof.Proof
+	var offset uint64
+	for l, size := 0, leafNum; ; l, size = l+1, size/2 {
+		nodes := AuditLayer{Layer: l}
+		source := AuditSourceComputed
+		if l == 0 {
+			source = AuditSourceChunk
+		}
+		if size == 1 {
+			nodes.Nodes = append(nodes.Nodes, AuditNode{Index: 0, Node: offset, Hash: hex.EncodeToString(layer[0].hash[:]), Source: source})
+			audit.Layers = append(audit.Layers, nodes)
+			audit.Root = nodes.Nodes[0].Hash
+			break
+		}
+		var next []auditNode
+		for j := 0; j < len(layer); j++ {
+			known := layer[j]
+			left, right := known, auditNode{index: known.index ^ 1}
+			proven := false
+			if known.index&1 == 0 && j+1 < len(layer) && layer[j+1].index == known.index+1 {
+				right = layer[j+1]
+				j++
+			} else {
+				if len(hashes) == 0 {
+					return nil, invalidProof(ReasonHashCount, "the proof has too few hashes")
+				}
+				right.hash, hashes = hashes[0], hashes[1:]
+				proven = true
+				if known.index&1 == 1 {
+					left, right = right, left
+				}
+			}
+			for _, n := range []auditNode{left, right} {
+				s := source
+				if proven && n.index != known.index {
+					s = AuditSourceProof
+				}
+				nodes.Nodes = append(nodes.Nodes, AuditNode{Index: n.index, Node: offset + n.index, Hash: hex.EncodeToString(n.hash[:]), Source: s})
+			}
+			next = append(next, auditNode{index: left.index / 2, hash: cfg.node(l+1, left.index/2, left.hash, right.hash)})
+		}
+		audit.Layers = append(audit.Layers, nodes)
+		layer = next
+		offset += size
+	}
+	if len(hashes) != 0 {
+		return nil, invalidProof(ReasonHashCount, "the proof has %d hashes too many", len(hashes))
+	}
+	if err := audit.annotateChunks(multiproof); err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
+
+// annotateChunks adds the words, word commitments and provenance of the distinct chunks of the proof, which are
+// in increasing chunk order like the chunk leafs, to the leafs.
+func (a *AuditProof) annotateChunks(multiproof *CompactMultiProof) error {
+	var leafs []*AuditNode
+	for i := range a.Layers[0].Nodes {
+		if a.Layers[0].Nodes[i].Source == AuditSourceChunk {
+			leafs = append(leafs, &a.Layers[0].Nodes[i])
+		}
+	}
+	for _, n := range []int{len(multiproof.ChunkWords), len(multiproof.WordCommitments), len(multiproof.Provenance)} {
+		if n != 0 && n != len(leafs) {
+			return invalidProof(ReasonChunkCount, "the proof annotates %d chunks, but has %d distinct chunks", n, len(leafs))
+		}
+	}
+	for i, leaf := range leafs {
+		if len(multiproof.ChunkWords) != 0 {
+			leaf.Words = make([]string, len(multiproof.ChunkWords[i]))
+			for j, w := range multiproof.ChunkWords[i] {
+				leaf.Words[j] = fmt.Sprintf("%016x", w)
+			}
+		}
+		if len(multiproof.WordCommitments) != 0 {
+			leaf.WordCommitments = hexStrings(multiproof.WordCommitments[i])
+		}
+		if len(multiproof.Provenance) != 0 {
+			provenance := multiproof.Provenance[i]
+			leaf.Provenance = &provenance
+		}
+	}
+	return nil
+}
+
+// Compact converts the audit proof back into the compact proof it was created from.
+func (a *AuditProof) Compact() (*CompactMultiProof, error) {
+	if len(a.Layers) == 0 {
+		return nil, errors.New("the audit proof has no layers")
+	}
+	multiproof := &CompactMultiProof{ProofType: a.ProofType, ChunkSize: a.ChunkSize}
+	for _, v := range a.AbsentIndices {
+		if v < 0 || v > int(maxK) {
+			return nil, fmt.Errorf("invalid absent index %d", v)
+		}
+		multiproof.AbsentIndices = append(multiproof.AbsentIndices, uint8(v))
+	}
+	leafs := make(map[uint64][32]byte)
+	for i, layer := range a.Layers {
+		for _, n := range layer.Nodes {
+			h, err := decodeHexHashes([]string{n.Hash})
+			if err != nil {
+				return nil, fmt.Errorf("decoding node %d of layer %d: %w", n.Index, layer.Layer, err)
+			}
+			switch {
+			case n.Source == AuditSourceProof:
+				multiproof.Proof = append(multiproof.Proof, h[0])
+			case i == 0 && n.Source == AuditSourceChunk:
+				leafs[n.Index] = h[0]
+				if err := multiproof.appendChunk(n); err != nil {
+					return nil, fmt.Errorf("chunk %d: %w", n.Index, err)
+				}
+			}
+		}
+	}
+	for _, bit := range a.Bits {
+		h, ok := leafs[bit.Chunk]
+		if !ok {
+			return nil, fmt.Errorf("the audit proof has no leaf of chunk %d", bit.Chunk)
+		}
+		multiproof.Chunks = append(multiproof.Chunks, h)
+	}
+	return multiproof, nil
+}
+
+// appendChunk appends the words, word commitments and provenance of the leaf of a chunk to the proof.
+func (p *CompactMultiProof) appendChunk(n AuditNode) error {
+	if n.Words != nil {
+		words, err := decodeHexWords(n.Words)
+		if err != nil {
+			return err
+		}
+		p.ChunkWords = append(p.ChunkWords, words)
+	}
+	if n.WordCommitments != nil {
+		commitments, err := decodeHexHashes(n.WordCommitments)
+		if err != nil {
+			return err
+		}
+		p.WordCommitments = append(p.WordCommitments, commitments)
+	}
+	if n.Provenance != nil {
+		p.Provenance = append(p.Provenance, *n.Provenance)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package bloomtree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestAuditProof(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2}, []byte{3})
+	key := bytes.Repeat([]byte{7}, 32)
+	var tests = []struct {
+		name string
+		opts []Option
+	}{
+		{name: "plain"},
+		{name: "chunk size", opts: []Option{WithChunkSize(256), WithAbsentIndices(3)}},
+		{name: "blinded", opts: []Option{WithChunkSize(256), WithBlinding(key)}},
+		{name: "provenance", opts: []Option{WithProvenance(4), WithHash(BLAKE3)}},
+		{name: "sparse", opts: []Option{WithSparse()}},
+	}
+	for _, test := range tests {
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tree.Root()
+		for _, elem := range [][]byte{{1}, {3}, {42}, {43}} {
+			proof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			audit, err := NewAuditProof(elem, []byte(seed), proof, dbf, test.opts...)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if audit.Root != hex.EncodeToString(root[:]) {
+				t.Fatalf("%s: expected the audit proof of %v to reach the root", test.name, elem)
+			}
+			last := audit.Layers[len(audit.Layers)-1]
+			if len(last.Nodes) != 1 || last.Nodes[0].Hash != audit.Root || last.Nodes[0].Node != uint64(tree.nodeCount()-1) {
+				t.Fatalf("%s: expected the last layer to hold only the root", test.name)
+			}
+			var hashes int
+			for _, layer := range audit.Layers {
+				for _, n := range layer.Nodes {
+					if n.Source == AuditSourceProof {
+						hashes++
+					}
+				}
+			}
+			if hashes != len(proof.Proof) || len(audit.Bits) != len(proof.Chunks) {
+				t.Fatalf("%s: expected %d proof hashes and %d bits, got %d and %d", test.name, len(proof.Proof), len(proof.Chunks), hashes, len(audit.Bits))
+			}
+
+			// the audit form survives JSON and converts back into the same compact proof
+			data, err := json.Marshal(audit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded AuditProof
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			compact, err := decoded.Compact()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := proof.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := compact.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, expected) {
+				t.Fatalf("%s: expected the compact proof\n%s\nafter the audit form, got\n%s", test.name, expected, got)
+			}
+			if ok, err := VerifyCompactMultiProof(elem, []byte(seed), compact, root, dbf, test.opts...); err != nil || !ok {
+				t.Fatalf("%s: failed to verify the converted proof of %v: %v", test.name, elem, err)
+			}
+		}
+	}
+}
+
+func TestAuditProofTampered(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.Proof[0][0] ^= 1
+	audit, err := NewAuditProof([]byte{1}, []byte(seed), proof, dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	if audit.Root == hex.EncodeToString(root[:]) {
+		t.Fatal("expected a tampered proof to reach another root")
+	}
+
+	proof.Proof = proof.Proof[1:]
+	if _, err := NewAuditProof([]byte{1}, []byte(seed), proof, dbf); err == nil {
+		t.Fatal("expected an error for a proof with too few hashes")
+	}
+	audit.Layers[0].Nodes[0].Hash = "zz"
+	if _, err := audit.Compact(); err == nil {
+		t.Fatal("expected an error for an invalid node hash")
+	}
+}
@@ -0,0 +1,256 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// BatchMultiProof proves the presence or absence of several elements in a bloom tree with a single
+// multiproof. Chunks and hashes shared between the elements are included only once.
+type BatchMultiProof struct {
+	// Chunks are the leaf hashes of the distinct chunks covering the elements, in increasing order.
+	Chunks [][32]byte
+	// Proof are the hashes needed to reconstruct the root from the chunks.
+	Proof [][32]byte
+	// ProofTypes are the proof types of the elements, in the order of the elements.
+	ProofTypes []ProofType
+	// AbsentIndices are the positions of the zero indices of every element, see CompactMultiProof.AbsentIndices.
+	// It is nil if no element has more than one zero index in the proof.
+	AbsentIndices [][]uint8
+	// ChunkWords are the bloom filter words of the chunks, in the order of Chunks.
+	ChunkWords [][]uint64
+	// WordCommitments are set for trees built with WithBlinding, see CompactMultiProof.WordCommitments.
+	WordCommitments [][][32]byte
+	// Provenance is set for trees built with WithProvenance, see CompactMultiProof.Provenance.
+	Provenance []Provenance
+	// Costs are the parts of the proof contributed by every element, in the order of the elements.
+	// They are reported by the prover for accounting, and are not needed for verification.
+	Costs []ElementCost
+}
+
+// ElementCost is the part of a batch proof contributed by an element. Chunks and hashes shared by several
+// elements are attributed to the first element needing them, so the costs of all elements add up to the
+// size of the batch proof.
+type ElementCost struct {
+	// Chunks is the number of chunks first opened for the element.
+	Chunks int
+	// Hashes is the number of proof hashes first needed for the element.
+	Hashes int
+	// Bytes is the number of encoded bytes of the chunks, their words, the hashes, the proof type and
+	// the absent indices of the element.
+	Bytes int
+}
+
+// GenerateCompactMultiProofBatch returns a single proof of the presence or absence of every element.
+// If the proof cannot be generated for one of the elements, a nil proof is returned together with the error.
+func (bt *BloomTree) GenerateCompactMultiProofBatch(elems [][]byte) (*BatchMultiProof, error) {
+	return bt.GenerateCompactMultiProofBatchCtx(context.Background(), elems)
+}
+
+// GenerateCompactMultiProofBatchCtx returns the proof of GenerateCompactMultiProofBatch, or the error of the
+// context once it is canceled or its deadline passes. The context is checked before every element, and huge
+// batches yield to other goroutines in between.
+func (bt *BloomTree) GenerateCompactMultiProofBatchCtx(ctx context.Context, elems [][]byte) (*BatchMultiProof, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if len(elems) == 0 {
+		return nil, errors.New("the batch has no elements")
+	}
+	if isEmptyFilter(bt.bf) {
+		return emptyBatchProof(len(elems)), nil
+	}
+	indices, elemIndices, proofTypes, absentIndices, err := bt.batchIndices(ctx, elems)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	chunks, chunkIndices := bt.getChunksAndIndices(indices)
+	chunks, chunkIndices = uniqueChunks(chunks, chunkIndices)
+	hashIndices, err := bt.generateProofIndices(chunkIndices)
+	if err != nil {
+		return nil, err
+	}
+	bt.recordAccess(chunkIndices)
+	proof, err := bt.proofHashes(ctx, hashIndices)
+	if err != nil {
+		return nil, err
+	}
+	batch := &BatchMultiProof{
+		Chunks:        chunks,
+		Proof:         proof,
+		ProofTypes:    proofTypes,
+		AbsentIndices: absentIndices,
+	}
+	batch.ChunkWords, batch.WordCommitments = bt.proofWords(chunkIndices, indices)
+	batch.Provenance = bt.proofProvenance(chunkIndices)
+	batch.Costs = bt.elementCosts(elemIndices, hashIndices, batch)
+	return batch, nil
+}
+
+// batchIndices returns the proven indices of all elements, and the proven indices, proof types and absent
+// indices of every element. The absent indices are nil if no element has more than one zero index.
+func (bt *BloomTree) batchIndices(ctx context.Context, elems [][]byte) ([]uint64, [][]uint64, []ProofType, [][]uint8, error) {
+	var (
+		indices       []uint64
+		elemIndices   = make([][]uint64, len(elems))
+		proofTypes    = make([]ProofType, len(elems))
+		absentIndices = make([][]uint8, len(elems))
+		multiple      bool
+	)
+	for i, elem := range elems {
+		if err := yieldPoint(ctx, i); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		proven, proofType, positions, err := bt.proofIndices(elem)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		indices = append(indices, proven...)
+		elemIndices[i] = proven
+		proofTypes[i] = proofType
+		absentIndices[i] = positions
+		multiple = multiple || positions != nil
+	}
+	if !multiple {
+		absentIndices = nil
+	}
+	if bt.cfg.smallestAbsence && !multiple {
+		indices = bt.smallestBatchAbsences(elems, elemIndices, proofTypes)
+	}
+	return indices, elemIndices, proofTypes, absentIndices, nil
+}
+
+// smallestBatchAbsences picks the zero index of every absent element that adds the fewest bytes to the chunks
+// opened for the present elements and the absent elements before it. It updates the indices and proof types of
+// the absent elements, and returns the proven indices of all elements.
+func (bt *BloomTree) smallestBatchAbsences(elems [][]byte, elemIndices [][]uint64, proofTypes []ProofType) []uint64 {
+	cover := newProofCover(bt)
+	for i, proven := range elemIndices {
+		if proofTypes[i].IsPresence() {
+			for _, v := range proven {
+				cover.open(bt.chunkIndex(v))
+			}
+		}
+	}
+	var indices []uint64
+	for i, proven := range elemIndices {
+		if proofTypes[i].IsAbsence() {
+			// proofIndices already rejected or counted indices past the bloom filter
+			fitted, _, _ := bt.cfg.fitIndices(bt.bf.GetElementIndices(elems[i]), uint64(bt.bf.BitArray().Len()))
+			index, proofType := bt.smallestAbsence(fitted, cover)
+			cover.open(bt.chunkIndex(index))
+			proven = []uint64{index}
+			elemIndices[i], proofTypes[i] = proven, proofType
+		}
+		indices = append(indices, proven...)
+	}
+	return indices
+}
+
+// elementCosts attributes every chunk and proof hash of the batch to the first element needing it.
+func (bt *BloomTree) elementCosts(elemIndices [][]uint64, hashIndices []uint64, batch *BatchMultiProof) []ElementCost {
+	leafNum := uint64(bt.nodeCount()+1) / 2
+	root := uint64(bt.nodeCount() - 1)
+	hashes := make(map[uint64]bool)
+	for _, index := range hashIndices {
+		hashes[index] = true
+	}
+	words := bt.bf.BitArray().Bytes()
+	opened := make(map[uint64]bool)
+	costs := make([]ElementCost, len(elemIndices))
+	for i, indices := range elemIndices {
+		cost := &costs[i]
+		cost.Bytes = 1
+		if batch.AbsentIndices != nil {
+			cost.Bytes += len(batch.AbsentIndices[i])
+		}
+		for _, v := range indices {
+			chunk := bt.chunkIndex(v)
+			if opened[chunk] {
+				continue
+			}
+			opened[chunk] = true
+			cost.Chunks++
+			cost.Bytes += 32 + 8*len(bt.leafWords(words, int(chunk)))
+			if batch.WordCommitments != nil {
+				cost.Bytes += 32 * len(bt.leafWords(words, int(chunk)))
+			}
+			for node := chunk; node != root; node = leafNum + node/2 {
+				if sibling := node ^ 1; hashes[sibling] {
+					delete(hashes, sibling)
+					cost.Hashes++
+					cost.Bytes += 32
+				}
+			}
+		}
+	}
+	return costs
+}
+
+// VerifyCompactMultiProofBatch returns whether the batch proof shows the presence or absence of every element,
+// as given by its proof type. The elements must be in the order they were proven in. Batch proofs of adaptive
+// trees cannot be verified.
+func VerifyCompactMultiProofBatch(elems [][]byte, seedValue []byte, proof *BatchMultiProof, root [32]byte, bf BloomFilter,
+	opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if len(elems) == 0 {
+		return false, errors.New("the batch has no elements")
+	}
+	if len(proof.ProofTypes) != len(elems) {
+		return false, invalidProof(ReasonProofType, "the proof covers %d elements, but %d were given", len(proof.ProofTypes), len(elems))
+	}
+	if proof.AbsentIndices != nil && len(proof.AbsentIndices) != len(elems) {
+		return false, invalidProof(ReasonProofType, "the proof has absent indices for %d elements, but %d were given", len(proof.AbsentIndices), len(elems))
+	}
+	if isEmptyFilter(bf) {
+		for i, proofType := range proof.ProofTypes {
+			if proofType.IsPresence() {
+				return false, invalidProof(ReasonProofType, "element %d: the bloom filter has no bits, so no element is present", i)
+			}
+		}
+		return verifyEmptyProof(&CompactMultiProof{Chunks: proof.Chunks, Proof: proof.Proof, ChunkWords: proof.ChunkWords}, root, cfg)
+	}
+	treeLength, err := filterTreeLength(bf, cfg.chunkSize)
+	if err != nil {
+		return false, err
+	}
+	var indices []uint
+	for i, elem := range elems {
+		var absentIndices []uint8
+		if proof.AbsentIndices != nil {
+			absentIndices = proof.AbsentIndices[i]
+		}
+		index, err := provenIndices(bf.MapElementToBF(elem, seedValue), proof.ProofTypes[i], absentIndices, bf, cfg)
+		if err != nil {
+			return false, fmt.Errorf("element %d: %w", i, err)
+		}
+		indices = append(indices, index...)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	_, chunkIndices := uniqueChunks(nil, cfg.chunkIndices(indices))
+	return verifyProof(cfg, chunkIndices, newCompactMultiProof(proof.Chunks, proof.Proof, Presence), root, treeLength)
+}
+
+// uniqueChunks removes consecutive duplicates from the sorted chunk indices and the chunk hashes, if given.
+func uniqueChunks(chunks [][32]byte, chunkIndices []uint64) ([][32]byte, []uint64) {
+	var (
+		uniqueChunks  [][32]byte
+		uniqueIndices []uint64
+	)
+	for i, index := range chunkIndices {
+		if i > 0 && index == chunkIndices[i-1] {
+			continue
+		}
+		uniqueIndices = append(uniqueIndices, index)
+		if chunks != nil {
+			uniqueChunks = append(uniqueChunks, chunks[i])
+		}
+	}
+	return uniqueChunks, uniqueIndices
+}
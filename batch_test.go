@@ -0,0 +1,131 @@
+package bloomtree
+
+import (
+	"testing"
+)
+
+func TestCompactMultiProofBatch(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	var tests = []struct {
+		numElem uint
+		opts    []Option
+		elems   [][]byte
+	}{
+		{numElem: 20, elems: [][]byte{{1}, {2}, {3}}},
+		{numElem: 200, elems: [][]byte{{1}, {9}, {2}, {42}}},
+		{numElem: 200, opts: []Option{WithAbsentIndices(3)}, elems: [][]byte{{9}, {1}, {42}}},
+		{numElem: 1000, opts: []Option{WithHash(BLAKE3)}, elems: [][]byte{{3}, {77}, {1}, {1}}},
+	}
+
+	for _, test := range tests {
+		dbf := generateDBF(test.numElem, seed, []byte{1}, []byte{2}, []byte{3})
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, err := tree.GenerateCompactMultiProofBatch(test.elems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var chunks int
+		for i, elem := range test.elems {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if batch.ProofTypes[i] != multiproof.ProofType {
+				t.Fatalf("expected proof type %v of element %v, but got %v", multiproof.ProofType, elem, batch.ProofTypes[i])
+			}
+			chunks += len(multiproof.ChunkWords)
+		}
+		if len(batch.Chunks) > chunks || len(batch.ChunkWords) != len(batch.Chunks) {
+			t.Fatalf("expected at most %d distinct chunks, but got %d", chunks, len(batch.Chunks))
+		}
+
+		verified, err := VerifyCompactMultiProofBatch(test.elems, []byte(seed), batch, tree.Root(), dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify batch proof of %v", test.elems)
+		}
+	}
+}
+
+func TestCompactMultiProofBatchErrors(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems := [][]byte{{1}, {9}, {2}}
+	batch, err := tree.GenerateCompactMultiProofBatch(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GenerateCompactMultiProofBatch(nil); err == nil {
+		t.Fatal("expected error for empty batch")
+	}
+	if _, err := VerifyCompactMultiProofBatch(elems[:2], []byte(seed), batch, tree.Root(), dbf); err == nil {
+		t.Fatal("expected error for missing element")
+	}
+	if _, err := VerifyCompactMultiProofBatch([][]byte{{9}, {1}, {2}}, []byte(seed), batch, tree.Root(), dbf); err == nil {
+		t.Fatal("expected error for reordered elements")
+	}
+
+	tampered := *batch
+	tampered.Chunks = tampered.Chunks[1:]
+	if verified, _ := VerifyCompactMultiProofBatch(elems, []byte(seed), &tampered, tree.Root(), dbf); verified {
+		t.Fatal("verified batch proof with a missing chunk")
+	}
+	tampered = *batch
+	tampered.Proof = append([][32]byte{{1}}, tampered.Proof[1:]...)
+	if verified, _ := VerifyCompactMultiProofBatch(elems, []byte(seed), &tampered, tree.Root(), dbf); verified {
+		t.Fatal("verified batch proof with a modified hash")
+	}
+}
+
+func TestBatchCosts(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1}, []byte{2}, []byte{3})
+	tree, err := NewBloomTree(dbf, WithAbsentIndices(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems := [][]byte{{1}, {2}, {1}, {42}, {3}}
+	batch, err := tree.GenerateCompactMultiProofBatch(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Costs) != len(elems) {
+		t.Fatalf("expected %d costs, but got %d", len(elems), len(batch.Costs))
+	}
+	var chunks, hashes, size int
+	for _, cost := range batch.Costs {
+		chunks += cost.Chunks
+		hashes += cost.Hashes
+		size += cost.Bytes
+	}
+	if chunks != len(batch.Chunks) || hashes != len(batch.Proof) {
+		t.Fatalf("expected costs of %d chunks and %d hashes, but got %d and %d", len(batch.Chunks), len(batch.Proof), chunks, hashes)
+	}
+	expected := 32 * (len(batch.Chunks) + len(batch.Proof))
+	for _, words := range batch.ChunkWords {
+		expected += 8 * len(words)
+	}
+	for i := range elems {
+		expected++
+		if batch.AbsentIndices != nil {
+			expected += len(batch.AbsentIndices[i])
+		}
+	}
+	if size != expected {
+		t.Fatalf("expected costs of %d bytes, but got %d", expected, size)
+	}
+	// the repeated element only needs chunks and hashes of the first one
+	if batch.Costs[2].Chunks != 0 || batch.Costs[2].Hashes != 0 || batch.Costs[0].Chunks == 0 {
+		t.Fatalf("unexpected costs %+v of the repeated element", batch.Costs[2])
+	}
+}
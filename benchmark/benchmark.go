@@ -0,0 +1,341 @@
+// Package benchmark runs a fixed corpus of synthetic workloads against bloomtree and reports machine-readable
+// results, so users of the module can track its performance across versions, e.g. in their CI. The workloads
+// are deterministic: the same workload builds the same bloom filter and asks the same queries with every
+// version of the module, so the results of two versions can be compared with Compare.
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// modulePath is the path of the module whose version is reported.
+const modulePath = "github.com/labbloom/bloom-tree"
+
+// batchSize is the number of elements of a batch proof of OpBatch.
+const batchSize = 16
+
+// Operation is the part of the API measured by a result.
+type Operation string
+
+const (
+	// OpBuild builds the tree of the bloom filter of the workload.
+	OpBuild Operation = "build"
+	// OpProve generates the proof of a query.
+	OpProve Operation = "prove"
+	// OpEncode writes the wire format of the proof of a query.
+	OpEncode Operation = "encode"
+	// OpVerify verifies the proof of a query.
+	OpVerify Operation = "verify"
+	// OpBatch generates the batch proof of 16 queries.
+	OpBatch Operation = "batch"
+)
+
+// Operations are the operations measured for every workload, in the order of the results.
+var Operations = []Operation{OpBuild, OpProve, OpEncode, OpVerify, OpBatch}
+
+// Workload describes a bloom filter and the queries asked about it.
+type Workload struct {
+	Name string `json:"name"`
+	// Bits is the approximate number of bits of the bloom filter.
+	Bits uint `json:"bits"`
+	// Density is the fraction of bits set before the elements of the present queries are added.
+	Density float64 `json:"density"`
+	// Present is the fraction of queries about elements of the bloom filter. The other queries are about
+	// elements that were not added, which are absent unless they are false positives.
+	Present float64 `json:"present"`
+	// Queries is the number of distinct queries, which the operations cycle through.
+	Queries int `json:"queries"`
+	// ChunkSize is the chunk size of the tree in bits.
+	ChunkSize int `json:"chunkSize"`
+}
+
+// Corpus returns the fixed workloads of the benchmark, from small and sparse filters to large and dense ones,
+// with query mixes of mostly present, mostly absent and balanced queries. The workloads of a name never
+// change, new workloads get new names.
+func Corpus() []Workload {
+	return []Workload{
+		{Name: "small-sparse", Bits: 1 << 16, Density: 0.1, Present: 0.5, Queries: 1000, ChunkSize: 64},
+		{Name: "small-dense", Bits: 1 << 16, Density: 0.5, Present: 0.5, Queries: 1000, ChunkSize: 64},
+		{Name: "medium-present", Bits: 1 << 20, Density: 0.1, Present: 0.9, Queries: 1000, ChunkSize: 64},
+		{Name: "medium-absent", Bits: 1 << 20, Density: 0.5, Present: 0.1, Queries: 1000, ChunkSize: 64},
+		{Name: "medium-wide-chunks", Bits: 1 << 20, Density: 0.5, Present: 0.5, Queries: 1000, ChunkSize: 512},
+		{Name: "large-dense", Bits: 1 << 22, Density: 0.5, Present: 0.5, Queries: 1000, ChunkSize: 64},
+	}
+}
+
+func (w Workload) check() error {
+	switch {
+	case w.Name == "":
+		return errors.New("the workload needs a name")
+	case w.Bits < 64:
+		return fmt.Errorf("workload %s: the bloom filter needs at least 64 bits", w.Name)
+	case w.Density < 0 || w.Density >= 1:
+		return fmt.Errorf("workload %s: the density must be in [0, 1)", w.Name)
+	case w.Present < 0 || w.Present > 1:
+		return fmt.Errorf("workload %s: the fraction of present queries must be in [0, 1]", w.Name)
+	case w.Queries < 1:
+		return fmt.Errorf("workload %s: the workload needs queries", w.Name)
+	}
+	return nil
+}
+
+// seed is the seed of the bloom filter and the random bits of the workload.
+func (w Workload) seed() []byte {
+	return []byte("benchmark " + w.Name)
+}
+
+// generate returns the bloom filter of the workload and its queries, in the order they are asked.
+func (w Workload) generate() (*DBF.DistBF, [][]byte) {
+	h := fnv.New64a()
+	h.Write(w.seed())
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+	// the number of elements of Bits bits at a false positive rate of 1%
+	dbf := DBF.NewDbf(uint(float64(w.Bits)/9.585)+1, 0.01, w.seed())
+	words := dbf.BitArray().Bytes()
+	for i := range words {
+		for bit := uint(0); bit < 64; bit++ {
+			if rng.Float64() < w.Density {
+				words[i] |= 1 << bit
+			}
+		}
+	}
+	if m := dbf.BitArray().Len(); m%64 != 0 {
+		words[len(words)-1] &= 1<<(m%64) - 1
+	}
+	present := int(w.Present * float64(w.Queries))
+	queries := make([][]byte, w.Queries)
+	for i := range queries {
+		if i < present {
+			queries[i] = []byte(fmt.Sprintf("element %d", i))
+			dbf.Add(queries[i])
+		} else {
+			queries[i] = []byte(fmt.Sprintf("absent element %d", i))
+		}
+	}
+	rng.Shuffle(len(queries), func(i, j int) { queries[i], queries[j] = queries[j], queries[i] })
+	return dbf, queries
+}
+
+// Result is the measurement of an operation on a workload.
+type Result struct {
+	Workload    string    `json:"workload"`
+	Operation   Operation `json:"operation"`
+	Iterations  int       `json:"iterations"`
+	NsPerOp     float64   `json:"nsPerOp"`
+	AllocsPerOp float64   `json:"allocsPerOp"`
+	BytesPerOp  float64   `json:"bytesPerOp"`
+}
+
+// Report holds the results of a run, and the environment they were measured in.
+type Report struct {
+	// Version is the version of the module in the build info of the binary, or "(devel)" if it is unknown.
+	Version   string   `json:"version"`
+	GoVersion string   `json:"goVersion"`
+	GOOS      string   `json:"goos"`
+	GOARCH    string   `json:"goarch"`
+	CPUs      int      `json:"cpus"`
+	Results   []Result `json:"results"`
+}
+
+// Run measures every operation on the workloads. Every operation is repeated until it took at least the given
+// duration, like a Go benchmark run with -benchtime. The results are only comparable between runs on the same
+// machine with the same duration.
+func Run(workloads []Workload, d time.Duration) (*Report, error) {
+	report := &Report{
+		Version:   moduleVersion(),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+	for _, w := range workloads {
+		results, err := runWorkload(w, d)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, results...)
+	}
+	return report, nil
+}
+
+func runWorkload(w Workload, d time.Duration) ([]Result, error) {
+	if err := w.check(); err != nil {
+		return nil, err
+	}
+	dbf, queries := w.generate()
+	opts := []bloomtree.Option{bloomtree.WithChunkSize(w.ChunkSize)}
+	tree, err := bloomtree.NewBloomTree(dbf, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("workload %s: %w", w.Name, err)
+	}
+	root := tree.Root()
+	proofs := make([]*bloomtree.CompactMultiProof, len(queries))
+	for i, q := range queries {
+		if proofs[i], err = tree.GenerateCompactMultiProof(q); err != nil {
+			return nil, fmt.Errorf("workload %s: %w", w.Name, err)
+		}
+	}
+	ops := map[Operation]func(i int) error{
+		OpBuild: func(i int) error {
+			_, err := bloomtree.NewBloomTree(dbf, opts...)
+			return err
+		},
+		OpProve: func(i int) error {
+			_, err := tree.GenerateCompactMultiProof(queries[i%len(queries)])
+			return err
+		},
+		OpEncode: func(i int) error {
+			proofs[i%len(proofs)].Encode()
+			return nil
+		},
+		OpVerify: func(i int) error {
+			i %= len(queries)
+			verified, err := bloomtree.VerifyCompactMultiProof(queries[i], w.seed(), proofs[i], root, dbf, opts...)
+			if err == nil && !verified {
+				err = errors.New("the proof failed verification")
+			}
+			return err
+		},
+		OpBatch: func(i int) error {
+			batch := make([][]byte, batchSize)
+			for j := range batch {
+				batch[j] = queries[(i*batchSize+j)%len(queries)]
+			}
+			_, err := tree.GenerateCompactMultiProofBatch(batch)
+			return err
+		},
+	}
+	var results []Result
+	for _, op := range Operations {
+		result, err := measure(d, ops[op])
+		if err != nil {
+			return nil, fmt.Errorf("workload %s, operation %s: %w", w.Name, op, err)
+		}
+		result.Workload, result.Operation = w.Name, op
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// measure runs the operation with a growing number of iterations until they took at least d.
+func measure(d time.Duration, op func(i int) error) (Result, error) {
+	for n := 1; ; {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if err := op(i); err != nil {
+				return Result{}, err
+			}
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if elapsed >= d || n >= 1e9 {
+			return Result{
+				Iterations:  n,
+				NsPerOp:     float64(elapsed.Nanoseconds()) / float64(n),
+				AllocsPerOp: float64(after.Mallocs-before.Mallocs) / float64(n),
+				BytesPerOp:  float64(after.TotalAlloc-before.TotalAlloc) / float64(n),
+			}, nil
+		}
+		// predict the iterations taking d with some headroom, growing at least by one and at most 100 times
+		next := 100 * n
+		if elapsed > 0 {
+			if predicted := int(1.2 * float64(n) * float64(d) / float64(elapsed)); predicted < next {
+				next = predicted
+			}
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+}
+
+// moduleVersion returns the version of the module in the build info of the binary, or "(devel)" if it is
+// unknown.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ReadReport reads a report written by WriteJSON.
+func ReadReport(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Regression is a metric of an operation on a workload that got worse between two reports.
+type Regression struct {
+	Workload  string
+	Operation Operation
+	// Metric is the JSON name of the metric, nsPerOp or allocsPerOp.
+	Metric string
+	Base   float64
+	Head   float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s/%s: %s %.1f -> %.1f (%+.1f%%)", r.Workload, r.Operation, r.Metric, r.Base, r.Head, 100*(r.Head/r.Base-1))
+}
+
+// Compare returns the regressions of head from base, i.e. the time and allocations per operation of head that
+// exceed those of base by more than the tolerance, e.g. 0.1 for 10%. Results in only one of the reports are
+// ignored. Time is only comparable between reports measured on the same machine.
+func Compare(base, head *Report, tolerance float64) []Regression {
+	type key struct {
+		workload  string
+		operation Operation
+	}
+	baseResults := make(map[key]Result)
+	for _, r := range base.Results {
+		baseResults[key{r.Workload, r.Operation}] = r
+	}
+	var regressions []Regression
+	for _, r := range head.Results {
+		b, ok := baseResults[key{r.Workload, r.Operation}]
+		if !ok {
+			continue
+		}
+		if r.NsPerOp > b.NsPerOp*(1+tolerance) {
+			regressions = append(regressions, Regression{r.Workload, r.Operation, "nsPerOp", b.NsPerOp, r.NsPerOp})
+		}
+		if r.AllocsPerOp > b.AllocsPerOp*(1+tolerance) && r.AllocsPerOp-b.AllocsPerOp >= 1 {
+			regressions = append(regressions, Regression{r.Workload, r.Operation, "allocsPerOp", b.AllocsPerOp, r.AllocsPerOp})
+		}
+	}
+	return regressions
+}
@@ -0,0 +1,79 @@
+package benchmark
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCorpus(t *testing.T) {
+	names := make(map[string]bool)
+	for _, w := range Corpus() {
+		if err := w.check(); err != nil {
+			t.Fatal(err)
+		}
+		if names[w.Name] {
+			t.Fatalf("duplicate workload %s", w.Name)
+		}
+		names[w.Name] = true
+	}
+
+	// the workloads are deterministic
+	w := Corpus()[0]
+	dbf, queries := w.generate()
+	again, againQueries := w.generate()
+	if !reflect.DeepEqual(dbf.BitArray().Bytes(), again.BitArray().Bytes()) || !reflect.DeepEqual(queries, againQueries) {
+		t.Fatal("expected the same bloom filter and queries for the same workload")
+	}
+	var present int
+	for _, q := range queries {
+		if bytes.HasPrefix(q, []byte("element")) {
+			present++
+		}
+	}
+	if present != int(w.Present*float64(w.Queries)) {
+		t.Fatalf("expected %d present queries, got %d", int(w.Present*float64(w.Queries)), present)
+	}
+}
+
+func TestRun(t *testing.T) {
+	workloads := []Workload{{Name: "tiny", Bits: 4096, Density: 0.3, Present: 0.5, Queries: 20, ChunkSize: 128}}
+	report, err := Run(workloads, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != len(Operations) {
+		t.Fatalf("expected %d results, got %d", len(Operations), len(report.Results))
+	}
+	for i, r := range report.Results {
+		if r.Workload != "tiny" || r.Operation != Operations[i] || r.Iterations < 1 || r.NsPerOp <= 0 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadReport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Fatalf("expected the report %+v after decoding, got %+v", report, decoded)
+	}
+	if regressions := Compare(report, decoded, 0); len(regressions) != 0 {
+		t.Fatalf("expected no regressions of the same report, got %v", regressions)
+	}
+	decoded.Results[1].NsPerOp *= 2
+	decoded.Results[1].AllocsPerOp += 10
+	regressions := Compare(report, decoded, 0.5)
+	if len(regressions) != 2 || regressions[0].Operation != Operations[1] || regressions[0].Metric != "nsPerOp" || regressions[1].Metric != "allocsPerOp" {
+		t.Fatalf("expected regressions of the time and allocations of %s, got %v", Operations[1], regressions)
+	}
+
+	if _, err := Run([]Workload{{Name: "invalid", Bits: 4096, Density: 1, Queries: 1, ChunkSize: 64}}, time.Millisecond); err == nil {
+		t.Fatal("expected error for an invalid workload")
+	}
+}
@@ -0,0 +1,57 @@
+package bloomtree
+
+import (
+	"errors"
+)
+
+// minBlindingKey is the minimum length of a blinding key in bytes.
+const minBlindingKey = 16
+
+// WithBlinding commits to every word of a chunk separately, salted with a salt derived from the secret key,
+// and blinds the words of opened chunks that hold none of the proven indices. Proofs then only reveal the
+// words needed to check the proven bits, e.g. a single word of an absence proof instead of its whole chunk,
+// and the commitments of the other words, which leak nothing without the key. The key is needed to build,
+// update and prove the tree, but not to verify its proofs. Adaptive trees cannot be blinded.
+func WithBlinding(key []byte) Option {
+	return func(c *config) error {
+		if len(key) < minBlindingKey {
+			return errors.New("the blinding key must have at least 16 bytes")
+		}
+		c.blindingKey = append([]byte(nil), key...)
+		return nil
+	}
+}
+
+// proofWords returns the words of the distinct sorted chunk indices opened for the sorted bloom filter
+// indices. For blinded trees, the words without an index are zeroed, and the word commitments hold the
+// commitment of every blinded word and the salt of every revealed word. They are nil otherwise.
+func (bt *BloomTree) proofWords(chunkIndices []uint64, indices []uint64) ([][]uint64, [][][32]byte) {
+	words := bt.chunkWords(chunkIndices)
+	if bt.cfg.blindingKey == nil {
+		return words, nil
+	}
+	revealed := make(map[uint64]bool)
+	for _, v := range indices {
+		revealed[v/64] = true
+	}
+	commitments := make([][][32]byte, len(words))
+	var i int
+	for j, index := range chunkIndices {
+		if j > 0 && index == chunkIndices[j-1] {
+			continue
+		}
+		first := index * uint64(bt.cfg.chunkSize/64)
+		commitments[i] = make([][32]byte, len(words[i]))
+		for w, word := range words[i] {
+			salt := bt.cfg.hash.wordSalt(bt.cfg.blindingKey, index, w)
+			if revealed[first+uint64(w)] {
+				commitments[i][w] = salt
+				continue
+			}
+			commitments[i][w] = bt.cfg.hash.wordCommitment(salt, word)
+			words[i][w] = 0
+		}
+		i++
+	}
+	return words, commitments
+}
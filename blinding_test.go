@@ -0,0 +1,143 @@
+package bloomtree
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWithBlinding(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	key := []byte("0123456789abcdef")
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithChunkSize(256), WithBlinding(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := NewBloomTree(dbf, WithChunkSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() == plain.Root() {
+		t.Fatal("expected blinded and plain trees to have different roots")
+	}
+	if err := tree.Update([]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	var hidden int
+	for _, elem := range [][]byte{{1}, {3}, {42}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// verification does not need the key
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf, WithChunkSize(256))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify blinded proof of element %v", elem)
+		}
+		indices, _, _, err := tree.proofIndices(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+		revealed := make(map[uint64]bool)
+		var chunks []uint64
+		for _, v := range indices {
+			revealed[v/64] = true
+			if chunk := v / 256; len(chunks) == 0 || chunks[len(chunks)-1] != chunk {
+				chunks = append(chunks, chunk)
+			}
+		}
+		words := dbf.BitArray().Bytes()
+		for i, chunkWords := range multiproof.ChunkWords {
+			if len(multiproof.WordCommitments[i]) != len(chunkWords) {
+				t.Fatal("expected a word commitment for every word")
+			}
+			for w, word := range chunkWords {
+				index := chunks[i]*4 + uint64(w)
+				if revealed[index] && word != words[index] {
+					t.Fatalf("revealed word %d does not match the bloom filter", index)
+				} else if !revealed[index] && word != 0 {
+					t.Fatalf("word %d without proven index is not blinded", index)
+				} else if !revealed[index] && words[index] != 0 {
+					hidden++
+				}
+			}
+		}
+
+		data := multiproof.Encode()
+		if data[0] != 3 {
+			t.Fatalf("expected wire version 3, but got %d", data[0])
+		}
+		decoded, err := DecodeCompactMultiProof(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON CompactMultiProof
+		output, err := multiproof.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fromJSON.UnmarshalJSON(output); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []*CompactMultiProof{decoded, &fromJSON} {
+			if !reflect.DeepEqual(p.WordCommitments, multiproof.WordCommitments) {
+				t.Fatal("decoded word commitments do not match")
+			}
+		}
+	}
+
+	if hidden == 0 {
+		t.Fatal("expected proofs to blind set words")
+	}
+
+	// decoded trees keep the key, so they generate the same proofs
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BloomTree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.SetBloomFilter(dbf); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := tree.GenerateCompactMultiProof([]byte{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err := decoded.GenerateCompactMultiProof([]byte{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(multiproof, expected) {
+		t.Fatal("the decoded tree generates another proof")
+	}
+}
+
+func TestWithBlindingErrors(t *testing.T) {
+	SetChunkSize(64)
+	key := []byte("0123456789abcdef")
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	if _, err := NewBloomTree(dbf, WithBlinding(key[:15])); err == nil {
+		t.Fatal("expected error for a short blinding key")
+	}
+	if _, err := NewAdaptiveBloomTree(dbf, 64, 256, WithBlinding(key)); err == nil {
+		t.Fatal("expected error for a blinded adaptive tree")
+	}
+	tree, err := NewBloomTree(dbf, WithBlinding(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GetChunkRange(0, 2); err == nil {
+		t.Fatal("expected error for a chunk range of a blinded tree")
+	}
+	if _, err := tree.GenerateEmptinessProof(0, 1); err == nil {
+		t.Fatal("expected error for an emptiness proof of a blinded tree")
+	}
+}
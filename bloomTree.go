@@ -1,12 +1,14 @@
 package bloomtree
 
 import (
+	"context"
 	"crypto/sha512"
 	"errors"
 	"fmt"
 	"math"
-	"sort"
+	"sync"
 
+	"github.com/labbloom/bloom-tree/core"
 	"github.com/willf/bitset"
 )
 
@@ -26,156 +28,470 @@ type BloomFilter interface {
 	GetElementIndices([]byte) []uint
 }
 
+// Prover generates proofs against the root of a bloom tree. It is implemented by BloomTree,
+// and by trees served remotely, so applications can use both alike.
+type Prover interface {
+	Root() [32]byte
+	GenerateCompactMultiProof(elem []byte) (*CompactMultiProof, error)
+}
+
 // BloomTree represents the bloom tree struct.
+//
+// Proofs and roots may be requested concurrently, as long as neither the tree nor its bloom filter is
+// modified at the same time. Updates and direct changes to the bloom filter require exclusive access,
+// otherwise proofs may be generated from a half updated tree and fail to verify. Snapshot and Freeze only
+// read the tree, so they may be called while proofs are generated. Freeze returns an immutable view of the
+// tree, which stays safe for concurrent use while the tree is updated.
 type BloomTree struct {
-	bf    BloomFilter
-	nodes [][32]byte
+	// clamped counts the element indices clamped by ClampOutOfRange. It is the first field, so it is 64 bit
+	// aligned for atomic access on 32 bit platforms.
+	clamped uint64
+	bf      BloomFilter
+	nodes   [][32]byte
+	// bounds holds the first word of every leaf chunk of an adaptive tree.
+	// It is nil for trees with a fixed chunk size.
+	bounds []uint64
+	// checksums holds the checksum of every chunk if the tree was built with WithChunkChecksums.
+	checksums []uint64
+	// store holds the nodes instead of nodes if the tree was built with WithNodeStore.
+	store NodeStore
+	cfg   config
+	// frozen rejects all modifications of the tree, see Freeze.
+	frozen bool
+	// spilled reports that the nodes were moved to a temporary file store by WithMemoryBudget.
+	spilled bool
+	// access counts the proofs of every chunk if the tree was built with WithAccessStats.
+	access *accessStats
+	// provenance holds the provenance of every chunk if the tree was built with WithProvenance.
+	provenance *chunkProvenance
+	// snapshotMu serializes snapshots, which share the nodes of the tree with their copies.
+	snapshotMu sync.Mutex
+	// nodesShared reports that nodes are shared with a snapshot, so the tree moves to copy-on-write pages
+	// before its next write instead of converting while snapshots may run next to proofs.
+	nodesShared bool
+	// manifest is the build manifest recorded when the tree was built, see Manifest. It is never modified.
+	manifest *BuildManifest
+	// popcounts caches the popcount sum tree of the current root, see PopcountRoot.
+	popcounts popcountCache
+}
+
+// NewBloomTree creates a new bloom tree. The nodes only depend on the bloom filter and the options,
+// never on GOMAXPROCS or scheduling, so roots can be pinned by other systems.
+func NewBloomTree(b BloomFilter, opts ...Option) (*BloomTree, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newBloomTree(context.Background(), b, cfg)
+}
+
+// NewBloomTreeCtx creates a new bloom tree like NewBloomTree, but stops hashing and returns the error of the
+// context once it is canceled or its deadline passes.
+func NewBloomTreeCtx(ctx context.Context, b BloomFilter, opts ...Option) (*BloomTree, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newBloomTree(ctx, b, cfg)
 }
 
-// NewBloomTree creates a new bloom tree.
-func NewBloomTree(b BloomFilter) (*BloomTree, error) {
+// newBloomTree builds the bloom tree of the bloom filter with the given configuration.
+func newBloomTree(ctx context.Context, b BloomFilter, cfg config) (*BloomTree, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkEVM(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkWordTrees(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkSparse(); err != nil {
+		return nil, err
+	}
+	if isEmptyFilter(b) {
+		return newEmptyTree(b, cfg), nil
+	}
+	bfAsInt, err := bloomFilterWords(b)
+	if err != nil {
+		return nil, err
+	}
+	bt := &BloomTree{
+		bf:  b,
+		cfg: cfg,
+	}
+	if bt.spilled, err = bt.cfg.spill(bt.leafCount(bfAsInt)); err != nil {
+		return nil, err
+	}
+	cfg = bt.cfg
+	if cfg.sparse {
+		err := bt.buildSparse(ctx, uint64(b.BitArray().Len()), bt.leafCount(bfAsInt), func(i int) ([32]byte, bool) {
+			words := bt.leafWords(bfAsInt, i)
+			if zeroWords(words) {
+				return [32]byte{}, false
+			}
+			return cfg.leaf(uint64(i), words...), true
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.store != nil {
+		err := bt.buildStore(ctx, bt.leafCount(bfAsInt), func(i int) [32]byte {
+			return cfg.leaf(uint64(i), bt.leafWords(bfAsInt, i)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		leafs := make([][sha512.Size256]byte, bt.leafCount(bfAsInt))
+		if err := hashLeafs(ctx, cfg, bfAsInt, leafs); err != nil {
+			return nil, err
+		}
+		if bt.nodes, err = buildNodesCtx(ctx, leafs, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.chunkChecksums {
+		bt.checksums = bt.chunkChecksums(bfAsInt)
+	}
+	if cfg.accessStats {
+		bt.access = &accessStats{counts: make([]uint64, (bt.nodeCount()+1)/2)}
+	}
+	bt.provenance = cfg.newProvenance(bt.leafCount(bfAsInt))
+	bt.manifest = bt.buildManifest(bfAsInt)
+	return bt, nil
+}
+
+// bloomFilterWords validates the bloom filter parameters and returns its bit array as words.
+func bloomFilterWords(b BloomFilter) ([]uint64, error) {
 	if b.NumOfHashes() >= uint(maxK) {
 		return nil, fmt.Errorf("parameter k of the bloom filter must be smaller than %d", maxK)
 	}
-	bf := b.BitArray()
-	bfAsInt := bf.Bytes()
+	bfAsInt := b.BitArray().Bytes()
 	if len(bfAsInt) == 0 {
 		return nil, errors.New("tree must have at least 1 leaf")
 	}
-	leafs := make([][sha512.Size256]byte, int(math.Ceil(float64(len(bfAsInt))/float64(chunkSize/64))))
-	hashLeafs(bfAsInt, leafs)
-	leafNum := int(math.Exp2(math.Ceil(math.Log2(float64(len(leafs))))))
+	return bfAsInt, nil
+}
+
+// buildNodes pads the leafs to a power of two and computes the internal nodes.
+func buildNodes(leafs [][32]byte, cfg config) [][32]byte {
+	nodes, _ := buildNodesCtx(context.Background(), leafs, cfg)
+	return nodes
+}
+
+// buildNodesCtx is buildNodes returning the error of the context once it is done.
+func buildNodesCtx(ctx context.Context, leafs [][32]byte, cfg config) ([][32]byte, error) {
+	leafNum := core.LeafNum(len(leafs))
 	nodes := make([][32]byte, (leafNum*2)-1)
 	for i, v := range leafs {
 		nodes[i] = v
 	}
 	for i := len(leafs); i < leafNum; i++ {
-		nodes[i] = hashLeaf(uint64(0), uint64(i))
+		nodes[i] = paddingLeaf(cfg, i)
+	}
+	// every layer only depends on the one below, so the nodes of a layer are hashed in parallel
+	for start, size, layer := leafNum, leafNum/2, 1; size > 0; start, size, layer = start+size, size/2, layer+1 {
+		first := start
+		err := parallelRangeCtx(ctx, cfg.workers, start, start+size, func(start, end int) {
+			for i := start; i < end; i++ {
+				nodes[i] = cfg.node(layer, uint64(i-first), nodes[2*(i-leafNum)], nodes[2*(i-leafNum)+1])
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// leaf hashes the words of the chunk at the given index, in the EVM layout for EVM trees,
+// as a word tree for trees with word trees, and word by word for blinded trees.
+func (c config) leaf(index uint64, words ...uint64) [32]byte {
+	if c.evm {
+		return evmLeaf(index, evmSlots(words))
 	}
-	for i := leafNum; i < len(nodes); i++ {
-		nodes[i] = hashChild(nodes[2*(i-leafNum)], nodes[2*(i-leafNum)+1])
+	if c.wordTrees {
+		nodes := wordTreeNodes(c.hash, index, words, c.chunkSize/64)
+		return c.hash.wordTreeLeaf(index, nodes[len(nodes)-1])
 	}
-	return &BloomTree{
-		bf:    b,
-		nodes: nodes,
-	}, nil
+	if c.blindingKey == nil {
+		return c.hash.leaf(c.chunkSize, index, words...)
+	}
+	commitments := make([][32]byte, len(words))
+	for i, w := range words {
+		commitments[i] = c.hash.wordCommitment(c.hash.wordSalt(c.blindingKey, index, i), w)
+	}
+	return c.hash.blindedLeaf(index, commitments...)
+}
+
+// paddingLeaf returns the hash of the padding leaf at index i.
+func paddingLeaf(cfg config, i int) [32]byte {
+	if cfg.legacyPadding {
+		return cfg.hash.leaf(cfg.chunkSize, uint64(0), uint64(i))
+	}
+	return cfg.hash.padding(uint64(i))
+}
+
+// leafCount returns the number of leafs holding bloom filter chunks, excluding padding.
+func (bt *BloomTree) leafCount(words []uint64) int {
+	if bt.bounds != nil {
+		return len(bt.bounds)
+	}
+	return int(math.Ceil(float64(len(words)) / float64(bt.cfg.chunkSize/64)))
+}
+
+// leafWords returns the bloom filter words of the leaf at the given index.
+func (bt *BloomTree) leafWords(words []uint64, index int) []uint64 {
+	if bt.bounds != nil {
+		return words[bt.bounds[index]:adaptiveChunkEnd(bt.bounds, index, len(words))]
+	}
+	step := bt.cfg.chunkSize / 64
+	end := (index + 1) * step
+	if end > len(words) {
+		end = len(words)
+	}
+	return words[index*step : end]
 }
 
 func (bt *BloomTree) GetBloomFilter() BloomFilter {
 	return bt.bf
 }
 
-func order(a, b uint64) (uint64, uint64) {
-	if a > b {
-		return b, a
+// generateProof returns the hashes needed to reconstruct the root from the leafs at the given indices.
+// It returns an error if an index lies outside of its layer of the tree.
+func (bt *BloomTree) generateProof(ctx context.Context, indices []uint64) ([][32]byte, error) {
+	s := getScratch()
+	defer putScratch(s)
+	hashIndices, err := s.path.ProofIndices(indices, bt.nodeCount())
+	if err != nil {
+		return nil, err
 	}
-	return a, b
-
+	bt.recordAccess(indices)
+	return bt.proofHashes(ctx, hashIndices)
 }
 
-func (bt *BloomTree) generateProof(indices []uint64) ([][32]byte, error) {
-	var hashes [][32]byte
-	var hashIndices []uint64
-	var hashIndicesBucket []int
-	var newIndices []uint64
-	prevIndices := indices
-	indMap := make(map[[2]uint64][2]int)
-	leavesPerLayer := uint64(len(bt.nodes) + 1)
-	currentLayer := uint64(0)
-	height := int(math.Log2(float64(len(bt.nodes) / 2)))
-	for i := 0; i <= height; i++ {
-		if len(newIndices) != 0 {
-			for j := 0; j < len(newIndices); j += 2 {
-				prevIndices = append(prevIndices, newIndices[j]/2)
-			}
-			newIndices = nil
-		}
-		for _, val := range prevIndices {
-			neighbor := val ^ 1
-			a, b := order(val, neighbor)
-			pair := [2]uint64{a, b}
-			if _, ok := indMap[pair]; ok {
-				if indMap[pair][0] != int(val) {
-					indMap[pair] = [2]int{-1, 0}
-				}
-			} else {
-				indMap[pair] = [2]int{int(val), int(neighbor + currentLayer)}
-			}
-		}
-		for k, v := range indMap {
-			if v[0] != -1 {
-				hashIndicesBucket = append(hashIndicesBucket, v[1])
-			}
-			newIndices = append(newIndices, k[0], k[1])
-		}
-		sort.Ints(hashIndicesBucket)
-		for _, elem := range hashIndicesBucket {
-			hashIndices = append(hashIndices, uint64(elem))
+// proofHashes returns the nodes at the given indices. It checks the context before every node, as nodes
+// may be read from a slow store, and yields to other goroutines while reading the nodes of huge batches.
+func (bt *BloomTree) proofHashes(ctx context.Context, hashIndices []uint64) ([][32]byte, error) {
+	hashes := make([][32]byte, 0, len(hashIndices))
+	for i, hashInd := range hashIndices {
+		if err := yieldPoint(ctx, i); err != nil {
+			return nil, err
 		}
-		indMap = make(map[[2]uint64][2]int)
-		hashIndicesBucket = nil
-		leavesPerLayer /= 2
-		currentLayer += leavesPerLayer
-		prevIndices = nil
+		hashes = append(hashes, bt.node(int(hashInd)))
 	}
-	for _, hashInd := range hashIndices {
-		hashes = append(hashes, bt.nodes[hashInd])
+	if err := bt.nodesErr(); err != nil {
+		return nil, err
 	}
 	return hashes, nil
 }
 
+// generateProofIndices returns the node indices of the hashes returned by generateProof.
+func (bt *BloomTree) generateProofIndices(indices []uint64) ([]uint64, error) {
+	return multiproofIndices(indices, bt.nodeCount())
+}
+
+// multiproofIndices returns the indices of the nodes needed to reconstruct the root from the leafs at the
+// given indices, in a tree of nodeCount nodes laid out like a bloom tree.
+func multiproofIndices(indices []uint64, nodeCount int) ([]uint64, error) {
+	s := getScratch()
+	defer putScratch(s)
+	hashIndices, err := s.path.ProofIndices(indices, nodeCount)
+	if err != nil {
+		return nil, err
+	}
+	return append([]uint64(nil), hashIndices...), nil
+}
+
+// chunkIndex returns the index of the chunk holding the bloom filter index v.
+func (bt *BloomTree) chunkIndex(v uint64) uint64 {
+	if bt.bounds != nil {
+		return adaptiveChunkIndex(bt.bounds, v)
+	}
+	return v / uint64(bt.cfg.chunkSize)
+}
+
+// getChunksAndIndices returns the leaf hashes and the indices of the chunks holding the bloom filter indices.
+// The leaf hashes are read from the tree instead of hashing the bloom filter again, so the work of a proof
+// does not grow with the size of the bloom filter.
 func (bt *BloomTree) getChunksAndIndices(indices []uint64) ([][32]byte, []uint64) {
 	chunks := make([][32]byte, len(indices))
 	chunkIndices := make([]uint64, len(indices))
-	bf := bt.bf.BitArray()
-	bfAsInt := bf.Bytes()
-	leafs := make([][sha512.Size256]byte, int(math.Ceil(float64(len(bfAsInt))/float64(chunkSize/64))))
-	hashLeafs(bfAsInt, leafs)
 	for i, v := range indices {
-		index := uint64(math.Floor(float64(v) / float64(chunkSize)))
-		chunks[i] = leafs[index]
+		index := bt.chunkIndex(v)
+		chunks[i] = bt.node(int(index))
 		chunkIndices[i] = index
 	}
 	return chunks, chunkIndices
 }
 
 // GenerateCompactMultiProof returns a compact multiproof to verify the presence, or absence of an element in a bloom tree.
+// If the proof cannot be generated, a nil proof is returned together with the error. Indices exceeding the bloom filter
+// length are reported as an *IndexError.
 func (bt *BloomTree) GenerateCompactMultiProof(elem []byte) (*CompactMultiProof, error) {
-	var proofType uint8
-	indices, present := bt.bf.Proof(elem)
-	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return bt.GenerateCompactMultiProofCtx(context.Background(), elem)
+}
+
+// GenerateCompactMultiProofCtx returns the proof of GenerateCompactMultiProof, or the error of the context
+// once it is canceled or its deadline passes, e.g. when the client of a request handler disconnects.
+func (bt *BloomTree) GenerateCompactMultiProofCtx(ctx context.Context, elem []byte) (*CompactMultiProof, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if isEmptyFilter(bt.bf) {
+		return emptyProof(bt.cfg), nil
+	}
+	indices, proofType, absentIndices, err := bt.proofIndices(elem)
+	if err != nil {
+		return nil, err
+	}
+	core.SortIndices(indices)
 	chunks, chunkIndices := bt.getChunksAndIndices(indices)
-	proof, err := bt.generateProof(chunkIndices)
+	proof, err := bt.generateProof(ctx, chunkIndices)
 	if err != nil {
-		return newCompactMultiProof(nil, nil, maxK), err
+		return nil, err
 	}
-	if present {
-		return newCompactMultiProof(chunks, proof, maxK), nil
+	multiproof := newCompactMultiProof(chunks, proof, proofType)
+	multiproof.ChunkWords, multiproof.WordCommitments = bt.proofWords(chunkIndices, indices)
+	multiproof.AbsentIndices = absentIndices
+	multiproof.ChunkSize = bt.cfg.chunkSize
+	multiproof.Provenance = bt.proofProvenance(chunkIndices)
+	return multiproof, nil
+}
+
+// proofIndices returns the bloom filter indices proving the presence or absence of elem, together with the
+// proof type and, for absence proofs with more than one zero index, the positions of the zero indices.
+func (bt *BloomTree) proofIndices(elem []byte) ([]uint64, ProofType, []uint8, error) {
+	if isEmptyFilter(bt.bf) {
+		return nil, 0, nil, ErrEmptyFilter
 	}
-	allIndices := bt.bf.GetElementIndices(elem)
-	for i, v := range allIndices {
-		if indices[0] == uint64(v) {
-			proofType = uint8(i)
+	proofType := Presence
+	indices, present := bt.bf.Proof(elem)
+	if len(indices) == 0 {
+		return nil, 0, nil, ErrNoIndices
+	}
+	var elemIndices []uint
+	if err := checkIndices(indices, uint64(bt.bf.BitArray().Len())); err != nil {
+		if bt.cfg.indexPolicy != ClampOutOfRange {
+			return nil, 0, nil, err
+		}
+		// the filter proves indices past its bit array, so the clamped element indices are proven instead
+		if elemIndices, err = bt.elementIndices(elem); err != nil {
+			return nil, 0, nil, err
 		}
+		indices, present = bt.clampedProof(elemIndices)
 	}
-	return newCompactMultiProof(chunks, proof, proofType), nil
+	var absentIndices []uint8
+	if !present {
+		if elemIndices == nil {
+			var err error
+			if elemIndices, err = bt.elementIndices(elem); err != nil {
+				return nil, 0, nil, err
+			}
+		}
+		proofType = absentIndex(elemIndices, indices[0])
+		if proofType.IsPresence() {
+			return nil, 0, nil, ErrInconsistentIndices
+		}
+		if bt.cfg.smallestAbsence && bt.cfg.absentIndices <= 1 {
+			var index uint64
+			index, proofType = bt.smallestAbsence(elemIndices, newProofCover(bt))
+			indices = []uint64{index}
+		}
+		if bt.cfg.absentIndices > 1 {
+			if bt.cfg.smallestAbsence {
+				indices, absentIndices = bt.smallestAbsences(elemIndices, bt.cfg.absentIndices, newProofCover(bt))
+			} else {
+				indices, absentIndices = bt.zeroIndices(elemIndices, bt.cfg.absentIndices)
+			}
+			if err := checkIndices(indices, uint64(bt.bf.BitArray().Len())); err != nil {
+				return nil, 0, nil, err
+			}
+			proofType = Absence(absentIndices[0])
+			if len(absentIndices) == 1 {
+				absentIndices = nil
+			}
+		}
+	}
+	return indices, proofType, absentIndices, nil
+}
+
+// chunkWords returns a copy of the bloom filter words of the distinct sorted chunk indices. The copies share
+// a single backing array.
+func (bt *BloomTree) chunkWords(chunkIndices []uint64) [][]uint64 {
+	words := bt.bf.BitArray().Bytes()
+	distinct, n := 0, 0
+	for i, index := range chunkIndices {
+		if i > 0 && index == chunkIndices[i-1] {
+			continue
+		}
+		distinct++
+		n += len(bt.leafWords(words, int(index)))
+	}
+	ret := make([][]uint64, 0, distinct)
+	backing := make([]uint64, 0, n)
+	for i, index := range chunkIndices {
+		if i > 0 && index == chunkIndices[i-1] {
+			continue
+		}
+		start := len(backing)
+		backing = append(backing, bt.leafWords(words, int(index))...)
+		ret = append(ret, backing[start:len(backing):len(backing)])
+	}
+	return ret
+}
+
+// zeroIndices returns up to n element indices pointing to zero bits, together with their positions.
+func (bt *BloomTree) zeroIndices(elemIndices []uint, n int) ([]uint64, []uint8) {
+	var (
+		indices   []uint64
+		positions []uint8
+	)
+	bf := bt.bf.BitArray()
+	for i, v := range elemIndices {
+		if len(indices) == n {
+			break
+		}
+		if !bf.Test(v) {
+			indices = append(indices, uint64(v))
+			positions = append(positions, uint8(i))
+		}
+	}
+	return indices, positions
+}
+
+// absentIndex returns the absence proof type for index, or Presence if it is not one of the element indices.
+func absentIndex(elemIndices []uint, index uint64) ProofType {
+	proofType := Presence
+	for i, v := range elemIndices {
+		if index == uint64(v) {
+			proofType = Absence(uint8(i))
+		}
+	}
+	return proofType
 }
 
 // Root returns the Bloom Tree root
 func (bt *BloomTree) Root() [32]byte {
-	return bt.nodes[len(bt.nodes)-1]
+	return bt.node(bt.nodeCount() - 1)
 }
 
-func hashLeafs(leaf []uint64, hashes [][sha512.Size256]byte) {
-	step := uint64(chunkSize / 64)
-	index := uint64(0)
-	length := uint64(len(leaf))
-	for i := uint64(0); i < length; i += step {
-		diff := step
-		if length-i < step {
-			diff = length - i
+// hashLeafs hashes the chunks of the bloom filter words into hashes, which holds one hash per chunk.
+// It returns the error of the context once it is done.
+func hashLeafs(ctx context.Context, cfg config, leaf []uint64, hashes [][sha512.Size256]byte) error {
+	step := cfg.chunkSize / 64
+	return parallelRangeCtx(ctx, cfg.workers, 0, len(hashes), func(start, end int) {
+		for index := start; index < end; index++ {
+			i := index * step
+			diff := step
+			if len(leaf)-i < step {
+				diff = len(leaf) - i
+			}
+			hashes[index] = cfg.leaf(uint64(index), leaf[i:i+diff]...)
 		}
-		hashes[index] = hashLeaf(index, leaf[i:i+diff]...)
-		index = index + 1
-	}
+	})
 }
@@ -1,10 +1,19 @@
 package bloomtree
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/labbloom/DBF"
+	"github.com/labbloom/bloom-tree/core"
 )
 
 func TestNewBloomTree64(t *testing.T) {
@@ -116,6 +125,259 @@ func TestBloomTreeExceedingK64(t *testing.T) {
 	}
 }
 
+func TestGenerateProofLayerBounds(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11 chunks are padded to 16 leafs
+	var tests = []struct {
+		indices []uint64
+		valid   bool
+	}{
+		{indices: []uint64{0}, valid: true},
+		{indices: []uint64{10}, valid: true},
+		{indices: []uint64{15}, valid: true},
+		{indices: []uint64{3, 16}, valid: false},
+		{indices: []uint64{1 << 63}, valid: false},
+	}
+
+	for _, test := range tests {
+		_, err := tree.generateProof(context.Background(), test.indices)
+		if test.valid && err != nil {
+			t.Fatalf("unexpected error %v for indices %v", err, test.indices)
+		} else if !test.valid && !errors.Is(err, ErrLayerIndexOutOfRange) {
+			t.Fatalf("expected error %v for indices %v, but got %v", ErrLayerIndexOutOfRange, test.indices, err)
+		}
+	}
+}
+
+func TestProofsNearPaddingBoundary(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	elements := [][]byte{{0}, {1}, {2}, {3}}
+	leafCounts := make(map[int]bool)
+	// filters of 1 to 19 words yield trees with and without padding around every power of two up to 16
+	for n := uint(5); n <= 360; n += 5 {
+		dbf := generateDBF(n, seed, elements...)
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leafCounts[tree.leafCount(dbf.BitArray().Bytes())] = true
+		for _, elem := range [][]byte{{0}, {3}, {4}, {5}, {200}} {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf)
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify proof for element %v in a tree of %d nodes", elem, len(tree.nodes))
+			}
+		}
+	}
+	for _, count := range []int{1, 2, 3, 4, 5, 7, 8, 9, 15, 16, 17} {
+		if !leafCounts[count] {
+			t.Fatalf("no tree with %d leafs was tested", count)
+		}
+	}
+}
+
+// stubBF is a bloom filter returning fixed indices for every element.
+type stubBF struct {
+	*DBF.DistBF
+	indices     []uint64
+	present     bool
+	elemIndices []uint
+}
+
+func (s *stubBF) Proof([]byte) ([]uint64, bool) {
+	return append([]uint64(nil), s.indices...), s.present
+}
+
+func (s *stubBF) GetElementIndices([]byte) []uint {
+	return s.elemIndices
+}
+
+func TestGenerateCompactMultiProofErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	length := uint64(dbf.BitArray().Len())
+	var tests = []struct {
+		bf  *stubBF
+		err error
+	}{
+		{
+			bf:  &stubBF{DistBF: dbf, indices: []uint64{1, length}, present: true},
+			err: ErrIndexOutOfRange,
+		},
+		{
+			bf:  &stubBF{DistBF: dbf, indices: []uint64{length + 1000}, elemIndices: []uint{uint(length + 1000)}},
+			err: ErrIndexOutOfRange,
+		},
+		{
+			bf:  &stubBF{DistBF: dbf, present: true},
+			err: ErrNoIndices,
+		},
+		{
+			bf:  &stubBF{DistBF: dbf, indices: []uint64{3}, elemIndices: []uint{1, 2}},
+			err: ErrInconsistentIndices,
+		},
+	}
+
+	for _, test := range tests {
+		tree, err := NewBloomTree(test.bf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+		if !errors.Is(err, test.err) {
+			t.Fatalf("expected error %v, but got %v", test.err, err)
+		}
+		if multiproof != nil {
+			t.Fatal("expected no proof on error")
+		}
+	}
+}
+
+func TestIndexError(t *testing.T) {
+	err := checkIndices([]uint64{0, 669, 670}, 670)
+	var indexErr *IndexError
+	if !errors.As(err, &indexErr) {
+		t.Fatalf("expected *IndexError, but got %v", err)
+	}
+	if indexErr.Index != 670 || indexErr.Length != 670 {
+		t.Fatalf("unexpected index error %v", indexErr)
+	}
+	if err := checkIndices([]uint64{0, 669}, 670); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDeterministicNodes(t *testing.T) {
+	SetChunkSize(64)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	seed := "secret seed"
+	var (
+		nodes  [][32]byte
+		proofs []*CompactMultiProof
+	)
+	for _, procs := range []int{1, 2, 8} {
+		runtime.GOMAXPROCS(procs)
+		// 20000 elements need more than minParallelItems chunks, so the leafs are hashed by several workers
+		dbf := generateDBF(20000, seed, []byte{1}, []byte{2}, []byte{3})
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.leafCount(dbf.BitArray().Bytes()) <= minParallelItems {
+			t.Fatal("the tree is too small to be hashed in parallel")
+		}
+		for _, elem := range [][]byte{{4}, {5}, {6}} {
+			if err := tree.Update(elem); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var treeProofs []*CompactMultiProof
+		for _, elem := range [][]byte{{1}, {5}, {42}} {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			treeProofs = append(treeProofs, multiproof)
+		}
+		if nodes == nil {
+			nodes, proofs = tree.nodes, treeProofs
+			continue
+		}
+		if !reflect.DeepEqual(tree.nodes, nodes) {
+			t.Fatalf("nodes with GOMAXPROCS=%d differ from GOMAXPROCS=1", procs)
+		}
+		if !reflect.DeepEqual(treeProofs, proofs) {
+			t.Fatalf("proofs with GOMAXPROCS=%d differ from GOMAXPROCS=1", procs)
+		}
+	}
+}
+
+// TestCoreNodes checks the parallel construction of trees against the sequential reference of the core package.
+func TestCoreNodes(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1}, []byte{2}, []byte{3})
+	for _, opts := range [][]Option{nil, {WithSparse()}, {WithHash(BLAKE3), WithChunkSize(128)}} {
+		tree, err := NewBloomTree(dbf, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		treeNodes, err := tree.allNodes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		leafNum := (len(treeNodes) + 1) / 2
+		leafs := make([][32]byte, leafNum)
+		words := dbf.BitArray().Bytes()
+		for i := range leafs {
+			if i < tree.leafCount(words) {
+				leafs[i] = tree.cfg.leaf(uint64(i), tree.leafWords(words, i)...)
+			} else {
+				leafs[i] = paddingLeaf(tree.cfg, i)
+			}
+		}
+		nodes, err := core.BuildNodes(tree.cfg.node, leafs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nodes, treeNodes) {
+			t.Fatalf("nodes of the tree with %d options differ from the core reference", len(opts))
+		}
+	}
+}
+
+func TestProofChunksReadFromTree(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bits set on the bloom filter directly are not hashed by proofs, only by updates of the tree
+	indices := dbf.GetElementIndices([]byte{42})
+	for _, v := range indices {
+		dbf.BitArray().Set(v)
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range indices {
+		if chunk := tree.nodes[tree.chunkIndex(uint64(v))]; !containsHash(multiproof.Chunks, chunk) {
+			t.Fatalf("expected the leaf hash %x of index %d in the proof", chunk, i)
+		}
+	}
+	if err := tree.Update([]byte{42}); err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err = tree.GenerateCompactMultiProof([]byte{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified, err := VerifyCompactMultiProof([]byte{42}, []byte("secret seed"), multiproof, tree.Root(), dbf); err != nil || !verified {
+		t.Fatalf("failed to verify the proof after the update: %v", err)
+	}
+}
+
+func containsHash(hashes [][32]byte, h [32]byte) bool {
+	for _, v := range hashes {
+		if v == h {
+			return true
+		}
+	}
+	return false
+}
+
 func generateDBF(numElem uint, seed string, elements ...[]byte) *DBF.DistBF {
 	dbf := DBF.NewDbf(numElem, 0.2, []byte(seed))
 	for _, elem := range elements {
@@ -123,3 +385,180 @@ func generateDBF(numElem uint, seed string, elements ...[]byte) *DBF.DistBF {
 	}
 	return dbf
 }
+
+func TestContextCancellation(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTreeCtx(context.Background(), dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != expected.Root() {
+		t.Fatalf("expected root %x, but got %x", expected.Root(), tree.Root())
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	var tests = []struct {
+		ctx      context.Context
+		expected error
+	}{
+		{ctx: canceled, expected: context.Canceled},
+		{ctx: expired, expected: context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		if _, err := NewBloomTreeCtx(test.ctx, dbf); !errors.Is(err, test.expected) {
+			t.Fatalf("expected %v building the tree, but got %v", test.expected, err)
+		}
+		if _, err := NewBloomTreeCtx(test.ctx, dbf, WithNodeStore(NewMemoryStore(tree.nodeCount()))); !errors.Is(err, test.expected) {
+			t.Fatalf("expected %v building the tree into a store, but got %v", test.expected, err)
+		}
+		if _, err := tree.GenerateCompactMultiProofCtx(test.ctx, []byte{1}); !errors.Is(err, test.expected) {
+			t.Fatalf("expected %v generating a proof, but got %v", test.expected, err)
+		}
+		if _, err := tree.GenerateCompactMultiProofBatchCtx(test.ctx, [][]byte{{1}, {2}}); !errors.Is(err, test.expected) {
+			t.Fatalf("expected %v generating a batch proof, but got %v", test.expected, err)
+		}
+	}
+	multiproof, err := tree.GenerateCompactMultiProofCtx(context.Background(), []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, tree.Root(), dbf)
+	if err != nil || !verified {
+		t.Fatalf("expected the proof to verify, but got %v, %v", verified, err)
+	}
+}
+
+func benchmarkDBF(n int) *DBF.DistBF {
+	dbf := DBF.NewDbf(uint(n), 0.01, []byte("benchmark seed"))
+	for i := 0; i < n; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element %d", i)))
+	}
+	return dbf
+}
+
+func BenchmarkNewBloomTree(b *testing.B) {
+	SetChunkSize(64)
+	for _, n := range []int{1000, 100000} {
+		dbf := benchmarkDBF(n)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewBloomTree(dbf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateCompactMultiProof(b *testing.B) {
+	SetChunkSize(64)
+	for _, n := range []int{1000, 100000} {
+		tree, err := NewBloomTree(benchmarkDBF(n))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, elem := range []string{"element 1", "absent element"} {
+			b.Run(fmt.Sprintf("n=%d/%s", n, elem), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := tree.GenerateCompactMultiProof([]byte(elem)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// proofPathBits is the size of the bloom filter of BenchmarkProofPath. The latency target of single element
+// proofs is a P99 below one millisecond on a 1-Gbit filter, run with -proof-path-bits=1073741824.
+var proofPathBits = flag.Uint("proof-path-bits", 1<<24, "number of bits of the bloom filter of BenchmarkProofPath")
+
+// proofPathDBF returns a bloom filter of about m bits with half of its bits set, like a filled filter, and the
+// elements added to it.
+func proofPathDBF(m uint) (*DBF.DistBF, [][]byte) {
+	// the number of elements of m bits at a false positive rate of 1%
+	dbf := DBF.NewDbf(uint(float64(m)/9.585), 0.01, []byte("benchmark seed"))
+	rng := rand.New(rand.NewSource(1))
+	words := dbf.BitArray().Bytes()
+	for i := range words {
+		words[i] = rng.Uint64() & rng.Uint64()
+	}
+	if m%64 != 0 {
+		words[len(words)-1] &= 1<<(m%64) - 1
+	}
+	elems := make([][]byte, 1000)
+	for i := range elems {
+		elems[i] = []byte(fmt.Sprintf("element %d", i))
+		dbf.Add(elems[i])
+	}
+	return dbf, elems
+}
+
+// BenchmarkProofPath measures the stages of serving a single element proof, and reports their P99 latency.
+func BenchmarkProofPath(b *testing.B) {
+	SetChunkSize(64)
+	dbf, elems := proofPathDBF(*proofPathBits)
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		elems = append(elems, []byte(fmt.Sprintf("absent element %d", i)))
+	}
+	multiproof, err := tree.GenerateCompactMultiProof(elems[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	stages := []struct {
+		name string
+		fn   func(elem []byte) error
+	}{
+		{"indices", func(elem []byte) error {
+			_, _, _, err := tree.proofIndices(elem)
+			return err
+		}},
+		{"generate", func(elem []byte) error {
+			_, err := tree.GenerateCompactMultiProof(elem)
+			return err
+		}},
+		{"encode", func(elem []byte) error {
+			multiproof.Encode()
+			return nil
+		}},
+		{"end-to-end", func(elem []byte) error {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				return err
+			}
+			multiproof.Encode()
+			return nil
+		}},
+	}
+	for _, stage := range stages {
+		b.Run(stage.name, func(b *testing.B) {
+			b.ReportAllocs()
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				if err := stage.fn(elems[i%len(elems)]); err != nil {
+					b.Fatal(err)
+				}
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
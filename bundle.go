@@ -0,0 +1,155 @@
+package bloomtree
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// bundleVersion is the version of the JSON form of verification bundles.
+const bundleVersion = 1
+
+// VerificationBundle is a self-contained proof of the presence or absence of a set of elements, e.g. for an
+// air-gapped auditor checking a screening list. It holds the parameters and the root of the tree signed by
+// its publisher, the seed of the bloom filter, the elements and their batch proof, and is verified without
+// the tree or the bloom filter by verifier.VerifyBundle.
+type VerificationBundle struct {
+	// Attestation is the root the proof was generated against, with the parameters of its tree.
+	Attestation RootAttestation
+	// Signature is the ed25519 signature of the attestation by the publisher of the tree.
+	Signature []byte
+	// Seed is the seed of the bloom filter, which maps the elements to their indices.
+	Seed []byte
+	// Elements are the proven elements, in the order of the proof types of the proof.
+	Elements [][]byte
+	// Proof is the batch proof of the elements, carrying the words of its chunks.
+	Proof *BatchMultiProof
+}
+
+// ExportVerificationBundle proves the presence or absence of the elements with a single batch proof, and
+// returns it in a bundle together with the attestation of the root signed with the key. The seed is the seed
+// of the bloom filter. Trees built with WithEVM, WithWordTrees or an adaptive chunk size are not supported,
+// as their chunks cannot be verified without the tree.
+func (bt *BloomTree) ExportVerificationBundle(elems [][]byte, seed []byte, key ed25519.PrivateKey) (*VerificationBundle, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if bt.cfg.evm || bt.cfg.wordTrees || bt.bounds != nil {
+		return nil, errors.New("verification bundles of EVM, word tree and adaptive trees are not supported")
+	}
+	proof, err := bt.GenerateCompactMultiProofBatch(elems)
+	if err != nil {
+		return nil, err
+	}
+	attestation := bt.Attestation()
+	signature, err := attestation.Sign(key)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([][]byte, len(elems))
+	for i, elem := range elems {
+		elements[i] = append([]byte(nil), elem...)
+	}
+	proof.Costs = nil
+	return &VerificationBundle{
+		Attestation: attestation,
+		Signature:   signature,
+		Seed:        append([]byte(nil), seed...),
+		Elements:    elements,
+		Proof:       proof,
+	}, nil
+}
+
+type bundleJSON struct {
+	Version int `json:"version"`
+	// Attestation is the canonical JSON of the attestation, as signed by the publisher.
+	Attestation json.RawMessage  `json:"attestation"`
+	Signature   string           `json:"signature"`
+	Seed        string           `json:"seed"`
+	Elements    []string         `json:"elements"`
+	Proof       *BatchMultiProof `json:"proof"`
+}
+
+type attestationJSON struct {
+	Root        string `json:"root"`
+	ChunkSize   uint64 `json:"chunkSize"`
+	Hash        string `json:"hash"`
+	NumOfHashes uint64 `json:"numOfHashes"`
+	FilterBits  uint64 `json:"filterBits"`
+}
+
+// MarshalJSON encodes the bundle with hex encoded bytes, which is the file format of verification bundles.
+func (b *VerificationBundle) MarshalJSON() ([]byte, error) {
+	attestation, err := b.Attestation.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]string, len(b.Elements))
+	for i, elem := range b.Elements {
+		elements[i] = hex.EncodeToString(elem)
+	}
+	return json.Marshal(bundleJSON{
+		Version:     bundleVersion,
+		Attestation: attestation,
+		Signature:   hex.EncodeToString(b.Signature),
+		Seed:        hex.EncodeToString(b.Seed),
+		Elements:    elements,
+		Proof:       b.Proof,
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a bundle.
+func (b *VerificationBundle) UnmarshalJSON(data []byte) error {
+	var aux bundleJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", aux.Version)
+	}
+	var a attestationJSON
+	if err := json.Unmarshal(aux.Attestation, &a); err != nil {
+		return fmt.Errorf("decoding attestation: %w", err)
+	}
+	roots, err := decodeHexHashes([]string{a.Root})
+	if err != nil {
+		return fmt.Errorf("decoding root: %w", err)
+	}
+	hash, err := ParseHash(a.Hash)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(aux.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	seed, err := hex.DecodeString(aux.Seed)
+	if err != nil {
+		return fmt.Errorf("decoding seed: %w", err)
+	}
+	elements := make([][]byte, len(aux.Elements))
+	for i, s := range aux.Elements {
+		if elements[i], err = hex.DecodeString(s); err != nil {
+			return fmt.Errorf("decoding element %d: %w", i, err)
+		}
+	}
+	if aux.Proof == nil {
+		return errors.New("the bundle has no proof")
+	}
+	*b = VerificationBundle{
+		Attestation: RootAttestation{
+			Root:        roots[0],
+			ChunkSize:   a.ChunkSize,
+			Hash:        hash,
+			NumOfHashes: a.NumOfHashes,
+			FilterBits:  a.FilterBits,
+		},
+		Signature: signature,
+		Seed:      seed,
+		Elements:  elements,
+		Proof:     aux.Proof,
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package bloomtree
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportVerificationBundle(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithAbsentIndices(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems := [][]byte{{1}, {2}, {42}}
+	bundle, err := tree.ExportVerificationBundle(elems, []byte(seed), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bundle.Attestation.VerifySignature(pub, bundle.Signature) {
+		t.Fatal("failed to verify the signature of the attestation")
+	}
+	if bundle.Attestation.Root != tree.Root() || bundle.Proof.Costs != nil {
+		t.Fatalf("unexpected bundle %+v", bundle)
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded VerificationBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, bundle) {
+		t.Fatalf("expected bundle %+v, but got %+v", bundle, &decoded)
+	}
+	verified, err := VerifyCompactMultiProofBatch(decoded.Elements, decoded.Seed, decoded.Proof, decoded.Attestation.Root, dbf,
+		WithAbsentIndices(2))
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify the decoded batch proof")
+	}
+
+	var tests = []struct {
+		name string
+		data string
+	}{
+		{name: "version", data: strings.Replace(string(data), `"version":1`, `"version":2`, 1)},
+		{name: "signature", data: strings.Replace(string(data), `"signature":"`, `"signature":"zz`, 1)},
+		{name: "proof", data: strings.Replace(string(data), `"proof":{`, `"other":{`, 1)},
+	}
+	for _, test := range tests {
+		if err := json.Unmarshal([]byte(test.data), &decoded); err == nil {
+			t.Fatalf("expected error for an invalid %s", test.name)
+		}
+	}
+}
+
+func TestExportVerificationBundleErrors(t *testing.T) {
+	SetChunkSize(64)
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf, WithWordTrees())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.ExportVerificationBundle([][]byte{{1}}, nil, key); err == nil {
+		t.Fatal("expected error for a tree with word trees")
+	}
+	tree, err = NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.ExportVerificationBundle(nil, nil, key); err == nil {
+		t.Fatal("expected error for no elements")
+	}
+	if _, err := tree.ExportVerificationBundle([][]byte{{1}}, nil, key[:10]); err == nil {
+		t.Fatal("expected error for an invalid key")
+	}
+}
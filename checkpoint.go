@@ -0,0 +1,224 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// Checkpoint folds the roots published in a period, e.g. a day, into a single digest, so archives keep one
+// digest per period and auditors can sample roots with a proof that they were published in it. The roots are
+// the leaves of a Merkle tree in the order of their publication, and the digest binds its root to the start
+// and length of the period and the number of roots.
+type Checkpoint struct {
+	hash   Hash
+	start  time.Time
+	period time.Duration
+	roots  [][32]byte
+	// nodes holds the Merkle tree of the roots, laid out like the nodes of a bloom tree.
+	nodes [][32]byte
+}
+
+// CheckpointProof proves that a root was published in the period of a checkpoint. Path holds the sibling
+// hashes from the leaf of the root up to the root of the Merkle tree of the checkpoint.
+type CheckpointProof struct {
+	Start  time.Time
+	Period time.Duration
+	Index  uint64
+	Roots  uint64
+	Root   [32]byte
+	Path   [][32]byte
+}
+
+// NewCheckpoint creates the checkpoint of the roots published in the period starting at start, in the order of
+// their publication. Only the hash function of the options is used.
+func NewCheckpoint(start time.Time, period time.Duration, roots [][32]byte, opts ...Option) (*Checkpoint, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid checkpoint period %s", period)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("the checkpoint needs at least one root")
+	}
+	leafNum := uint64(core.LeafNum(len(roots)))
+	cp := &Checkpoint{
+		hash:   cfg.hash,
+		start:  start.UTC(),
+		period: period,
+		roots:  append([][32]byte(nil), roots...),
+		nodes:  make([][32]byte, 2*leafNum-1),
+	}
+	for i := uint64(0); i < leafNum; i++ {
+		var root [32]byte
+		if i < uint64(len(roots)) {
+			root = roots[i]
+		}
+		cp.nodes[i] = cfg.hash.checkpointLeaf(i, root)
+	}
+	for i := leafNum; i < uint64(len(cp.nodes)); i++ {
+		c := 2 * (i - leafNum)
+		cp.nodes[i] = cfg.hash.checkpointNode(cp.nodes[c], cp.nodes[c+1])
+	}
+	return cp, nil
+}
+
+// Digest returns the digest committing to the roots of the period.
+func (cp *Checkpoint) Digest() [32]byte {
+	return cp.hash.checkpointDigest(cp.nodes[len(cp.nodes)-1], uint64(cp.start.UnixNano()), uint64(cp.period), uint64(len(cp.roots)))
+}
+
+// Start returns the start of the period of the checkpoint, in UTC.
+func (cp *Checkpoint) Start() time.Time {
+	return cp.start
+}
+
+// Period returns the length of the period of the checkpoint.
+func (cp *Checkpoint) Period() time.Duration {
+	return cp.period
+}
+
+// Roots returns the roots of the checkpoint in the order of their publication.
+func (cp *Checkpoint) Roots() [][32]byte {
+	return append([][32]byte(nil), cp.roots...)
+}
+
+// Prove returns a proof that the root was published in the period of the checkpoint, or ErrNotCheckpointed.
+// A root published several times is proven at its first publication.
+func (cp *Checkpoint) Prove(root [32]byte) (*CheckpointProof, error) {
+	for i, r := range cp.roots {
+		if r != root {
+			continue
+		}
+		leafNum := uint64(len(cp.nodes)+1) / 2
+		var path [][32]byte
+		for node := uint64(i); node != uint64(len(cp.nodes)-1); node = core.Parent(node, leafNum) {
+			path = append(path, cp.nodes[core.Sibling(node)])
+		}
+		return &CheckpointProof{
+			Start:  cp.start,
+			Period: cp.period,
+			Index:  uint64(i),
+			Roots:  uint64(len(cp.roots)),
+			Root:   root,
+			Path:   path,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %x", ErrNotCheckpointed, root)
+}
+
+// VerifyCheckpointProof returns whether the root of the proof was published in the period of the checkpoint with
+// the given digest. Only the hash function of the options is used.
+func VerifyCheckpointProof(proof *CheckpointProof, digest [32]byte, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.Index >= proof.Roots {
+		return false, invalidProof(ReasonChunkMismatch, "the proof is of root %d, but the checkpoint has %d roots", proof.Index, proof.Roots)
+	}
+	if proof.Roots > 1<<62 {
+		return false, invalidProof(ReasonHashCount, "the checkpoint cannot have %d roots", proof.Roots)
+	}
+	height := core.Height(2*core.LeafNum(int(proof.Roots)) - 1)
+	if len(proof.Path) != height {
+		return false, invalidProof(ReasonHashCount, "the path has %d hashes, but %d are needed", len(proof.Path), height)
+	}
+	h := cfg.hash
+	node := h.checkpointLeaf(proof.Index, proof.Root)
+	index := proof.Index
+	for _, sibling := range proof.Path {
+		if index%2 == 0 {
+			node = h.checkpointNode(node, sibling)
+		} else {
+			node = h.checkpointNode(sibling, node)
+		}
+		index /= 2
+	}
+	if h.checkpointDigest(node, uint64(proof.Start.UnixNano()), uint64(proof.Period), proof.Roots) != digest {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the checkpoint digest")
+	}
+	return true, nil
+}
+
+// Checkpointer collects published roots into the periods they were published in, e.g. days, and returns the
+// checkpoint of a period. Periods are aligned to the zero time, so periods of a day start at midnight UTC. A
+// checkpointer is safe for concurrent use.
+type Checkpointer struct {
+	mu     sync.Mutex
+	opts   []Option
+	period time.Duration
+	// roots holds the roots of every period, keyed by the start of the period in nanoseconds since the epoch.
+	roots map[int64][][32]byte
+}
+
+// NewCheckpointer returns a checkpointer of periods of the given length, e.g. 24 hours. Only the hash function
+// of the options is used.
+func NewCheckpointer(period time.Duration, opts ...Option) (*Checkpointer, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid checkpoint period %s", period)
+	}
+	if _, err := newConfig(opts); err != nil {
+		return nil, err
+	}
+	return &Checkpointer{opts: opts, period: period, roots: make(map[int64][][32]byte)}, nil
+}
+
+// Publish records the root as published at the given time.
+func (c *Checkpointer) Publish(root [32]byte, published time.Time) {
+	start := c.periodStart(published).UnixNano()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roots[start] = append(c.roots[start], root)
+}
+
+// Checkpoint returns the checkpoint of the period holding the given time. Roots published later in the
+// period are only covered by checkpoints created afterwards, so the checkpoint of a period is final once
+// the period is over.
+func (c *Checkpointer) Checkpoint(t time.Time) (*Checkpoint, error) {
+	start := c.periodStart(t)
+	c.mu.Lock()
+	roots := append([][32]byte(nil), c.roots[start.UnixNano()]...)
+	c.mu.Unlock()
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no roots were published in the period starting at %s", start.Format(time.RFC3339))
+	}
+	return NewCheckpoint(start, c.period, roots, c.opts...)
+}
+
+// Periods returns the starts of the periods holding published roots, in increasing order.
+func (c *Checkpointer) Periods() []time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	starts := make([]int64, 0, len(c.roots))
+	for start := range c.roots {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	ret := make([]time.Time, len(starts))
+	for i, start := range starts {
+		ret[i] = time.Unix(0, start).UTC()
+	}
+	return ret
+}
+
+// Prune drops the roots of the periods ending no later than the given time, e.g. once their checkpoints are archived.
+func (c *Checkpointer) Prune(before time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for start := range c.roots {
+		if !time.Unix(0, start).Add(c.period).After(before) {
+			delete(c.roots, start)
+		}
+	}
+}
+
+func (c *Checkpointer) periodStart(t time.Time) time.Time {
+	return t.UTC().Truncate(c.period)
+}
@@ -0,0 +1,110 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	for _, n := range []int{1, 2, 5, 8} {
+		roots := make([][32]byte, n)
+		for i := range roots {
+			roots[i][0], roots[i][1] = byte(i), byte(n)
+		}
+		cp, err := NewCheckpoint(day, 24*time.Hour, roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, root := range roots {
+			proof, err := cp.Prove(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := VerifyCheckpointProof(proof, cp.Digest()); err != nil || !ok {
+				t.Fatalf("failed to verify root %d of %d: %v", root[0], n, err)
+			}
+			// the digest binds the period and the number of roots
+			other := *proof
+			other.Start = proof.Start.Add(24 * time.Hour)
+			if ok, _ := VerifyCheckpointProof(&other, cp.Digest()); ok {
+				t.Fatal("expected the proof to fail for another day")
+			}
+			other = *proof
+			other.Root[2] ^= 1
+			if ok, _ := VerifyCheckpointProof(&other, cp.Digest()); ok {
+				t.Fatal("expected the proof to fail for another root")
+			}
+			other = *proof
+			other.Roots = uint64(2 * n)
+			if ok, _ := VerifyCheckpointProof(&other, cp.Digest()); ok {
+				t.Fatal("expected the proof to fail for another number of roots")
+			}
+		}
+		if _, err := cp.Prove([32]byte{0xff}); !errors.Is(err, ErrNotCheckpointed) {
+			t.Fatalf("expected ErrNotCheckpointed, got %v", err)
+		}
+	}
+	if _, err := NewCheckpoint(day, 24*time.Hour, nil); err == nil {
+		t.Fatal("expected an error for a checkpoint without roots")
+	}
+	cp, err := NewCheckpoint(day, time.Hour, [][32]byte{{1}, {2}, {3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := cp.Prove([32]byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCheckpointProof(&CheckpointProof{Index: 3, Roots: 3}, cp.Digest()); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for an index out of range, got %v", err)
+	}
+	proof.Path = proof.Path[1:]
+	if _, err := VerifyCheckpointProof(proof, cp.Digest()); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected ErrInvalidProof for a short path, got %v", err)
+	}
+}
+
+func TestCheckpointer(t *testing.T) {
+	c, err := NewCheckpointer(24*time.Hour, WithHash(BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	// the roots of a day are folded together, regardless of the time zone they were published in
+	c.Publish([32]byte{1}, day.Add(time.Hour))
+	c.Publish([32]byte{2}, day.Add(23*time.Hour).In(time.FixedZone("UTC+2", 2*3600)))
+	c.Publish([32]byte{3}, day.Add(25*time.Hour))
+	cp, err := c.Checkpoint(day.Add(12 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Start().Equal(day) || len(cp.Roots()) != 2 {
+		t.Fatalf("expected the 2 roots of %s, got %d roots of %s", day, len(cp.Roots()), cp.Start())
+	}
+	proof, err := cp.Prove([32]byte{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyCheckpointProof(proof, cp.Digest(), WithHash(BLAKE3)); err != nil || !ok {
+		t.Fatalf("failed to verify the proof of the checkpointer: %v", err)
+	}
+	if ok, _ := VerifyCheckpointProof(proof, cp.Digest()); ok {
+		t.Fatal("expected the proof to fail with another hash function")
+	}
+	if _, err := cp.Prove([32]byte{3}); !errors.Is(err, ErrNotCheckpointed) {
+		t.Fatal("expected the root of the next day not to be part of the checkpoint")
+	}
+
+	if periods := c.Periods(); len(periods) != 2 || !periods[0].Equal(day) || !periods[1].Equal(day.Add(24*time.Hour)) {
+		t.Fatalf("unexpected periods %v", periods)
+	}
+	c.Prune(day.Add(24 * time.Hour))
+	if _, err := c.Checkpoint(day); err == nil {
+		t.Fatal("expected the pruned period to have no checkpoint")
+	}
+	if _, err := c.Checkpoint(day.Add(24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package bloomtree
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// errNoChecksums is returned by staleness checks of trees built without WithChunkChecksums.
+var errNoChecksums = errors.New("the tree was built without chunk checksums")
+
+// chunkChecksum returns the xxhash of the words of a chunk.
+func chunkChecksum(words []uint64) uint64 {
+	d := xxhash.New()
+	var b [8]byte
+	for _, w := range words {
+		binary.LittleEndian.PutUint64(b[:], w)
+		d.Write(b[:])
+	}
+	return d.Sum64()
+}
+
+// chunkChecksums returns the checksums of all chunks of the bloom filter words.
+func (bt *BloomTree) chunkChecksums(words []uint64) []uint64 {
+	checksums := make([]uint64, bt.leafCount(words))
+	parallelRange(bt.cfg.workers, 0, len(checksums), func(start, end int) {
+		for i := start; i < end; i++ {
+			checksums[i] = chunkChecksum(bt.leafWords(words, i))
+		}
+	})
+	return checksums
+}
+
+// ChunkChecksums returns a copy of the checksums of the chunks as they were hashed into the tree,
+// or nil if the tree was built without WithChunkChecksums.
+func (bt *BloomTree) ChunkChecksums() []uint64 {
+	return append([]uint64(nil), bt.checksums...)
+}
+
+// StaleChunks returns the indices of the chunks whose bloom filter words changed since they were hashed,
+// e.g. because bits were set on the bloom filter directly instead of through SetBits. Only the checksums
+// are compared, so this is much cheaper than rebuilding the tree.
+func (bt *BloomTree) StaleChunks() ([]uint64, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if bt.checksums == nil {
+		return nil, errNoChecksums
+	}
+	var stale []uint64
+	words := bt.bf.BitArray().Bytes()
+	for i, checksum := range bt.checksums {
+		if chunkChecksum(bt.leafWords(words, i)) != checksum {
+			stale = append(stale, uint64(i))
+		}
+	}
+	return stale, nil
+}
+
+// Refresh rehashes only the stale chunks and their ancestors, and returns the indices of those chunks.
+func (bt *BloomTree) Refresh() ([]uint64, error) {
+	if bt.frozen {
+		return nil, ErrFrozen
+	}
+	if bt.bounds != nil {
+		return nil, errors.New("incremental updates are not supported by adaptive trees")
+	}
+	stale, err := bt.StaleChunks()
+	if err != nil {
+		return nil, err
+	}
+	words := bt.bf.BitArray().Bytes()
+	dirty := make(map[uint64]bool)
+	for _, leaf := range stale {
+		leafWords := bt.leafWords(words, int(leaf))
+		bt.setNode(int(leaf), bt.cfg.leaf(leaf, leafWords...))
+		bt.checksums[leaf] = chunkChecksum(leafWords)
+		dirty[leaf] = true
+	}
+	bt.updateAncestors(dirty)
+	bt.touchProvenance(dirty)
+	if err := bt.nodesErr(); err != nil {
+		return nil, err
+	}
+	return stale, nil
+}
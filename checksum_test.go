@@ -0,0 +1,69 @@
+package bloomtree
+
+import (
+	"testing"
+)
+
+func TestStaleChunks(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithChunkChecksums())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.ChunkChecksums()) != 11 {
+		t.Fatalf("expected 11 checksums, but got %d", len(tree.ChunkChecksums()))
+	}
+	stale, err := tree.StaleChunks()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(stale) != 0 {
+		t.Fatalf("expected no stale chunks, but got %v", stale)
+	}
+
+	// bits set through the tree keep the checksums current
+	if err := tree.SetBits([]uint64{130}); err != nil {
+		t.Fatal(err)
+	}
+	if stale, _ := tree.StaleChunks(); len(stale) != 0 {
+		t.Fatalf("expected no stale chunks after SetBits, but got %v", stale)
+	}
+
+	// bits set on the bloom filter directly make their chunks stale
+	dbf.BitArray().Set(3).Set(70).Set(650)
+	stale, err = tree.StaleChunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 3 || stale[0] != 0 || stale[1] != 1 || stale[2] != 10 {
+		t.Fatalf("expected stale chunks [0 1 10], but got %v", stale)
+	}
+	refreshed, err := tree.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(refreshed) != 3 {
+		t.Fatalf("expected 3 refreshed chunks, but got %v", refreshed)
+	}
+	rebuilt, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != rebuilt.Root() {
+		t.Fatal("refreshed root does not match rebuilt root")
+	}
+	if stale, _ := tree.StaleChunks(); len(stale) != 0 {
+		t.Fatalf("expected no stale chunks after Refresh, but got %v", stale)
+	}
+
+	plain, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.ChunkChecksums() != nil {
+		t.Fatal("expected no checksums without WithChunkChecksums")
+	}
+	if _, err := plain.StaleChunks(); err == nil {
+		t.Fatal("expected error for tree without checksums")
+	}
+}
@@ -0,0 +1,93 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// ChunkRange is an authenticated slice of a bloom filter: the words of the chunks [Start, End)
+// together with the hashes needed to reconstruct the bloom tree root.
+type ChunkRange struct {
+	Start uint64
+	End   uint64
+	// Words are the bloom filter words of every chunk of the range.
+	Words [][]uint64
+	// Proof are the hashes needed to reconstruct the bloom tree root.
+	Proof [][32]byte
+}
+
+// GetChunkRange returns the chunks [start, end) of the bloom filter with a proof against the root,
+// so light clients can download the bloom filter in pieces and verify every piece on its own.
+func (bt *BloomTree) GetChunkRange(start, end uint64) (*ChunkRange, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if bt.bounds != nil {
+		return nil, errors.New("chunk ranges are not supported by adaptive trees")
+	}
+	if bt.cfg.blindingKey != nil {
+		return nil, errors.New("chunk ranges are not supported by blinded trees")
+	}
+	words := bt.bf.BitArray().Bytes()
+	if start >= end || end > uint64(bt.leafCount(words)) {
+		return nil, fmt.Errorf("invalid chunk range [%d, %d)", start, end)
+	}
+	indices := make([]uint64, 0, end-start)
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	proof, err := bt.generateProof(context.Background(), indices)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkRange{
+		Start: start,
+		End:   end,
+		Words: bt.chunkWords(indices),
+		Proof: proof,
+	}, nil
+}
+
+// VerifyChunkRange returns whether the chunk range belongs to the bloom tree with the given root,
+// built from a bloom filter of filterBits bits.
+func VerifyChunkRange(r *ChunkRange, root [32]byte, filterBits uint64, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if r.Start > r.End || uint64(len(r.Words)) != r.End-r.Start {
+		return false, invalidProof(ReasonChunkCount, "the range [%d, %d) has %d chunks", r.Start, r.End, len(r.Words))
+	}
+	for i, words := range r.Words {
+		if n := ChunkWordCount(r.Start+uint64(i), filterBits, cfg.chunkSize); len(words) != n {
+			return false, invalidProof(ReasonChunkCount, "chunk %d has %d words, but %d are expected", r.Start+uint64(i), len(words), n)
+		}
+	}
+	return verifyChunkRange(r.Start, r.End, func(i uint64, n int) []uint64 {
+		return r.Words[i-r.Start]
+	}, r.Proof, root, filterBits, cfg)
+}
+
+// verifyChunkRange verifies that the chunks [start, end) returned by chunkWords, given the chunk index
+// and its number of words, reconstruct the root of a tree built from a bloom filter of filterBits bits.
+func verifyChunkRange(start, end uint64, chunkWords func(i uint64, n int) []uint64, proof [][32]byte, root [32]byte,
+	filterBits uint64, cfg config) (bool, error) {
+	leafs := LeafCountFor(filterBits, cfg.chunkSize)
+	if start >= end || end > leafs {
+		return false, fmt.Errorf("invalid chunk range [%d, %d)", start, end)
+	}
+	var (
+		chunks  [][32]byte
+		indices []uint64
+	)
+	for i := start; i < end; i++ {
+		chunks = append(chunks, cfg.leaf(i, chunkWords(i, ChunkWordCount(i, filterBits, cfg.chunkSize))...))
+		indices = append(indices, i)
+	}
+	treeLeafs := core.LeafNum(int(leafs))
+	multiproof := newCompactMultiProof(chunks, proof, Presence)
+	return verifyProof(cfg, indices, multiproof, root, (treeLeafs*2)-1)
+}
@@ -0,0 +1,73 @@
+package bloomtree
+
+import (
+	"testing"
+)
+
+func TestGetChunkRange(t *testing.T) {
+	SetChunkSize(128)
+	defer SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1}, []byte{2}, []byte{3})
+	tree, err := NewBloomTree(dbf, WithHash(SHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterBits := uint64(dbf.BitArray().Len())
+	words := dbf.BitArray().Bytes()
+	// 11 words are split into 6 chunks, the last one holding a single word
+	var tests = []struct {
+		start, end uint64
+	}{
+		{start: 0, end: 1},
+		{start: 2, end: 5},
+		{start: 4, end: 6},
+		{start: 0, end: 6},
+	}
+
+	for _, test := range tests {
+		r, err := tree.GetChunkRange(test.start, test.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		for _, chunk := range r.Words {
+			got = append(got, chunk...)
+		}
+		end := int(test.end) * 2
+		if end > len(words) {
+			end = len(words)
+		}
+		want := words[test.start*2 : end]
+		if len(got) != len(want) {
+			t.Fatalf("expected %d words in range [%d, %d), but got %d", len(want), test.start, test.end, len(got))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("word %d of range [%d, %d) does not match", i, test.start, test.end)
+			}
+		}
+		verified, err := VerifyChunkRange(r, tree.Root(), filterBits, WithHash(SHA256))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify range [%d, %d)", test.start, test.end)
+		}
+
+		r.Words[0][0] ^= 1
+		if verified, _ := VerifyChunkRange(r, tree.Root(), filterBits, WithHash(SHA256)); verified {
+			t.Fatalf("verified modified range [%d, %d)", test.start, test.end)
+		}
+	}
+
+	if _, err := tree.GetChunkRange(3, 7); err == nil {
+		t.Fatal("expected error for range exceeding the bloom filter")
+	}
+	r, err := tree.GetChunkRange(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Words[1] = r.Words[1][:1]
+	if _, err := VerifyChunkRange(r, tree.Root(), filterBits, WithHash(SHA256)); err == nil {
+		t.Fatal("expected error for a truncated chunk")
+	}
+}
@@ -0,0 +1,589 @@
+// Command bloomtree builds bloom trees, and generates and verifies their proofs from the command line,
+// e.g. for scripts, debugging and conformance tests of verifiers written in other languages.
+//
+// Usage:
+//
+//	bloomtree build -elements file -n n -fpr p -seed s -filter out [-manifest file]
+//	                                                                  build a bloom filter and print the root of its tree
+//	bloomtree root -filter file                                       print the root of the tree of a bloom filter
+//	bloomtree prove -filter file -element e [-wire | -codec name] [-version v]
+//	                                                                  print the proof of an element
+//	bloomtree verify -filter file -seed s -element e -root r -proof file [-codec name]
+//	bloomtree audit -filter file -seed s -element e -proof file [-codec name]
+//	                                                                  print the audit form of a proof
+//	bloomtree audit -compact -proof file                              print the proof of an audit form
+//	bloomtree verify-bundle -bundle file -key k                      verify a verification bundle
+//	bloomtree verify-manifest -filter file -manifest file             rebuild the root recorded by a build manifest
+//	bloomtree bench [-workloads names] [-duration d] [-out file] [-baseline file -tolerance t]
+//	                                                                  run the benchmark corpus
+//
+// Bloom filter files hold the DBF encoding written by build. Elements are given as text, or hex encoded with
+// -hex. Proofs are printed as canonical JSON, or hex encoded in the wire format with -wire; verify accepts
+// both, and reads the proof from standard input if the file is "-". Proofs of other codecs registered with
+// bloomtree.RegisterCodec are printed and read with -codec, hex encoded unless the codec encodes text. Tree
+// options like -chunk-size and -hash must be the same for all commands of a tree. prove -version annotates the
+// chunks of JSON proofs with the given filter version and the build time, which verify reports after the result,
+// warning about proofs mixing chunks of several builds. audit prints the verbose audit form of a proof, listing
+// every node of its hash path, and with -compact converts an audit form back into the canonical JSON proof. bench writes the JSON report of the workloads of the
+// benchmark package, all of them unless -workloads lists their names, and with -baseline prints the regressions
+// from the report of an earlier run and fails if there are any.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/benchmark"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// errInvalid is returned for proofs and bundles that do not verify, so the command exits with status 1.
+var errInvalid = errors.New("invalid")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "bloomtree:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command given by the arguments.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected a command: build, root, prove, verify, audit, verify-bundle, verify-manifest or bench")
+	}
+	cmd := commands[args[0]]
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	c := &command{flags: flags, stdin: stdin, stdout: stdout}
+	flags.StringVar(&c.filter, "filter", "", "bloom filter file")
+	flags.BoolVar(&c.hex, "hex", false, "elements are hex encoded")
+	flags.IntVar(&c.chunkSize, "chunk-size", 0, "chunk size of the tree in bits, 64 if zero")
+	flags.StringVar(&c.hash, "hash", "sha512/256", "hash function of the tree")
+	return cmd(c, args[1:])
+}
+
+var commands = map[string]func(c *command, args []string) error{
+	"build":           (*command).build,
+	"root":            (*command).root,
+	"prove":           (*command).prove,
+	"verify":          (*command).verify,
+	"audit":           (*command).audit,
+	"verify-bundle":   (*command).verifyBundle,
+	"verify-manifest": (*command).verifyManifest,
+	"bench":           (*command).bench,
+}
+
+// command holds the flags shared by all commands.
+type command struct {
+	flags     *flag.FlagSet
+	stdin     io.Reader
+	stdout    io.Writer
+	filter    string
+	hex       bool
+	chunkSize int
+	hash      string
+}
+
+func (c *command) build(args []string) error {
+	elements := c.flags.String("elements", "-", "file with one element per line, - for standard input")
+	n := c.flags.Uint("n", 1000, "expected number of elements")
+	fpr := c.flags.Float64("fpr", 0.01, "false positive rate")
+	seed := c.flags.String("seed", "", "seed of the bloom filter")
+	manifest := c.flags.String("manifest", "", "file the build manifest of the tree is written to")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if c.filter == "" {
+		return errors.New("-filter is required")
+	}
+	r, err := c.open(*elements)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dbf := DBF.NewDbf(*n, *fpr, []byte(*seed))
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		elem, err := c.element(scanner.Text())
+		if err != nil {
+			return err
+		}
+		dbf.Add(elem)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	data, err := dbf.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.filter, data, 0644); err != nil {
+		return err
+	}
+	tree, err := c.tree(dbf)
+	if err != nil {
+		return err
+	}
+	if *manifest != "" {
+		m, err := tree.Manifest()
+		if err != nil {
+			return err
+		}
+		data, err := m.CanonicalJSON()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*manifest, data, 0644); err != nil {
+			return err
+		}
+	}
+	root := tree.Root()
+	_, err = fmt.Fprintln(c.stdout, hex.EncodeToString(root[:]))
+	return err
+}
+
+func (c *command) root(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	dbf, err := c.readFilter()
+	if err != nil {
+		return err
+	}
+	return c.printRoot(dbf)
+}
+
+func (c *command) printRoot(dbf *DBF.DistBF) error {
+	tree, err := c.tree(dbf)
+	if err != nil {
+		return err
+	}
+	root := tree.Root()
+	_, err = fmt.Fprintln(c.stdout, hex.EncodeToString(root[:]))
+	return err
+}
+
+func (c *command) prove(args []string) error {
+	element := c.flags.String("element", "", "element to prove")
+	wire := c.flags.Bool("wire", false, "print the hex encoded wire format instead of JSON, like -codec wire")
+	codecName := c.flags.String("codec", bloomtree.CodecJSON, "name of the codec of the proof")
+	version := c.flags.Uint64("version", 0, "filter version the chunks of the proof are annotated with, none if zero")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if *wire {
+		*codecName = bloomtree.CodecWire
+	}
+	codec, err := bloomtree.LookupCodec(*codecName)
+	if err != nil {
+		return err
+	}
+	dbf, err := c.readFilter()
+	if err != nil {
+		return err
+	}
+	var opts []bloomtree.Option
+	if *version != 0 {
+		opts = append(opts, bloomtree.WithProvenance(*version))
+	}
+	tree, err := c.tree(dbf, opts...)
+	if err != nil {
+		return err
+	}
+	elem, err := c.element(*element)
+	if err != nil {
+		return err
+	}
+	multiproof, err := tree.GenerateCompactMultiProof(elem)
+	if err != nil {
+		return err
+	}
+	data, err := codec.Marshal(multiproof)
+	if err != nil {
+		return err
+	}
+	if !isText(codec) {
+		data = []byte(hex.EncodeToString(data))
+	}
+	_, err = fmt.Fprintln(c.stdout, string(data))
+	return err
+}
+
+func (c *command) verify(args []string) error {
+	element := c.flags.String("element", "", "element of the proof")
+	seed := c.flags.String("seed", "", "seed of the bloom filter")
+	rootHex := c.flags.String("root", "", "hex encoded root")
+	proofFile := c.flags.String("proof", "-", "proof file, - for standard input")
+	codecName := c.flags.String("codec", "", "name of the codec of the proof, JSON or the wire format if empty")
+	m := c.flags.Uint64("m", 0, "number of bits of the bloom filter, instead of -filter")
+	k := c.flags.Uint("k", 0, "number of hash functions of the bloom filter, instead of -filter")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	params := verifier.Params{M: *m, K: *k, ChunkSize: c.chunkSize}
+	var err error
+	if params.Hash, err = bloomtree.ParseHash(c.hash); err != nil {
+		return err
+	}
+	if c.filter != "" {
+		dbf, err := c.readFilter()
+		if err != nil {
+			return err
+		}
+		params.M, params.K = uint64(dbf.BitArray().Len()), dbf.NumOfHashes()
+	}
+	if params.M == 0 || params.K == 0 {
+		return errors.New("either -filter or -m and -k are required")
+	}
+	root, err := decodeRoot(*rootHex)
+	if err != nil {
+		return err
+	}
+	elem, err := c.element(*element)
+	if err != nil {
+		return err
+	}
+	multiproof, err := c.readProof(*proofFile, *codecName)
+	if err != nil {
+		return err
+	}
+	present, err := verifier.Verify(elem, []byte(*seed), multiproof, root, params)
+	if err != nil {
+		fmt.Fprintln(c.stdout, "invalid:", err)
+		return errInvalid
+	}
+	result := "absent"
+	if present {
+		result = "present"
+	}
+	if _, err := fmt.Fprintln(c.stdout, result); err != nil {
+		return err
+	}
+	// the provenance is not covered by the root, it is reported but not verified
+	builds := multiproof.Builds()
+	for _, b := range builds {
+		fmt.Fprintf(c.stdout, "chunks of filter version %d built %s\n", b.Version, b.Built.Format(time.RFC3339))
+	}
+	if len(builds) > 1 {
+		fmt.Fprintf(c.stdout, "warning: the proof mixes chunks of %d builds\n", len(builds))
+	}
+	return nil
+}
+
+func (c *command) audit(args []string) error {
+	element := c.flags.String("element", "", "element of the proof")
+	seed := c.flags.String("seed", "", "seed of the bloom filter")
+	proofFile := c.flags.String("proof", "-", "proof file, - for standard input")
+	codecName := c.flags.String("codec", "", "name of the codec of the proof, JSON or the wire format if empty")
+	compact := c.flags.Bool("compact", false, "convert an audit form back into the proof")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if *compact {
+		data, err := c.readFile(*proofFile)
+		if err != nil {
+			return err
+		}
+		var audit bloomtree.AuditProof
+		if err := json.Unmarshal(data, &audit); err != nil {
+			return fmt.Errorf("decoding audit proof: %w", err)
+		}
+		multiproof, err := audit.Compact()
+		if err != nil {
+			return err
+		}
+		data, err = multiproof.CanonicalJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.stdout, string(data))
+		return err
+	}
+	dbf, err := c.readFilter()
+	if err != nil {
+		return err
+	}
+	opts, err := c.options()
+	if err != nil {
+		return err
+	}
+	elem, err := c.element(*element)
+	if err != nil {
+		return err
+	}
+	multiproof, err := c.readProof(*proofFile, *codecName)
+	if err != nil {
+		return err
+	}
+	audit, err := bloomtree.NewAuditProof(elem, []byte(*seed), multiproof, dbf, opts...)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(audit, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.stdout, string(data))
+	return err
+}
+
+func (c *command) verifyBundle(args []string) error {
+	bundleFile := c.flags.String("bundle", "-", "bundle file, - for standard input")
+	keyHex := c.flags.String("key", "", "hex encoded ed25519 public key of the publisher")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(*keyHex)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("-key must be a hex encoded %d byte public key", ed25519.PublicKeySize)
+	}
+	data, err := c.readFile(*bundleFile)
+	if err != nil {
+		return err
+	}
+	var bundle bloomtree.VerificationBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("decoding bundle: %w", err)
+	}
+	present, err := verifier.VerifyBundle(&bundle, key, nil)
+	if err != nil {
+		fmt.Fprintln(c.stdout, "invalid:", err)
+		return errInvalid
+	}
+	for i, elem := range bundle.Elements {
+		result := "absent"
+		if present[i] {
+			result = "present"
+		}
+		if _, err := fmt.Fprintf(c.stdout, "%s %s\n", hex.EncodeToString(elem), result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *command) verifyManifest(args []string) error {
+	manifestFile := c.flags.String("manifest", "-", "manifest file, - for standard input")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	dbf, err := c.readFilter()
+	if err != nil {
+		return err
+	}
+	data, err := c.readFile(*manifestFile)
+	if err != nil {
+		return err
+	}
+	var manifest bloomtree.BuildManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("decoding manifest: %w", err)
+	}
+	if err := bloomtree.VerifyManifest(&manifest, dbf); err != nil {
+		fmt.Fprintln(c.stdout, "invalid:", err)
+		return errInvalid
+	}
+	_, err = fmt.Fprintln(c.stdout, hex.EncodeToString(manifest.Root[:]))
+	return err
+}
+
+func (c *command) bench(args []string) error {
+	names := c.flags.String("workloads", "", "comma separated names of the workloads to run, all if empty")
+	duration := c.flags.Duration("duration", time.Second, "minimum duration of every operation")
+	out := c.flags.String("out", "", "file the report is written to, standard output if empty")
+	baseline := c.flags.String("baseline", "", "report of an earlier run to compare with")
+	tolerance := c.flags.Float64("tolerance", 0.1, "fraction an operation may get worse than the baseline")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if *baseline != "" && *out == "" {
+		return errors.New("-baseline needs -out")
+	}
+	workloads := benchmark.Corpus()
+	if *names != "" {
+		byName := make(map[string]benchmark.Workload)
+		for _, w := range workloads {
+			byName[w.Name] = w
+		}
+		workloads = nil
+		for _, name := range strings.Split(*names, ",") {
+			w, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("unknown workload %q", name)
+			}
+			workloads = append(workloads, w)
+		}
+	}
+	report, err := benchmark.Run(workloads, *duration)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return report.WriteJSON(c.stdout)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if *baseline == "" {
+		return nil
+	}
+	data, err := c.readFile(*baseline)
+	if err != nil {
+		return err
+	}
+	base, err := benchmark.ReadReport(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decoding baseline: %w", err)
+	}
+	regressions := benchmark.Compare(base, report, *tolerance)
+	for _, r := range regressions {
+		fmt.Fprintln(c.stdout, "regression:", r)
+	}
+	if len(regressions) > 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// tree builds the tree of the bloom filter with the tree options of the flags.
+func (c *command) tree(dbf *DBF.DistBF, extra ...bloomtree.Option) (*bloomtree.BloomTree, error) {
+	opts, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	return bloomtree.NewBloomTree(dbf, append(opts, extra...)...)
+}
+
+// options returns the tree options set by the shared flags.
+func (c *command) options() ([]bloomtree.Option, error) {
+	hash, err := bloomtree.ParseHash(c.hash)
+	if err != nil {
+		return nil, err
+	}
+	opts := []bloomtree.Option{bloomtree.WithHash(hash)}
+	if c.chunkSize != 0 {
+		opts = append(opts, bloomtree.WithChunkSize(c.chunkSize))
+	}
+	return opts, nil
+}
+
+func (c *command) readFilter() (*DBF.DistBF, error) {
+	if c.filter == "" {
+		return nil, errors.New("-filter is required")
+	}
+	data, err := ioutil.ReadFile(c.filter)
+	if err != nil {
+		return nil, err
+	}
+	dbf, err := DBF.UnmarshalBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding bloom filter %s: %w", c.filter, err)
+	}
+	return dbf, nil
+}
+
+// readProof reads a proof encoded with the named codec, or in canonical JSON or the hex encoded wire format
+// if the name is empty.
+func (c *command) readProof(name, codecName string) (*bloomtree.CompactMultiProof, error) {
+	data, err := c.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if codecName != "" {
+		codec, err := bloomtree.LookupCodec(codecName)
+		if err != nil {
+			return nil, err
+		}
+		if !isText(codec) {
+			if data, err = hex.DecodeString(string(data)); err != nil {
+				return nil, fmt.Errorf("decoding proof: %w", err)
+			}
+		}
+		multiproof, err := codec.Unmarshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s proof: %w", codecName, err)
+		}
+		return multiproof, nil
+	}
+	if bytes.HasPrefix(data, []byte("{")) {
+		var multiproof bloomtree.CompactMultiProof
+		if err := json.Unmarshal(data, &multiproof); err != nil {
+			return nil, fmt.Errorf("decoding proof: %w", err)
+		}
+		return &multiproof, nil
+	}
+	wire, err := hex.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding proof: %w", err)
+	}
+	return bloomtree.DecodeCompactMultiProof(wire)
+}
+
+// isText returns whether the codec encodes proofs as text, which is printed as is instead of hex encoded.
+func isText(codec bloomtree.Codec) bool {
+	contentType := codec.ContentType()
+	return strings.HasPrefix(contentType, "text/") || contentType == "application/json"
+}
+
+// open opens the named file, or standard input for "-".
+func (c *command) open(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(c.stdin), nil
+	}
+	return os.Open(name)
+}
+
+func (c *command) readFile(name string) ([]byte, error) {
+	r, err := c.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// element decodes an element given on the command line or in an elements file.
+func (c *command) element(s string) ([]byte, error) {
+	if !c.hex {
+		return []byte(s), nil
+	}
+	elem, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decoding element %q: %w", s, err)
+	}
+	return elem, nil
+}
+
+func decodeRoot(s string) ([32]byte, error) {
+	var root [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(root) {
+		return root, errors.New("-root must be a hex encoded 32 byte root")
+	}
+	copy(root[:], b)
+	return root, nil
+}
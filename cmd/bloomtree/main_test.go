@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labbloom/bloom-tree/benchmark"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filter := filepath.Join(dir, "filter")
+
+	manifest := filepath.Join(dir, "manifest.json")
+
+	var out bytes.Buffer
+	args := []string{"build", "-filter", filter, "-seed", "s", "-manifest", manifest}
+	if err := run(args, strings.NewReader("foo\nbar\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	root := strings.TrimSpace(out.String())
+	if len(root) != 64 {
+		t.Fatalf("expected a hex encoded root, got %q", root)
+	}
+	out.Reset()
+	if err := run([]string{"verify-manifest", "-filter", filter, "-manifest", manifest}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != root {
+		t.Fatalf("expected the manifest to reproduce root %s, got %s", root, out.String())
+	}
+	other := filepath.Join(dir, "other")
+	if err := run([]string{"build", "-filter", other, "-seed", "s"}, strings.NewReader("baz\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"verify-manifest", "-filter", other, "-manifest", manifest}, nil, &out); err != errInvalid {
+		t.Fatalf("expected %v for the manifest of another filter, got %v", errInvalid, err)
+	}
+	out.Reset()
+	if err := run([]string{"root", "-filter", filter}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != root {
+		t.Fatalf("expected root %s, got %s", root, out.String())
+	}
+
+	tests := []struct {
+		element string
+		prove   []string
+		expect  string
+	}{
+		{"foo", nil, "present"},
+		{"bar", []string{"-wire"}, "present"},
+		{"baz", nil, "absent"},
+		{"baz", []string{"-wire"}, "absent"},
+		{"foo", []string{"-codec", "wire"}, "present"},
+		{"baz", []string{"-codec", "json"}, "absent"},
+	}
+	for _, test := range tests {
+		var proof bytes.Buffer
+		args := append([]string{"prove", "-filter", filter, "-element", test.element}, test.prove...)
+		if err := run(args, nil, &proof); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		args = []string{"verify", "-filter", filter, "-seed", "s", "-element", test.element, "-root", root}
+		if len(test.prove) == 2 {
+			args = append(args, test.prove...)
+		}
+		if err := run(args, &proof, &out); err != nil {
+			t.Fatalf("element %s: %v", test.element, err)
+		}
+		if strings.TrimSpace(out.String()) != test.expect {
+			t.Fatalf("element %s: expected %s, got %s", test.element, test.expect, out.String())
+		}
+	}
+
+	var proof bytes.Buffer
+	if err := run([]string{"prove", "-filter", filter, "-element", "foo"}, nil, &proof); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	args = []string{"verify", "-filter", filter, "-seed", "s", "-element", "baz", "-root", root}
+	if err := run(args, &proof, &out); err != errInvalid {
+		t.Fatalf("expected %v for the proof of another element, got %v", errInvalid, err)
+	}
+	if err := run([]string{"prove", "-filter", filter, "-element", "foo", "-chunk-size", "100"}, nil, &out); err == nil {
+		t.Fatal("expected an error for an invalid chunk size")
+	}
+	if err := run([]string{"prove", "-filter", filter, "-element", "foo", "-codec", "unknown"}, nil, &out); err == nil {
+		t.Fatal("expected an error for an unknown codec")
+	}
+	if err := run([]string{"unknown"}, nil, &out); err == nil {
+		t.Fatal("expected an error for an unknown command")
+	}
+}
+
+func TestRunProvenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filter := filepath.Join(dir, "filter")
+	var out bytes.Buffer
+	if err := run([]string{"build", "-filter", filter, "-seed", "s"}, strings.NewReader("foo\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	root := strings.TrimSpace(out.String())
+
+	var proof bytes.Buffer
+	if err := run([]string{"prove", "-filter", filter, "-element", "foo", "-version", "7"}, nil, &proof); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	args := []string{"verify", "-filter", filter, "-seed", "s", "-element", "foo", "-root", root}
+	if err := run(args, &proof, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || lines[0] != "present" || !strings.HasPrefix(lines[1], "chunks of filter version 7 built ") {
+		t.Fatalf("expected the result and the build of the chunks, got %q", out.String())
+	}
+}
+
+func TestRunAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filter := filepath.Join(dir, "filter")
+	var out bytes.Buffer
+	if err := run([]string{"build", "-filter", filter, "-seed", "s"}, strings.NewReader("foo\nbar\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	root := strings.TrimSpace(out.String())
+
+	var proof bytes.Buffer
+	if err := run([]string{"prove", "-filter", filter, "-element", "foo"}, nil, &proof); err != nil {
+		t.Fatal(err)
+	}
+	var audit bytes.Buffer
+	if err := run([]string{"audit", "-filter", filter, "-seed", "s", "-element", "foo"}, bytes.NewReader(proof.Bytes()), &audit); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(audit.String(), `"root": "`+root+`"`) || !strings.Contains(audit.String(), `"source": "proof"`) {
+		t.Fatalf("expected the audit form to list the path up to the root, got %s", audit.String())
+	}
+	out.Reset()
+	if err := run([]string{"audit", "-compact"}, &audit, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != proof.String() {
+		t.Fatalf("expected the proof %s after converting the audit form back, got %s", proof.String(), out.String())
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	report := filepath.Join(dir, "report.json")
+	var out bytes.Buffer
+	args := []string{"bench", "-workloads", "small-sparse", "-duration", "1ms", "-out", report}
+	if err := run(args, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"workload": "small-sparse"`) {
+		t.Fatalf("expected the results of the workload in the report, got %s", data)
+	}
+
+	// a baseline ten times as fast is a regression
+	base, err := benchmark.ReadReport(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range base.Results {
+		base.Results[i].NsPerOp /= 10
+	}
+	var buf bytes.Buffer
+	if err := base.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(dir, "baseline.json")
+	if err := ioutil.WriteFile(baseline, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run(append(args, "-baseline", baseline), nil, &out); err != errInvalid {
+		t.Fatalf("expected errInvalid for a regression, got %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "regression: small-sparse/") {
+		t.Fatalf("expected the regressions, got %q", out.String())
+	}
+	if err := run([]string{"bench", "-workloads", "unknown"}, nil, &out); err == nil {
+		t.Fatal("expected an error for an unknown workload")
+	}
+}
@@ -0,0 +1,113 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Names of the built-in codecs.
+const (
+	// CodecJSON encodes proofs as canonical JSON.
+	CodecJSON = "json"
+	// CodecWire encodes proofs in the binary wire format of CompactMultiProof.Encode.
+	CodecWire = "wire"
+)
+
+// Codec encodes proofs for transport, e.g. by the server, its client and the command line tool, which look
+// codecs up by name. Custom encodings are plugged in with RegisterCodec. A codec must be safe for concurrent use.
+type Codec interface {
+	// ContentType returns the media type of the encoded proofs, e.g. "application/json".
+	ContentType() string
+	// Marshal encodes the proof.
+	Marshal(proof *CompactMultiProof) ([]byte, error)
+	// Unmarshal decodes a proof encoded by Marshal.
+	Unmarshal(data []byte) (*CompactMultiProof, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{byName: map[string]Codec{
+	CodecJSON: jsonCodec{},
+	CodecWire: wireCodec{},
+}}
+
+// RegisterCodec makes the codec available under the name, usually from the init function of the package
+// implementing it. Names are unique, the built-in codecs cannot be replaced.
+func RegisterCodec(name string, codec Codec) error {
+	if name == "" {
+		return errors.New("the codec needs a name")
+	}
+	if codec == nil {
+		return fmt.Errorf("the codec %q is nil", name)
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.byName[name]; ok {
+		return fmt.Errorf("the codec %q is already registered", name)
+	}
+	codecs.byName[name] = codec
+	return nil
+}
+
+// LookupCodec returns the codec registered under the name. An error wrapping ErrUnknownCodec is returned
+// if there is none.
+func LookupCodec(name string) (Codec, error) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
+
+// Codecs returns the names of the registered codecs in ascending order.
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	names := make([]string, 0, len(codecs.byName))
+	for name := range codecs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(proof *CompactMultiProof) ([]byte, error) {
+	return proof.CanonicalJSON()
+}
+
+func (jsonCodec) Unmarshal(data []byte) (*CompactMultiProof, error) {
+	var proof CompactMultiProof
+	if err := json.Unmarshal(data, &proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+type wireCodec struct{}
+
+func (wireCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+func (wireCodec) Marshal(proof *CompactMultiProof) ([]byte, error) {
+	if err := proof.checkBinary(); err != nil {
+		return nil, err
+	}
+	return proof.Encode(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte) (*CompactMultiProof, error) {
+	return DecodeCompactMultiProof(data)
+}
@@ -0,0 +1,89 @@
+package bloomtree
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// reversedCodec is a custom codec writing the wire format backwards.
+type reversedCodec struct{}
+
+func (reversedCodec) ContentType() string {
+	return "application/x-reversed"
+}
+
+func (reversedCodec) Marshal(proof *CompactMultiProof) ([]byte, error) {
+	return reverse(proof.Encode()), nil
+}
+
+func (reversedCodec) Unmarshal(data []byte) (*CompactMultiProof, error) {
+	return DecodeCompactMultiProof(reverse(append([]byte(nil), data...)))
+}
+
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+func TestCodecs(t *testing.T) {
+	SetChunkSize(64)
+	tree, err := NewBloomTree(generateDBF(200, "secret seed", []byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the registry is global, so repeated runs find the codec registered
+	if _, err := LookupCodec("reversed"); err != nil {
+		if err := RegisterCodec("reversed", reversedCodec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{CodecJSON, CodecWire, "reversed"} {
+		codec, err := LookupCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := codec.Marshal(proof)
+		if err != nil {
+			t.Fatalf("codec %s: %v", name, err)
+		}
+		decoded, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("codec %s: %v", name, err)
+		}
+		if !reflect.DeepEqual(decoded, proof) {
+			t.Fatalf("codec %s: expected %+v, but got %+v", name, proof, decoded)
+		}
+	}
+	if names := Codecs(); !reflect.DeepEqual(names, []string{CodecJSON, "reversed", CodecWire}) {
+		t.Fatalf("unexpected codecs %v", names)
+	}
+
+	var tests = []struct {
+		name  string
+		codec Codec
+	}{
+		{name: "", codec: reversedCodec{}},
+		{name: "nil", codec: nil},
+		{name: CodecJSON, codec: reversedCodec{}},
+		{name: "reversed", codec: reversedCodec{}},
+	}
+	for _, test := range tests {
+		if err := RegisterCodec(test.name, test.codec); err == nil {
+			t.Fatalf("expected error registering codec %q", test.name)
+		}
+	}
+	if _, err := LookupCodec("unknown"); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("expected %v, but got %v", ErrUnknownCodec, err)
+	}
+	if _, err := (wireCodec{}).Marshal(&CompactMultiProof{ChunkSize: -1}); err == nil {
+		t.Fatal("expected error for a proof the wire format cannot hold")
+	}
+}
@@ -0,0 +1,50 @@
+package bloomtree
+
+import (
+	"fmt"
+)
+
+// WithSeed sets the seed of the bloom filter, which CommittedRoot binds together with the other parameters.
+// Only a commitment to the seed is part of the committed root. Without it, the committed root binds the empty
+// seed. Verifiers pass the seed to VerifyCommittedProof instead.
+func WithSeed(seed []byte) Option {
+	return func(c *config) error {
+		c.seed = append([]byte(nil), seed...)
+		return nil
+	}
+}
+
+// CommittedRoot returns the root of the tree bound to the number of bits and hash functions of its bloom filter,
+// the seed set with WithSeed, the chunk size and the hash function. Unlike the plain root, a committed root
+// cannot be combined with proofs of a tree built with other parameters, so it should be preferred when roots
+// are published to verifiers of other systems.
+func (bt *BloomTree) CommittedRoot() [32]byte {
+	return bt.Attestation().CommittedRoot(bt.cfg.seed)
+}
+
+// CommittedRoot returns the root of the attestation bound to its parameters and the seed of the bloom filter.
+func (a RootAttestation) CommittedRoot(seed []byte) [32]byte {
+	return a.Hash.committedRoot(a.Root, a.FilterBits, a.NumOfHashes, a.Hash.seedCommitment(seed), a.ChunkSize)
+}
+
+// VerifyCommittedProof verifies the proof against the plain root like VerifyCompactMultiProof, after checking
+// that the root together with the parameters of the bloom filter, the seed and the options matches the committed
+// root. An error wrapping ErrCommittedRootMismatch is returned if it does not.
+func VerifyCommittedProof(element, seedValue []byte, multiproof *CompactMultiProof, root, committedRoot [32]byte,
+	bf BloomFilter, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	attestation := RootAttestation{
+		Root:        root,
+		ChunkSize:   uint64(cfg.chunkSize),
+		Hash:        cfg.hash,
+		NumOfHashes: uint64(bf.NumOfHashes()),
+		FilterBits:  uint64(bf.BitArray().Len()),
+	}
+	if attestation.CommittedRoot(seedValue) != committedRoot {
+		return false, fmt.Errorf("%w %x", ErrCommittedRootMismatch, committedRoot)
+	}
+	return VerifyCompactMultiProof(element, seedValue, multiproof, root, bf, opts...)
+}
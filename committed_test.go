@@ -0,0 +1,62 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommittedRoot(t *testing.T) {
+	SetChunkSize(64)
+	seed := []byte("secret seed")
+	dbf := generateDBF(200, string(seed), []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed := tree.CommittedRoot()
+	if committed == tree.Root() {
+		t.Fatal("expected the committed root to differ from the plain root")
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyCommittedProof([]byte{1}, seed, multiproof, tree.Root(), committed, dbf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify the proof against the committed root")
+	}
+
+	// every parameter is bound by the committed root
+	a := tree.Attestation()
+	var tests = []struct {
+		name   string
+		change func(a *RootAttestation) []byte
+	}{
+		{name: "root", change: func(a *RootAttestation) []byte { a.Root[0] ^= 1; return seed }},
+		{name: "chunk size", change: func(a *RootAttestation) []byte { a.ChunkSize = 128; return seed }},
+		{name: "hash", change: func(a *RootAttestation) []byte { a.Hash = SHA256; return seed }},
+		{name: "k", change: func(a *RootAttestation) []byte { a.NumOfHashes++; return seed }},
+		{name: "m", change: func(a *RootAttestation) []byte { a.FilterBits++; return seed }},
+		{name: "seed", change: func(a *RootAttestation) []byte { return []byte("other seed") }},
+	}
+	for _, test := range tests {
+		changed := a
+		if changed.CommittedRoot(test.change(&changed)) == committed {
+			t.Fatalf("the committed root does not bind the %s", test.name)
+		}
+	}
+
+	// verifiers with other parameters reject the committed root
+	if _, err := VerifyCommittedProof([]byte{1}, seed, multiproof, tree.Root(), committed, dbf, WithChunkSize(128)); !errors.Is(err, ErrCommittedRootMismatch) {
+		t.Fatalf("expected ErrCommittedRootMismatch for another chunk size, but got %v", err)
+	}
+	if _, err := VerifyCommittedProof([]byte{1}, []byte("other seed"), multiproof, tree.Root(), committed, dbf); !errors.Is(err, ErrCommittedRootMismatch) {
+		t.Fatalf("expected ErrCommittedRootMismatch for another seed, but got %v", err)
+	}
+	other := generateDBF(300, string(seed), []byte{1}, []byte{2})
+	if _, err := VerifyCommittedProof([]byte{1}, seed, multiproof, tree.Root(), committed, other); !errors.Is(err, ErrCommittedRootMismatch) {
+		t.Fatalf("expected ErrCommittedRootMismatch for another bloom filter, but got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package conformance checks verifiers written outside of this module against proofs generated by bloomtree.
+// It generates test cases for every feature an independent verifier has to get right, runs them through a
+// pluggable Verifier, and reports the cases where its verdict differs from the reference implementation.
+package conformance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// Feature is the part of the proof format exercised by a case.
+type Feature string
+
+const (
+	// FeatureHash covers leaf and child hashing.
+	FeatureHash Feature = "hash"
+	// FeatureEncoding covers the canonical JSON encoding, duplicate chunks and the proof type.
+	FeatureEncoding Feature = "encoding"
+	// FeatureOrdering covers the order of chunks and sibling hashes.
+	FeatureOrdering Feature = "ordering"
+)
+
+// Case is a single proof to verify. It is sent to subprocess verifiers as JSON.
+type Case struct {
+	Name    string  `json:"name"`
+	Feature Feature `json:"feature"`
+	// Element is the hex encoded element the proof is about.
+	Element string `json:"element"`
+	// Indices are the bloom filter indices of the element, in the order of the hash functions.
+	Indices []uint64 `json:"indices"`
+	// Filter are the words of the bloom filter, hex encoded as 16 digit big endian numbers.
+	Filter     []string `json:"filter"`
+	FilterBits uint64   `json:"filterBits"`
+	ChunkSize  int      `json:"chunkSize"`
+	// Root is the hex encoded root of the bloom tree.
+	Root string `json:"root"`
+	// Proof is the canonical JSON form of the compact multiproof.
+	Proof json.RawMessage `json:"proof"`
+	// Expected is the verdict of the reference verifier.
+	Expected bool `json:"expected"`
+
+	multiproof *bloomtree.CompactMultiProof
+	bf         bloomtree.BloomFilter
+	seed       []byte
+	element    []byte
+	root       [32]byte
+}
+
+// Result is the outcome of running a case through a verifier.
+type Result struct {
+	Case  Case
+	Valid bool
+	Err   error
+}
+
+// Compatible returns whether the verifier agreed with the reference verifier.
+// An error counts as rejecting the proof.
+func (r Result) Compatible() bool {
+	return r.Valid == r.Case.Expected && (r.Err == nil || !r.Case.Expected)
+}
+
+// Report holds the results of a conformance run.
+type Report struct {
+	Results []Result
+}
+
+// Compatible returns whether the verifier agreed with the reference verifier on every case.
+func (r *Report) Compatible() bool {
+	return len(r.Incompatibilities()) == 0
+}
+
+// Incompatibilities returns the results that differ from the reference verifier, grouped by feature.
+func (r *Report) Incompatibilities() map[Feature][]Result {
+	ret := make(map[Feature][]Result)
+	for _, res := range r.Results {
+		if !res.Compatible() {
+			ret[res.Case.Feature] = append(ret[res.Case.Feature], res)
+		}
+	}
+	return ret
+}
+
+// Run generates the conformance cases and verifies each of them with v.
+func Run(v Verifier) (*Report, error) {
+	cases, err := Cases()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	for _, c := range cases {
+		valid, err := v.Verify(c)
+		report.Results = append(report.Results, Result{Case: c, Valid: valid && err == nil, Err: err})
+	}
+	return report, nil
+}
+
+// mutation derives a case from a generated proof.
+type mutation struct {
+	name    string
+	feature Feature
+	present bool
+	apply   func(p *bloomtree.CompactMultiProof)
+}
+
+var mutations = []mutation{
+	{name: "presence proof", feature: FeatureHash, present: true},
+	{name: "absence proof", feature: FeatureHash},
+	{name: "presence proof with tampered chunk", feature: FeatureHash, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		p.Chunks[0][0] ^= 1
+	}},
+	{name: "presence proof with tampered sibling", feature: FeatureHash, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		if len(p.Proof) != 0 {
+			p.Proof[len(p.Proof)-1][31] ^= 1
+		}
+	}},
+	{name: "absence proof with tampered chunk", feature: FeatureHash, apply: func(p *bloomtree.CompactMultiProof) {
+		p.Chunks[0][31] ^= 1
+	}},
+	{name: "presence proof with duplicate chunks", feature: FeatureEncoding, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		p.Chunks = append(p.Chunks, p.Chunks[len(p.Chunks)-1])
+	}},
+	{name: "presence proof typed as absence", feature: FeatureEncoding, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		p.ProofType = bloomtree.Absence(0)
+	}},
+	{name: "absence proof typed as presence", feature: FeatureEncoding, apply: func(p *bloomtree.CompactMultiProof) {
+		p.ProofType = bloomtree.Presence
+	}},
+	{name: "presence proof with reversed chunks", feature: FeatureOrdering, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		for i, j := 0, len(p.Chunks)-1; i < j; i, j = i+1, j-1 {
+			p.Chunks[i], p.Chunks[j] = p.Chunks[j], p.Chunks[i]
+		}
+	}},
+	{name: "presence proof with reversed siblings", feature: FeatureOrdering, present: true, apply: func(p *bloomtree.CompactMultiProof) {
+		for i, j := 0, len(p.Proof)-1; i < j; i, j = i+1, j-1 {
+			p.Proof[i], p.Proof[j] = p.Proof[j], p.Proof[i]
+		}
+	}},
+}
+
+// Cases returns the conformance cases, generated from fixed bloom filters with the current chunk size.
+// The expected verdict of every case is computed with bloomtree.VerifyCompactMultiProof.
+func Cases() ([]Case, error) {
+	seed := []byte("conformance seed")
+	var cases []Case
+	for _, n := range []uint{20, 200, 1000} {
+		dbf := DBF.NewDbf(n, 0.1, seed)
+		for i := uint(0); i < n/2; i++ {
+			dbf.Add([]byte(fmt.Sprintf("member %d", i)))
+		}
+		tree, err := bloomtree.NewBloomTree(dbf)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mutations {
+			element := []byte(fmt.Sprintf("member %d", n/4))
+			if !m.present {
+				element, err = absentElement(dbf)
+				if err != nil {
+					return nil, err
+				}
+			}
+			multiproof, err := tree.GenerateCompactMultiProof(element)
+			if err != nil {
+				return nil, err
+			}
+			if m.apply != nil {
+				m.apply(multiproof)
+			}
+			c, err := newCase(fmt.Sprintf("%s (n=%d)", m.name, n), m.feature, element, seed, multiproof, tree.Attestation(), dbf)
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
+
+func absentElement(dbf *DBF.DistBF) ([]byte, error) {
+	for i := 0; i < 1000; i++ {
+		element := []byte(fmt.Sprintf("non-member %d", i))
+		if !dbf.VerifyElement(element) {
+			return element, nil
+		}
+	}
+	return nil, fmt.Errorf("no absent element found")
+}
+
+func newCase(name string, feature Feature, element, seed []byte, multiproof *bloomtree.CompactMultiProof,
+	att bloomtree.RootAttestation, bf bloomtree.BloomFilter) (Case, error) {
+	proof, err := multiproof.CanonicalJSON()
+	if err != nil {
+		return Case{}, err
+	}
+	words := bf.BitArray().Bytes()
+	filter := make([]string, len(words))
+	for i, w := range words {
+		filter[i] = fmt.Sprintf("%016x", w)
+	}
+	var indices []uint64
+	for _, v := range bf.MapElementToBF(element, seed) {
+		indices = append(indices, uint64(v))
+	}
+	expected, err := bloomtree.VerifyCompactMultiProof(element, seed, multiproof, att.Root, bf)
+	return Case{
+		Name:       name,
+		Feature:    feature,
+		Element:    hex.EncodeToString(element),
+		Indices:    indices,
+		Filter:     filter,
+		FilterBits: att.FilterBits,
+		ChunkSize:  int(att.ChunkSize),
+		Root:       hex.EncodeToString(att.Root[:]),
+		Proof:      proof,
+		Expected:   expected && err == nil,
+		multiproof: multiproof,
+		bf:         bf,
+		seed:       seed,
+		element:    element,
+		root:       att.Root,
+	}, nil
+}
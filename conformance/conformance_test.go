@@ -0,0 +1,85 @@
+package conformance
+
+import (
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+var referenceVerifier = VerifierFunc(func(c Case) (bool, error) {
+	return bloomtree.VerifyCompactMultiProof(c.element, c.seed, c.multiproof, c.root, c.bf)
+})
+
+func TestCases(t *testing.T) {
+	cases, err := Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(map[Feature]int)
+	rejected := make(map[Feature]int)
+	for _, c := range cases {
+		if c.Expected {
+			accepted[c.Feature]++
+		} else {
+			rejected[c.Feature]++
+		}
+		if len(c.Indices) == 0 || len(c.Filter) == 0 || len(c.Proof) == 0 {
+			t.Fatalf("incomplete case %s", c.Name)
+		}
+	}
+	for _, feature := range []Feature{FeatureHash, FeatureEncoding, FeatureOrdering} {
+		if accepted[feature] == 0 || rejected[feature] == 0 {
+			t.Fatalf("feature %s needs accepted and rejected cases, got %d and %d", feature, accepted[feature], rejected[feature])
+		}
+	}
+}
+
+func TestRunReferenceVerifier(t *testing.T) {
+	report, err := Run(referenceVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Compatible() {
+		t.Fatalf("reference verifier is incompatible: %v", report.Incompatibilities())
+	}
+}
+
+func TestRunIncompatibleVerifier(t *testing.T) {
+	var tests = []struct {
+		verifier     Verifier
+		incompatible []Feature
+	}{
+		{
+			verifier: VerifierFunc(func(c Case) (bool, error) {
+				return true, nil
+			}),
+			incompatible: []Feature{FeatureHash, FeatureEncoding, FeatureOrdering},
+		},
+		{
+			// a verifier ignoring the order of the siblings
+			verifier: VerifierFunc(func(c Case) (bool, error) {
+				if c.Feature == FeatureOrdering {
+					return true, nil
+				}
+				return referenceVerifier(c)
+			}),
+			incompatible: []Feature{FeatureOrdering},
+		},
+	}
+
+	for _, test := range tests {
+		report, err := Run(test.verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		incompatibilities := report.Incompatibilities()
+		if len(incompatibilities) != len(test.incompatible) {
+			t.Fatalf("expected incompatibilities in %v, but got %v", test.incompatible, incompatibilities)
+		}
+		for _, feature := range test.incompatible {
+			if len(incompatibilities[feature]) == 0 {
+				t.Fatalf("expected incompatibility in feature %s", feature)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// Verifier verifies the proof of a conformance case.
+type Verifier interface {
+	Verify(c Case) (bool, error)
+}
+
+// VerifierFunc adapts a function to the Verifier interface.
+type VerifierFunc func(c Case) (bool, error)
+
+// Verify calls f(c).
+func (f VerifierFunc) Verify(c Case) (bool, error) {
+	return f(c)
+}
+
+// Subprocess runs an external verifier program once per case. The case is written to its standard input as JSON,
+// and the program must write a JSON object {"valid": bool} or {"error": string} to its standard output.
+type Subprocess struct {
+	Path string
+	Args []string
+	// Env is the environment of the program. If nil, the program inherits the current environment.
+	Env []string
+}
+
+type subprocessResult struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+// Verify runs the program for the given case.
+func (s *Subprocess) Verify(c Case) (bool, error) {
+	input, err := json.Marshal(c)
+	if err != nil {
+		return false, err
+	}
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Env = s.Env
+	cmd.Stdin = bytes.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("running verifier %s: %w", s.Path, err)
+	}
+	var res subprocessResult
+	if err := json.Unmarshal(output, &res); err != nil {
+		return false, fmt.Errorf("decoding verifier output %q: %w", output, err)
+	}
+	if res.Error != "" {
+		return false, fmt.Errorf("verifier: %s", res.Error)
+	}
+	return res.Valid, nil
+}
@@ -0,0 +1,61 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestHelperProcess is run as the external verifier by TestSubprocess.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("CONFORMANCE_HELPER")
+	if mode == "" {
+		return
+	}
+	var c Case
+	if err := json.NewDecoder(os.Stdin).Decode(&c); err != nil {
+		fmt.Printf(`{"error": %q}`, err.Error())
+		os.Exit(0)
+	}
+	switch mode {
+	case "expected":
+		fmt.Printf(`{"valid": %t}`, c.Expected)
+	case "error":
+		fmt.Print(`{"error": "unsupported proof"}`)
+	default:
+		fmt.Print("garbage")
+	}
+	os.Exit(0)
+}
+
+func TestSubprocess(t *testing.T) {
+	var tests = []struct {
+		mode       string
+		compatible bool
+	}{
+		{mode: "expected", compatible: true},
+		{mode: "error", compatible: false},
+		{mode: "garbage", compatible: false},
+	}
+
+	for _, test := range tests {
+		verifier := &Subprocess{
+			Path: os.Args[0],
+			Args: []string{"-test.run=TestHelperProcess"},
+			Env:  append(os.Environ(), "CONFORMANCE_HELPER="+test.mode),
+		}
+		report, err := Run(verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Compatible() != test.compatible {
+			t.Fatalf("expected compatibility %t for mode %s, got incompatibilities %v", test.compatible, test.mode, report.Incompatibilities())
+		}
+		for _, res := range report.Results {
+			if test.mode != "expected" && res.Err == nil {
+				t.Fatalf("expected error for mode %s", test.mode)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+pragma solidity ^0.8.0;
+
+/// @title BloomTreeVerifier
+/// @notice Reference verifier of the EVM proofs of bloom trees built with bloomtree.WithEVM.
+/// It mirrors bloomtree.VerifyEVMProof, which is the Go implementation used for testing.
+library BloomTreeVerifier {
+    /// @notice A chunk of the bloom filter together with its path to the root.
+    struct Chunk {
+        // index is the leaf index of the chunk.
+        uint256 index;
+        // data are the bits of the chunk, bit i of the chunk being bit i % 256 of data[i / 256].
+        uint256[] data;
+        // siblings are the sibling hashes on the path from the leaf to the root.
+        bytes32[] siblings;
+    }
+
+    /// @notice Returns the leaf hash of a chunk.
+    function leaf(uint256 index, uint256[] memory data) internal pure returns (bytes32) {
+        return keccak256(abi.encodePacked(uint8(0), index, data));
+    }
+
+    /// @notice Verifies the chunks against the root of a tree with the given chunk size, and returns whether
+    /// the proof shows the presence or the absence of the element with the given bloom filter indices.
+    /// The indices are trusted to be the indices of the element, they are sorted in increasing order, and
+    /// the chunks are sorted by their index. Reverts if the proof is invalid.
+    function verify(
+        bytes32 root,
+        uint256 chunkSize,
+        bool present,
+        uint256[] memory indices,
+        Chunk[] memory chunks
+    ) internal pure returns (bool) {
+        require(chunkSize != 0 && chunkSize % 64 == 0, "invalid chunk size");
+        require(indices.length != 0, "no indices");
+        require(present || indices.length == 1, "an absence proof must have a single index");
+        for (uint256 i = 0; i < chunks.length; i++) {
+            bytes32 node = leaf(chunks[i].index, chunks[i].data);
+            uint256 position = chunks[i].index;
+            for (uint256 j = 0; j < chunks[i].siblings.length; j++) {
+                if (position & 1 == 0) {
+                    node = keccak256(abi.encodePacked(node, chunks[i].siblings[j]));
+                } else {
+                    node = keccak256(abi.encodePacked(chunks[i].siblings[j], node));
+                }
+                position >>= 1;
+            }
+            require(position == 0 && node == root, "chunk does not match the root");
+        }
+        uint256 c = 0;
+        for (uint256 i = 0; i < indices.length; i++) {
+            uint256 index = indices[i] / chunkSize;
+            while (c < chunks.length && chunks[c].index < index) {
+                c++;
+            }
+            require(c < chunks.length && chunks[c].index == index, "missing chunk");
+            uint256 offset = indices[i] % chunkSize;
+            require(offset / 256 < chunks[c].data.length, "index exceeds its chunk");
+            bool set = (chunks[c].data[offset / 256] >> (offset % 256)) & 1 == 1;
+            require(set == present, "bit does not match the proof type");
+        }
+        return present;
+    }
+}
@@ -0,0 +1,104 @@
+// Package core holds the pure primitives of a bloom tree: the hashes of its leafs, padding leafs and internal
+// nodes, and the index math of its proof paths. The functions have no side effects and depend on no state of a
+// tree, only on their arguments, so formal verification and differential fuzzing tools can target the
+// algorithm in isolation. The bloomtree package builds and verifies trees with them.
+//
+// A tree of n leafs, n a power of two, has 2n-1 nodes laid out layer by layer: the leafs at [0, n), their
+// parents at [n, n+n/2), and so on up to the root at 2n-2. The parent of node i is n+i/2 and its sibling is i^1.
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"golang.org/x/crypto/sha3"
+	"lukechampine.com/blake3"
+)
+
+// Hash is the hash function of the leafs and internal nodes of a tree. The values are those of bloomtree.Hash.
+type Hash uint8
+
+const (
+	// SHA512_256 is SHA-512/256, the default hash function.
+	SHA512_256 Hash = iota
+	// SHA256 is SHA-256.
+	SHA256
+	// Keccak256 is the legacy Keccak-256 used by the EVM.
+	Keccak256
+	// BLAKE3 is BLAKE3 with a 256 bit output.
+	BLAKE3
+)
+
+// Valid returns whether h is a known hash function. Unknown hash functions hash like SHA512_256.
+func (h Hash) Valid() bool {
+	return h <= BLAKE3
+}
+
+// Sum returns the 256 bit digest of data.
+func (h Hash) Sum(data []byte) [32]byte {
+	switch h {
+	case SHA256:
+		return sha256.Sum256(data)
+	case Keccak256:
+		var ret [32]byte
+		k := sha3.NewLegacyKeccak256()
+		k.Write(data)
+		copy(ret[:], k.Sum(nil))
+		return ret
+	case BLAKE3:
+		return blake3.Sum256(data)
+	default:
+		return sha512.Sum512_256(data)
+	}
+}
+
+// Child hashes the two children of an internal node, the left one first.
+func (h Hash) Child(left, right [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, left[:]...)
+	elem = append(elem, right[:]...)
+	return h.Sum(elem)
+}
+
+// Node hashes the two children of the internal node at the given index of a layer, where the leafs are layer 0.
+// The hash of the internal nodes of a plain tree does not depend on their position, Node is the NodeFunc of
+// such trees.
+func (h Hash) Node(layer int, index uint64, left, right [32]byte) [32]byte {
+	return h.Child(left, right)
+}
+
+// Leaf hashes the words of the chunk at the given index of a tree with the given chunk size in bits, a positive
+// multiple of 64. The index is prefixed as chunkSize little endian bytes, and every word takes 64 little endian
+// bytes. A chunk at the end of the bloom filter may hold fewer words than the chunk size.
+func (h Hash) Leaf(chunkSize int, index uint64, words ...uint64) [32]byte {
+	var elem []byte
+
+	a := make([]byte, chunkSize)
+	binary.LittleEndian.PutUint64(a, index)
+
+	elem = append(elem, a[:]...)
+	for _, w := range words {
+		b := make([]byte, 64)
+		binary.LittleEndian.PutUint64(b, w)
+		elem = append(elem, b...)
+	}
+
+	return h.Sum(elem)
+}
+
+// Padding hashes the padding leaf at the given index, which fills the leafs after the last chunk up to a power
+// of two. The domain tag keeps padding leafs apart from leafs of real chunks, which would otherwise collide
+// with all-zero chunks.
+func (h Hash) Padding(index uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("padding leaf")...)
+	elem = appendUint64(elem, index)
+	return h.Sum(elem)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	a := make([]byte, 8)
+	binary.LittleEndian.PutUint64(a, v)
+	return append(b, a...)
+}
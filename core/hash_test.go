@@ -0,0 +1,47 @@
+package core
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	left, right := SHA512_256.Sum([]byte("left")), SHA512_256.Sum([]byte("right"))
+	if SHA512_256.Child(left, right) != sha512.Sum512_256(append(left[:], right[:]...)) {
+		t.Fatal("expected the child hash of the concatenated children")
+	}
+	if SHA512_256.Child(left, right) == SHA512_256.Child(right, left) {
+		t.Fatal("expected the child hash to depend on the order of the children")
+	}
+	if SHA512_256.Node(3, 7, left, right) != SHA512_256.Child(left, right) {
+		t.Fatal("expected the node of a plain tree to be the child hash")
+	}
+
+	// the leaf of a chunk of 128 bits prefixes the index as 128 bytes, and every word takes 64 bytes
+	data := make([]byte, 128+2*64)
+	binary.LittleEndian.PutUint64(data, 5)
+	binary.LittleEndian.PutUint64(data[128:], 1)
+	binary.LittleEndian.PutUint64(data[192:], 2)
+	if SHA512_256.Leaf(128, 5, 1, 2) != sha512.Sum512_256(data) {
+		t.Fatal("leaf hash does not match its layout")
+	}
+	if SHA512_256.Padding(3) == SHA512_256.Leaf(64, 0, 3) || SHA512_256.Padding(3) == SHA512_256.Padding(4) {
+		t.Fatal("expected padding leafs to differ from each other and from chunks")
+	}
+
+	seen := make(map[[32]byte]Hash)
+	for _, h := range []Hash{SHA512_256, SHA256, Keccak256, BLAKE3} {
+		if !h.Valid() {
+			t.Fatalf("expected hash %d to be valid", h)
+		}
+		sum := h.Sum([]byte("bloom tree"))
+		if other, ok := seen[sum]; ok {
+			t.Fatalf("hash %d and %d return the same digest", h, other)
+		}
+		seen[sum] = h
+	}
+	if Hash(4).Valid() {
+		t.Fatal("expected hash 4 to be invalid")
+	}
+}
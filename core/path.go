@@ -0,0 +1,304 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// ErrLayerIndexOutOfRange is returned when a node index lies outside of its layer of the tree.
+var ErrLayerIndexOutOfRange = errors.New("node index out of layer range")
+
+// NodeFunc hashes the two children of the internal node at the given index of a layer, where the leafs are
+// layer 0. Hash.Node is the NodeFunc of plain trees, other trees may hash nodes depending on their position.
+type NodeFunc func(layer int, index uint64, left, right [32]byte) [32]byte
+
+// CheckTreeLength returns an error unless n is the number of nodes of a tree, i.e. one less than a power of two.
+func CheckTreeLength(n int) error {
+	if n <= 0 || (n+1)&n != 0 {
+		return fmt.Errorf("invalid number of tree nodes %d", n)
+	}
+	return nil
+}
+
+// TreeLength returns the number of nodes of the tree of a bloom filter of the given number of words, with the
+// given chunk size in bits. The chunks are padded to a power of two leafs.
+func TreeLength(words, chunkSize int) int {
+	step := chunkSize / 64
+	return 2*LeafNum((words+step-1)/step) - 1
+}
+
+// LeafNum returns the number of leafs of a tree of the given number of chunks, i.e. the smallest power of two
+// that is at least the number of chunks, which must not exceed 2^62.
+func LeafNum(chunks int) int {
+	if chunks <= 1 {
+		return 1
+	}
+	return 1 << uint(bits.Len64(uint64(chunks-1)))
+}
+
+// Height returns the number of layers above the leafs of a tree of treeLength nodes, i.e. the length of the
+// path from a leaf to the root.
+func Height(treeLength int) int {
+	return bits.TrailingZeros64(uint64(treeLength+1) / 2)
+}
+
+// Parent returns the index of the parent of node i in a tree of leafNum leafs.
+func Parent(i, leafNum uint64) uint64 {
+	return leafNum + i/2
+}
+
+// Sibling returns the index of the sibling of node i. Every layer starts at an even index, so siblings only
+// differ in their lowest bit.
+func Sibling(i uint64) uint64 {
+	return i ^ 1
+}
+
+// ChunkIndex returns the index of the chunk holding the bloom filter index v, for the given chunk size in bits.
+func ChunkIndex(v uint64, chunkSize int) uint64 {
+	return v / uint64(chunkSize)
+}
+
+// SortIndices sorts node or chunk indices in place. The few indices of a proof are sorted by insertion, which
+// unlike sort.Slice neither allocates nor calls a closure per comparison.
+func SortIndices(indices []uint64) {
+	if len(indices) > 32 {
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+		return
+	}
+	for i := 1; i < len(indices); i++ {
+		for j := i; j > 0 && indices[j] < indices[j-1]; j-- {
+			indices[j], indices[j-1] = indices[j-1], indices[j]
+		}
+	}
+}
+
+// BuildNodes returns the nodes of the tree of the given leafs, whose number must be a power of two, i.e. the
+// chunks must already be padded. It is the sequential reference of the parallel construction of bloomtree.
+func BuildNodes(node NodeFunc, leafs [][32]byte) ([][32]byte, error) {
+	leafNum := len(leafs)
+	if err := CheckTreeLength(2*leafNum - 1); err != nil {
+		return nil, err
+	}
+	nodes := make([][32]byte, 2*leafNum-1)
+	copy(nodes, leafs)
+	for start, size, layer := leafNum, leafNum/2, 1; size > 0; start, size, layer = start+size, size/2, layer+1 {
+		for i := start; i < start+size; i++ {
+			nodes[i] = node(layer, uint64(i-start), nodes[2*(i-leafNum)], nodes[2*(i-leafNum)+1])
+		}
+	}
+	return nodes, nil
+}
+
+// PathBuffers holds the buffers of ProofIndices, so callers generating many proofs can reuse them. The zero
+// value is ready to use. A PathBuffers must not be used concurrently.
+type PathBuffers struct {
+	layer, next, hashIndices []uint64
+}
+
+// Cap returns the capacity of the largest buffer, e.g. to drop buffers grown by a huge batch proof.
+func (b *PathBuffers) Cap() int {
+	c := cap(b.layer)
+	if cap(b.next) > c {
+		c = cap(b.next)
+	}
+	if cap(b.hashIndices) > c {
+		c = cap(b.hashIndices)
+	}
+	return c
+}
+
+// ProofIndices returns the indices of the nodes needed to reconstruct the root from the leafs at the given
+// indices, in a tree of treeLength nodes. The indices of every layer are sorted and deduplicated, so a node
+// whose sibling is proven as well needs no hash, and the hashes of every layer are ordered by their index.
+func ProofIndices(indices []uint64, treeLength int) ([]uint64, error) {
+	var b PathBuffers
+	return b.ProofIndices(indices, treeLength)
+}
+
+// ProofIndices is ProofIndices returning the indices in the buffers, which are valid until the buffers are
+// used again.
+func (b *PathBuffers) ProofIndices(indices []uint64, treeLength int) ([]uint64, error) {
+	layer := append(b.layer[:0], indices...)
+	SortIndices(layer)
+	unique := 0
+	for j, val := range layer {
+		if j == 0 || val != layer[unique-1] {
+			layer[unique] = val
+			unique++
+		}
+	}
+	layer = layer[:unique]
+	next, hashIndices := b.next[:0], b.hashIndices[:0]
+	leavesPerLayer := uint64(treeLength + 1)
+	currentLayer := uint64(0)
+	height := Height(treeLength)
+	for i := 0; i < height; i++ {
+		layerSize := leavesPerLayer / 2
+		next = next[:0]
+		for j := 0; j < len(layer); j++ {
+			val := layer[j]
+			// the neighbor of an index inside the layer is inside the layer, as layer sizes are even
+			if val >= layerSize {
+				b.layer, b.next, b.hashIndices = layer, next, hashIndices
+				return nil, fmt.Errorf("%w: index %d in layer %d of size %d", ErrLayerIndexOutOfRange, val, i, layerSize)
+			}
+			// a pair of siblings needs no hash, otherwise the sibling is part of the proof
+			if val&1 == 0 && j+1 < len(layer) && layer[j+1] == val+1 {
+				j++
+			} else {
+				hashIndices = append(hashIndices, Sibling(val)+currentLayer)
+			}
+			next = append(next, val/2)
+		}
+		layer, next = next, layer
+		leavesPerLayer /= 2
+		currentLayer += leavesPerLayer
+	}
+	b.layer, b.next, b.hashIndices = layer, next, hashIndices
+	return hashIndices, nil
+}
+
+// CountError is returned by Root for proofs with the wrong number of chunks or hashes.
+type CountError struct {
+	// Hashes is set if the number of hashes is wrong, otherwise the number of chunks is.
+	Hashes bool
+	msg    string
+}
+
+func (e *CountError) Error() string {
+	return e.msg
+}
+
+func chunkCountError(format string, args ...interface{}) error {
+	return &CountError{msg: fmt.Sprintf(format, args...)}
+}
+
+func hashCountError(format string, args ...interface{}) error {
+	return &CountError{Hashes: true, msg: fmt.Sprintf(format, args...)}
+}
+
+// Root returns the root reconstructed from the chunk hashes at the given sorted leaf indices and the proof
+// hashes, in a tree of treeLength nodes whose internal nodes are hashed by node. Consecutive duplicate indices,
+// chunks and hashes are allowed. A *CountError is returned for the wrong number of chunks or hashes.
+func Root(node NodeFunc, chunkIndices []uint64, chunks, hashes [][32]byte, treeLength int) ([32]byte, error) {
+	if err := CheckTreeLength(treeLength); err != nil {
+		return [32]byte{}, err
+	}
+	var (
+		pairs        []int
+		newIndices   []uint64
+		newBlueNodes [][32]byte
+	)
+
+	proof := hashes
+	blueNodes := chunks
+	prevIndices := chunkIndices
+	indMap := make(map[uint64]int)
+	height := Height(treeLength)
+	if len(blueNodes) == 0 {
+		return [32]byte{}, chunkCountError("the proof has no chunks")
+	}
+	// remove duplicates of blue nodes
+	var uniqueBlueNodes [][32]byte
+	uniqueBlueNodes = append(uniqueBlueNodes, blueNodes[0])
+	for i := 1; i < len(blueNodes); i++ {
+		if blueNodes[i] != blueNodes[i-1] {
+			uniqueBlueNodes = append(uniqueBlueNodes, blueNodes[i])
+		}
+	}
+	blueNodes = uniqueBlueNodes
+
+	// remove duplicates of proof
+	var uniqueProof [][32]byte
+	if len(proof) != 0 {
+		uniqueProof = append(uniqueProof, proof[0])
+		for i := 1; i < len(proof); i++ {
+			if proof[i] != proof[i-1] {
+				uniqueProof = append(uniqueProof, proof[i])
+			}
+		}
+	}
+	proof = uniqueProof
+	proofNum := 0
+	for i := 0; i < height; i++ {
+		if len(newIndices) != 0 {
+			for j := 0; j < len(newIndices); j += 2 {
+				prevIndices = append(prevIndices, newIndices[j]/2)
+			}
+			newIndices = nil
+		}
+		// indMap maps the sum of the indices of a pair of siblings to the proven one, or -1 if both are proven
+		for _, val := range prevIndices {
+			neighbor := Sibling(val)
+			if _, ok := indMap[val+neighbor]; ok {
+				if indMap[val+neighbor] != int(val) {
+					indMap[val+neighbor] = -1
+				}
+			} else {
+				indMap[val+neighbor] = int(val)
+				pairs = append(pairs, int(val+neighbor))
+			}
+		}
+		for k, v := range indMap {
+			if v == -1 {
+				a, b := order((k-1)/2, (k+1)/2)
+				newIndices = append(newIndices, a, b)
+			} else {
+				a, b := order(uint64(v), k-uint64(v))
+				newIndices = append(newIndices, a, b)
+			}
+		}
+		sort.Ints(pairs)
+		blueNodeNum := 0
+		for _, v := range pairs {
+			value := uint64(v)
+			if indMap[value] == -1 {
+				if blueNodeNum+1 >= len(blueNodes) {
+					return [32]byte{}, chunkCountError("the proof has too few chunks")
+				}
+				newBlueNodes = append(newBlueNodes, node(i+1, (value-1)/4, blueNodes[blueNodeNum], blueNodes[blueNodeNum+1]))
+				blueNodeNum += 2
+			} else {
+				if blueNodeNum >= len(blueNodes) {
+					return [32]byte{}, chunkCountError("the proof has too few chunks")
+				}
+				if proofNum >= len(proof) {
+					return [32]byte{}, hashCountError("the proof has too few hashes")
+				}
+				newBlueNodes = append(newBlueNodes, orderedNode(node, i+1, indMap[value], v-indMap[value], blueNodes[blueNodeNum], proof[proofNum]))
+				blueNodeNum++
+				proofNum++
+			}
+		}
+		if blueNodeNum != len(blueNodes) {
+			return [32]byte{}, chunkCountError("the proof has %d distinct chunks, but %d are needed", len(blueNodes), blueNodeNum)
+		}
+		blueNodes = newBlueNodes
+		newBlueNodes = nil
+		indMap = make(map[uint64]int)
+		pairs = nil
+		prevIndices = nil
+	}
+	if proofNum != len(proof) {
+		return [32]byte{}, hashCountError("the proof has %d hashes, but %d are needed", len(proof), proofNum)
+	}
+	return blueNodes[0], nil
+}
+
+// orderedNode hashes the node h1 at index ind1 of a layer with its sibling h2 at index indNeighbor, in the
+// order of their indices.
+func orderedNode(node NodeFunc, layer, ind1, indNeighbor int, h1, h2 [32]byte) [32]byte {
+	if ind1 > indNeighbor {
+		return node(layer, uint64(indNeighbor/2), h2, h1)
+	}
+	return node(layer, uint64(ind1/2), h1, h2)
+}
+
+func order(a, b uint64) (uint64, uint64) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
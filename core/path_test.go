@@ -0,0 +1,138 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTreeMath(t *testing.T) {
+	var tests = []struct {
+		words, chunkSize int
+		treeLength       int
+		height           int
+	}{
+		{words: 1, chunkSize: 64, treeLength: 1, height: 0},
+		{words: 1, chunkSize: 512, treeLength: 1, height: 0},
+		{words: 2, chunkSize: 64, treeLength: 3, height: 1},
+		{words: 3, chunkSize: 64, treeLength: 7, height: 2},
+		{words: 3, chunkSize: 128, treeLength: 3, height: 1},
+		{words: 17, chunkSize: 64, treeLength: 63, height: 5},
+		{words: 16, chunkSize: 64, treeLength: 31, height: 4},
+	}
+	for _, test := range tests {
+		treeLength := TreeLength(test.words, test.chunkSize)
+		if treeLength != test.treeLength {
+			t.Fatalf("expected %d nodes for %d words of chunk size %d, got %d", test.treeLength, test.words, test.chunkSize, treeLength)
+		}
+		if err := CheckTreeLength(treeLength); err != nil {
+			t.Fatal(err)
+		}
+		if height := Height(treeLength); height != test.height {
+			t.Fatalf("expected height %d of %d nodes, got %d", test.height, treeLength, height)
+		}
+	}
+	for _, n := range []int{0, -1, 2, 6, 30} {
+		if CheckTreeLength(n) == nil {
+			t.Fatalf("expected an error for %d nodes", n)
+		}
+	}
+	// in a tree of 8 leafs, the parents of the leafs start at 8 and the root is 14
+	if Parent(5, 8) != 10 || Parent(10, 8) != 13 || Parent(13, 8) != 14 || Sibling(10) != 11 || Sibling(13) != 12 {
+		t.Fatal("unexpected parent or sibling in a tree of 8 leafs")
+	}
+	if ChunkIndex(130, 64) != 2 || ChunkIndex(130, 128) != 1 {
+		t.Fatal("unexpected chunk index")
+	}
+}
+
+func TestProofIndices(t *testing.T) {
+	var tests = []struct {
+		indices  []uint64
+		expected []uint64
+		err      error
+	}{
+		{indices: []uint64{0}, expected: []uint64{1, 17, 25, 29}},
+		{indices: []uint64{0, 1}, expected: []uint64{17, 25, 29}},
+		{indices: []uint64{2, 2, 6}, expected: []uint64{3, 7, 16, 18, 29}},
+		{indices: []uint64{9, 5, 3, 5}, expected: []uint64{2, 4, 8, 16, 19, 21, 27}},
+		{indices: []uint64{16}, err: ErrLayerIndexOutOfRange},
+	}
+	var b PathBuffers
+	for _, test := range tests {
+		hashIndices, err := ProofIndices(test.indices, 31)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("expected error %v for indices %v, but got %v", test.err, test.indices, err)
+		}
+		if test.err == nil && !reflect.DeepEqual(hashIndices, test.expected) {
+			t.Fatalf("expected hash indices %v for indices %v, but got %v", test.expected, test.indices, hashIndices)
+		}
+		// reused buffers give the same indices
+		buffered, err := b.ProofIndices(test.indices, 31)
+		if test.err == nil && (err != nil || !reflect.DeepEqual(buffered, test.expected)) {
+			t.Fatalf("expected hash indices %v for indices %v in buffers, but got %v", test.expected, test.indices, buffered)
+		}
+	}
+	if b.Cap() == 0 {
+		t.Fatal("expected the buffers to grow")
+	}
+}
+
+func TestRoot(t *testing.T) {
+	leafs := make([][32]byte, 8)
+	for i := range leafs {
+		if i < 6 {
+			leafs[i] = SHA512_256.Leaf(64, uint64(i), uint64(i*i))
+		} else {
+			leafs[i] = SHA512_256.Padding(uint64(i))
+		}
+	}
+	nodes, err := BuildNodes(SHA512_256.Node, leafs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes[14] != SHA512_256.Child(nodes[12], nodes[13]) || nodes[9] != SHA512_256.Child(leafs[2], leafs[3]) {
+		t.Fatal("unexpected internal nodes")
+	}
+	if _, err := BuildNodes(SHA512_256.Node, leafs[:6]); err == nil {
+		t.Fatal("expected an error for leafs that are not a power of two")
+	}
+
+	for _, indices := range [][]uint64{{0}, {7}, {2, 3}, {1, 1, 4}, {0, 2, 5, 6}, {0, 1, 2, 3, 4, 5, 6, 7}} {
+		hashIndices, err := ProofIndices(indices, len(nodes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var chunks, hashes [][32]byte
+		for _, i := range indices {
+			chunks = append(chunks, nodes[i])
+		}
+		for _, i := range hashIndices {
+			hashes = append(hashes, nodes[i])
+		}
+		root, err := Root(SHA512_256.Node, indices, chunks, hashes, len(nodes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != nodes[len(nodes)-1] {
+			t.Fatalf("failed to reconstruct the root from the chunks %v", indices)
+		}
+
+		var count *CountError
+		if len(hashes) > 0 {
+			if _, err := Root(SHA512_256.Node, indices, chunks, hashes[1:], len(nodes)); !errors.As(err, &count) || !count.Hashes {
+				t.Fatalf("expected a CountError of the hashes of chunks %v, got %v", indices, err)
+			}
+		}
+		if _, err := Root(SHA512_256.Node, indices, chunks, append(hashes, nodes[0]), len(nodes)); !errors.As(err, &count) || !count.Hashes {
+			t.Fatalf("expected a CountError of the hashes of chunks %v, got %v", indices, err)
+		}
+	}
+	var count *CountError
+	if _, err := Root(SHA512_256.Node, []uint64{0, 1}, leafs[:1], nil, len(nodes)); !errors.As(err, &count) || count.Hashes {
+		t.Fatalf("expected a CountError of the chunks, got %v", err)
+	}
+	if _, err := Root(SHA512_256.Node, []uint64{0}, leafs[:1], nil, 6); err == nil {
+		t.Fatal("expected an error for an invalid number of nodes")
+	}
+}
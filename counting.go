@@ -0,0 +1,88 @@
+package bloomtree
+
+import (
+	"errors"
+	"math"
+)
+
+// CountingBloomFilter is a bloom filter whose elements can be removed again, like a counting bloom filter.
+type CountingBloomFilter interface {
+	BloomFilter
+	// Add inserts an element.
+	Add(elem []byte)
+	// Remove deletes an element added before, and returns the indices of the bits it cleared.
+	Remove(elem []byte) ([]uint, error)
+}
+
+// CountingFilter turns a bloom filter into a CountingBloomFilter by keeping a counter for every bit.
+// Counters saturate at their maximum and are never decremented from there, so their bits stay set.
+type CountingFilter struct {
+	BloomFilter
+	counts []uint8
+}
+
+// NewCountingFilter returns a CountingFilter backed by the bloom filter. The counters of bits set
+// before are saturated, as the number of elements sharing them is unknown.
+func NewCountingFilter(b BloomFilter) *CountingFilter {
+	bf := b.BitArray()
+	counts := make([]uint8, bf.Len())
+	for i, ok := bf.NextSet(0); ok; i, ok = bf.NextSet(i + 1) {
+		counts[i] = math.MaxUint8
+	}
+	return &CountingFilter{BloomFilter: b, counts: counts}
+}
+
+// Add inserts an element and increments the counters of its bits.
+func (c *CountingFilter) Add(elem []byte) {
+	bf := c.BitArray()
+	for _, v := range c.GetElementIndices(elem) {
+		if c.counts[v] < math.MaxUint8 {
+			c.counts[v]++
+		}
+		bf.Set(v)
+	}
+}
+
+// Remove decrements the counters of the bits of an element, and clears the bits whose counter drops to zero.
+func (c *CountingFilter) Remove(elem []byte) ([]uint, error) {
+	indices := c.GetElementIndices(elem)
+	for _, v := range indices {
+		if c.counts[v] == 0 {
+			return nil, errors.New("the element is not in the bloom filter")
+		}
+	}
+	var cleared []uint
+	bf := c.BitArray()
+	for _, v := range indices {
+		if c.counts[v] == math.MaxUint8 || c.counts[v] == 0 {
+			continue
+		}
+		c.counts[v]--
+		if c.counts[v] == 0 {
+			bf.Clear(v)
+			cleared = append(cleared, v)
+		}
+	}
+	return cleared, nil
+}
+
+// Delete removes an element from the counting bloom filter of the tree, and recomputes only the leafs
+// holding the cleared bits and their ancestors.
+func (bt *BloomTree) Delete(elem []byte) error {
+	if err := bt.checkUpdate(nil); err != nil {
+		return err
+	}
+	cbf, ok := bt.bf.(CountingBloomFilter)
+	if !ok {
+		return errors.New("elements can only be deleted from counting bloom filters")
+	}
+	cleared, err := cbf.Remove(elem)
+	if err != nil {
+		return err
+	}
+	indices := make([]uint64, len(cleared))
+	for i, v := range cleared {
+		indices[i] = uint64(v)
+	}
+	return bt.rehashChunks(indices)
+}
@@ -0,0 +1,83 @@
+package bloomtree
+
+import (
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestDelete(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	cbf := NewCountingFilter(DBF.NewDbf(200, 0.2, []byte(seed)))
+	for _, elem := range [][]byte{{1}, {2}, {3}} {
+		cbf.Add(elem)
+	}
+	tree, err := NewBloomTree(cbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := tree.Root()
+	if err := tree.Update([]byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Delete([]byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != before {
+		t.Fatal("expected the root before the update after deleting the element")
+	}
+
+	if err := tree.Delete([]byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := NewBloomTree(generateDBF(200, seed, []byte{1}, []byte{3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != rebuilt.Root() {
+		t.Fatal("root after deletion does not match a filter without the element")
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multiproof.ProofType.IsPresence() {
+		t.Fatal("expected an absence proof for the deleted element")
+	}
+	verified, err := VerifyCompactMultiProof([]byte{2}, []byte(seed), multiproof, tree.Root(), cbf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify absence proof of the deleted element")
+	}
+
+	if err := tree.Delete([]byte{2}); err == nil {
+		t.Fatal("expected error for deleting an absent element")
+	}
+	if err := tree.SetBits([]uint64{5}); err == nil {
+		t.Fatal("expected error for setting bits of a counting bloom filter")
+	}
+}
+
+func TestCountingFilterSaturation(t *testing.T) {
+	SetChunkSize(64)
+	// bits set before the counting filter was created are never cleared
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	cbf := NewCountingFilter(dbf)
+	cleared, err := cbf.Remove([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleared) != 0 || !cbf.BitArray().Test(dbf.GetElementIndices([]byte{1})[0]) {
+		t.Fatal("expected the bits set before to stay set")
+	}
+
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Delete([]byte{1}); err == nil {
+		t.Fatal("expected error for deleting from a bloom filter without counters")
+	}
+}
@@ -0,0 +1,171 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// DiffProof proves which chunks changed between two versions of a bloom tree. The chunks are opened in both
+// versions with a single set of proof hashes, which reconstructs the old root from the old words and the new root
+// from the new words, so every other chunk is proven to be unchanged.
+type DiffProof struct {
+	// ChunkSize is the chunk size of the trees.
+	ChunkSize int
+	// Chunks are the changed chunks, in increasing order of their index.
+	Chunks []DiffChunk
+	// Proof are the hashes needed to reconstruct both roots from the changed chunks.
+	Proof [][32]byte
+}
+
+// DiffChunk is a chunk that changed between two versions of a bloom tree.
+type DiffChunk struct {
+	// Index is the index of the chunk.
+	Index uint64
+	// Old are the bloom filter words of the chunk in the old tree.
+	Old []uint64
+	// New are the bloom filter words of the chunk in the new tree.
+	New []uint64
+}
+
+// GenerateDiffProof returns the proof of the chunks that changed from the old to the new tree. Both trees must
+// have been built with the same options from bloom filters of the same size. Blinded and adaptive trees are
+// not supported, as their chunks cannot be compared by the words alone.
+func GenerateDiffProof(oldTree, newTree *BloomTree) (*DiffProof, error) {
+	if oldTree.bf == nil || newTree.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if oldTree.cfg.blindingKey != nil || newTree.cfg.blindingKey != nil || oldTree.bounds != nil || newTree.bounds != nil {
+		return nil, errors.New("diff proofs of blinded and adaptive trees are not supported")
+	}
+	if oldTree.cfg.chunkSize != newTree.cfg.chunkSize || oldTree.cfg.hash != newTree.cfg.hash {
+		return nil, errors.New("the trees have different chunk sizes or hash functions")
+	}
+	oldWords, newWords := oldTree.bf.BitArray().Bytes(), newTree.bf.BitArray().Bytes()
+	if len(oldWords) != len(newWords) || oldTree.nodeCount() != newTree.nodeCount() {
+		return nil, fmt.Errorf("the bloom filters have %d and %d words", len(oldWords), len(newWords))
+	}
+	proof := &DiffProof{ChunkSize: oldTree.cfg.chunkSize}
+	var indices []uint64
+	for i := 0; i < oldTree.leafCount(oldWords); i++ {
+		if oldTree.node(i) == newTree.node(i) {
+			continue
+		}
+		indices = append(indices, uint64(i))
+		proof.Chunks = append(proof.Chunks, DiffChunk{
+			Index: uint64(i),
+			Old:   append([]uint64(nil), oldTree.leafWords(oldWords, i)...),
+			New:   append([]uint64(nil), newTree.leafWords(newWords, i)...),
+		})
+	}
+	if err := oldTree.nodesErr(); err != nil {
+		return nil, err
+	}
+	if err := newTree.nodesErr(); err != nil {
+		return nil, err
+	}
+	if len(indices) == 0 {
+		return proof, nil
+	}
+	hashIndices, err := oldTree.generateProofIndices(indices)
+	if err != nil {
+		return nil, err
+	}
+	if proof.Proof, err = oldTree.proofHashes(context.Background(), hashIndices); err != nil {
+		return nil, err
+	}
+	newHashes, err := newTree.proofHashes(context.Background(), hashIndices)
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range newHashes {
+		if h != proof.Proof[i] {
+			return nil, errors.New("the trees differ in nodes not covered by their leafs, they were built with other options")
+		}
+	}
+	return proof, nil
+}
+
+// VerifyDiffProof returns whether the proof shows that exactly its chunks changed from the tree with the old root
+// to the tree with the new root, both built from bloom filters of filterBits bits with the given options. The
+// chunk size of the proof must be the chunk size of the options, as ChangedBits locates the bits by it. Roots
+// given with WithCrossCheckRoot are checked against the new root.
+func VerifyDiffProof(proof *DiffProof, oldRoot, newRoot [32]byte, filterBits uint64, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.ChunkSize != cfg.chunkSize {
+		return false, chunkSizeMismatch(proof.ChunkSize, cfg.chunkSize)
+	}
+	if filterBits == 0 {
+		return false, errors.New("the bloom filter must have at least one bit")
+	}
+	for _, other := range cfg.crossCheckRoots {
+		if other != newRoot {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, newRoot, other)
+		}
+	}
+	// the cross check roots are roots of the new version, so they do not apply to the old root
+	cfg.crossCheckRoots = nil
+	if len(proof.Chunks) == 0 {
+		if oldRoot != newRoot {
+			return false, invalidProof(ReasonRootMismatch, "the proof changes no chunks, but the roots differ")
+		}
+		return true, nil
+	}
+	leafCount := LeafCountFor(filterBits, cfg.chunkSize)
+	indices := make([]uint64, len(proof.Chunks))
+	oldLeafs := make([][32]byte, len(proof.Chunks))
+	newLeafs := make([][32]byte, len(proof.Chunks))
+	for i, chunk := range proof.Chunks {
+		if chunk.Index >= leafCount || (i > 0 && chunk.Index <= indices[i-1]) {
+			return false, invalidProof(ReasonChunkMismatch, "invalid chunk index %d", chunk.Index)
+		}
+		expected := ChunkWordCount(chunk.Index, filterBits, cfg.chunkSize)
+		if len(chunk.Old) != expected || len(chunk.New) != expected {
+			return false, invalidProof(ReasonChunkCount, "chunk %d must have %d words", chunk.Index, expected)
+		}
+		if equalWords(chunk.Old, chunk.New) {
+			return false, invalidProof(ReasonChunkMismatch, "chunk %d did not change", chunk.Index)
+		}
+		indices[i] = chunk.Index
+		oldLeafs[i] = cfg.leaf(chunk.Index, chunk.Old...)
+		newLeafs[i] = cfg.leaf(chunk.Index, chunk.New...)
+	}
+	treeLength := NodeCountFor(filterBits, cfg.chunkSize)
+	for _, v := range []struct {
+		leafs [][32]byte
+		root  [32]byte
+	}{{oldLeafs, oldRoot}, {newLeafs, newRoot}} {
+		if _, err := verifyProof(cfg, indices, newCompactMultiProof(v.leafs, proof.Proof, Presence), v.root, treeLength); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ChangedBits returns the bloom filter indices of the bits that differ between the old and the new words of the
+// changed chunks, in increasing order. The proof must have been verified, so the old and new words of every chunk
+// have the same length and its chunk size is the chunk size of the trees.
+func (p *DiffProof) ChangedBits() []uint64 {
+	var changed []uint64
+	for _, chunk := range p.Chunks {
+		for w := range chunk.Old {
+			for diff := chunk.Old[w] ^ chunk.New[w]; diff != 0; diff &= diff - 1 {
+				changed = append(changed, chunk.Index*uint64(p.ChunkSize)+uint64(64*w+bits.TrailingZeros64(diff)))
+			}
+		}
+	}
+	return changed
+}
+
+func equalWords(a, b []uint64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
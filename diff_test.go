@@ -0,0 +1,141 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDiffProof(t *testing.T) {
+	SetChunkSize(64)
+	var tests = []struct {
+		opts []Option
+	}{
+		{},
+		{opts: []Option{WithChunkSize(256)}},
+		{opts: []Option{WithHash(Keccak256), WithWordTrees()}},
+		{opts: []Option{WithEVM(), WithChunkSize(512)}},
+	}
+	for _, test := range tests {
+		dbf := generateDBF(1000, "secret seed", []byte{1}, []byte{2})
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old, err := tree.Freeze()
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldBits := old.GetBloomFilter().BitArray().Clone()
+
+		// no changes
+		proof, err := GenerateDiffProof(old, tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof.Chunks) != 0 {
+			t.Fatalf("expected no changed chunks, but got %d", len(proof.Chunks))
+		}
+		if verified, err := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...); err != nil || !verified {
+			t.Fatalf("failed to verify the empty diff: %v", err)
+		}
+
+		for _, elem := range [][]byte{{3}, {4}, {5}} {
+			if err := tree.Update(elem); err != nil {
+				t.Fatal(err)
+			}
+		}
+		proof, err = GenerateDiffProof(old, tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof.Chunks) == 0 {
+			t.Fatal("expected changed chunks")
+		}
+		verified, err := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatal("failed to verify the diff proof")
+		}
+		changed := oldBits.SymmetricDifference(dbf.BitArray())
+		bits := proof.ChangedBits()
+		if uint(len(bits)) != changed.Count() {
+			t.Fatalf("expected %d changed bits, but got %d", changed.Count(), len(bits))
+		}
+		for _, v := range bits {
+			if !changed.Test(uint(v)) {
+				t.Fatalf("bit %d did not change", v)
+			}
+		}
+
+		// the proof does not verify against other roots or with other words
+		if verified, _ := VerifyDiffProof(proof, tree.Root(), old.Root(), uint64(oldBits.Len()), test.opts...); verified {
+			t.Fatal("expected the proof to fail with swapped roots")
+		}
+		proof.Chunks[0].New[0] ^= 1 << 63
+		if verified, _ := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...); verified {
+			t.Fatal("expected the proof to fail with other words")
+		}
+		proof.Chunks[0].New[0] ^= 1 << 63
+
+		// the chunk size of the proof must be set, and cross check roots are roots of the new version
+		chunkSize := proof.ChunkSize
+		for _, size := range []int{0, 2 * chunkSize} {
+			proof.ChunkSize = size
+			if _, err := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...); !errors.Is(err, ErrChunkSizeMismatch) {
+				t.Fatalf("expected a chunk size mismatch for chunk size %d, but got %v", size, err)
+			}
+		}
+		proof.ChunkSize = chunkSize
+		opts := append([]Option{WithCrossCheckRoot(tree.Root())}, test.opts...)
+		if verified, err := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), opts...); err != nil || !verified {
+			t.Fatalf("expected the proof to verify with the new root cross checked, but got %v", err)
+		}
+		opts = append([]Option{WithCrossCheckRoot(old.Root())}, test.opts...)
+		if _, err := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), opts...); !errors.Is(err, ErrRootMismatch) {
+			t.Fatalf("expected a root mismatch with another cross checked root, but got %v", err)
+		}
+
+		// a proof without chunks does not show that the roots differ
+		empty := &DiffProof{ChunkSize: proof.ChunkSize}
+		var verr *VerificationError
+		if verified, err := VerifyDiffProof(empty, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...); verified || !errors.As(err, &verr) || verr.Reason != ReasonRootMismatch {
+			t.Fatalf("expected a root mismatch for a proof without chunks, but got %t, %v", verified, err)
+		}
+
+		if len(proof.Chunks) > 1 {
+			proof.Chunks = proof.Chunks[1:]
+			if verified, _ := VerifyDiffProof(proof, old.Root(), tree.Root(), uint64(oldBits.Len()), test.opts...); verified {
+				t.Fatal("expected the proof to fail without a changed chunk")
+			}
+		}
+	}
+}
+
+func TestGenerateDiffProofErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name string
+		bf   BloomFilter
+		opts []Option
+	}{
+		{name: "chunk size", bf: dbf, opts: []Option{WithChunkSize(128)}},
+		{name: "hash", bf: dbf, opts: []Option{WithHash(BLAKE3)}},
+		{name: "blinding", bf: dbf, opts: []Option{WithBlinding([]byte("0123456789abcdef"))}},
+		{name: "size", bf: generateDBF(400, "secret seed", []byte{1})},
+	}
+	for _, test := range tests {
+		other, err := NewBloomTree(test.bf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GenerateDiffProof(tree, other); err == nil {
+			t.Fatalf("expected error for trees with another %s", test.name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ChangedChunks returns the sorted indices of the leafs that differ between two versions of a bloom tree.
+// Both versions must have the same geometry. Equal subtrees are skipped, so the cost grows with the number
+// of changed chunks rather than with the size of the tree.
+func ChangedChunks(oldVersion, newVersion *BloomTree) ([]uint64, error) {
+	if oldVersion.nodeCount() != newVersion.nodeCount() {
+		return nil, errors.New("the tree versions have a different number of nodes")
+	}
+	if oldVersion.cfg.legacyPadding != newVersion.cfg.legacyPadding {
+		return nil, errors.New("the tree versions use different padding")
+	}
+	leafNum := uint64(oldVersion.nodeCount()+1) / 2
+	var changed []uint64
+	stack := []uint64{uint64(oldVersion.nodeCount() - 1)}
+	for len(stack) != 0 {
+		index := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if oldVersion.node(int(index)) == newVersion.node(int(index)) {
+			continue
+		}
+		if index < leafNum {
+			changed = append(changed, index)
+			continue
+		}
+		child := 2 * (index - leafNum)
+		stack = append(stack, child, child+1)
+	}
+	for _, version := range []*BloomTree{oldVersion, newVersion} {
+		if err := version.nodesErr(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	return changed, nil
+}
+
+// DriftMetrics tracks how many chunks change between consecutive versions of a bloom tree.
+// It implements expvar.Var, so it can be published with expvar.Publish. It is safe for concurrent use.
+type DriftMetrics struct {
+	mu       sync.Mutex
+	snapshot DriftSnapshot
+}
+
+// DriftSnapshot is a point in time copy of DriftMetrics.
+type DriftSnapshot struct {
+	// Rebuilds is the number of observed version changes.
+	Rebuilds uint64 `json:"rebuilds"`
+	// ChangedChunks is the total number of changed chunks over all rebuilds.
+	ChangedChunks uint64 `json:"changedChunks"`
+	// LastChangedChunks is the number of chunks changed by the last rebuild.
+	LastChangedChunks uint64 `json:"lastChangedChunks"`
+	// Leafs is the number of leafs of the last observed version, including padding.
+	Leafs uint64 `json:"leafs"`
+	// MeanChangeRate is the mean fraction of leafs changed per rebuild.
+	MeanChangeRate float64 `json:"meanChangeRate"`
+}
+
+// Observe records the chunks changed from oldVersion to newVersion, and returns them.
+func (m *DriftMetrics) Observe(oldVersion, newVersion *BloomTree) ([]uint64, error) {
+	changed, err := ChangedChunks(oldVersion, newVersion)
+	if err != nil {
+		return nil, err
+	}
+	leafs := uint64(newVersion.nodeCount()+1) / 2
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &m.snapshot
+	rate := float64(len(changed)) / float64(leafs)
+	s.MeanChangeRate = (s.MeanChangeRate*float64(s.Rebuilds) + rate) / float64(s.Rebuilds+1)
+	s.Rebuilds++
+	s.ChangedChunks += uint64(len(changed))
+	s.LastChangedChunks = uint64(len(changed))
+	s.Leafs = leafs
+	return changed, nil
+}
+
+// Snapshot returns the current metrics.
+func (m *DriftMetrics) Snapshot() DriftSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot
+}
+
+// String returns the metrics as JSON.
+func (m *DriftMetrics) String() string {
+	b, _ := json.Marshal(m.Snapshot())
+	return string(b)
+}
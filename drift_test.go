@@ -0,0 +1,111 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+)
+
+func TestChangedChunks(t *testing.T) {
+	SetChunkSize(64)
+	var tests = []struct {
+		bits    []uint64
+		changed []uint64
+	}{
+		{bits: nil, changed: nil},
+		{bits: []uint64{0}, changed: []uint64{0}},
+		{bits: []uint64{1, 2, 64}, changed: []uint64{0, 1}},
+		{bits: []uint64{660, 5, 300}, changed: []uint64{0, 4, 10}},
+	}
+
+	for _, test := range tests {
+		dbf := generateSparseDBF()
+		oldVersion, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newVersion, err := NewBloomTree(generateSparseDBF())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := newVersion.SetBits(test.bits); err != nil {
+			t.Fatal(err)
+		}
+		changed, err := ChangedChunks(oldVersion, newVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changed) != len(test.changed) {
+			t.Fatalf("expected changed chunks %v, but got %v", test.changed, changed)
+		}
+		for i := range changed {
+			if changed[i] != test.changed[i] {
+				t.Fatalf("expected changed chunks %v, but got %v", test.changed, changed)
+			}
+		}
+	}
+}
+
+func TestChangedChunksGeometry(t *testing.T) {
+	SetChunkSize(64)
+	small, err := NewBloomTree(generateDBF(10, "secret seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := NewBloomTree(generateDBF(200, "secret seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ChangedChunks(small, large); err == nil {
+		t.Fatal("expected error for trees with different geometry")
+	}
+	legacy, err := NewBloomTree(generateDBF(200, "secret seed"), WithLegacyPadding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ChangedChunks(legacy, large); err == nil {
+		t.Fatal("expected error for trees with different padding")
+	}
+}
+
+func TestDriftMetrics(t *testing.T) {
+	SetChunkSize(64)
+	var metrics DriftMetrics
+	expvar.Publish("bloomtree_drift_test", &metrics)
+
+	dbf := generateSparseDBF()
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bits := range [][]uint64{{0, 64}, {0, 1, 2, 3}, {640}} {
+		prev, err := NewBloomTree(generateSparseDBF())
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(prev.nodes, tree.nodes)
+		if err := tree.SetBits(bits); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := metrics.Observe(prev, tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot := metrics.Snapshot()
+	// 2, 1 and 1 chunks of 16 leafs changed
+	if snapshot.Rebuilds != 3 || snapshot.ChangedChunks != 4 || snapshot.LastChangedChunks != 1 || snapshot.Leafs != 16 {
+		t.Fatalf("unexpected metrics %+v", snapshot)
+	}
+	if math.Abs(snapshot.MeanChangeRate-1.0/12) > 1e-9 {
+		t.Fatalf("expected mean change rate %f, but got %f", 1.0/12, snapshot.MeanChangeRate)
+	}
+	var published DriftSnapshot
+	if err := json.Unmarshal([]byte(expvar.Get("bloomtree_drift_test").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published != snapshot {
+		t.Fatalf("published metrics %+v do not match %+v", published, snapshot)
+	}
+}
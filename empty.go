@@ -0,0 +1,97 @@
+package bloomtree
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/willf/bitset"
+)
+
+// EmptyRoot returns the root of the tree of a bloom filter of filterBits zero bits, built with the given options,
+// e.g. to publish the root of a service before its first element is added. Computing it takes as long as building
+// the tree. Bloom filters without any bits, e.g. placeholders of services that have not loaded their filter yet,
+// have the canonical empty root of the hash function: every element is absent from them, their absence proofs
+// carry no chunks and no hashes and verify against the empty root only, and their trees cannot be updated.
+func EmptyRoot(filterBits uint64, opts ...Option) ([32]byte, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	if filterBits == 0 {
+		return cfg.hash.emptyRoot(), nil
+	}
+	bt, err := newBloomTree(context.Background(), zeroFilter{bits: bitset.New(uint(filterBits))}, cfg)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return bt.Root(), nil
+}
+
+// isEmptyFilter returns whether the bloom filter has no bits.
+func isEmptyFilter(bf BloomFilter) bool {
+	return len(bf.BitArray().Bytes()) == 0
+}
+
+// newEmptyTree returns the tree of a bloom filter without bits, whose only node is the empty root.
+func newEmptyTree(b BloomFilter, cfg config) *BloomTree {
+	bt := &BloomTree{bf: b, nodes: [][32]byte{cfg.hash.emptyRoot()}, cfg: cfg}
+	bt.manifest = bt.buildManifest(nil)
+	return bt
+}
+
+// emptyProof returns the proof of absence of every element from a bloom filter without bits.
+func emptyProof(cfg config) *CompactMultiProof {
+	return &CompactMultiProof{ProofType: Absence(0), ChunkSize: cfg.chunkSize}
+}
+
+// emptyBatchProof returns the proof of absence of n elements from a bloom filter without bits.
+func emptyBatchProof(n int) *BatchMultiProof {
+	proofTypes := make([]ProofType, n)
+	costs := make([]ElementCost, n)
+	for i := range proofTypes {
+		proofTypes[i] = Absence(0)
+		// the proof type is the only part of the proof of an element
+		costs[i].Bytes = 1
+	}
+	return &BatchMultiProof{ProofTypes: proofTypes, Costs: costs}
+}
+
+// verifyEmptyProof returns whether the proof shows the absence of an element from a bloom filter without bits
+// with the given root.
+func verifyEmptyProof(multiproof *CompactMultiProof, root [32]byte, cfg config) (bool, error) {
+	for _, other := range cfg.crossCheckRoots {
+		if other != root {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, root, other)
+		}
+	}
+	if multiproof.ChunkSize != 0 && multiproof.ChunkSize != cfg.chunkSize {
+		return false, chunkSizeMismatch(multiproof.ChunkSize, cfg.chunkSize)
+	}
+	if multiproof.ProofType.IsPresence() {
+		return false, invalidProof(ReasonProofType, "the bloom filter has no bits, so no element is present")
+	}
+	if cfg.pinnedHeight {
+		return false, invalidProof(ReasonTreeHeight, "the bloom filter has no bits, but height %d is pinned", cfg.treeHeight)
+	}
+	if len(multiproof.Chunks) != 0 || len(multiproof.ChunkWords) != 0 {
+		return false, invalidProof(ReasonChunkCount, "the bloom filter has no bits, but the proof has %d chunks", len(multiproof.Chunks))
+	}
+	if len(multiproof.Proof) != 0 {
+		return false, invalidProof(ReasonHashCount, "the bloom filter has no bits, but the proof has %d hashes", len(multiproof.Proof))
+	}
+	if cfg.hash.emptyRoot() != root {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the root")
+	}
+	return true, nil
+}
+
+// zeroFilter is a bloom filter without set bits, which only provides its bit array.
+type zeroFilter struct {
+	bits *bitset.BitSet
+}
+
+func (f zeroFilter) Proof([]byte) ([]uint64, bool)        { return nil, false }
+func (f zeroFilter) BitArray() *bitset.BitSet             { return f.bits }
+func (f zeroFilter) MapElementToBF([]byte, []byte) []uint { return nil }
+func (f zeroFilter) NumOfHashes() uint                    { return 1 }
+func (f zeroFilter) GetElementIndices([]byte) []uint      { return nil }
@@ -0,0 +1,141 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+	"github.com/willf/bitset"
+)
+
+// emptyBF is a bloom filter without bits.
+type emptyBF struct {
+	*DBF.DistBF
+}
+
+func (emptyBF) BitArray() *bitset.BitSet {
+	return bitset.New(0)
+}
+
+func TestEmptyFilter(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	bf := emptyBF{DBF.NewDbf(10, 0.2, []byte(seed))}
+	tree, err := NewBloomTree(bf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := EmptyRoot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != root {
+		t.Fatal("expected the tree of an empty bloom filter to have the empty root")
+	}
+	if keccak, _ := EmptyRoot(0, WithHash(Keccak256)); keccak == root {
+		t.Fatal("expected the empty root to depend on the hash function")
+	}
+
+	elems := [][]byte{{1}, {2}, []byte("foo")}
+	for _, elem := range elems {
+		proof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.ProofType.IsPresence() || len(proof.Chunks) != 0 || len(proof.Proof) != 0 {
+			t.Fatalf("expected an absence proof without chunks and hashes, but got %+v", proof)
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), proof, root, bf, WithCrossCheckRoot(root))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify the absence of element %v", elem)
+		}
+		other := root
+		other[0] ^= 1
+		if verified, _ := VerifyCompactMultiProof(elem, []byte(seed), proof, other, bf); verified {
+			t.Fatal("verified the proof of an empty bloom filter against another root")
+		}
+	}
+	batch, err := tree.GenerateCompactMultiProofBatch(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified, err := VerifyCompactMultiProofBatch(elems, []byte(seed), batch, root, bf); err != nil || !verified {
+		t.Fatalf("failed to verify the batch proof of an empty bloom filter, got %t and %v", verified, err)
+	}
+
+	var tests = []struct {
+		proof  *CompactMultiProof
+		reason FailureReason
+	}{
+		{proof: &CompactMultiProof{ProofType: Presence}, reason: ReasonProofType},
+		{proof: &CompactMultiProof{ProofType: Absence(0), Chunks: [][32]byte{{}}}, reason: ReasonChunkCount},
+		{proof: &CompactMultiProof{ProofType: Absence(0), Proof: [][32]byte{{}}}, reason: ReasonHashCount},
+	}
+	for _, test := range tests {
+		var verr *VerificationError
+		if _, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), test.proof, root, bf); !errors.As(err, &verr) || verr.Reason != test.reason {
+			t.Fatalf("expected a verification error for %v, but got %v", test.reason, err)
+		}
+	}
+
+	if err := tree.Update([]byte{1}); !errors.Is(err, ErrEmptyFilter) {
+		t.Fatalf("expected %v, but got %v", ErrEmptyFilter, err)
+	}
+	if _, err := tree.GenerateCompactMultiProofEVM([]byte{1}); err == nil {
+		t.Fatal("expected error for an EVM proof of an empty bloom filter")
+	}
+
+	// the encoded tree takes the empty bloom filter again
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BloomTree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.SetBloomFilter(bf); err != nil {
+		t.Fatal(err)
+	}
+	full, err := NewBloomTree(generateDBF(10, seed, []byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := full.SetBloomFilter(bf); err == nil {
+		t.Fatal("expected error attaching an empty bloom filter to a tree of another root")
+	}
+}
+
+func TestZeroFilter(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	for _, opts := range [][]Option{nil, {WithSparse()}, {WithChunkSize(128), WithHash(Keccak256)}} {
+		dbf := DBF.NewDbf(200, 0.2, []byte(seed))
+		tree, err := NewBloomTree(dbf, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := EmptyRoot(uint64(dbf.BitArray().Len()), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.Root() != root {
+			t.Fatal("expected the tree of an all-zero bloom filter to have the empty root of its size")
+		}
+		for i := 0; i < 50; i++ {
+			elem := []byte{byte(i)}
+			proof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), proof, root, dbf, opts...)
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified || proof.ProofType.IsPresence() {
+				t.Fatalf("failed to verify the absence of element %v from an all-zero bloom filter", elem)
+			}
+		}
+	}
+}
@@ -0,0 +1,716 @@
+package bloomtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// MarshalBinary encodes the proof as the proof type, followed by the uvarint length prefixed chunks,
+// proof hashes, absent indices and chunk words, the uvarint chunk size if it is known, and the uvarint
+// length prefixed word commitments of every chunk of blinded proofs.
+func (p *CompactMultiProof) MarshalBinary() ([]byte, error) {
+	if err := p.checkBinary(); err != nil {
+		return nil, err
+	}
+	return p.appendBinary(make([]byte, 0, p.binarySize())), nil
+}
+
+// checkBinary returns an error if the proof cannot be encoded with MarshalBinary.
+func (p *CompactMultiProof) checkBinary() error {
+	if p.ChunkSize < 0 {
+		return fmt.Errorf("invalid chunk size %d", p.ChunkSize)
+	}
+	if len(p.WordCommitments) != 0 && p.ChunkSize == 0 {
+		return errors.New("proofs with word commitments require a chunk size")
+	}
+	return nil
+}
+
+// appendBinary appends the MarshalBinary encoding of a valid proof to data.
+func (p *CompactMultiProof) appendBinary(data []byte) []byte {
+	buf := bytes.NewBuffer(data)
+	buf.WriteByte(byte(p.ProofType))
+	writeHashes(buf, p.Chunks)
+	writeHashes(buf, p.Proof)
+	writeUvarint(buf, uint64(len(p.AbsentIndices)))
+	buf.Write(p.AbsentIndices)
+	writeUvarint(buf, uint64(len(p.ChunkWords)))
+	for _, words := range p.ChunkWords {
+		writeWords(buf, words)
+	}
+	if p.ChunkSize != 0 {
+		writeUvarint(buf, uint64(p.ChunkSize))
+	}
+	if len(p.WordCommitments) != 0 {
+		writeUvarint(buf, uint64(len(p.WordCommitments)))
+		for _, commitments := range p.WordCommitments {
+			writeHashes(buf, commitments)
+		}
+	}
+	return buf.Bytes()
+}
+
+// binarySize returns the number of bytes of the MarshalBinary encoding of the proof.
+func (p *CompactMultiProof) binarySize() int {
+	n := 1 + uvarintSize(uint64(len(p.Chunks))) + 32*len(p.Chunks) + uvarintSize(uint64(len(p.Proof))) + 32*len(p.Proof) +
+		uvarintSize(uint64(len(p.AbsentIndices))) + len(p.AbsentIndices) + uvarintSize(uint64(len(p.ChunkWords)))
+	for _, words := range p.ChunkWords {
+		n += uvarintSize(uint64(len(words))) + 8*len(words)
+	}
+	if p.ChunkSize != 0 {
+		n += uvarintSize(uint64(p.ChunkSize))
+	}
+	if len(p.WordCommitments) != 0 {
+		n += uvarintSize(uint64(len(p.WordCommitments)))
+		for _, commitments := range p.WordCommitments {
+			n += uvarintSize(uint64(len(commitments))) + 32*len(commitments)
+		}
+	}
+	return n
+}
+
+// uvarintSize returns the number of bytes of the uvarint encoding of v.
+func uvarintSize(v uint64) int {
+	n := 1
+	for ; v >= 0x80; v >>= 7 {
+		n++
+	}
+	return n
+}
+
+// UnmarshalBinary decodes a proof encoded with MarshalBinary.
+func (p *CompactMultiProof) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	proofType, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("decoding proof type: %w", err)
+	}
+	chunks, err := readHashes(r)
+	if err != nil {
+		return fmt.Errorf("decoding chunks: %w", err)
+	}
+	proof, err := readHashes(r)
+	if err != nil {
+		return fmt.Errorf("decoding proof hashes: %w", err)
+	}
+	absentIndices, err := readBytes(r)
+	if err != nil {
+		return fmt.Errorf("decoding absent indices: %w", err)
+	}
+	numChunkWords, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("decoding chunk words: %w", err)
+	}
+	if numChunkWords > uint64(r.Len()) {
+		return fmt.Errorf("decoding chunk words: %w", io.ErrUnexpectedEOF)
+	}
+	var chunkWords [][]uint64
+	for i := uint64(0); i < numChunkWords; i++ {
+		words, err := readWords(r)
+		if err != nil {
+			return fmt.Errorf("decoding chunk words: %w", err)
+		}
+		chunkWords = append(chunkWords, words)
+	}
+	var size uint64
+	if r.Len() != 0 {
+		if size, err = binary.ReadUvarint(r); err != nil {
+			return fmt.Errorf("decoding chunk size: %w", err)
+		}
+		if err := checkChunkSize(int(size)); err != nil || size > math.MaxInt32 {
+			return fmt.Errorf("invalid chunk size %d", size)
+		}
+	}
+	var wordCommitments [][][32]byte
+	if r.Len() != 0 {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("decoding word commitments: %w", err)
+		}
+		if n == 0 || n > uint64(r.Len()) {
+			return fmt.Errorf("decoding word commitments: invalid count %d", n)
+		}
+		for i := uint64(0); i < n; i++ {
+			commitments, err := readHashes(r)
+			if err != nil {
+				return fmt.Errorf("decoding word commitments: %w", err)
+			}
+			wordCommitments = append(wordCommitments, commitments)
+		}
+	}
+	if r.Len() != 0 {
+		return errors.New("trailing data after proof")
+	}
+	decoded := CompactMultiProof{
+		Chunks:          chunks,
+		Proof:           proof,
+		ProofType:       ProofType(proofType),
+		ChunkWords:      chunkWords,
+		AbsentIndices:   absentIndices,
+		ChunkSize:       int(size),
+		WordCommitments: wordCommitments,
+	}
+	if err := decoded.checkOrder(); err != nil {
+		return fmt.Errorf("non-canonical proof: %w", err)
+	}
+	*p = decoded
+	return nil
+}
+
+type proofJSON struct {
+	Chunks        []string   `json:"chunks"`
+	Proof         []string   `json:"proof"`
+	ProofType     uint8      `json:"proofType"`
+	ChunkWords    [][]string `json:"chunkWords,omitempty"`
+	AbsentIndices []uint8    `json:"absentIndices,omitempty"`
+	ChunkSize     int        `json:"chunkSize,omitempty"`
+	// WordCommitments are the hex encoded word commitments of every chunk.
+	WordCommitments [][]string       `json:"wordCommitments,omitempty"`
+	Provenance      []provenanceJSON `json:"provenance,omitempty"`
+}
+
+// MarshalJSON returns the canonical JSON form of the proof.
+func (p *CompactMultiProof) MarshalJSON() ([]byte, error) {
+	return p.CanonicalJSON()
+}
+
+// UnmarshalJSON decodes the JSON form of a proof.
+func (p *CompactMultiProof) UnmarshalJSON(data []byte) error {
+	var aux proofJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	chunks, err := decodeHexHashes(aux.Chunks)
+	if err != nil {
+		return fmt.Errorf("decoding chunks: %w", err)
+	}
+	proof, err := decodeHexHashes(aux.Proof)
+	if err != nil {
+		return fmt.Errorf("decoding proof hashes: %w", err)
+	}
+	var chunkWords [][]uint64
+	for _, s := range aux.ChunkWords {
+		words, err := decodeHexWords(s)
+		if err != nil {
+			return fmt.Errorf("decoding chunk words: %w", err)
+		}
+		chunkWords = append(chunkWords, words)
+	}
+	if aux.ChunkSize != 0 {
+		if err := checkChunkSize(aux.ChunkSize); err != nil {
+			return fmt.Errorf("invalid chunk size %d", aux.ChunkSize)
+		}
+	}
+	var wordCommitments [][][32]byte
+	for _, s := range aux.WordCommitments {
+		commitments, err := decodeHexHashes(s)
+		if err != nil {
+			return fmt.Errorf("decoding word commitments: %w", err)
+		}
+		wordCommitments = append(wordCommitments, commitments)
+	}
+	provenance, err := decodeProvenance(aux.Provenance)
+	if err != nil {
+		return fmt.Errorf("decoding provenance: %w", err)
+	}
+	decoded := CompactMultiProof{
+		Chunks:          chunks,
+		Proof:           proof,
+		ProofType:       ProofType(aux.ProofType),
+		ChunkWords:      chunkWords,
+		AbsentIndices:   aux.AbsentIndices,
+		ChunkSize:       aux.ChunkSize,
+		WordCommitments: wordCommitments,
+		Provenance:      provenance,
+	}
+	if err := decoded.checkOrder(); err != nil {
+		return fmt.Errorf("non-canonical proof: %w", err)
+	}
+	*p = decoded
+	return nil
+}
+
+type batchProofJSON struct {
+	Chunks          []string         `json:"chunks"`
+	Proof           []string         `json:"proof"`
+	ProofTypes      []int            `json:"proofTypes"`
+	AbsentIndices   [][]int          `json:"absentIndices,omitempty"`
+	ChunkWords      [][]string       `json:"chunkWords,omitempty"`
+	WordCommitments [][]string       `json:"wordCommitments,omitempty"`
+	Provenance      []provenanceJSON `json:"provenance,omitempty"`
+}
+
+// MarshalJSON encodes the batch proof with hex encoded hashes and words. The costs of the elements are
+// not encoded, as they are not needed for verification.
+func (p *BatchMultiProof) MarshalJSON() ([]byte, error) {
+	// small integers are encoded as numbers, encoding/json would encode byte slices as base64
+	aux := batchProofJSON{
+		Chunks:     hexStrings(p.Chunks),
+		Proof:      hexStrings(p.Proof),
+		ProofTypes: make([]int, len(p.ProofTypes)),
+	}
+	for i, v := range p.ProofTypes {
+		aux.ProofTypes[i] = int(v)
+	}
+	for _, positions := range p.AbsentIndices {
+		var ints []int
+		for _, v := range positions {
+			ints = append(ints, int(v))
+		}
+		aux.AbsentIndices = append(aux.AbsentIndices, ints)
+	}
+	for _, words := range p.ChunkWords {
+		s := make([]string, len(words))
+		for i, w := range words {
+			s[i] = fmt.Sprintf("%016x", w)
+		}
+		aux.ChunkWords = append(aux.ChunkWords, s)
+	}
+	for _, commitments := range p.WordCommitments {
+		aux.WordCommitments = append(aux.WordCommitments, hexStrings(commitments))
+	}
+	aux.Provenance = encodeProvenance(p.Provenance)
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON decodes the JSON form of a batch proof.
+func (p *BatchMultiProof) UnmarshalJSON(data []byte) error {
+	var aux batchProofJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	chunks, err := decodeHexHashes(aux.Chunks)
+	if err != nil {
+		return fmt.Errorf("decoding chunks: %w", err)
+	}
+	proof, err := decodeHexHashes(aux.Proof)
+	if err != nil {
+		return fmt.Errorf("decoding proof hashes: %w", err)
+	}
+	proofTypes := make([]ProofType, len(aux.ProofTypes))
+	for i, v := range aux.ProofTypes {
+		if v < 0 || v > int(Presence) {
+			return fmt.Errorf("invalid proof type %d", v)
+		}
+		proofTypes[i] = ProofType(v)
+	}
+	var absentIndices [][]uint8
+	for _, ints := range aux.AbsentIndices {
+		var positions []uint8
+		for _, v := range ints {
+			if v < 0 || v >= int(maxK) {
+				return fmt.Errorf("invalid absent index %d", v)
+			}
+			positions = append(positions, uint8(v))
+		}
+		absentIndices = append(absentIndices, positions)
+	}
+	var chunkWords [][]uint64
+	for _, s := range aux.ChunkWords {
+		words, err := decodeHexWords(s)
+		if err != nil {
+			return fmt.Errorf("decoding chunk words: %w", err)
+		}
+		chunkWords = append(chunkWords, words)
+	}
+	var wordCommitments [][][32]byte
+	for _, s := range aux.WordCommitments {
+		commitments, err := decodeHexHashes(s)
+		if err != nil {
+			return fmt.Errorf("decoding word commitments: %w", err)
+		}
+		wordCommitments = append(wordCommitments, commitments)
+	}
+	provenance, err := decodeProvenance(aux.Provenance)
+	if err != nil {
+		return fmt.Errorf("decoding provenance: %w", err)
+	}
+	decoded := BatchMultiProof{
+		Chunks:          chunks,
+		Proof:           proof,
+		ProofTypes:      proofTypes,
+		AbsentIndices:   absentIndices,
+		ChunkWords:      chunkWords,
+		WordCommitments: wordCommitments,
+		Provenance:      provenance,
+	}
+	if err := decoded.checkOrder(); err != nil {
+		return fmt.Errorf("non-canonical proof: %w", err)
+	}
+	*p = decoded
+	return nil
+}
+
+func hexStrings(hashes [][32]byte) []string {
+	ret := make([]string, len(hashes))
+	for i, h := range hashes {
+		ret[i] = hex.EncodeToString(h[:])
+	}
+	return ret
+}
+
+// treeEncodingVersion is the version of the binary encoding of bloom trees.
+// Version 2 added the hash function, version 1 trees are decoded as SHA-512/256 trees.
+// Version 3 added the blinding key of blinded trees.
+const treeEncodingVersion = 3
+
+// MarshalBinary encodes the nodes and construction parameters of the bloom tree.
+// The bloom filter is not part of the encoding, it has to be attached with SetBloomFilter after decoding.
+// The encoding of a blinded tree holds its blinding key, and must be kept as secret as the key.
+func (bt *BloomTree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(treeEncodingVersion)
+	writeUvarint(&buf, uint64(bt.cfg.chunkSize))
+	var flags byte
+	if bt.cfg.legacyPadding {
+		flags |= 1
+	}
+	if bt.cfg.blindingKey != nil {
+		flags |= 2
+	}
+	if bt.cfg.evm {
+		flags |= 4
+	}
+	if bt.cfg.wordTrees {
+		flags |= 8
+	}
+	if bt.cfg.sparse {
+		flags |= 16
+	}
+	buf.WriteByte(flags)
+	buf.WriteByte(byte(bt.cfg.hash))
+	writeUvarint(&buf, uint64(bt.cfg.absentIndices))
+	if bt.cfg.blindingKey != nil {
+		writeUvarint(&buf, uint64(len(bt.cfg.blindingKey)))
+		buf.Write(bt.cfg.blindingKey)
+	}
+	writeUvarint(&buf, uint64(len(bt.bounds)))
+	for _, v := range bt.bounds {
+		writeUvarint(&buf, v)
+	}
+	nodes, err := bt.allNodes()
+	if err != nil {
+		return nil, err
+	}
+	writeHashes(&buf, nodes)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a bloom tree encoded with MarshalBinary. The decoded tree keeps the
+// chunk size it was encoded with, regardless of the chunk size set by SetChunkSize.
+func (bt *BloomTree) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("decoding version: %w", err)
+	}
+	if version < 1 || version > treeEncodingVersion {
+		return fmt.Errorf("unsupported bloom tree encoding version %d", version)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("decoding chunk size: %w", err)
+	}
+	if err := checkChunkSize(int(size)); err != nil || size > math.MaxInt32 {
+		return fmt.Errorf("invalid chunk size %d", size)
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("decoding flags: %w", err)
+	}
+	var hash Hash
+	if version >= 2 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("decoding hash: %w", err)
+		}
+		if hash = Hash(b); !hash.valid() {
+			return fmt.Errorf("unknown hash function %v", hash)
+		}
+	}
+	absentIndices, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("decoding absent indices: %w", err)
+	}
+	var blindingKey []byte
+	if flags&2 != 0 {
+		if version < 3 {
+			return errors.New("blinded trees require encoding version 3")
+		}
+		if blindingKey, err = readBytes(r); err != nil {
+			return fmt.Errorf("decoding blinding key: %w", err)
+		}
+		if len(blindingKey) < minBlindingKey {
+			return errors.New("the blinding key must have at least 16 bytes")
+		}
+	}
+	numBounds, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("decoding chunk bounds: %w", err)
+	}
+	if numBounds > uint64(r.Len()) {
+		return fmt.Errorf("decoding chunk bounds: %w", io.ErrUnexpectedEOF)
+	}
+	var bounds []uint64
+	for i := uint64(0); i < numBounds; i++ {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("decoding chunk bounds: %w", err)
+		}
+		bounds = append(bounds, v)
+	}
+	nodes, err := readHashes(r)
+	if err != nil {
+		return fmt.Errorf("decoding nodes: %w", err)
+	}
+	if err := core.CheckTreeLength(len(nodes)); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("trailing data after bloom tree")
+	}
+	*bt = BloomTree{
+		nodes:  nodes,
+		bounds: bounds,
+		cfg: config{
+			legacyPadding: flags&1 != 0,
+			absentIndices: int(absentIndices),
+			hash:          hash,
+			chunkSize:     int(size),
+			blindingKey:   blindingKey,
+			evm:           flags&4 != 0,
+			wordTrees:     flags&8 != 0,
+			sparse:        flags&16 != 0,
+		},
+	}
+	return nil
+}
+
+type treeJSON struct {
+	ChunkSize     int      `json:"chunkSize"`
+	Hash          string   `json:"hash,omitempty"`
+	LegacyPadding bool     `json:"legacyPadding,omitempty"`
+	AbsentIndices int      `json:"absentIndices,omitempty"`
+	Bounds        []uint64 `json:"bounds,omitempty"`
+	BlindingKey   string   `json:"blindingKey,omitempty"`
+	EVM           bool     `json:"evm,omitempty"`
+	WordTrees     bool     `json:"wordTrees,omitempty"`
+	Sparse        bool     `json:"sparse,omitempty"`
+	Nodes         []string `json:"nodes"`
+}
+
+// MarshalJSON encodes the nodes and construction parameters of the bloom tree as JSON.
+// The bloom filter is not part of the encoding, it has to be attached with SetBloomFilter after decoding.
+func (bt *BloomTree) MarshalJSON() ([]byte, error) {
+	treeNodes, err := bt.allNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, len(treeNodes))
+	for i, n := range treeNodes {
+		nodes[i] = hex.EncodeToString(n[:])
+	}
+	return json.Marshal(treeJSON{
+		ChunkSize:     bt.cfg.chunkSize,
+		Hash:          bt.cfg.hash.String(),
+		LegacyPadding: bt.cfg.legacyPadding,
+		AbsentIndices: bt.cfg.absentIndices,
+		Bounds:        bt.bounds,
+		BlindingKey:   hex.EncodeToString(bt.cfg.blindingKey),
+		EVM:           bt.cfg.evm,
+		WordTrees:     bt.cfg.wordTrees,
+		Sparse:        bt.cfg.sparse,
+		Nodes:         nodes,
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a bloom tree.
+func (bt *BloomTree) UnmarshalJSON(data []byte) error {
+	var aux treeJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if err := checkChunkSize(aux.ChunkSize); err != nil {
+		return fmt.Errorf("invalid chunk size %d", aux.ChunkSize)
+	}
+	hash := SHA512_256
+	if aux.Hash != "" {
+		var err error
+		if hash, err = ParseHash(aux.Hash); err != nil {
+			return err
+		}
+	}
+	var blindingKey []byte
+	if aux.BlindingKey != "" {
+		var err error
+		if blindingKey, err = hex.DecodeString(aux.BlindingKey); err != nil {
+			return fmt.Errorf("decoding blinding key: %w", err)
+		}
+		if len(blindingKey) < minBlindingKey {
+			return errors.New("the blinding key must have at least 16 bytes")
+		}
+	}
+	nodes, err := decodeHexHashes(aux.Nodes)
+	if err != nil {
+		return fmt.Errorf("decoding nodes: %w", err)
+	}
+	if err := core.CheckTreeLength(len(nodes)); err != nil {
+		return err
+	}
+	*bt = BloomTree{
+		nodes:  nodes,
+		bounds: aux.Bounds,
+		cfg: config{
+			legacyPadding: aux.LegacyPadding,
+			absentIndices: aux.AbsentIndices,
+			hash:          hash,
+			chunkSize:     aux.ChunkSize,
+			blindingKey:   blindingKey,
+			evm:           aux.EVM,
+			wordTrees:     aux.WordTrees,
+			sparse:        aux.Sparse,
+		},
+	}
+	return nil
+}
+
+// SetBloomFilter attaches the bloom filter the tree was built from, e.g. after decoding the tree.
+// Only the number of chunks is checked, the chunks are not hashed again.
+func (bt *BloomTree) SetBloomFilter(b BloomFilter) error {
+	if bt.frozen {
+		return ErrFrozen
+	}
+	if isEmptyFilter(b) {
+		if bt.nodeCount() != 1 || bt.Root() != bt.cfg.hash.emptyRoot() {
+			return errors.New("a bloom filter without bits only fits the tree of the empty root")
+		}
+		bt.bf = b
+		return nil
+	}
+	bfAsInt, err := bloomFilterWords(b)
+	if err != nil {
+		return err
+	}
+	leafs := bt.leafCount(bfAsInt)
+	if leafNum := (bt.nodeCount() + 1) / 2; leafs > leafNum || leafs <= leafNum/2 {
+		return fmt.Errorf("a bloom filter of %d chunks does not fit a tree of %d leafs", leafs, leafNum)
+	}
+	bt.bf = b
+	return nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func writeHashes(buf *bytes.Buffer, hashes [][32]byte) {
+	writeUvarint(buf, uint64(len(hashes)))
+	for _, h := range hashes {
+		buf.Write(h[:])
+	}
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func readHashes(r *bytes.Reader) ([][32]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()/32) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var hashes [][32]byte
+	for i := uint64(0); i < n; i++ {
+		var h [32]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+func writeWords(buf *bytes.Buffer, words []uint64) {
+	writeUvarint(buf, uint64(len(words)))
+	var b [8]byte
+	for _, w := range words {
+		binary.LittleEndian.PutUint64(b[:], w)
+		buf.Write(b[:])
+	}
+}
+
+func readWords(r *bytes.Reader) ([]uint64, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()/8) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	words := make([]uint64, n)
+	b := make([]byte, 8)
+	for i := range words {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		words[i] = binary.LittleEndian.Uint64(b)
+	}
+	return words, nil
+}
+
+func decodeHexWords(s []string) ([]uint64, error) {
+	words := make([]uint64, len(s))
+	for i, v := range s {
+		if len(v) != 16 {
+			return nil, fmt.Errorf("invalid word length %d", len(v))
+		}
+		w, err := strconv.ParseUint(v, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		words[i] = w
+	}
+	return words, nil
+}
+
+func decodeHexHashes(s []string) ([][32]byte, error) {
+	var hashes [][32]byte
+	for _, v := range s {
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 32 {
+			return nil, fmt.Errorf("invalid hash length %d", len(b))
+		}
+		var h [32]byte
+		copy(h[:], b)
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,179 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestCompactMultiProofEncoding(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{0}, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithAbsentIndices(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, elem := range [][]byte{{1}, {3}, {4}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := multiproof.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromBinary CompactMultiProof
+		if err := fromBinary.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		jsonData, err := json.Marshal(multiproof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON CompactMultiProof
+		if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decoded := range []*CompactMultiProof{&fromBinary, &fromJSON} {
+			if len(decoded.ChunkWords) != len(multiproof.ChunkWords) || decoded.ChunkWords[0][0] != multiproof.ChunkWords[0][0] {
+				t.Fatalf("decoded chunk words %v do not match %v", decoded.ChunkWords, multiproof.ChunkWords)
+			}
+			if decoded.ProofType != multiproof.ProofType || len(decoded.AbsentIndices) != len(multiproof.AbsentIndices) {
+				t.Fatalf("decoded proof type %v, %v does not match %v, %v", decoded.ProofType, decoded.AbsentIndices,
+					multiproof.ProofType, multiproof.AbsentIndices)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), decoded, tree.Root(), dbf)
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify decoded proof for element %v", elem)
+			}
+		}
+
+		var truncated CompactMultiProof
+		// the chunk size of one byte is optional, so the chunk words are truncated
+		if err := truncated.UnmarshalBinary(data[:len(data)-2]); err == nil {
+			t.Fatal("expected error for truncated proof")
+		}
+		var trailing CompactMultiProof
+		if err := trailing.UnmarshalBinary(append(data, 0)); err == nil {
+			t.Fatal("expected error for trailing data")
+		}
+	}
+}
+
+func TestBloomTreeEncoding(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{0}, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithLegacyPadding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	adaptiveTree, err := NewAdaptiveBloomTree(dbf, 64, 256, WithHash(BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bt := range []*BloomTree{tree, adaptiveTree} {
+		data, err := bt.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromBinary BloomTree
+		if err := fromBinary.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		jsonData, err := json.Marshal(bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON BloomTree
+		if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decoded := range []*BloomTree{&fromBinary, &fromJSON} {
+			if decoded.Root() != bt.Root() || len(decoded.nodes) != len(bt.nodes) || len(decoded.bounds) != len(bt.bounds) {
+				t.Fatal("decoded tree does not match")
+			}
+			if !reflect.DeepEqual(decoded.cfg, bt.cfg) {
+				t.Fatalf("decoded config %+v does not match %+v", decoded.cfg, bt.cfg)
+			}
+			if _, err := decoded.GenerateCompactMultiProof([]byte{1}); !errors.Is(err, ErrNoBloomFilter) {
+				t.Fatalf("expected error %v, but got %v", ErrNoBloomFilter, err)
+			}
+			if err := decoded.SetBloomFilter(dbf); err != nil {
+				t.Fatal(err)
+			}
+			multiproof, err := decoded.GenerateCompactMultiProof([]byte{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(multiproof.Chunks) == 0 {
+				t.Fatal("expected chunks in proof")
+			}
+		}
+	}
+}
+
+func TestBloomTreeEncodingErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{0})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded BloomTree
+	// the decoded tree keeps its chunk size regardless of the package chunk size
+	SetChunkSize(128)
+	err = decoded.UnmarshalBinary(data)
+	SetChunkSize(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.cfg.chunkSize != 64 {
+		t.Fatalf("expected chunk size 64, but got %d", decoded.cfg.chunkSize)
+	}
+	// the chunk size 64 is the single uvarint byte after the version
+	invalid := append([]byte{data[0], 65}, data[2:]...)
+	if err := decoded.UnmarshalBinary(invalid); err == nil {
+		t.Fatal("expected error for invalid chunk size")
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-5]); err == nil {
+		t.Fatal("expected error for truncated tree")
+	}
+	if err := decoded.UnmarshalBinary(append([]byte{treeEncodingVersion + 1}, data[1:]...)); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+
+	// version 1 has no hash byte after the flags and is decoded as SHA-512/256
+	v1 := append([]byte{1}, data[1:3]...)
+	if err := decoded.UnmarshalBinary(append(v1, data[4:]...)); err != nil {
+		t.Fatal(err)
+	} else if decoded.Root() != tree.Root() || decoded.cfg.hash != SHA512_256 {
+		t.Fatal("decoded version 1 tree does not match")
+	}
+	if err := decoded.UnmarshalBinary(append(append([]byte(nil), data[:3]...), append([]byte{42}, data[4:]...)...)); err == nil {
+		t.Fatal("expected error for unknown hash function")
+	}
+
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.SetBloomFilter(DBF.NewDbf(1000, 0.2, []byte("secret seed"))); err == nil {
+		t.Fatal("expected error for bloom filter not fitting the tree")
+	}
+}
@@ -0,0 +1,156 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+var (
+	// ErrIndexOutOfRange is returned when a bloom filter index exceeds the length of the bloom filter.
+	ErrIndexOutOfRange = errors.New("bloom filter index out of range")
+	// ErrLayerIndexOutOfRange is returned when a node index lies outside of its layer of the tree.
+	ErrLayerIndexOutOfRange = core.ErrLayerIndexOutOfRange
+	// ErrNoBloomFilter is returned when a decoded tree is used before its bloom filter was attached.
+	ErrNoBloomFilter = errors.New("no bloom filter attached to the tree")
+	// ErrEmptyFilter is returned when a tree of a bloom filter without bits is updated or asked for chunks.
+	ErrEmptyFilter = errors.New("the bloom filter has no bits")
+	// ErrNoIndices is returned when the bloom filter maps an element to no indices.
+	ErrNoIndices = errors.New("the bloom filter returned no indices for the element")
+	// ErrInconsistentIndices is returned when the index of an absence proof is not one of the element indices.
+	ErrInconsistentIndices = errors.New("the absent index is not one of the element indices")
+	// ErrRootMismatch is returned when the roots given with WithCrossCheckRoot differ from the verified root.
+	ErrRootMismatch = errors.New("the independently built roots do not match")
+	// ErrFrozen is returned when a frozen tree is modified.
+	ErrFrozen = errors.New("the tree is frozen")
+	// ErrChunkSizeMismatch is returned when a proof was generated from a tree with another chunk size.
+	ErrChunkSizeMismatch = errors.New("the chunk size of the proof does not match")
+	// ErrCommittedRootMismatch is returned when a root and the parameters of a proof do not match a committed root.
+	ErrCommittedRootMismatch = errors.New("the root and parameters do not match the committed root")
+	// ErrInjectedFault is returned by a FaultStore failing a read or write on purpose.
+	ErrInjectedFault = errors.New("injected storage fault")
+	// ErrManifestMismatch is returned when a bloom filter or the root rebuilt from it do not match a build manifest.
+	ErrManifestMismatch = errors.New("the build does not match the manifest")
+	// ErrStoreLocked is returned when the file of a node store is locked by another process, e.g. when a rebuilder
+	// opens a file that readers have mapped, or a reader opens a file that is being rebuilt.
+	ErrStoreLocked = errors.New("the node store file is locked by another process")
+	// ErrNotCheckpointed is returned when a root was not published in the period of a checkpoint.
+	ErrNotCheckpointed = errors.New("the root was not published in the period of the checkpoint")
+	// ErrUnknownCodec is returned when no codec is registered under a name.
+	ErrUnknownCodec = errors.New("unknown codec")
+	// ErrInvalidProof is matched by every VerificationError, i.e. by every proof that failed verification.
+	ErrInvalidProof = errors.New("invalid proof")
+)
+
+// FailureReason tells why a proof failed verification.
+type FailureReason int
+
+const (
+	// ReasonRootMismatch is the reason of proofs whose chunks and hashes reconstruct another root.
+	ReasonRootMismatch FailureReason = iota + 1
+	// ReasonChunkMismatch is the reason of proofs whose chunks do not match the bits of the element indices,
+	// e.g. a presence proof opening a zero bit.
+	ReasonChunkMismatch
+	// ReasonProofType is the reason of proofs whose proof type or absent indices are out of range or malformed.
+	ReasonProofType
+	// ReasonChunkCount is the reason of proofs with the wrong number of chunks or chunk words for the element
+	// indices, i.e. for the k hash functions of the bloom filter.
+	ReasonChunkCount
+	// ReasonHashCount is the reason of proofs with too few or too many hashes.
+	ReasonHashCount
+	// ReasonChunkSize is the reason of proofs generated from a tree with another chunk size.
+	ReasonChunkSize
+	// ReasonNonCanonical is the reason of proofs violating the canonical order, see CompactMultiProof.CheckOrder.
+	ReasonNonCanonical
+	// ReasonTreeHeight is the reason of proofs of a tree whose height differs from the height pinned by the
+	// verifier, see WithTreeHeight.
+	ReasonTreeHeight
+)
+
+func (r FailureReason) String() string {
+	switch r {
+	case ReasonRootMismatch:
+		return "root mismatch"
+	case ReasonChunkMismatch:
+		return "chunk mismatch"
+	case ReasonProofType:
+		return "invalid proof type"
+	case ReasonChunkCount:
+		return "wrong number of chunks"
+	case ReasonHashCount:
+		return "wrong number of hashes"
+	case ReasonChunkSize:
+		return "chunk size mismatch"
+	case ReasonNonCanonical:
+		return "non-canonical order"
+	case ReasonTreeHeight:
+		return "tree height mismatch"
+	}
+	return fmt.Sprintf("FailureReason(%d)", int(r))
+}
+
+// VerificationError reports why a proof failed verification, so callers can tell a malformed proof from a
+// proof against another root, and both from the valid absence proof of an element. It matches ErrInvalidProof
+// with errors.Is, and unwraps to its cause, e.g. ErrChunkSizeMismatch.
+//
+// Functions of this package returning whether a proof verifies report a well-formed proof reconstructing another
+// root with ReasonRootMismatch. Their result tells whether the proof verifies against the root, while its proof
+// type tells the presence or absence of the element.
+type VerificationError struct {
+	Reason FailureReason
+	Err    error
+}
+
+func (e *VerificationError) Error() string {
+	if e.Err == nil {
+		return "invalid proof: " + e.Reason.String()
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrInvalidProof.
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrInvalidProof
+}
+
+// chunkSizeMismatch returns the VerificationError of a proof of a tree with another chunk size.
+func chunkSizeMismatch(proofChunkSize, chunkSize int) error {
+	return &VerificationError{Reason: ReasonChunkSize, Err: fmt.Errorf("%w: the proof has chunk size %d, but the chunk size is %d",
+		ErrChunkSizeMismatch, proofChunkSize, chunkSize)}
+}
+
+// invalidProof returns a VerificationError of the reason with a formatted cause.
+func invalidProof(reason FailureReason, format string, args ...interface{}) error {
+	return &VerificationError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// IndexError reports a bloom filter index that exceeds the length of the bloom filter.
+type IndexError struct {
+	Index  uint64
+	Length uint64
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("bloom filter index %d exceeds the bloom filter length %d", e.Index, e.Length)
+}
+
+// Unwrap returns ErrIndexOutOfRange.
+func (e *IndexError) Unwrap() error {
+	return ErrIndexOutOfRange
+}
+
+// checkIndices returns an IndexError for the first index that exceeds the bloom filter length.
+func checkIndices(indices []uint64, length uint64) error {
+	for _, v := range indices {
+		if v >= length {
+			return &IndexError{Index: v, Length: length}
+		}
+	}
+	return nil
+}
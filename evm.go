@@ -0,0 +1,168 @@
+package bloomtree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// EVMProof proves the presence or absence of an element in a tree built with WithEVM, in the layout of the
+// reference Solidity verifier in contracts/BloomTreeVerifier.sol. Every opened chunk carries its own path to
+// the root, which costs more hashes than a compact multiproof, but is simple and cheap to verify in a contract.
+type EVMProof struct {
+	// Present is true for presence proofs, and false for absence proofs.
+	Present bool
+	// Indices are the proven bloom filter indices, all element indices of a presence proof,
+	// or the single zero index of an absence proof.
+	Indices []uint64
+	// Chunks are the distinct chunks holding the indices, in increasing order.
+	Chunks []EVMChunk
+}
+
+// EVMChunk is a chunk of an EVMProof.
+type EVMChunk struct {
+	// Index is the leaf index of the chunk.
+	Index uint64
+	// Data are the bits of the chunk as big-endian uint256 values, bit i of the chunk being bit i%256 of Data[i/256].
+	Data [][32]byte
+	// Siblings are the sibling hashes on the path from the leaf to the root.
+	Siblings [][32]byte
+}
+
+// WithEVM builds the tree with keccak256 and the leaf layout of the reference Solidity verifier, so its root
+// can be posted on-chain and its EVMProofs verified by a contract. A leaf hashes the byte 0, the big-endian
+// uint256 leaf index and the Data of the chunk, as keccak256(abi.encodePacked(uint8(0), index, data)).
+// Internal nodes hash the concatenation of their children. EVM trees cannot be blinded or adaptive.
+func WithEVM() Option {
+	return func(c *config) error {
+		c.evm = true
+		c.hash = Keccak256
+		return nil
+	}
+}
+
+// checkEVM returns an error if the options conflict with the EVM layout.
+func (c config) checkEVM() error {
+	if !c.evm {
+		return nil
+	}
+	if c.hash != Keccak256 {
+		return errors.New("trees with the EVM layout must use keccak256")
+	}
+	if c.blindingKey != nil {
+		return errors.New("trees with the EVM layout cannot be blinded")
+	}
+	return nil
+}
+
+// evmSlots packs bloom filter words into big-endian uint256 values, four words per value.
+func evmSlots(words []uint64) [][32]byte {
+	slots := make([][32]byte, (len(words)+3)/4)
+	for i, w := range words {
+		// word i holds bits 64*(i%4) to 64*(i%4)+63 of its value
+		offset := 24 - 8*(i%4)
+		binary.BigEndian.PutUint64(slots[i/4][offset:offset+8], w)
+	}
+	return slots
+}
+
+// evmLeaf hashes a chunk as keccak256(abi.encodePacked(uint8(0), uint256(index), data)).
+func evmLeaf(index uint64, data [][32]byte) [32]byte {
+	elem := make([]byte, 33, 33+32*len(data))
+	binary.BigEndian.PutUint64(elem[25:], index)
+	for _, slot := range data {
+		elem = append(elem, slot[:]...)
+	}
+	return Keccak256.sum(elem)
+}
+
+// GenerateCompactMultiProofEVM returns a proof of the presence or absence of an element in the EVM layout.
+// The tree must have been built with WithEVM.
+func (bt *BloomTree) GenerateCompactMultiProofEVM(elem []byte) (*EVMProof, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if !bt.cfg.evm {
+		return nil, errors.New("the tree was not built with the EVM layout")
+	}
+	indices, present := bt.bf.Proof(elem)
+	if len(indices) == 0 {
+		return nil, ErrNoIndices
+	}
+	if err := checkIndices(indices, uint64(bt.bf.BitArray().Len())); err != nil {
+		return nil, err
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	proof := &EVMProof{Present: present, Indices: indices}
+	words := bt.bf.BitArray().Bytes()
+	root := uint64(bt.nodeCount() - 1)
+	leafNum := uint64(bt.nodeCount()+1) / 2
+	for i, v := range indices {
+		chunk := bt.chunkIndex(v)
+		if i > 0 && chunk == bt.chunkIndex(indices[i-1]) {
+			continue
+		}
+		bt.recordChunk(chunk)
+		var siblings [][32]byte
+		for node := chunk; node != root; node = leafNum + node/2 {
+			siblings = append(siblings, bt.node(int(node^1)))
+		}
+		proof.Chunks = append(proof.Chunks, EVMChunk{
+			Index:    chunk,
+			Data:     evmSlots(bt.leafWords(words, int(chunk))),
+			Siblings: siblings,
+		})
+	}
+	if err := bt.nodesErr(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyEVMProof verifies the proof against the root of a tree with the given chunk size, exactly like the
+// reference Solidity verifier, and returns whether it proves the presence or the absence of the element.
+// Like the contract, it trusts the indices to be the bloom filter indices of the element, which the caller
+// has to check, e.g. with the MapElementToBF method of the bloom filter.
+func VerifyEVMProof(proof *EVMProof, root [32]byte, chunkSize uint64) (bool, error) {
+	if chunkSize == 0 || chunkSize%64 != 0 {
+		return false, errors.New("The chunk size must be divisible by 64")
+	}
+	if len(proof.Indices) == 0 {
+		return false, ErrNoIndices
+	}
+	if !proof.Present && len(proof.Indices) != 1 {
+		return false, errors.New("an absence proof must have a single index")
+	}
+	for i, chunk := range proof.Chunks {
+		node := evmLeaf(chunk.Index, chunk.Data)
+		position := chunk.Index
+		for _, sibling := range chunk.Siblings {
+			if position&1 == 0 {
+				node = Keccak256.child(node, sibling)
+			} else {
+				node = Keccak256.child(sibling, node)
+			}
+			position >>= 1
+		}
+		if position != 0 || node != root {
+			return false, invalidProof(ReasonRootMismatch, "chunk %d does not match the root", i)
+		}
+	}
+	for _, v := range proof.Indices {
+		chunk := sort.Search(len(proof.Chunks), func(i int) bool { return proof.Chunks[i].Index >= v/chunkSize })
+		if chunk == len(proof.Chunks) || proof.Chunks[chunk].Index != v/chunkSize {
+			return false, fmt.Errorf("the chunk of index %d is missing", v)
+		}
+		offset := v % chunkSize
+		data := proof.Chunks[chunk].Data
+		if offset/256 >= uint64(len(data)) {
+			return false, fmt.Errorf("index %d exceeds its chunk", v)
+		}
+		bit := offset % 256
+		if set := data[offset/256][31-bit/8]>>(bit%8)&1 == 1; set != proof.Present {
+			return false, fmt.Errorf("bit %d does not match the proof type", v)
+		}
+	}
+	return proof.Present, nil
+}
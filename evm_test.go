@@ -0,0 +1,121 @@
+package bloomtree
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+func TestEVMLeaf(t *testing.T) {
+	words := []uint64{1, 2, 3, 4, 5}
+	// abi.encodePacked(uint8(0), uint256(7), data) of the two uint256 values packing the words
+	packed := make([]byte, 1+32+64)
+	packed[32] = 7
+	for i, w := range words {
+		end := 1 + 32 + 32*(i/4+1) - 8*(i%4)
+		binary.BigEndian.PutUint64(packed[end-8:end], w)
+	}
+	k := sha3.NewLegacyKeccak256()
+	k.Write(packed)
+	var expected [32]byte
+	copy(expected[:], k.Sum(nil))
+	if leaf := evmLeaf(7, evmSlots(words)); leaf != expected {
+		t.Fatalf("expected leaf %x, but got %x", expected, leaf)
+	}
+}
+
+func TestGenerateCompactMultiProofEVM(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2}, []byte{3})
+	for _, size := range []uint64{64, 512} {
+		tree, err := NewBloomTree(dbf, WithEVM(), WithChunkSize(int(size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			element []byte
+			present bool
+		}{
+			{element: []byte{1}, present: true},
+			{element: []byte{3}, present: true},
+			{element: []byte{42}, present: false},
+		} {
+			proof, err := tree.GenerateCompactMultiProofEVM(test.element)
+			if err != nil {
+				t.Fatal(err)
+			}
+			present, err := VerifyEVMProof(proof, tree.Root(), size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if present != test.present {
+				t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+			}
+			// compact multiproofs of EVM trees verify as well
+			multiproof, err := tree.GenerateCompactMultiProof(test.element)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf,
+				WithEVM(), WithChunkSize(int(size)))
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify compact multiproof of element %v", test.element)
+			}
+		}
+	}
+}
+
+func TestVerifyEVMProofErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithEVM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name      string
+		element   []byte
+		chunkSize uint64
+		tamper    func(p *EVMProof)
+	}{
+		{name: "flipped sibling", element: []byte{1}, tamper: func(p *EVMProof) { p.Chunks[0].Siblings[0][0] ^= 1 }},
+		{name: "flipped data", element: []byte{1}, tamper: func(p *EVMProof) { p.Chunks[0].Data[0][31] ^= 1 }},
+		{name: "missing chunk", element: []byte{1}, tamper: func(p *EVMProof) { p.Chunks = p.Chunks[1:] }},
+		{name: "presence claimed for absent element", element: []byte{42}, tamper: func(p *EVMProof) { p.Present = true }},
+		{name: "absence claimed for present element", element: []byte{1}, tamper: func(p *EVMProof) { p.Present = false }},
+		{name: "wrong chunk size", element: []byte{1}, chunkSize: 128, tamper: func(p *EVMProof) {}},
+		{name: "short path", element: []byte{1}, tamper: func(p *EVMProof) { p.Chunks[0].Siblings = p.Chunks[0].Siblings[1:] }},
+	}
+	for _, test := range tests {
+		proof, err := tree.GenerateCompactMultiProofEVM(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(proof)
+		chunkSize := test.chunkSize
+		if chunkSize == 0 {
+			chunkSize = 64
+		}
+		if _, err := VerifyEVMProof(proof, tree.Root(), chunkSize); err == nil {
+			t.Fatalf("expected error for %s", test.name)
+		}
+	}
+
+	if _, err := NewBloomTree(dbf, WithEVM(), WithHash(SHA256)); err == nil {
+		t.Fatal("expected error for an EVM tree with another hash function")
+	}
+	if _, err := NewBloomTree(dbf, WithEVM(), WithBlinding([]byte("0123456789abcdef"))); err == nil {
+		t.Fatal("expected error for a blinded EVM tree")
+	}
+	plain, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.GenerateCompactMultiProofEVM([]byte{1}); err == nil {
+		t.Fatal("expected error for a tree without the EVM layout")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/server"
+)
+
+// Config are the parameters of a blocklist service.
+type Config struct {
+	// Capacity is the number of entries the bloom filter is sized for.
+	Capacity uint
+	// FalsePositiveRate is the false positive rate of the bloom filter at its capacity.
+	FalsePositiveRate float64
+	// Seed is the seed of the bloom filter, which clients need to map entries to bloom filter indices.
+	Seed []byte
+	// Epochs is the number of earlier epochs whose roots are still served, so clients can rotate lazily.
+	Epochs int
+	// Key signs the root of every epoch.
+	Key ed25519.PrivateKey
+}
+
+// SignedRoot is the root of an epoch together with the parameters of its tree, signed by the service.
+type SignedRoot struct {
+	Epoch       uint64
+	Attestation bloomtree.RootAttestation
+	Signature   []byte
+}
+
+type signedRootJSON struct {
+	Epoch       uint64 `json:"epoch"`
+	Root        string `json:"root"`
+	ChunkSize   uint64 `json:"chunkSize"`
+	Hash        string `json:"hash"`
+	NumOfHashes uint64 `json:"numOfHashes"`
+	FilterBits  uint64 `json:"filterBits"`
+	Signature   string `json:"signature"`
+}
+
+// Service is a blocklist whose entries are published in epochs. Entries added during an epoch are queued,
+// and become visible once Rotate starts the next epoch with a new signed root.
+//
+// The service serves the proofs of the server package, the signed root of the current epoch at /signed-root,
+// and ingests entries POSTed to /entries, one per line.
+type Service struct {
+	mu        sync.Mutex
+	cfg       Config
+	tree      *bloomtree.BloomTree
+	pending   [][]byte
+	signed    *SignedRoot
+	snapshots *bloomtree.SnapshotStore
+	proofs    *server.Server
+	mux       *http.ServeMux
+}
+
+// NewService returns a service with an empty blocklist, whose first epoch is already published.
+func NewService(cfg Config) (*Service, error) {
+	if len(cfg.Key) != ed25519.PrivateKeySize {
+		return nil, errors.New("the service needs an ed25519 private key")
+	}
+	tree, err := bloomtree.NewBloomTree(DBF.NewDbf(cfg.Capacity, cfg.FalsePositiveRate, cfg.Seed))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := bloomtree.NewSnapshotStore(cfg.Epochs + 1)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{cfg: cfg, tree: tree, snapshots: snapshots, mux: http.NewServeMux()}
+	frozen, err := tree.Freeze()
+	if err != nil {
+		return nil, err
+	}
+	s.proofs = server.New(frozen)
+	s.proofs.SetSnapshots(snapshots)
+	s.mux.Handle("/", s.proofs)
+	s.mux.HandleFunc("/signed-root", s.handleSignedRoot)
+	s.mux.HandleFunc("/entries", s.handleEntries)
+	if _, err := s.Rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add queues an entry for the next epoch.
+func (s *Service) Add(entry []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, entry)
+}
+
+// Rotate adds the queued entries to the tree and publishes its root as the next epoch. Proofs against the
+// roots of the last Config.Epochs epochs are still served. An epoch without new entries has the root of the
+// previous one.
+func (s *Service) Rotate() (*SignedRoot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.pending {
+		if err := s.tree.Update(entry); err != nil {
+			return nil, err
+		}
+	}
+	s.pending = nil
+	// the served tree is a frozen view, so the next epoch can be prepared while proofs are served
+	frozen, err := s.tree.Freeze()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.snapshots.Add(frozen); err != nil {
+		return nil, err
+	}
+	s.proofs.SetTree(frozen)
+
+	signed := &SignedRoot{Attestation: frozen.Attestation()}
+	if s.signed != nil {
+		signed.Epoch = s.signed.Epoch + 1
+	}
+	message, err := signed.message()
+	if err != nil {
+		return nil, err
+	}
+	signed.Signature = ed25519.Sign(s.cfg.Key, message)
+	s.signed = signed
+	return signed, nil
+}
+
+// SignedRoot returns the signed root of the current epoch.
+func (s *Service) SignedRoot() *SignedRoot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signed
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Service) handleSignedRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.SignedRoot())
+}
+
+func (s *Service) handleEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	scanner := bufio.NewScanner(r.Body)
+	var entries [][]byte
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			entries = append(entries, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, entry := range entries {
+		s.Add(entry)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "queued %d entries for the next epoch\n", len(entries))
+}
+
+// message returns the signed message, which binds the epoch to the canonical JSON of the attestation.
+func (r *SignedRoot) message() ([]byte, error) {
+	attestation, err := r.Attestation.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("blocklist epoch "+strconv.FormatUint(r.Epoch, 10)+"\n"), attestation...), nil
+}
+
+// Verify returns whether the root was signed with the private key of the given public key.
+func (r *SignedRoot) Verify(key ed25519.PublicKey) bool {
+	message, err := r.message()
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(key, message, r.Signature)
+}
+
+// MarshalJSON encodes the signed root with hex encoded hashes.
+func (r *SignedRoot) MarshalJSON() ([]byte, error) {
+	a := r.Attestation
+	return json.Marshal(signedRootJSON{
+		Epoch:       r.Epoch,
+		Root:        hex.EncodeToString(a.Root[:]),
+		ChunkSize:   a.ChunkSize,
+		Hash:        a.Hash.String(),
+		NumOfHashes: a.NumOfHashes,
+		FilterBits:  a.FilterBits,
+		Signature:   hex.EncodeToString(r.Signature),
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a signed root.
+func (r *SignedRoot) UnmarshalJSON(data []byte) error {
+	var aux signedRootJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(aux.Root)
+	if err != nil || len(root) != 32 {
+		return fmt.Errorf("invalid root %q", aux.Root)
+	}
+	hash, err := bloomtree.ParseHash(aux.Hash)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(aux.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	*r = SignedRoot{
+		Epoch: aux.Epoch,
+		Attestation: bloomtree.RootAttestation{
+			ChunkSize:   aux.ChunkSize,
+			Hash:        hash,
+			NumOfHashes: aux.NumOfHashes,
+			FilterBits:  aux.FilterBits,
+		},
+		Signature: signature,
+	}
+	copy(r.Attestation.Root[:], root)
+	return nil
+}
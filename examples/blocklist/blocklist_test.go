@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := []byte("blocklist seed")
+	svc, err := NewService(Config{Capacity: 1000, FalsePositiveRate: 0.001, Seed: seed, Epochs: 1, Key: private})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+	ctx := context.Background()
+	checker := NewChecker(ts.URL, seed, public)
+	if _, err := checker.Blocked(ctx, []byte("evil.example")); err == nil {
+		t.Fatal("expected error checking an entry before the first refresh")
+	}
+	signed, err := checker.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Epoch != 0 {
+		t.Fatalf("expected the first epoch to be 0, but got %d", signed.Epoch)
+	}
+	firstRoot := signed.Attestation.Root
+
+	// ingested entries are published with the next epoch
+	resp, err := http.Post(ts.URL+"/entries", "text/plain", strings.NewReader("evil.example\n\nspam.example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status %d for ingestion, but got %d", http.StatusAccepted, resp.StatusCode)
+	}
+	svc.Add([]byte("malware.example"))
+	if blocked, err := checker.Blocked(ctx, []byte("evil.example")); err != nil || blocked {
+		t.Fatalf("expected queued entries to be absent until the next epoch, but got %t, %v", blocked, err)
+	}
+	if _, err := svc.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if signed, err = checker.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if signed.Epoch != 1 || signed.Attestation.Root == firstRoot {
+		t.Fatalf("unexpected signed root %+v after the rotation", signed)
+	}
+	var tests = []struct {
+		entry   string
+		blocked bool
+	}{
+		{entry: "evil.example", blocked: true},
+		{entry: "spam.example", blocked: true},
+		{entry: "malware.example", blocked: true},
+		{entry: "good.example", blocked: false},
+	}
+	for _, test := range tests {
+		blocked, err := checker.Blocked(ctx, []byte(test.entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked != test.blocked {
+			t.Fatalf("expected %s to be blocked %t, but got %t", test.entry, test.blocked, blocked)
+		}
+	}
+
+	// clients that have not refreshed yet are served proofs against the root of the previous epoch
+	stale := NewChecker(ts.URL, seed, public)
+	stale.signed = &SignedRoot{Epoch: 0, Attestation: svc.SignedRoot().Attestation}
+	stale.signed.Attestation.Root = firstRoot
+	if blocked, err := stale.Blocked(ctx, []byte("evil.example")); err != nil || blocked {
+		t.Fatalf("expected the absence of evil.example in the previous epoch, but got %t, %v", blocked, err)
+	}
+	// roots older than the last Config.Epochs epochs are no longer served
+	svc.Add([]byte("phishing.example"))
+	if _, err := svc.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stale.Blocked(ctx, []byte("evil.example")); err == nil {
+		t.Fatal("expected error for the root of an evicted epoch")
+	}
+
+	// roots signed by another key and rollbacks to earlier epochs are rejected
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewChecker(ts.URL, seed, otherPublic).Refresh(ctx); err == nil {
+		t.Fatal("expected error for a root signed by another key")
+	}
+	checker.signed.Epoch = 5
+	if _, err := checker.Refresh(ctx); err == nil {
+		t.Fatal("expected error for a rollback to an earlier epoch")
+	}
+	forged := *svc.SignedRoot()
+	forged.Epoch++
+	if forged.Verify(public) {
+		t.Fatal("expected the signature to bind the epoch")
+	}
+}
+
+func TestCheckerSignedParams(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := []byte("blocklist seed")
+	svc, err := NewService(Config{Capacity: 1000, FalsePositiveRate: 0.001, Seed: seed, Key: private})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Add([]byte("evil.example"))
+	if _, err := svc.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// after the refresh, the proof server reports other parameters than the signed ones
+	var lying int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&lying) == 1 && r.URL.Path == "/metadata" {
+			a := svc.SignedRoot().Attestation
+			a.FilterBits, a.NumOfHashes = 2*a.FilterBits, a.NumOfHashes+1
+			data, _ := a.CanonicalJSON()
+			w.Write(data)
+			return
+		}
+		svc.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	checker := NewChecker(ts.URL, seed, public)
+	if _, err := checker.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&lying, 1)
+	for entry, expected := range map[string]bool{"evil.example": true, "good.example": false} {
+		if blocked, err := checker.Blocked(ctx, []byte(entry)); err != nil || blocked != expected {
+			t.Fatalf("expected %s to be blocked %t with the signed parameters, but got %t, %v", entry, expected, blocked, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	key := ed25519.NewKeyFromSeed(seed)
+	svc, err := NewService(Config{Capacity: 100, FalsePositiveRate: 0.01, Seed: []byte("blocklist"), Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Add([]byte("evil.example"))
+	if _, err := svc.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	publicKey := fmt.Sprintf("%x", key.Public())
+	if err := run([]string{"check", "-url", ts.URL, "-public-key", publicKey, "evil.example", "good.example"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "evil.example: blocked true") || !strings.Contains(out.String(), "good.example: blocked false") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	for _, args := range [][]string{nil, {"unknown"}, {"check", "-public-key", "zz"}, {"serve", "-key", "zz"}} {
+		if err := run(args, &out); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labbloom/bloom-tree/server"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// Checker checks entries against a blocklist service, trusting only roots signed by the service. Every
+// answer is verified against the signed root of the latest epoch seen.
+type Checker struct {
+	client *server.Client
+	key    ed25519.PublicKey
+
+	mu     sync.RWMutex
+	signed *SignedRoot
+}
+
+// NewChecker returns a checker of the service at the base URL, whose roots are signed with the private key of
+// the given public key. The seed is the seed of the bloom filter of the service.
+func NewChecker(baseURL string, seed []byte, key ed25519.PublicKey) *Checker {
+	return &Checker{client: &server.Client{BaseURL: baseURL, Seed: seed}, key: key}
+}
+
+// Refresh fetches the signed root of the current epoch, and returns it once its signature checks out. Roots of
+// earlier epochs than the one seen last are rejected, so a service cannot roll clients back to a blocklist
+// without recent entries.
+func (c *Checker) Refresh(ctx context.Context) (*SignedRoot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.client.BaseURL, "/")+"/signed-root", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the signed root failed with status %s", resp.Status)
+	}
+	var signed SignedRoot
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, err
+	}
+	if !signed.Verify(c.key) {
+		return nil, fmt.Errorf("the root of epoch %d has an invalid signature", signed.Epoch)
+	}
+	if current := c.current(); current != nil && signed.Epoch < current.Epoch {
+		return nil, fmt.Errorf("the service rolled back from epoch %d to %d", current.Epoch, signed.Epoch)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signed = &signed
+	return &signed, nil
+}
+
+// Blocked returns whether the entry is on the blocklist of the latest epoch seen by Refresh, which must have
+// been called before. The proof is verified with the parameters of the signed root, so the proof server cannot
+// change them after Refresh. Like every bloom filter, the blocklist has false positives, but no false negatives.
+func (c *Checker) Blocked(ctx context.Context, entry []byte) (bool, error) {
+	signed := c.current()
+	if signed == nil {
+		return false, errors.New("no signed root, call Refresh first")
+	}
+	client := *c.client
+	client.Params = verifier.AttestedParams(signed.Attestation)
+	return client.Prove(ctx, entry, signed.Attestation.Root)
+}
+
+func (c *Checker) current() *SignedRoot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.signed
+}
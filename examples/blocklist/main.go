@@ -0,0 +1,127 @@
+// Command blocklist is a reference deployment of bloom trees: a blocklist service publishing its entries in
+// epochs with signed roots, and a client checking entries against it without trusting the service for more
+// than the signature of the root.
+//
+// Usage:
+//
+//	blocklist serve -addr :8080 -key hex [-epoch 1m] [-capacity n] [-fpr p] [-seed s] [-epochs n]
+//	blocklist check -url http://localhost:8080 -public-key hex [-seed s] entry...
+//
+// serve publishes a new epoch every -epoch with the entries POSTed to /entries since the last one, and serves
+// proofs against the roots of the current and the last -epochs epochs. -key is the hex encoded ed25519 seed of
+// the signing key; a new key is generated and its public key printed if it is empty. check prints whether
+// every entry is blocked, verified against the signed root of the current epoch.
+//
+// The service wires together the public APIs most deployments use: DBF filters updated in place with
+// BloomTree.Update, frozen views served by server.Server during rotation, a SnapshotStore for the roots
+// of earlier epochs, and root attestations signed with ed25519. The integration test of this package runs
+// the whole flow, so the example keeps working as the APIs evolve.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// random is the source of generated signing keys, which tests can make deterministic.
+var random io.Reader = rand.Reader
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "blocklist:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected a command: serve or check")
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	seed := flags.String("seed", "blocklist", "seed of the bloom filter")
+	switch args[0] {
+	case "serve":
+		addr := flags.String("addr", ":8080", "address to listen on")
+		keyHex := flags.String("key", "", "hex encoded ed25519 seed of the signing key")
+		epoch := flags.Duration("epoch", time.Minute, "duration of an epoch")
+		capacity := flags.Uint("capacity", 100000, "number of entries the bloom filter is sized for")
+		fpr := flags.Float64("fpr", 0.001, "false positive rate of the bloom filter")
+		epochs := flags.Int("epochs", 2, "number of earlier epochs whose roots are served")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		key, err := signingKey(*keyHex, stdout)
+		if err != nil {
+			return err
+		}
+		svc, err := NewService(Config{Capacity: *capacity, FalsePositiveRate: *fpr, Seed: []byte(*seed), Epochs: *epochs, Key: key})
+		if err != nil {
+			return err
+		}
+		go func() {
+			for range time.Tick(*epoch) {
+				signed, err := svc.Rotate()
+				if err != nil {
+					log.Printf("rotating the epoch: %v", err)
+					continue
+				}
+				log.Printf("published epoch %d with root %x", signed.Epoch, signed.Attestation.Root)
+			}
+		}()
+		return http.ListenAndServe(*addr, svc)
+	case "check":
+		url := flags.String("url", "http://localhost:8080", "URL of the service")
+		keyHex := flags.String("public-key", "", "hex encoded ed25519 public key of the service")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		key, err := hex.DecodeString(*keyHex)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return errors.New("-public-key must be a hex encoded ed25519 public key")
+		}
+		ctx := context.Background()
+		checker := NewChecker(*url, []byte(*seed), key)
+		signed, err := checker.Refresh(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "epoch %d, root %x\n", signed.Epoch, signed.Attestation.Root)
+		for _, entry := range flags.Args() {
+			blocked, err := checker.Blocked(ctx, []byte(entry))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s: blocked %t\n", entry, blocked)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// signingKey decodes the hex encoded ed25519 seed, or generates a key and prints its public key if it is empty.
+func signingKey(seedHex string, stdout io.Writer) (ed25519.PrivateKey, error) {
+	if seedHex == "" {
+		public, private, err := ed25519.GenerateKey(random)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(stdout, "public key %x\n", public)
+		return private, nil
+	}
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("-key must be a hex encoded ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
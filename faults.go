@@ -0,0 +1,109 @@
+package bloomtree
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults describes the faults a FaultStore injects into the reads and writes of its store.
+type Faults struct {
+	// Latency delays every read and write.
+	Latency time.Duration
+	// ReadErrorRate is the probability that a read fails with ErrInjectedFault and returns a zero hash.
+	ReadErrorRate float64
+	// WriteErrorRate is the probability that a write fails with ErrInjectedFault and is dropped.
+	WriteErrorRate float64
+	// CorruptionRate is the probability that a read silently returns the node with one bit flipped.
+	CorruptionRate float64
+	// Nodes limits the faults to the given node indices if it is not nil.
+	Nodes map[int]bool
+	// Seed seeds the choice of the faults, so a failing run can be reproduced.
+	Seed int64
+}
+
+// FaultStore is a NodeStore injecting faults into the reads and writes of another store, so applications can
+// test how they recover from storage failures, like slow disks, failing databases or corrupted nodes, without
+// a real failing backend. Injected errors are reported by Err like the errors of the wrapped store.
+type FaultStore struct {
+	storeErr
+	store NodeStore
+
+	mu     sync.Mutex
+	faults Faults
+	rnd    *rand.Rand
+}
+
+// NewFaultStore returns a FaultStore injecting the faults into the reads and writes of the store.
+func NewFaultStore(store NodeStore, faults Faults) *FaultStore {
+	s := &FaultStore{store: store}
+	s.SetFaults(faults)
+	return s
+}
+
+// SetFaults replaces the injected faults and forgets the injected errors, e.g. to let a failed store recover.
+// Errors of the wrapped store are kept.
+func (s *FaultStore) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+	s.rnd = rand.New(rand.NewSource(faults.Seed))
+	s.storeErr.mu.Lock()
+	s.storeErr.err = nil
+	s.storeErr.mu.Unlock()
+}
+
+// inject waits for the latency and returns whether the read or write of node i fails, and for reads the bit
+// of the node to flip, or -1.
+func (s *FaultStore) inject(i int, write bool) (bool, int) {
+	s.mu.Lock()
+	faults := s.faults
+	fail, flip := false, -1
+	if faults.Nodes == nil || faults.Nodes[i] {
+		if write {
+			fail = s.rnd.Float64() < faults.WriteErrorRate
+		} else if fail = s.rnd.Float64() < faults.ReadErrorRate; !fail && s.rnd.Float64() < faults.CorruptionRate {
+			flip = s.rnd.Intn(256)
+		}
+	}
+	s.mu.Unlock()
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+	return fail, flip
+}
+
+// Len returns the number of nodes of the wrapped store.
+func (s *FaultStore) Len() int { return s.store.Len() }
+
+// Node reads the node at index i from the wrapped store, unless an error is injected.
+func (s *FaultStore) Node(i int) [32]byte {
+	fail, flip := s.inject(i, false)
+	if fail {
+		s.set(fmt.Errorf("reading node %d: %w", i, ErrInjectedFault))
+		return [32]byte{}
+	}
+	h := s.store.Node(i)
+	if flip >= 0 {
+		h[flip/8] ^= 1 << uint(flip%8)
+	}
+	return h
+}
+
+// SetNode writes the node at index i to the wrapped store, unless an error is injected.
+func (s *FaultStore) SetNode(i int, h [32]byte) {
+	if fail, _ := s.inject(i, true); fail {
+		s.set(fmt.Errorf("writing node %d: %w", i, ErrInjectedFault))
+		return
+	}
+	s.store.SetNode(i, h)
+}
+
+// Err returns the first injected error, or else the first error of the wrapped store.
+func (s *FaultStore) Err() error {
+	if err := s.storeErr.Err(); err != nil {
+		return err
+	}
+	return s.store.Err()
+}
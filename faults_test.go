@@ -0,0 +1,62 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultStore(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := tree.nodeCount()
+	if _, err := NewBloomTree(dbf, WithNodeStore(NewFaultStore(NewMemoryStore(n), Faults{WriteErrorRate: 1}))); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected ErrInjectedFault building the tree, but got %v", err)
+	}
+
+	store := NewFaultStore(NewMemoryStore(n), Faults{})
+	faulty, err := NewBloomTree(dbf, WithNodeStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faulty.Root() != tree.Root() {
+		t.Fatalf("expected root %x without faults, but got %x", tree.Root(), faulty.Root())
+	}
+	verify := func(faults Faults) (bool, error) {
+		store.SetFaults(faults)
+		multiproof, err := faulty.GenerateCompactMultiProof([]byte{1})
+		if err != nil {
+			return false, err
+		}
+		return VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, tree.Root(), dbf)
+	}
+	if _, err := verify(Faults{ReadErrorRate: 1}); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected ErrInjectedFault generating a proof, but got %v", err)
+	}
+	if verified, err := verify(Faults{CorruptionRate: 1, Seed: 7}); (err != nil && !errors.Is(err, ErrInvalidProof)) || verified {
+		t.Fatalf("expected a proof of corrupted nodes to fail, but got %v, %v", verified, err)
+	}
+	// only the root fails, which proofs do not read
+	if verified, err := verify(Faults{ReadErrorRate: 1, Nodes: map[int]bool{n - 1: true}}); err != nil || !verified {
+		t.Fatalf("expected the proof to verify, but got %v, %v", verified, err)
+	}
+	if faulty.Root() != [32]byte{} || !errors.Is(store.Err(), ErrInjectedFault) {
+		t.Fatalf("expected a failed read of the root, but got %x, %v", faulty.Root(), store.Err())
+	}
+	// the store recovers once the faults are removed
+	if verified, err := verify(Faults{}); err != nil || !verified {
+		t.Fatalf("expected the proof to verify after recovering, but got %v, %v", verified, err)
+	}
+
+	store.SetFaults(Faults{Latency: 5 * time.Millisecond})
+	start := time.Now()
+	faulty.Root()
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("expected a read to take at least 5ms, but it took %v", elapsed)
+	}
+}
@@ -0,0 +1,228 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/willf/bitset"
+)
+
+// FilterFamily commits to several related bloom filters, e.g. one blocklist per category, in a single tree.
+// The chunks of the filters are interleaved leaf groups: leaf g*F+f holds chunk g of filter f of F filters,
+// so the chunks of one filter are spread over the tree instead of taking a subtree of their own. The root is
+// bound to the number of filters and groups, so a proof identifies the filter its chunks belong to without the
+// extra path of a BloomForest. Filters with fewer chunks than the largest one are padded with zero chunks.
+type FilterFamily struct {
+	cfg     config
+	filters []BloomFilter
+	groups  uint64
+	bits    *bitset.BitSet
+	// trees holds a view of the tree per filter, which maps the indices of its filter to the interleaved bits.
+	trees []*BloomTree
+}
+
+// FamilyProof proves the presence or absence of an element in one filter of a family. TreeRoot is the root of
+// the tree of the interleaved filters, which Proof opens.
+type FamilyProof struct {
+	Filter   uint64
+	Filters  uint64
+	Groups   uint64
+	TreeRoot [32]byte
+	Proof    *CompactMultiProof
+}
+
+// NewFilterFamily creates the family of the given filters, in the order their proofs refer to them. The
+// filters must have bits, adaptive chunks are not supported. The filters must not be modified while the family
+// is used, the family is built again to commit to changes.
+func NewFilterFamily(filters []BloomFilter, opts ...Option) (*FilterFamily, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("the family needs at least one filter")
+	}
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	step := uint64(cfg.chunkSize / 64)
+	words := make([][]uint64, len(filters))
+	var groups uint64
+	for f, bf := range filters {
+		if bf == nil || isEmptyFilter(bf) {
+			return nil, fmt.Errorf("filter %d of the family has no bits", f)
+		}
+		if words[f], err = bloomFilterWords(bf); err != nil {
+			return nil, fmt.Errorf("filter %d: %w", f, err)
+		}
+		if n := (uint64(len(words[f])) + step - 1) / step; n > groups {
+			groups = n
+		}
+	}
+	numFilters := uint64(len(filters))
+	interleaved := make([]uint64, groups*numFilters*step)
+	for f, w := range words {
+		for g := uint64(0); g*step < uint64(len(w)); g++ {
+			end := (g + 1) * step
+			if end > uint64(len(w)) {
+				end = uint64(len(w))
+			}
+			copy(interleaved[(g*numFilters+uint64(f))*step:], w[g*step:end])
+		}
+	}
+	ff := &FilterFamily{
+		cfg:     cfg,
+		filters: append([]BloomFilter(nil), filters...),
+		groups:  groups,
+		bits:    bitset.From(interleaved),
+	}
+	base, err := newBloomTree(context.Background(), ff.view(0), cfg)
+	if err != nil {
+		return nil, err
+	}
+	ff.trees = make([]*BloomTree, len(filters))
+	for f := range filters {
+		// the views share the nodes of the tree and cannot be updated
+		ff.trees[f] = &BloomTree{
+			clamped:    base.clamped,
+			bf:         ff.view(f),
+			nodes:      base.nodes,
+			bounds:     base.bounds,
+			checksums:  base.checksums,
+			store:      base.store,
+			cfg:        base.cfg,
+			frozen:     true,
+			spilled:    base.spilled,
+			access:     base.access,
+			provenance: base.provenance,
+		}
+	}
+	return ff, nil
+}
+
+// view returns the bloom filter of filter f on the interleaved bits.
+func (ff *FilterFamily) view(f int) *familyFilter {
+	return &familyFilter{
+		bf:        ff.filters[f],
+		bits:      ff.bits,
+		filter:    uint64(f),
+		filters:   uint64(len(ff.filters)),
+		chunkSize: uint64(ff.cfg.chunkSize),
+	}
+}
+
+// Root returns the root committing to all filters of the family.
+func (ff *FilterFamily) Root() [32]byte {
+	return ff.cfg.hash.familyRoot(ff.trees[0].Root(), uint64(len(ff.filters)), ff.groups)
+}
+
+// Len returns the number of filters of the family.
+func (ff *FilterFamily) Len() int {
+	return len(ff.filters)
+}
+
+// GenerateCompactMultiProof returns a proof of the presence or absence of the element in the given filter.
+func (ff *FilterFamily) GenerateCompactMultiProof(filter int, elem []byte) (*FamilyProof, error) {
+	if filter < 0 || filter >= len(ff.filters) {
+		return nil, fmt.Errorf("%w: filter %d of %d", ErrLayerIndexOutOfRange, filter, len(ff.filters))
+	}
+	bt := ff.trees[filter]
+	proof, err := bt.GenerateCompactMultiProof(elem)
+	if err != nil {
+		return nil, err
+	}
+	return &FamilyProof{
+		Filter:   uint64(filter),
+		Filters:  uint64(len(ff.filters)),
+		Groups:   ff.groups,
+		TreeRoot: bt.Root(),
+		Proof:    proof,
+	}, nil
+}
+
+// VerifyFamilyProof returns whether the proof is valid for the given filter of the family with the given root,
+// where bf is the bloom filter of that filter. Proofs of other filters are invalid. Whether the element is present
+// is reported by the proof type.
+func VerifyFamilyProof(element, seedValue []byte, proof *FamilyProof, root [32]byte, filter int, bf BloomFilter, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.Proof == nil {
+		return false, errors.New("the family proof must open the tree of the family")
+	}
+	for _, other := range cfg.crossCheckRoots {
+		if other != root {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, root, other)
+		}
+	}
+	if filter < 0 || proof.Filter != uint64(filter) {
+		return false, invalidProof(ReasonChunkMismatch, "the proof is of filter %d, but filter %d is verified", proof.Filter, filter)
+	}
+	if proof.Filter >= proof.Filters {
+		return false, invalidProof(ReasonChunkMismatch, "the proof is of filter %d, but the family has %d filters", proof.Filter, proof.Filters)
+	}
+	step := uint64(cfg.chunkSize / 64)
+	if isEmptyFilter(bf) || (uint64(len(bf.BitArray().Bytes()))+step-1)/step > proof.Groups {
+		return false, invalidProof(ReasonChunkCount, "the bloom filter has more chunks than the %d groups of the family", proof.Groups)
+	}
+	if cfg.hash.familyRoot(proof.TreeRoot, proof.Filters, proof.Groups) != root {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the root")
+	}
+	// the cross check roots are family roots, the proof is verified against the root of the tree
+	cfg.crossCheckRoots = nil
+	leaves := forestLeafCount(proof.Groups * proof.Filters)
+	chunkIndices := func(indices []uint) []uint64 {
+		ret := make([]uint64, len(indices))
+		for i, v := range indices {
+			ret[i] = uint64(v)/uint64(cfg.chunkSize)*proof.Filters + proof.Filter
+		}
+		return ret
+	}
+	return verifyCompactMultiProof(element, seedValue, proof.Proof, proof.TreeRoot, bf, int(2*leaves-1), chunkIndices, cfg)
+}
+
+// familyFilter is the bloom filter of one filter of a family on the interleaved bits of all filters.
+type familyFilter struct {
+	bf        BloomFilter
+	bits      *bitset.BitSet
+	filter    uint64
+	filters   uint64
+	chunkSize uint64
+}
+
+// index maps an index of the filter to its index in the interleaved bits.
+func (f *familyFilter) index(v uint64) uint64 {
+	return (v/f.chunkSize*f.filters+f.filter)*f.chunkSize + v%f.chunkSize
+}
+
+func (f *familyFilter) indices(indices []uint) []uint {
+	ret := make([]uint, len(indices))
+	for i, v := range indices {
+		ret[i] = uint(f.index(uint64(v)))
+	}
+	return ret
+}
+
+func (f *familyFilter) Proof(elem []byte) ([]uint64, bool) {
+	indices, present := f.bf.Proof(elem)
+	ret := make([]uint64, len(indices))
+	for i, v := range indices {
+		ret[i] = f.index(v)
+	}
+	return ret, present
+}
+
+func (f *familyFilter) BitArray() *bitset.BitSet {
+	return f.bits
+}
+
+func (f *familyFilter) MapElementToBF(elem, seed []byte) []uint {
+	return f.indices(f.bf.MapElementToBF(elem, seed))
+}
+
+func (f *familyFilter) NumOfHashes() uint {
+	return f.bf.NumOfHashes()
+}
+
+func (f *familyFilter) GetElementIndices(elem []byte) []uint {
+	return f.indices(f.bf.GetElementIndices(elem))
+}
@@ -0,0 +1,106 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFilterFamily(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	filters := []BloomFilter{
+		generateDBF(200, seed, []byte{1}),
+		generateDBF(200, seed, []byte{2}),
+		// a smaller filter is padded with zero chunks
+		generateDBF(50, seed, []byte{3}),
+	}
+	if _, err := NewFilterFamily(nil); err == nil {
+		t.Fatal("expected error for a family without filters")
+	}
+	family, err := NewFilterFamily(filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := NewFilterFamily(filters[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family.Len() != 3 || single.Len() != 1 {
+		t.Fatalf("expected 3 and 1 filters, but got %d and %d", family.Len(), single.Len())
+	}
+	tree, err := NewBloomTree(filters[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.Root() == tree.Root() {
+		t.Fatal("expected the family root to differ from the root of the tree of its only filter")
+	}
+	if _, err := family.GenerateCompactMultiProof(3, []byte{1}); !errors.Is(err, ErrLayerIndexOutOfRange) {
+		t.Fatalf("expected ErrLayerIndexOutOfRange for a filter out of range, but got %v", err)
+	}
+
+	var tests = []struct {
+		family  *FilterFamily
+		filter  int
+		elem    []byte
+		present bool
+	}{
+		{family: family, filter: 0, elem: []byte{1}, present: true},
+		{family: family, filter: 1, elem: []byte{2}, present: true},
+		{family: family, filter: 2, elem: []byte{3}, present: true},
+		{family: family, filter: 2, elem: []byte{42}, present: false},
+		{family: single, filter: 0, elem: []byte{1}, present: true},
+	}
+	for _, test := range tests {
+		proof, err := test.family.GenerateCompactMultiProof(test.filter, test.elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Proof.ProofType.IsPresence() != test.present {
+			t.Fatalf("expected presence %t of element %v in filter %d", test.present, test.elem, test.filter)
+		}
+		root := test.family.Root()
+		bf := filters[test.filter]
+		verified, err := VerifyFamilyProof(test.elem, []byte(seed), proof, root, test.filter, bf, WithCrossCheckRoot(root))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify family proof of element %v in filter %d", test.elem, test.filter)
+		}
+		if test.family.Len() == 1 {
+			continue
+		}
+
+		// claiming the chunks to belong to another filter fails
+		moved := *proof
+		moved.Filter = uint64((test.filter + 1) % test.family.Len())
+		if verified, _ := VerifyFamilyProof(test.elem, []byte(seed), &moved, root, int(moved.Filter), bf); verified {
+			t.Fatalf("expected proof of filter %d to fail as filter %d", test.filter, moved.Filter)
+		}
+		// and a proof of the filter does not verify for another filter
+		if verified, err := VerifyFamilyProof(test.elem, []byte(seed), proof, root, int(moved.Filter), bf); verified || !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("expected ErrInvalidProof for a proof of filter %d verified as filter %d, got %t and %v", test.filter, moved.Filter, verified, err)
+		}
+		// so does claiming another number of filters or groups
+		moved = *proof
+		moved.Filters++
+		if verified, _ := VerifyFamilyProof(test.elem, []byte(seed), &moved, root, int(moved.Filter), bf); verified {
+			t.Fatal("expected proof to fail for another number of filters")
+		}
+		moved = *proof
+		moved.Groups++
+		if verified, _ := VerifyFamilyProof(test.elem, []byte(seed), &moved, root, int(moved.Filter), bf); verified {
+			t.Fatal("expected proof to fail for another number of groups")
+		}
+		moved = *proof
+		moved.Filter = moved.Filters
+		if _, err := VerifyFamilyProof(test.elem, []byte(seed), &moved, root, int(moved.Filter), bf); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("expected ErrInvalidProof for a filter out of range, but got %v", err)
+		}
+	}
+
+	// the views of the filters cannot be updated
+	if err := family.trees[0].Update([]byte{4}); err == nil {
+		t.Fatal("expected error updating the tree of a family")
+	}
+}
@@ -0,0 +1,239 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BloomForest commits to the roots of several bloom trees, one per shard, under a single root. The roots of
+// the trees are the leaves of a Merkle tree, whose root is bound to the number of shards and to the assignment
+// of elements to shards by ForestShard. The tree of a shard must hold the elements assigned to it, so a proof
+// cannot answer for an element from the tree of another shard. A proof of an element chains from the element
+// through the tree of its shard up to the forest root. The trees must use the same hash function. A forest is
+// not safe for concurrent modification.
+type BloomForest struct {
+	hash  Hash
+	trees []*BloomTree
+	// nodes holds the Merkle tree of the roots of the trees, laid out like the nodes of a bloom tree.
+	nodes [][32]byte
+}
+
+// ForestProof proves the membership of an element in the tree of a shard of a forest. Path holds the
+// sibling hashes from the leaf of the shard up to the root of the Merkle tree of the forest.
+type ForestProof struct {
+	Shard    uint64
+	Shards   uint64
+	TreeRoot [32]byte
+	Path     [][32]byte
+	Proof    *CompactMultiProof
+}
+
+// NewBloomForest creates a forest of the given trees, one per shard in the order of the shards.
+func NewBloomForest(trees ...*BloomTree) (*BloomForest, error) {
+	if len(trees) == 0 {
+		return nil, errors.New("the forest needs at least one tree")
+	}
+	h := trees[0].cfg.hash
+	for i, bt := range trees {
+		if bt == nil {
+			return nil, fmt.Errorf("the tree of shard %d is missing", i)
+		}
+		if bt.cfg.hash != h {
+			return nil, fmt.Errorf("the tree of shard %d uses hash %v, but the forest uses %v", i, bt.cfg.hash, h)
+		}
+	}
+	leafNum := forestLeafCount(uint64(len(trees)))
+	bf := &BloomForest{
+		hash:  h,
+		trees: append([]*BloomTree(nil), trees...),
+		nodes: make([][32]byte, 2*leafNum-1),
+	}
+	for i := uint64(0); i < leafNum; i++ {
+		bf.nodes[i] = bf.leaf(i)
+	}
+	for i := leafNum; i < uint64(len(bf.nodes)); i++ {
+		c := 2 * (i - leafNum)
+		bf.nodes[i] = h.forestNode(bf.nodes[c], bf.nodes[c+1])
+	}
+	return bf, nil
+}
+
+// ForestShard returns the shard of the element in a forest of the given number of shards whose trees use the
+// hash function h, i.e. the shard whose bloom filter must hold the element.
+func ForestShard(h Hash, element []byte, shards int) int {
+	if shards < 1 {
+		return 0
+	}
+	return int(h.forestShard(element, uint64(shards)))
+}
+
+// forestLeafCount returns the number of leaves of the Merkle tree of a forest of the given number of shards.
+func forestLeafCount(shards uint64) uint64 {
+	leafNum := uint64(1)
+	for leafNum < shards {
+		leafNum *= 2
+	}
+	return leafNum
+}
+
+// leaf returns the leaf of the shard, or the hash of the zero root for the padding leaves.
+func (bf *BloomForest) leaf(shard uint64) [32]byte {
+	if shard >= uint64(len(bf.trees)) {
+		return bf.hash.forestLeaf(shard, [32]byte{})
+	}
+	return bf.hash.forestLeaf(shard, bf.trees[shard].Root())
+}
+
+// Root returns the root committing to the trees of all shards.
+func (bf *BloomForest) Root() [32]byte {
+	return bf.hash.forestRoot(bf.nodes[len(bf.nodes)-1], uint64(len(bf.trees)))
+}
+
+// Len returns the number of shards of the forest.
+func (bf *BloomForest) Len() int {
+	return len(bf.trees)
+}
+
+// Shard returns the shard of the element, see ForestShard.
+func (bf *BloomForest) Shard(element []byte) int {
+	return ForestShard(bf.hash, element, len(bf.trees))
+}
+
+// Tree returns the tree of the shard.
+func (bf *BloomForest) Tree(shard int) *BloomTree {
+	return bf.trees[shard]
+}
+
+// SetTree replaces the tree of the shard and updates the root of the forest. Trees that are updated in
+// place must be set again for the forest to commit to their new root.
+func (bf *BloomForest) SetTree(shard int, bt *BloomTree) error {
+	if shard < 0 || shard >= len(bf.trees) {
+		return fmt.Errorf("%w: shard %d of %d", ErrLayerIndexOutOfRange, shard, len(bf.trees))
+	}
+	if bt == nil {
+		return fmt.Errorf("the tree of shard %d is missing", shard)
+	}
+	if bt.cfg.hash != bf.hash {
+		return fmt.Errorf("the tree of shard %d uses hash %v, but the forest uses %v", shard, bt.cfg.hash, bf.hash)
+	}
+	bf.trees[shard] = bt
+	leafNum := uint64(len(bf.nodes)+1) / 2
+	node := uint64(shard)
+	bf.nodes[node] = bf.leaf(node)
+	for node != uint64(len(bf.nodes)-1) {
+		parent := leafNum + node/2
+		c := 2 * (parent - leafNum)
+		bf.nodes[parent] = bf.hash.forestNode(bf.nodes[c], bf.nodes[c+1])
+		node = parent
+	}
+	return nil
+}
+
+// GenerateCompactMultiProof returns a proof of the presence or absence of the element in the tree of its shard.
+func (bf *BloomForest) GenerateCompactMultiProof(elem []byte) (*ForestProof, error) {
+	shard := bf.Shard(elem)
+	proof, err := bf.trees[shard].GenerateCompactMultiProof(elem)
+	if err != nil {
+		return nil, err
+	}
+	leafNum := uint64(len(bf.nodes)+1) / 2
+	var path [][32]byte
+	for node := uint64(shard); node != uint64(len(bf.nodes)-1); node = leafNum + node/2 {
+		path = append(path, bf.nodes[node^1])
+	}
+	return &ForestProof{
+		Shard:    uint64(shard),
+		Shards:   uint64(len(bf.trees)),
+		TreeRoot: bf.trees[shard].Root(),
+		Path:     path,
+		Proof:    proof,
+	}, nil
+}
+
+// VerifyForestPath returns whether the tree root of the proof is the root of the tree of its shard in the
+// forest with the given root. It neither verifies the proof of the element nor that the element belongs to the
+// shard, see VerifyForestProof.
+func VerifyForestPath(proof *ForestProof, root [32]byte, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	return verifyForestPath(proof, root, cfg.hash)
+}
+
+func verifyForestPath(proof *ForestProof, root [32]byte, h Hash) (bool, error) {
+	if proof.Shard >= proof.Shards {
+		return false, invalidProof(ReasonChunkMismatch, "the proof is of shard %d, but the forest has %d shards", proof.Shard, proof.Shards)
+	}
+	height := 0
+	for leafNum := forestLeafCount(proof.Shards); leafNum > 1; leafNum /= 2 {
+		height++
+	}
+	if len(proof.Path) != height {
+		return false, invalidProof(ReasonHashCount, "the path has %d hashes, but %d are needed", len(proof.Path), height)
+	}
+	node := h.forestLeaf(proof.Shard, proof.TreeRoot)
+	index := proof.Shard
+	for _, sibling := range proof.Path {
+		if index%2 == 0 {
+			node = h.forestNode(node, sibling)
+		} else {
+			node = h.forestNode(sibling, node)
+		}
+		index /= 2
+	}
+	if h.forestRoot(node, proof.Shards) != root {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the root")
+	}
+	return true, nil
+}
+
+// VerifyForestProof returns whether the proof is valid for the forest with the given root, where bf is the
+// bloom filter of the shard of the proof. The shard of the proof must be the shard of the element, see
+// ForestShard. Whether the element is present is reported by the proof type.
+func VerifyForestProof(element, seedValue []byte, proof *ForestProof, root [32]byte, bf BloomFilter, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.Proof == nil {
+		return false, errors.New("the forest proof must open the tree of its shard")
+	}
+	for _, other := range cfg.crossCheckRoots {
+		if other != root {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, root, other)
+		}
+	}
+	if err := verifyForestShard(element, proof, cfg.hash); err != nil {
+		return false, err
+	}
+	if verified, err := verifyForestPath(proof, root, cfg.hash); err != nil || !verified {
+		return false, err
+	}
+	// the cross check roots are forest roots, the shard is verified against the root of its own tree
+	cfg.crossCheckRoots = nil
+	treeLength, err := filterTreeLength(bf, cfg.chunkSize)
+	if err != nil {
+		return false, err
+	}
+	return verifyCompactMultiProof(element, seedValue, proof.Proof, proof.TreeRoot, bf, treeLength, cfg.chunkIndices, cfg)
+}
+
+// VerifyForestShard returns an error if the shard of the proof is not the shard of the element, see ForestShard.
+func VerifyForestShard(element []byte, proof *ForestProof, opts ...Option) error {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return err
+	}
+	return verifyForestShard(element, proof, cfg.hash)
+}
+
+func verifyForestShard(element []byte, proof *ForestProof, h Hash) error {
+	if proof.Shards == 0 {
+		return invalidProof(ReasonChunkMismatch, "the proof is of a forest without shards")
+	}
+	if shard := h.forestShard(element, proof.Shards); shard != proof.Shard {
+		return invalidProof(ReasonChunkMismatch, "the proof is of shard %d, but the element belongs to shard %d", proof.Shard, shard)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ForestBuilder builds the trees of the shards of a BloomForest concurrently within a global budget of
+// worker goroutines, e.g. to rebuild 64 shards on all cores of a machine instead of one shard after another.
+type ForestBuilder struct {
+	workers int
+	cfg     config
+	onShard func(shard int, root [32]byte)
+}
+
+// NewForestBuilder returns a builder of forests whose trees are built with the given options, on up to workers
+// goroutines in total. A worker count below 1 uses GOMAXPROCS workers. WithWorkers in opts is ignored, the
+// budget is split between the shards built at the same time. The trees cannot be kept in a node store.
+func NewForestBuilder(workers int, opts ...Option) (*ForestBuilder, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.store != nil {
+		return nil, errors.New("the trees of a forest cannot share a node store")
+	}
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &ForestBuilder{workers: workers, cfg: cfg}, nil
+}
+
+// OnShard calls fn with the root of every shard as soon as its tree is built, in the order the shards
+// complete, e.g. to publish the roots of a rebuild while it runs. The calls are not concurrent.
+func (fb *ForestBuilder) OnShard(fn func(shard int, root [32]byte)) {
+	fb.onShard = fn
+}
+
+// Build builds the trees of the bloom filters, one per shard in the order of the shards, and returns the forest
+// committing to them. The filter of a shard must hold the elements assigned to it by ForestShard. Up to as many shards as there are workers are built at the same time, each on an equal
+// share of the workers. The first error stops the remaining shards, and is returned together with its shard.
+func (fb *ForestBuilder) Build(ctx context.Context, filters ...BloomFilter) (*BloomForest, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("the forest needs at least one tree")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrent := fb.workers
+	if concurrent > len(filters) {
+		concurrent = len(filters)
+	}
+	cfg := fb.cfg
+	cfg.workers = fb.workers / concurrent
+
+	trees := make([]*BloomTree, len(filters))
+	shards := make(chan int, len(filters))
+	for i := range filters {
+		shards <- i
+	}
+	close(shards)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < concurrent; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shard := range shards {
+				if ctx.Err() != nil {
+					return
+				}
+				bt, err := newBloomTree(ctx, filters[shard], cfg)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("shard %d: %w", shard, err)
+					}
+					cancel()
+				} else {
+					trees[shard] = bt
+					if fb.onShard != nil {
+						fb.onShard(shard, bt.Root())
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return NewBloomForest(trees...)
+}
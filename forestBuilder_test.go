@@ -0,0 +1,89 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+// tooManyHashesBF is a bloom filter with more hash functions than proofs support.
+type tooManyHashesBF struct {
+	*DBF.DistBF
+}
+
+func (tooManyHashesBF) NumOfHashes() uint {
+	return 300
+}
+
+func TestForestBuilder(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	filters := make([]BloomFilter, 9)
+	trees := make([]*BloomTree, len(filters))
+	for i := range filters {
+		dbf := generateDBF(200, seed, []byte{byte(i)}, []byte(fmt.Sprintf("shard %d", i)))
+		filters[i] = dbf
+		tree, err := NewBloomTree(dbf, WithHash(Keccak256))
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees[i] = tree
+	}
+	expected, err := NewBloomForest(trees...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 1, 3, 32} {
+		builder, err := NewForestBuilder(workers, WithHash(Keccak256))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots := make(map[int][32]byte)
+		builder.OnShard(func(shard int, root [32]byte) {
+			if _, ok := roots[shard]; ok {
+				t.Errorf("shard %d was reported twice", shard)
+			}
+			roots[shard] = root
+		})
+		forest, err := builder.Build(context.Background(), filters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forest.Root() != expected.Root() {
+			t.Fatalf("%d workers: expected the root of the serially built forest", workers)
+		}
+		if len(roots) != len(trees) {
+			t.Fatalf("%d workers: expected the roots of %d shards, but got %d", workers, len(trees), len(roots))
+		}
+		for shard, root := range roots {
+			if root != trees[shard].Root() {
+				t.Fatalf("%d workers: unexpected root of shard %d", workers, shard)
+			}
+		}
+	}
+
+	builder, err := NewForestBuilder(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Build(context.Background()); err == nil {
+		t.Fatal("expected error for a forest without shards")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := builder.Build(ctx, filters...); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, but got %v", context.Canceled, err)
+	}
+	invalid := append([]BloomFilter(nil), filters...)
+	invalid[4] = tooManyHashesBF{generateDBF(200, seed)}
+	if _, err := builder.Build(context.Background(), invalid...); err == nil {
+		t.Fatal("expected error for an invalid shard")
+	}
+	if _, err := NewForestBuilder(2, WithNodeStore(NewMemoryStore(0))); err == nil {
+		t.Fatal("expected error for trees sharing a node store")
+	}
+}
@@ -0,0 +1,180 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestBloomForest(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	// the elements are added to the filters of their shards
+	filters := []*DBF.DistBF{generateDBF(200, seed), generateDBF(200, seed), generateDBF(200, seed)}
+	elements := [][]byte{{1}, {2}, {3}, {4}, {5}, {6}}
+	for _, elem := range elements {
+		filters[ForestShard(SHA512_256, elem, len(filters))].Add(elem)
+	}
+	var trees []*BloomTree
+	for _, dbf := range filters {
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees = append(trees, tree)
+	}
+	if _, err := NewBloomForest(); err == nil {
+		t.Fatal("expected error for a forest without trees")
+	}
+	other, err := NewBloomTree(filters[0], WithHash(Keccak256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBloomForest(trees[0], other); err == nil {
+		t.Fatal("expected error for trees of different hash functions")
+	}
+	forest, err := NewBloomForest(trees...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := NewBloomForest(trees[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forest.Len() != 3 || single.Len() != 1 {
+		t.Fatalf("expected 3 and 1 shards, but got %d and %d", forest.Len(), single.Len())
+	}
+	if single.Root() == trees[0].Root() {
+		t.Fatal("expected the forest root to differ from the root of its only tree")
+	}
+
+	var tests = []struct {
+		forest  *BloomForest
+		filters []*DBF.DistBF
+		elem    []byte
+		present bool
+	}{
+		{forest: forest, filters: filters, elem: []byte{42}, present: false},
+	}
+	for _, elem := range elements {
+		// the single tree holds the elements of shard 0
+		if forest.Shard(elem) == 0 {
+			tests = append(tests, struct {
+				forest  *BloomForest
+				filters []*DBF.DistBF
+				elem    []byte
+				present bool
+			}{forest: single, filters: filters[:1], elem: elem, present: true})
+		}
+		tests = append(tests, struct {
+			forest  *BloomForest
+			filters []*DBF.DistBF
+			elem    []byte
+			present bool
+		}{forest: forest, filters: filters, elem: elem, present: true})
+	}
+	for _, test := range tests {
+		proof, err := test.forest.GenerateCompactMultiProof(test.elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shard := test.forest.Shard(test.elem)
+		if proof.Shard != uint64(shard) || proof.Proof.ProofType.IsPresence() != test.present {
+			t.Fatalf("expected presence %t of element %v in shard %d", test.present, test.elem, shard)
+		}
+		root := test.forest.Root()
+		verified, err := VerifyForestProof(test.elem, []byte(seed), proof, root, test.filters[shard], WithCrossCheckRoot(root))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify forest proof of element %v in shard %d", test.elem, shard)
+		}
+		if proof.Shards == 1 {
+			continue
+		}
+
+		// the proof of an element cannot name another shard, whose tree does not hold it
+		moved := *proof
+		moved.Shard = uint64((shard + 1) % int(proof.Shards))
+		if verified, err := VerifyForestProof(test.elem, []byte(seed), &moved, root, test.filters[shard]); verified || !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("expected %v for forest proof of shard %d as shard %d, got %t and %v", ErrInvalidProof, shard, moved.Shard, verified, err)
+		}
+	}
+
+	// another tree committed to for a shard cannot prove its elements
+	for _, elem := range elements {
+		shard := forest.Shard(elem)
+		other := trees[(shard+1)%len(trees)]
+		multiproof, err := other.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := forest.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof.TreeRoot, proof.Proof = other.Root(), multiproof
+		if verified, _ := VerifyForestProof(elem, []byte(seed), proof, forest.Root(), filters[(shard+1)%len(trees)]); verified {
+			t.Fatalf("verified element %v of shard %d from the tree of another shard", elem, shard)
+		}
+	}
+
+	proof, err := forest.GenerateCompactMultiProof(elements[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *proof
+	tampered.Path = append([][32]byte(nil), proof.Path...)
+	tampered.Path[0][0] ^= 1
+	if verified, err := VerifyForestPath(&tampered, forest.Root()); !errors.Is(err, ErrInvalidProof) || verified {
+		t.Fatalf("expected a tampered path to fail verification, got %t and %v", verified, err)
+	}
+	// the padding leaf of the forest cannot be claimed as a shard
+	padding := *proof
+	padding.Shard = 3
+	if _, err := VerifyForestPath(&padding, forest.Root()); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected %v for a shard out of range, but got %v", ErrInvalidProof, err)
+	}
+	truncated := *proof
+	truncated.Path = proof.Path[:1]
+	if _, err := VerifyForestPath(&truncated, forest.Root()); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected %v for a truncated path, but got %v", ErrInvalidProof, err)
+	}
+
+	// updated trees are committed to when they are set again
+	added := []byte{7}
+	for forest.Shard(added) != 1 {
+		added[0]++
+	}
+	before := forest.Root()
+	if err := trees[1].Update(added); err != nil {
+		t.Fatal(err)
+	}
+	if err := forest.SetTree(1, trees[1]); err != nil {
+		t.Fatal(err)
+	}
+	if forest.Root() == before {
+		t.Fatal("expected the root to change after setting an updated tree")
+	}
+	rebuilt, err := NewBloomForest(trees...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Root() != forest.Root() {
+		t.Fatal("expected the root of an updated forest to match the root of a rebuilt forest")
+	}
+	proof, err = forest.GenerateCompactMultiProof(added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified, err := VerifyForestProof(added, []byte(seed), proof, forest.Root(), filters[1]); err != nil || !verified {
+		t.Fatalf("failed to verify the proof of an added element, got %t and %v", verified, err)
+	}
+	if verified, _ := VerifyForestProof(added, []byte(seed), proof, before, filters[1]); verified {
+		t.Fatal("verified the proof of an added element against an old root")
+	}
+	if err := forest.SetTree(1, other); err == nil {
+		t.Fatal("expected error for a tree of another hash function")
+	}
+}
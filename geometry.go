@@ -0,0 +1,93 @@
+package bloomtree
+
+import (
+	"fmt"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// WordBits is the number of bits of a bloom filter word. Chunk sizes are positive multiples of it.
+//
+// The geometry helpers derive the layout of a tree from the number of bits of its bloom filter and its chunk
+// size in bits, so storage backends, on-chain verifiers and delegated subtrees share the arithmetic of the
+// package instead of re-deriving it. A tree of n padded leafs, n a power of two, has 2n-1 nodes laid out layer
+// by layer: the leafs at [0, n), their parents at [n, n+n/2), and so on up to the root at 2n-2. Adaptive trees
+// have chunks of varying sizes and do not follow the helpers.
+//
+// The helpers do not validate their arguments, as they are called on the hot paths of proofs: the chunk size
+// must be a positive multiple of WordBits, e.g. from a verified attestation, or the helpers divide by zero.
+const WordBits = 64
+
+// ChunkIndexOf returns the index of the chunk, and with it of the leaf, holding the bloom filter bit index. It
+// panics for a chunk size of zero.
+func ChunkIndexOf(bitIndex uint64, chunkSize int) uint64 {
+	return core.ChunkIndex(bitIndex, chunkSize)
+}
+
+// WordCountFor returns the number of words of a bloom filter of filterBits bits.
+func WordCountFor(filterBits uint64) uint64 {
+	return (filterBits + WordBits - 1) / WordBits
+}
+
+// LeafCountFor returns the number of leafs holding chunks of a bloom filter of filterBits bits, excluding the
+// padding leafs. It panics for chunk sizes below WordBits.
+func LeafCountFor(filterBits uint64, chunkSize int) uint64 {
+	step := uint64(chunkSize / WordBits)
+	return (WordCountFor(filterBits) + step - 1) / step
+}
+
+// ChunkWordCount returns the number of words of the chunk at the given index, which is less than the chunk size
+// for the last chunk of a bloom filter whose words do not fill it, and zero for padding leafs. The chunk size
+// must be a multiple of WordBits, it panics for smaller ones.
+func ChunkWordCount(chunk, filterBits uint64, chunkSize int) int {
+	words, step := WordCountFor(filterBits), uint64(chunkSize/WordBits)
+	if chunk*step >= words {
+		return 0
+	}
+	if words-chunk*step < step {
+		return int(words - chunk*step)
+	}
+	return int(step)
+}
+
+// PaddedLeafCount returns the number of leafs of the tree of a bloom filter of filterBits bits, i.e. the
+// smallest power of two that is at least LeafCountFor. Like LeafCountFor, it panics for chunk sizes below
+// WordBits.
+func PaddedLeafCount(filterBits uint64, chunkSize int) uint64 {
+	return uint64(core.LeafNum(int(LeafCountFor(filterBits, chunkSize))))
+}
+
+// NodeCountFor returns the number of nodes of the tree of a bloom filter of filterBits bits, the length of its
+// node array. Its chunk size has the precondition of PaddedLeafCount.
+func NodeCountFor(filterBits uint64, chunkSize int) int {
+	return 2*int(PaddedLeafCount(filterBits, chunkSize)) - 1
+}
+
+// LayerStart returns the index in the node array of the first node of a layer of a tree of leafNum leafs,
+// where the leafs are layer 0.
+func LayerStart(layer int, leafNum uint64) uint64 {
+	return 2 * (leafNum - leafNum>>uint(layer))
+}
+
+// NodeIndex returns the index in the node array of the node at the given index of a layer of a tree of leafNum
+// leafs. An error wrapping ErrLayerIndexOutOfRange is returned if the layer has no such node.
+func NodeIndex(layer int, index, leafNum uint64) (uint64, error) {
+	if layer < 0 || index >= leafNum>>uint(layer) {
+		return 0, fmt.Errorf("%w: node %d of layer %d of a tree of %d leafs", ErrLayerIndexOutOfRange, index, layer, leafNum)
+	}
+	return LayerStart(layer, leafNum) + index, nil
+}
+
+// NodeLayer returns the layer of the node at index i of the node array of a tree of leafNum leafs, and its index
+// within the layer. An error wrapping ErrLayerIndexOutOfRange is returned if the tree has no such node.
+func NodeLayer(i, leafNum uint64) (int, uint64, error) {
+	if leafNum == 0 || i >= 2*leafNum-1 {
+		return 0, 0, fmt.Errorf("%w: node %d of a tree of %d leafs", ErrLayerIndexOutOfRange, i, leafNum)
+	}
+	layer, start := 0, uint64(0)
+	for width := leafNum; i >= start+width; width /= 2 {
+		start += width
+		layer++
+	}
+	return layer, i - start, nil
+}
@@ -0,0 +1,89 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+func TestGeometry(t *testing.T) {
+	var tests = []struct {
+		filterBits uint64
+		chunkSize  int
+		leafs      uint64
+		padded     uint64
+		lastWords  int
+	}{
+		{filterBits: 1, chunkSize: 64, leafs: 1, padded: 1, lastWords: 1},
+		{filterBits: 64, chunkSize: 64, leafs: 1, padded: 1, lastWords: 1},
+		{filterBits: 65, chunkSize: 64, leafs: 2, padded: 2, lastWords: 1},
+		{filterBits: 1000, chunkSize: 256, leafs: 4, padded: 4, lastWords: 4},
+		{filterBits: 1025, chunkSize: 256, leafs: 5, padded: 8, lastWords: 1},
+		{filterBits: 5000, chunkSize: 512, leafs: 10, padded: 16, lastWords: 7},
+	}
+	for _, test := range tests {
+		if leafs := LeafCountFor(test.filterBits, test.chunkSize); leafs != test.leafs {
+			t.Fatalf("expected %d leafs for %d bits in chunks of %d, got %d", test.leafs, test.filterBits, test.chunkSize, leafs)
+		}
+		if padded := PaddedLeafCount(test.filterBits, test.chunkSize); padded != test.padded {
+			t.Fatalf("expected %d padded leafs for %d bits in chunks of %d, got %d", test.padded, test.filterBits, test.chunkSize, padded)
+		}
+		if n := NodeCountFor(test.filterBits, test.chunkSize); n != int(2*test.padded-1) {
+			t.Fatalf("expected %d nodes for %d bits in chunks of %d, got %d", 2*test.padded-1, test.filterBits, test.chunkSize, n)
+		}
+		var words uint64
+		for i := uint64(0); i < test.padded; i++ {
+			words += uint64(ChunkWordCount(i, test.filterBits, test.chunkSize))
+		}
+		if last := ChunkWordCount(test.leafs-1, test.filterBits, test.chunkSize); last != test.lastWords || words != WordCountFor(test.filterBits) {
+			t.Fatalf("expected %d words in the last chunk and %d in all, got %d and %d", test.lastWords, WordCountFor(test.filterBits), last, words)
+		}
+		if chunk := ChunkIndexOf(test.filterBits-1, test.chunkSize); chunk != test.leafs-1 {
+			t.Fatalf("expected the last bit of %d bits in chunk %d, got %d", test.filterBits, test.leafs-1, chunk)
+		}
+	}
+
+	// the helpers agree with the trees of the package
+	dbf := generateDBF(1000, "secret seed", []byte{1})
+	for _, chunkSize := range []int{64, 256, 1024} {
+		n, err := TreeLength(dbf, WithChunkSize(chunkSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := NodeCountFor(uint64(dbf.BitArray().Len()), chunkSize); n != expected {
+			t.Fatalf("expected a tree of %d nodes with chunk size %d, got %d", expected, chunkSize, n)
+		}
+	}
+}
+
+func TestNodeLayout(t *testing.T) {
+	for _, leafNum := range []uint64{1, 2, 8, 32} {
+		nodes := 2*leafNum - 1
+		for i := uint64(0); i < nodes; i++ {
+			layer, index, err := NodeLayer(i, leafNum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if node, err := NodeIndex(layer, index, leafNum); err != nil || node != i {
+				t.Fatalf("expected node %d at index %d of layer %d of %d leafs, got %d, %v", i, index, layer, leafNum, node, err)
+			}
+			if i == nodes-1 {
+				if layer != core.Height(int(nodes)) || index != 0 {
+					t.Fatalf("expected the root of %d leafs at the top layer, got layer %d", leafNum, layer)
+				}
+				continue
+			}
+			parent, _ := NodeIndex(layer+1, index/2, leafNum)
+			if parent != core.Parent(i, leafNum) {
+				t.Fatalf("expected parent %d of node %d of %d leafs, got %d", core.Parent(i, leafNum), i, leafNum, parent)
+			}
+		}
+		if _, _, err := NodeLayer(nodes, leafNum); !errors.Is(err, ErrLayerIndexOutOfRange) {
+			t.Fatalf("expected ErrLayerIndexOutOfRange for node %d of %d leafs, got %v", nodes, leafNum, err)
+		}
+		if _, err := NodeIndex(0, leafNum, leafNum); !errors.Is(err, ErrLayerIndexOutOfRange) {
+			t.Fatalf("expected ErrLayerIndexOutOfRange for leaf %d of %d leafs, got %v", leafNum, leafNum, err)
+		}
+	}
+}
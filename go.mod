@@ -3,7 +3,12 @@ module github.com/labbloom/bloom-tree
 go 1.13
 
 require (
+	github.com/bits-and-blooms/bloom/v3 v3.7.1
+	github.com/cespare/xxhash/v2 v2.1.1
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/labbloom/DBF v0.0.0-20200120152626-4d4fd29ad009
 	github.com/willf/bitset v1.1.10
+	github.com/willf/bloom v2.0.3+incompatible
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	lukechampine.com/blake3 v1.0.0
 )
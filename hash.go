@@ -4,38 +4,334 @@ import (
 	"crypto/sha512"
 	"encoding/binary"
 	"errors"
+	"fmt"
+
+	"github.com/labbloom/bloom-tree/core"
 )
 
 var chunkSize = 64
 
+// Hash is the hash function used for the leafs and internal nodes of a bloom tree.
+type Hash uint8
+
+const (
+	// SHA512_256 is SHA-512/256, the default hash function.
+	SHA512_256 = Hash(core.SHA512_256)
+	// SHA256 is SHA-256.
+	SHA256 = Hash(core.SHA256)
+	// Keccak256 is the legacy Keccak-256 used by the EVM.
+	Keccak256 = Hash(core.Keccak256)
+	// BLAKE3 is BLAKE3 with a 256 bit output.
+	BLAKE3 = Hash(core.BLAKE3)
+)
+
+var hashNames = map[Hash]string{
+	SHA512_256: "sha512/256",
+	SHA256:     "sha256",
+	Keccak256:  "keccak256",
+	BLAKE3:     "blake3",
+}
+
+// ParseHash returns the hash function with the given name, as returned by Hash.String.
+func ParseHash(name string) (Hash, error) {
+	for h, n := range hashNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash function %q", name)
+}
+
+func (h Hash) String() string {
+	if name, ok := hashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("hash(%d)", uint8(h))
+}
+
+func (h Hash) valid() bool {
+	_, ok := hashNames[h]
+	return ok
+}
+
+// sum returns the 256 bit digest of data.
+func (h Hash) sum(data []byte) [32]byte {
+	return core.Hash(h).Sum(data)
+}
+
 // Hash returns a 256 bit hash
 func hashChild(elem1, elem2 [32]byte) [32]byte {
-	var elem []byte
-	elem = append(elem, elem1[:]...)
-	elem = append(elem, elem2[:]...)
-	return sha512.Sum512_256(elem)
+	return SHA512_256.child(elem1, elem2)
 }
 
 func hashLeaf(index uint64, elements ...uint64) [sha512.Size256]byte {
-	var elem []byte
+	return SHA512_256.leaf(chunkSize, index, elements...)
+}
 
-	a := make([]byte, chunkSize)
-	binary.LittleEndian.PutUint64(a, index)
+// child hashes two children of an internal node.
+func (h Hash) child(elem1, elem2 [32]byte) [32]byte {
+	return core.Hash(h).Child(elem1, elem2)
+}
+
+// leaf hashes the words of the chunk at the given index of a tree with the given chunk size,
+// which is also the length of the index prefix.
+func (h Hash) leaf(size int, index uint64, elements ...uint64) [32]byte {
+	return core.Hash(h).Leaf(size, index, elements...)
+}
+
+// Chunk returns the leaf hash of the chunk at the given index holding the given bloom filter words,
+// for trees with the chunk size set by SetChunkSize.
+func (h Hash) Chunk(index uint64, words ...uint64) [32]byte {
+	return h.leaf(chunkSize, index, words...)
+}
+
+// SizedChunk returns the leaf hash of the chunk at the given index of a tree built with WithChunkSize(size).
+func (h Hash) SizedChunk(size int, index uint64, words ...uint64) [32]byte {
+	return h.leaf(size, index, words...)
+}
 
-	elem = append(elem, a[:]...)
-	for _, e := range elements {
-		b := make([]byte, 64)
-		binary.LittleEndian.PutUint64(b, e)
-		elem = append(elem, b...)
+// blindedLeaf hashes the word commitments of the chunk at the given index of a blinded tree.
+func (h Hash) blindedLeaf(index uint64, commitments ...[32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("blinded leaf")...)
+	elem = appendUint64(elem, index)
+	for _, c := range commitments {
+		elem = append(elem, c[:]...)
 	}
+	return h.sum(elem)
+}
 
-	return sha512.Sum512_256(elem)
+// wordCommitment commits to a word of a blinded tree with its salt.
+func (h Hash) wordCommitment(salt [32]byte, word uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("blinded word")...)
+	elem = append(elem, salt[:]...)
+	elem = appendUint64(elem, word)
+	return h.sum(elem)
+}
+
+// wordSalt derives the salt of the given word of a chunk from the blinding key.
+func (h Hash) wordSalt(key []byte, chunk uint64, word int) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("word salt")...)
+	elem = append(elem, key...)
+	elem = appendUint64(elem, chunk)
+	elem = appendUint64(elem, uint64(word))
+	return h.sum(elem)
+}
+
+// BlindedChunk returns the leaf hash of the chunk at the given index of a tree built with WithBlinding,
+// given the commitments of its words.
+func (h Hash) BlindedChunk(index uint64, commitments ...[32]byte) [32]byte {
+	return h.blindedLeaf(index, commitments...)
+}
+
+// WordCommitment returns the commitment of a word of a tree built with WithBlinding, given its salt.
+func (h Hash) WordCommitment(salt [32]byte, word uint64) [32]byte {
+	return h.wordCommitment(salt, word)
+}
+
+// word hashes a word of the word tree of the chunk at the given index, position being its index in the chunk.
+func (h Hash) word(index uint64, position int, word uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("word leaf")...)
+	elem = appendUint64(elem, index)
+	elem = appendUint64(elem, uint64(position))
+	elem = appendUint64(elem, word)
+	return h.sum(elem)
+}
+
+// wordPadding hashes the padding leaf at the given position of the word tree of a chunk.
+func (h Hash) wordPadding(index uint64, position int) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("word padding")...)
+	elem = appendUint64(elem, index)
+	elem = appendUint64(elem, uint64(position))
+	return h.sum(elem)
+}
+
+// wordTreeLeaf hashes the root of the word tree of the chunk at the given index into its leaf.
+func (h Hash) wordTreeLeaf(index uint64, root [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("word tree leaf")...)
+	elem = appendUint64(elem, index)
+	elem = append(elem, root[:]...)
+	return h.sum(elem)
+}
+
+// seedCommitment commits to the seed of a bloom filter without revealing it to holders of committed roots.
+func (h Hash) seedCommitment(seed []byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("seed commitment")...)
+	elem = append(elem, seed...)
+	return h.sum(elem)
+}
+
+// committedRoot binds the root of a tree to the parameters of its bloom filter and tree.
+func (h Hash) committedRoot(root [32]byte, m, k uint64, seedCommitment [32]byte, chunkSize uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("committed root")...)
+	elem = append(elem, byte(h))
+	elem = append(elem, root[:]...)
+	elem = appendUint64(elem, m)
+	elem = appendUint64(elem, k)
+	elem = append(elem, seedCommitment[:]...)
+	elem = appendUint64(elem, chunkSize)
+	return h.sum(elem)
 }
 
+// padding hashes the padding leaf at the given index. The domain tag keeps padding leafs
+// apart from leafs of real chunks, which would otherwise collide with all-zero chunks.
+func (h Hash) padding(index uint64) [32]byte {
+	return core.Hash(h).Padding(index)
+}
+
+// adaptiveLeaf hashes a variable sized chunk, committing to the words [start, end) it spans.
+func (h Hash) adaptiveLeaf(size int, index, start, end uint64, elements ...uint64) [32]byte {
+	return h.leaf(size, index, append([]uint64{start, end}, elements...)...)
+}
+
+// popcountLeaf hashes the popcount of a chunk together with its leaf hash.
+func (h Hash) popcountLeaf(leaf [32]byte, count uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("popcount leaf")...)
+	elem = append(elem, leaf[:]...)
+	elem = appendUint64(elem, count)
+	return h.sum(elem)
+}
+
+// popcountNode hashes two children of the popcount sum tree.
+func (h Hash) popcountNode(left PopcountNode, right PopcountNode) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("popcount node")...)
+	elem = append(elem, left.Hash[:]...)
+	elem = appendUint64(elem, left.Count)
+	elem = append(elem, right.Hash[:]...)
+	elem = appendUint64(elem, right.Count)
+	return h.sum(elem)
+}
+
+// popcountRoot commits to the root of the popcount sum tree and the total popcount, bound to the root of the
+// bloom tree whose chunks are counted.
+func (h Hash) popcountRoot(treeRoot [32]byte, root PopcountNode) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("popcount root")...)
+	elem = append(elem, treeRoot[:]...)
+	elem = append(elem, root.Hash[:]...)
+	elem = appendUint64(elem, root.Count)
+	return h.sum(elem)
+}
+
+// overlayRoot commits to the roots of the member and tombstone trees of an overlay tree.
+func (h Hash) overlayRoot(members, tombstones [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("overlay root")...)
+	elem = append(elem, members[:]...)
+	elem = append(elem, tombstones[:]...)
+	return h.sum(elem)
+}
+
+// forestLeaf hashes the root of the tree of a shard into its leaf of a forest.
+func (h Hash) forestLeaf(shard uint64, root [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("forest leaf")...)
+	elem = appendUint64(elem, shard)
+	elem = append(elem, root[:]...)
+	return h.sum(elem)
+}
+
+// forestNode hashes two children of the Merkle tree of a forest.
+func (h Hash) forestNode(left, right [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("forest node")...)
+	elem = append(elem, left[:]...)
+	elem = append(elem, right[:]...)
+	return h.sum(elem)
+}
+
+// forestRoot commits to the root of the Merkle tree of a forest and its number of shards, whose elements are
+// assigned by forestShard.
+func (h Hash) forestRoot(root [32]byte, shards uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("forest root")...)
+	elem = append(elem, root[:]...)
+	elem = appendUint64(elem, shards)
+	elem = append(elem, []byte("forest shard")...)
+	return h.sum(elem)
+}
+
+// forestShard returns the shard of an element in a forest of the given number of shards.
+func (h Hash) forestShard(element []byte, shards uint64) uint64 {
+	var elem []byte
+	elem = append(elem, []byte("forest shard")...)
+	elem = append(elem, element...)
+	sum := h.sum(elem)
+	return binary.BigEndian.Uint64(sum[:8]) % shards
+}
+
+// checkpointLeaf hashes a root published in a period into its leaf of a checkpoint.
+func (h Hash) checkpointLeaf(index uint64, root [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("checkpoint leaf")...)
+	elem = appendUint64(elem, index)
+	elem = append(elem, root[:]...)
+	return h.sum(elem)
+}
+
+// checkpointNode hashes two children of the Merkle tree of a checkpoint.
+func (h Hash) checkpointNode(left, right [32]byte) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("checkpoint node")...)
+	elem = append(elem, left[:]...)
+	elem = append(elem, right[:]...)
+	return h.sum(elem)
+}
+
+// checkpointDigest binds the root of the Merkle tree of a checkpoint to its period and number of roots.
+func (h Hash) checkpointDigest(root [32]byte, start, period, roots uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("checkpoint digest")...)
+	elem = append(elem, root[:]...)
+	elem = appendUint64(elem, start)
+	elem = appendUint64(elem, period)
+	elem = appendUint64(elem, roots)
+	return h.sum(elem)
+}
+
+// familyRoot binds the root of the tree of a filter family to the number of its filters and leaf groups.
+func (h Hash) familyRoot(root [32]byte, filters, groups uint64) [32]byte {
+	var elem []byte
+	elem = append(elem, []byte("filter family root")...)
+	elem = append(elem, root[:]...)
+	elem = appendUint64(elem, filters)
+	elem = appendUint64(elem, groups)
+	return h.sum(elem)
+}
+
+// emptyRoot is the canonical root of the tree of a bloom filter without bits.
+func (h Hash) emptyRoot() [32]byte {
+	return h.sum([]byte("empty tree"))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	a := make([]byte, 8)
+	binary.LittleEndian.PutUint64(a, v)
+	return append(b, a...)
+}
+
+// SetChunkSize sets the default chunk size of trees built or verified without WithChunkSize.
 func SetChunkSize(v int) error {
-	if v % 64 != 0 {
-		return errors.New("The chunk size must be divisible by 64")
+	if err := checkChunkSize(v); err != nil {
+		return err
 	}
 	chunkSize = v
 	return nil
 }
+
+// checkChunkSize returns an error unless v is a positive multiple of 64.
+func checkChunkSize(v int) error {
+	if v <= 0 || v%64 != 0 {
+		return errors.New("The chunk size must be divisible by 64")
+	}
+	return nil
+}
@@ -54,3 +54,53 @@ func TestHashChild(t *testing.T) {
 		}
 	}
 }
+
+func TestHashes(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	roots := make(map[[32]byte]Hash)
+	for _, h := range []Hash{SHA512_256, SHA256, Keccak256, BLAKE3} {
+		parsed, err := ParseHash(h.String())
+		if err != nil || parsed != h {
+			t.Fatalf("failed to parse hash %v", h)
+		}
+		tree, err := NewBloomTree(dbf, WithHash(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, ok := roots[tree.Root()]; ok {
+			t.Fatalf("hash %v has the same root as %v", h, other)
+		}
+		roots[tree.Root()] = h
+		if tree.nodes[0] != h.Chunk(0, dbf.BitArray().Bytes()[0]) {
+			t.Fatalf("leaf 0 does not match the %v chunk hash", h)
+		}
+
+		for _, elem := range [][]byte{{1}, {3}} {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf, WithHash(h))
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify proof of %v with hash %v", elem, h)
+			}
+			if h != SHA512_256 {
+				verified, _ = VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf)
+				if verified {
+					t.Fatalf("verified proof of hash %v with SHA-512/256", h)
+				}
+			}
+		}
+	}
+
+	if _, err := NewBloomTree(dbf, WithHash(Hash(42))); err == nil {
+		t.Fatal("expected error for unknown hash function")
+	}
+	if _, err := ParseHash("md5"); err == nil {
+		t.Fatal("expected error for unknown hash name")
+	}
+}
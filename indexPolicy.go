@@ -0,0 +1,87 @@
+package bloomtree
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// IndexPolicy tells how trees and verifiers treat bloom filter indices past the end of the bit array, which a
+// buggy BloomFilter adapter or a truncated filter may map elements to.
+type IndexPolicy uint8
+
+const (
+	// RejectOutOfRange fails proofs, updates and verifications of elements mapped past the bit array with an
+	// *IndexError. It is the default.
+	RejectOutOfRange IndexPolicy = iota
+	// ClampOutOfRange maps indices past the bit array to its last bit, and counts them in ClampedIndices, so
+	// the elements of a slightly truncated filter can still be proven while the mismatch is monitored.
+	ClampOutOfRange
+)
+
+// WithIndexPolicy sets how indices past the end of the bloom filter are treated. Provers and verifiers must
+// use the same policy, as a clamped proof does not verify when the indices are rejected, and vice versa.
+// The indices of counting bloom filters are never clamped by Update, as their counters cannot be clamped.
+func WithIndexPolicy(p IndexPolicy) Option {
+	return func(c *config) error {
+		if p > ClampOutOfRange {
+			return fmt.Errorf("unknown index policy %d", p)
+		}
+		c.indexPolicy = p
+		return nil
+	}
+}
+
+// ClampedIndices returns the number of element indices past the end of the bloom filter that were clamped to
+// its last bit by proofs and updates of a tree built with WithIndexPolicy(ClampOutOfRange). Any other value
+// than zero means the bloom filter does not match its indices.
+func (bt *BloomTree) ClampedIndices() uint64 {
+	return atomic.LoadUint64(&bt.clamped)
+}
+
+// fitIndices returns the element indices within a bloom filter of length bits according to the index
+// policy, together with the number of clamped indices. Clamped indices are returned in a copy.
+func (c config) fitIndices(indices []uint, length uint64) ([]uint, int, error) {
+	var clamped []uint
+	n := 0
+	for i, v := range indices {
+		if uint64(v) < length {
+			continue
+		}
+		if c.indexPolicy != ClampOutOfRange || length == 0 {
+			return nil, 0, &IndexError{Index: uint64(v), Length: length}
+		}
+		if clamped == nil {
+			clamped = append([]uint(nil), indices...)
+		}
+		clamped[i] = uint(length - 1)
+		n++
+	}
+	if clamped == nil {
+		return indices, 0, nil
+	}
+	return clamped, n, nil
+}
+
+// elementIndices returns the bloom filter indices of elem fitted to the bloom filter of the tree, and counts
+// the clamped indices.
+func (bt *BloomTree) elementIndices(elem []byte) ([]uint, error) {
+	indices, n, err := bt.cfg.fitIndices(bt.bf.GetElementIndices(elem), uint64(bt.bf.BitArray().Len()))
+	if n > 0 {
+		atomic.AddUint64(&bt.clamped, uint64(n))
+	}
+	return indices, err
+}
+
+// clampedProof works like the Proof of DBF bloom filters on the clamped element indices, for filters whose
+// own Proof returns indices past the bit array.
+func (bt *BloomTree) clampedProof(elemIndices []uint) ([]uint64, bool) {
+	bits := bt.bf.BitArray()
+	var ret []uint64
+	for _, v := range elemIndices {
+		if !bits.Test(v) {
+			return []uint64{uint64(v)}, false
+		}
+		ret = append(ret, uint64(v))
+	}
+	return ret, true
+}
@@ -0,0 +1,111 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+// overflowFilter maps every element to one more index past the end of the bit array, like a buggy adapter.
+type overflowFilter struct {
+	*DBF.DistBF
+}
+
+func (f overflowFilter) GetElementIndices(elem []byte) []uint {
+	return append(f.DistBF.GetElementIndices(elem), f.BitArray().Len()+3)
+}
+
+func (f overflowFilter) MapElementToBF(elem, seed []byte) []uint {
+	return append(f.DistBF.MapElementToBF(elem, seed), f.BitArray().Len()+3)
+}
+
+func (f overflowFilter) Proof(elem []byte) ([]uint64, bool) {
+	var ret []uint64
+	for _, v := range f.GetElementIndices(elem) {
+		if !f.BitArray().Test(v) {
+			return []uint64{uint64(v)}, false
+		}
+		ret = append(ret, uint64(v))
+	}
+	return ret, true
+}
+
+func TestIndexPolicy(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2})
+	bf := overflowFilter{dbf}
+	length := uint64(dbf.BitArray().Len())
+	if _, err := NewBloomTree(bf, WithIndexPolicy(IndexPolicy(7))); err == nil {
+		t.Fatal("expected an error for an unknown index policy")
+	}
+
+	// by default, elements mapped past the bit array are rejected
+	tree, err := NewBloomTree(bf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexErr *IndexError
+	if _, err := tree.GenerateCompactMultiProof([]byte{1}); !errors.As(err, &indexErr) || indexErr.Index != length+3 || indexErr.Length != length {
+		t.Fatalf("expected an *IndexError of index %d, got %v", length+3, err)
+	}
+	if _, err := tree.GenerateCompactMultiProofBatch([][]byte{{2}, {1}}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange for a batch, got %v", err)
+	}
+	if err := tree.Update([]byte{3}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange for an update, got %v", err)
+	}
+	plain, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := plain.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), proof, plain.Root(), bf); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange for a verification, got %v", err)
+	}
+	if tree.ClampedIndices() != 0 {
+		t.Fatal("expected no clamped indices without ClampOutOfRange")
+	}
+
+	// clamped indices point to the last bit, and are counted
+	tree, err = NewBloomTree(bf, WithIndexPolicy(ClampOutOfRange))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range [][]byte{{1}, {2}, {42}} {
+		proof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := VerifyCompactMultiProof(elem, []byte(seed), proof, tree.Root(), bf, WithIndexPolicy(ClampOutOfRange)); err != nil || !ok {
+			t.Fatalf("failed to verify the clamped proof of %v: %v", elem, err)
+		}
+		if elem[0] != 42 && proof.ProofType.IsPresence() != dbf.BitArray().Test(uint(length-1)) {
+			t.Fatalf("expected presence of %v only if the last bit is set", elem)
+		}
+		if _, err := VerifyCompactMultiProof(elem, []byte(seed), proof, tree.Root(), bf); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Fatalf("expected ErrIndexOutOfRange verifying a clamped proof without ClampOutOfRange, got %v", err)
+		}
+	}
+	if tree.ClampedIndices() == 0 {
+		t.Fatal("expected clamped indices")
+	}
+	clamped := tree.ClampedIndices()
+	if err := tree.Update([]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.ClampedIndices() != clamped+1 || !dbf.BitArray().Test(uint(length-1)) {
+		t.Fatal("expected the update to set the clamped last bit")
+	}
+	proof, err = tree.GenerateCompactMultiProof([]byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyCompactMultiProof([]byte{3}, []byte(seed), proof, tree.Root(), bf, WithIndexPolicy(ClampOutOfRange)); err != nil || !ok || !proof.ProofType.IsPresence() {
+		t.Fatalf("expected a presence proof of the updated element, got %v", err)
+	}
+}
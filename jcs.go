@@ -0,0 +1,236 @@
+package bloomtree
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// maxSafeInteger is the largest integer that can be represented exactly by an
+// IEEE 754 double, and therefore the largest number RFC 8785 can serialize.
+const maxSafeInteger = 1<<53 - 1
+
+// RootAttestation describes a bloom tree root together with the parameters
+// a verifier needs to interpret proofs generated against it.
+type RootAttestation struct {
+	Root        [32]byte
+	ChunkSize   uint64
+	Hash        Hash
+	NumOfHashes uint64
+	FilterBits  uint64
+}
+
+// Attestation returns the root attestation of the bloom tree.
+func (bt *BloomTree) Attestation() RootAttestation {
+	return RootAttestation{
+		Root:        bt.Root(),
+		ChunkSize:   uint64(bt.cfg.chunkSize),
+		Hash:        bt.cfg.hash,
+		NumOfHashes: uint64(bt.bf.NumOfHashes()),
+		FilterBits:  uint64(bt.bf.BitArray().Len()),
+	}
+}
+
+// CanonicalJSON returns the RFC 8785 (JCS) canonical JSON form of the root attestation.
+func (a RootAttestation) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(a.object())
+}
+
+// Sign returns the ed25519 signature of the canonical JSON of the root attestation.
+func (a RootAttestation) Sign(key ed25519.PrivateKey) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	message, err := a.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(key, message), nil
+}
+
+// VerifySignature returns whether the signature of the root attestation was made with the private key of the
+// given public key.
+func (a RootAttestation) VerifySignature(key ed25519.PublicKey, signature []byte) bool {
+	if len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	message, err := a.CanonicalJSON()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, message, signature)
+}
+
+// object returns the JSON object of the root attestation.
+func (a RootAttestation) object() map[string]interface{} {
+	return map[string]interface{}{
+		"root":        hex.EncodeToString(a.Root[:]),
+		"chunkSize":   a.ChunkSize,
+		"hash":        a.Hash.String(),
+		"numOfHashes": a.NumOfHashes,
+		"filterBits":  a.FilterBits,
+	}
+}
+
+// CanonicalJSON returns the RFC 8785 (JCS) canonical JSON form of the proof.
+// Hashes are encoded as lowercase hex strings.
+func (p *CompactMultiProof) CanonicalJSON() ([]byte, error) {
+	obj := map[string]interface{}{
+		"chunks":    hexHashes(p.Chunks),
+		"proof":     hexHashes(p.Proof),
+		"proofType": uint64(p.ProofType),
+	}
+	if len(p.ChunkWords) != 0 {
+		chunkWords := make([]interface{}, len(p.ChunkWords))
+		for i, words := range p.ChunkWords {
+			chunkWords[i] = hexWords(words)
+		}
+		obj["chunkWords"] = chunkWords
+	}
+	if len(p.AbsentIndices) != 0 {
+		absentIndices := make([]interface{}, len(p.AbsentIndices))
+		for i, v := range p.AbsentIndices {
+			absentIndices[i] = uint64(v)
+		}
+		obj["absentIndices"] = absentIndices
+	}
+	if p.ChunkSize != 0 {
+		obj["chunkSize"] = uint64(p.ChunkSize)
+	}
+	if len(p.WordCommitments) != 0 {
+		wordCommitments := make([]interface{}, len(p.WordCommitments))
+		for i, commitments := range p.WordCommitments {
+			wordCommitments[i] = hexHashes(commitments)
+		}
+		obj["wordCommitments"] = wordCommitments
+	}
+	if len(p.Provenance) != 0 {
+		obj["provenance"] = canonicalProvenance(p.Provenance)
+	}
+	return canonicalJSON(obj)
+}
+
+// hexWords encodes words as 16 digit hex numbers, as canonical JSON numbers cannot exceed 2^53-1.
+func hexWords(words []uint64) []interface{} {
+	ret := make([]interface{}, len(words))
+	for i, w := range words {
+		ret[i] = fmt.Sprintf("%016x", w)
+	}
+	return ret
+}
+
+func hexHashes(hashes [][32]byte) []interface{} {
+	ret := make([]interface{}, len(hashes))
+	for i, h := range hashes {
+		ret[i] = hex.EncodeToString(h[:])
+	}
+	return ret
+}
+
+// canonicalJSON serializes v following RFC 8785. Only the subset of JSON values
+// used by this package is supported: objects, arrays, strings, booleans, null
+// and unsigned integers.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case uint64:
+		if val > maxSafeInteger {
+			return fmt.Errorf("integer %d cannot be represented in canonical JSON", val)
+		}
+		buf.WriteString(strconv.FormatUint(val, 10))
+	case string:
+		writeCanonicalString(buf, val)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		// RFC 8785 orders properties by their UTF-16 code units.
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, val[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported canonical JSON type %T", v)
+	}
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hexDigits = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[r>>4])
+				buf.WriteByte(hexDigits[r&0xf])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
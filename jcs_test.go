@@ -0,0 +1,118 @@
+package bloomtree
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	var tests = []struct {
+		input  interface{}
+		output string
+	}{
+		{
+			input:  map[string]interface{}{"b": uint64(2), "a": uint64(1)},
+			output: `{"a":1,"b":2}`,
+		},
+		{
+			input:  map[string]interface{}{"\u20ac": true, "\r": nil, "\U0001f600": false, "\u00e9": uint64(0)},
+			output: "{\"\\r\":null,\"\u00e9\":0,\"\u20ac\":true,\"\U0001f600\":false}",
+		},
+		{
+			input:  []interface{}{"a\"b\\c", "\u0001\t/"},
+			output: `["a\"b\\c","\u0001\t/"]`,
+		},
+	}
+
+	for _, test := range tests {
+		output, err := canonicalJSON(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != test.output {
+			t.Fatalf("expected %s, but got %s", test.output, output)
+		}
+	}
+}
+
+func TestCanonicalJSONUnsafeInteger(t *testing.T) {
+	_, err := canonicalJSON(uint64(maxSafeInteger + 1))
+	if err == nil {
+		t.Fatal("expected error for integer exceeding 2^53-1")
+	}
+}
+
+func TestCompactMultiProofCanonicalJSON(t *testing.T) {
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2}, []byte{3})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := multiproof.CanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(output), `{"chunkSize":64,"chunkWords":[["`) || !strings.HasSuffix(string(output), `,"proofType":255}`) {
+		t.Fatalf("unexpected canonical form %s", output)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(output, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded["chunks"].([]interface{})) != len(multiproof.Chunks) {
+		t.Fatal("chunk count mismatch")
+	}
+}
+
+func TestRootAttestationCanonicalJSON(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := tree.Attestation().CanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	expected := `{"chunkSize":64,"filterBits":670,"hash":"sha512/256","numOfHashes":3,"root":"` + hexHashes([][32]byte{root})[0].(string) + `"}`
+	if string(output) != expected {
+		t.Fatalf("expected %s, but got %s", expected, output)
+	}
+}
+
+func TestRootAttestationSignature(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := tree.Attestation()
+	signature, err := attestation.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !attestation.VerifySignature(pub, signature) {
+		t.Fatal("failed to verify the signature")
+	}
+	attestation.FilterBits++
+	if attestation.VerifySignature(pub, signature) {
+		t.Fatal("expected the signature to fail for another attestation")
+	}
+	if _, err := attestation.Sign(key[:10]); err == nil {
+		t.Fatal("expected error for an invalid key")
+	}
+}
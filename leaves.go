@@ -0,0 +1,75 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ExportLeaves returns a copy of the leaf hashes of the chunks, excluding the padding leafs.
+// Together with the bloom filter they allow rebuilding the tree with ImportLeaves without hashing the chunks again.
+func (bt *BloomTree) ExportLeaves() [][32]byte {
+	var leafs int
+	if bt.bf != nil {
+		leafs = bt.leafCount(bt.bf.BitArray().Bytes())
+	} else if bt.bounds != nil {
+		leafs = len(bt.bounds)
+	} else {
+		leafs = (bt.nodeCount() + 1) / 2
+	}
+	ret := make([][32]byte, leafs)
+	for i := range ret {
+		ret[i] = bt.node(i)
+	}
+	return ret
+}
+
+// ImportLeaves builds a tree from the bloom filter and its leaf hashes exported with ExportLeaves,
+// hashing only the padding leafs and the internal nodes. The leafs and the internal nodes are hashed with the
+// same hash function, so the leafs can only be reused by a tree with the hash function, chunk size and leaf
+// options (EVM layout, word trees or blinding) of the exported tree, e.g. to rebuild it with other padding,
+// sparse or in a node store. A tree with another hash function has to hash its leafs again. Only the first
+// leaf hash is checked against the bloom filter, which rejects leafs of other options, so the other leafs
+// must be trusted. Leafs of adaptive trees cannot be imported.
+func ImportLeaves(b BloomFilter, leafs [][32]byte, opts ...Option) (*BloomTree, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkSparse(); err != nil {
+		return nil, err
+	}
+	bfAsInt, err := bloomFilterWords(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(leafs) == 0 {
+		return nil, errors.New("tree must have at least 1 leaf")
+	}
+	bt := &BloomTree{
+		bf:  b,
+		cfg: cfg,
+	}
+	if n := bt.leafCount(bfAsInt); n != len(leafs) {
+		return nil, fmt.Errorf("a bloom filter of %d chunks does not match %d leafs", n, len(leafs))
+	}
+	if cfg.leaf(0, bt.leafWords(bfAsInt, 0)...) != leafs[0] {
+		return nil, errors.New("the leafs were hashed with another hash function or other leaf options")
+	}
+	if cfg.sparse {
+		if err := bt.buildSparse(context.Background(), uint64(b.BitArray().Len()), len(leafs), importedLeaf(leafs)); err != nil {
+			return nil, err
+		}
+	} else if cfg.store != nil {
+		if err := bt.buildStore(context.Background(), len(leafs), func(i int) [32]byte { return leafs[i] }); err != nil {
+			return nil, err
+		}
+	} else {
+		bt.nodes = buildNodes(append([][32]byte(nil), leafs...), cfg)
+	}
+	if cfg.chunkChecksums {
+		bt.checksums = bt.chunkChecksums(bfAsInt)
+	}
+	bt.manifest = bt.buildManifest(bfAsInt)
+	return bt, nil
+}
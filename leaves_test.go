@@ -0,0 +1,61 @@
+package bloomtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportLeaves(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafs := tree.ExportLeaves()
+	if len(leafs) != 11 {
+		t.Fatalf("expected 11 leafs without padding, but got %d", len(leafs))
+	}
+
+	imported, err := ImportLeaves(dbf, leafs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported.nodes, tree.nodes) {
+		t.Fatal("imported nodes do not match")
+	}
+
+	// the internal nodes can be rebuilt with another padding
+	legacy, err := ImportLeaves(dbf, leafs, WithLegacyPadding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Root() == tree.Root() || !reflect.DeepEqual(legacy.nodes[:11], tree.nodes[:11]) {
+		t.Fatal("expected equal leafs and a different root")
+	}
+	multiproof, err := legacy.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, legacy.Root(), dbf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify proof of imported tree")
+	}
+
+	if _, err := ImportLeaves(dbf, leafs[:10]); err == nil {
+		t.Fatal("expected error for missing leafs")
+	}
+	if _, err := ImportLeaves(generateDBF(1000, seed), leafs); err == nil {
+		t.Fatal("expected error for a different bloom filter size")
+	}
+	// the leafs are bound to the hash function of the tree
+	if _, err := ImportLeaves(dbf, leafs, WithHash(Keccak256)); err == nil {
+		t.Fatal("expected error for leafs of another hash function")
+	}
+	if _, err := ImportLeaves(dbf, leafs, WithWordTrees()); err == nil {
+		t.Fatal("expected error for leafs of other leaf options")
+	}
+}
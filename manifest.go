@@ -0,0 +1,260 @@
+package bloomtree
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+)
+
+// manifestVersion is the version of the JSON form of build manifests.
+const manifestVersion = 1
+
+// modulePath is the path of this module, which identifies its version in the build info of a binary.
+const modulePath = "github.com/labbloom/bloom-tree"
+
+// Names of the options recorded by build manifests, besides the chunk size and the hash function.
+const (
+	ManifestLegacyPadding = "legacyPadding"
+	ManifestEVM           = "evm"
+	ManifestWordTrees     = "wordTrees"
+	// ManifestSparse is accepted in manifests, but no longer recorded, as sparse trees have the root of dense trees.
+	ManifestSparse = "sparse"
+	// ManifestBlinded records a blinded tree, whose root can only be reproduced with the blinding key.
+	ManifestBlinded = "blinded"
+)
+
+// manifestOptions maps the recorded options to the options reproducing them.
+var manifestOptions = map[string]Option{
+	ManifestLegacyPadding: WithLegacyPadding(),
+	ManifestEVM:           WithEVM(),
+	ManifestWordTrees:     WithWordTrees(),
+	ManifestSparse:        WithSparse(),
+}
+
+// BuildManifest records the inputs and the result of building a bloom tree, so third parties can audit a
+// published root by rebuilding it from the bloom filter with VerifyManifest.
+type BuildManifest struct {
+	// FilterChecksum is the SHA-256 of the words of the bloom filter, as 8 little endian bytes each.
+	FilterChecksum [32]byte
+	FilterBits     uint64
+	NumOfHashes    uint64
+	ChunkSize      uint64
+	Hash           Hash
+	// Options are the recorded options changing the root, e.g. ManifestEVM, in ascending order.
+	Options []string
+	// CodeVersion is the version of this module that built the tree, "(devel)" if it is unknown.
+	CodeVersion string
+	Root        [32]byte
+}
+
+// Manifest returns the build manifest of the tree at its current root. The manifest is recorded while the
+// tree is built, from the words it hashes, so it describes the bloom filter the root was built from even if the
+// filter was modified directly since. Once updates changed the root, the manifest is recorded again from the
+// bloom filter. Manifests of adaptive trees are not supported.
+func (bt *BloomTree) Manifest() (*BuildManifest, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if bt.bounds != nil {
+		return nil, errors.New("manifests of adaptive trees are not supported")
+	}
+	if m := bt.manifest; m != nil && m.Root == bt.Root() {
+		manifest := *m
+		manifest.Options = append([]string(nil), m.Options...)
+		return &manifest, nil
+	}
+	return bt.buildManifest(bt.bf.BitArray().Bytes()), nil
+}
+
+// buildManifest returns the build manifest of the tree at its current root, built from the given words of its
+// bloom filter. It returns nil for adaptive trees.
+func (bt *BloomTree) buildManifest(words []uint64) *BuildManifest {
+	if bt.bounds != nil {
+		return nil
+	}
+	var options []string
+	for name, set := range map[string]bool{
+		ManifestLegacyPadding: bt.cfg.legacyPadding,
+		ManifestEVM:           bt.cfg.evm,
+		ManifestWordTrees:     bt.cfg.wordTrees,
+		ManifestBlinded:       bt.cfg.blindingKey != nil,
+	} {
+		if set {
+			options = append(options, name)
+		}
+	}
+	sort.Strings(options)
+	return &BuildManifest{
+		FilterChecksum: wordsChecksum(words),
+		FilterBits:     uint64(bt.bf.BitArray().Len()),
+		NumOfHashes:    uint64(bt.bf.NumOfHashes()),
+		ChunkSize:      uint64(bt.cfg.chunkSize),
+		Hash:           bt.cfg.hash,
+		Options:        options,
+		CodeVersion:    codeVersion(),
+		Root:           bt.Root(),
+	}
+}
+
+// VerifyManifest rebuilds the tree of the bloom filter with the parameters of the manifest, and returns an error
+// wrapping ErrManifestMismatch if the filter or the rebuilt root differ from the manifest. Blinded trees need the
+// blinding key, given as WithBlinding in opts. The code version is not checked, it tells auditors which version
+// to build with if the root differs.
+func VerifyManifest(m *BuildManifest, bf BloomFilter, opts ...Option) error {
+	if checksum := filterChecksum(bf); checksum != m.FilterChecksum {
+		return fmt.Errorf("%w: the bloom filter has checksum %x instead of %x", ErrManifestMismatch, checksum, m.FilterChecksum)
+	}
+	if bits, k := uint64(bf.BitArray().Len()), uint64(bf.NumOfHashes()); bits != m.FilterBits || k != m.NumOfHashes {
+		return fmt.Errorf("%w: the bloom filter has %d bits and %d hash functions instead of %d and %d",
+			ErrManifestMismatch, bits, k, m.FilterBits, m.NumOfHashes)
+	}
+	var buildOpts []Option
+	for _, name := range m.Options {
+		if name == ManifestBlinded {
+			continue
+		}
+		opt, ok := manifestOptions[name]
+		if !ok {
+			return fmt.Errorf("unknown manifest option %q", name)
+		}
+		buildOpts = append(buildOpts, opt)
+	}
+	buildOpts = append(buildOpts, WithChunkSize(int(m.ChunkSize)), WithHash(m.Hash))
+	cfg, err := newConfig(append(buildOpts, opts...))
+	if err != nil {
+		return err
+	}
+	switch blinded := hasOption(m.Options, ManifestBlinded); {
+	case blinded && cfg.blindingKey == nil:
+		return errors.New("the manifest records a blinded tree, whose root needs the blinding key")
+	case !blinded && cfg.blindingKey != nil:
+		return errors.New("the manifest records a tree without blinding, but a blinding key was given")
+	}
+	bt, err := newBloomTree(context.Background(), bf, cfg)
+	if err != nil {
+		return err
+	}
+	if root := bt.Root(); root != m.Root {
+		return fmt.Errorf("%w: the rebuilt root is %x instead of %x", ErrManifestMismatch, root, m.Root)
+	}
+	return nil
+}
+
+func hasOption(options []string, name string) bool {
+	for _, o := range options {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filterChecksum returns the SHA-256 of the words of the bloom filter, as 8 little endian bytes each.
+func filterChecksum(bf BloomFilter) [32]byte {
+	return wordsChecksum(bf.BitArray().Bytes())
+}
+
+// wordsChecksum returns the SHA-256 of the words, as 8 little endian bytes each.
+func wordsChecksum(words []uint64) [32]byte {
+	h := sha256.New()
+	var buf [8]byte
+	for _, w := range words {
+		binary.LittleEndian.PutUint64(buf[:], w)
+		h.Write(buf[:])
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// codeVersion returns the version of this module in the build info of the binary, or "(devel)" if it is unknown.
+func codeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+type manifestJSON struct {
+	Version        int      `json:"version"`
+	FilterChecksum string   `json:"filterChecksum"`
+	FilterBits     uint64   `json:"filterBits"`
+	NumOfHashes    uint64   `json:"numOfHashes"`
+	ChunkSize      uint64   `json:"chunkSize"`
+	Hash           string   `json:"hash"`
+	Options        []string `json:"options"`
+	CodeVersion    string   `json:"codeVersion"`
+	Root           string   `json:"root"`
+}
+
+// CanonicalJSON returns the RFC 8785 (JCS) canonical JSON form of the manifest, which is also its JSON encoding.
+func (m *BuildManifest) CanonicalJSON() ([]byte, error) {
+	options := make([]interface{}, len(m.Options))
+	for i, o := range m.Options {
+		options[i] = o
+	}
+	return canonicalJSON(map[string]interface{}{
+		"version":        uint64(manifestVersion),
+		"filterChecksum": hex.EncodeToString(m.FilterChecksum[:]),
+		"filterBits":     m.FilterBits,
+		"numOfHashes":    m.NumOfHashes,
+		"chunkSize":      m.ChunkSize,
+		"hash":           m.Hash.String(),
+		"options":        options,
+		"codeVersion":    m.CodeVersion,
+		"root":           hex.EncodeToString(m.Root[:]),
+	})
+}
+
+// MarshalJSON encodes the manifest as canonical JSON.
+func (m *BuildManifest) MarshalJSON() ([]byte, error) {
+	return m.CanonicalJSON()
+}
+
+// UnmarshalJSON decodes the JSON form of a manifest.
+func (m *BuildManifest) UnmarshalJSON(data []byte) error {
+	var aux manifestJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Version != manifestVersion {
+		return fmt.Errorf("unsupported manifest version %d", aux.Version)
+	}
+	hashes, err := decodeHexHashes([]string{aux.FilterChecksum, aux.Root})
+	if err != nil {
+		return err
+	}
+	hash, err := ParseHash(aux.Hash)
+	if err != nil {
+		return err
+	}
+	if len(aux.Options) == 0 {
+		aux.Options = nil
+	}
+	*m = BuildManifest{
+		FilterChecksum: hashes[0],
+		FilterBits:     aux.FilterBits,
+		NumOfHashes:    aux.NumOfHashes,
+		ChunkSize:      aux.ChunkSize,
+		Hash:           hash,
+		Options:        aux.Options,
+		CodeVersion:    aux.CodeVersion,
+		Root:           hashes[1],
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBuildManifest(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	key := []byte("0123456789abcdef")
+	var tests = []struct {
+		opts    []Option
+		options []string
+	}{
+		{opts: nil},
+		{opts: []Option{WithChunkSize(128), WithHash(Keccak256)}},
+		{opts: []Option{WithSparse()}},
+		{opts: []Option{WithEVM()}, options: []string{ManifestEVM}},
+		{opts: []Option{WithWordTrees(), WithLegacyPadding()}, options: []string{ManifestLegacyPadding, ManifestWordTrees}},
+		{opts: []Option{WithBlinding(key)}, options: []string{ManifestBlinded}},
+	}
+	for i, test := range tests {
+		dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := tree.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manifest.Root != tree.Root() || !reflect.DeepEqual(manifest.Options, test.options) || manifest.CodeVersion == "" {
+			t.Fatalf("%d: unexpected manifest %+v", i, manifest)
+		}
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded BuildManifest
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&decoded, manifest) {
+			t.Fatalf("%d: expected manifest %+v, but got %+v", i, manifest, decoded)
+		}
+
+		var opts []Option
+		if manifest.Options != nil && manifest.Options[0] == ManifestBlinded {
+			if err := VerifyManifest(manifest, dbf); err == nil {
+				t.Fatalf("%d: expected error verifying a blinded manifest without the key", i)
+			}
+			opts = append(opts, WithBlinding(key))
+		}
+		if err := VerifyManifest(manifest, dbf, opts...); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		forged := *manifest
+		forged.Root[0] ^= 1
+		if err := VerifyManifest(&forged, dbf, opts...); !errors.Is(err, ErrManifestMismatch) {
+			t.Fatalf("%d: expected %v for another root, but got %v", i, ErrManifestMismatch, err)
+		}
+		dbf.Add([]byte{3})
+		if err := VerifyManifest(manifest, dbf, opts...); !errors.Is(err, ErrManifestMismatch) {
+			t.Fatalf("%d: expected %v for another bloom filter, but got %v", i, ErrManifestMismatch, err)
+		}
+		// the manifest recorded by the build describes the built filter, until an update changes the root
+		if recorded, err := tree.Manifest(); err != nil || !reflect.DeepEqual(recorded, manifest) {
+			t.Fatalf("%d: expected the recorded manifest %+v, but got %+v, %v", i, manifest, recorded, err)
+		}
+		if err := tree.Update([]byte{3}); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := tree.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Root != tree.Root() || updated.FilterChecksum == manifest.FilterChecksum {
+			t.Fatalf("%d: expected the manifest of the updated tree, but got %+v", i, updated)
+		}
+		if err := VerifyManifest(updated, dbf, opts...); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"version":2}`), &BuildManifest{}); err == nil {
+		t.Fatal("expected error for an unsupported manifest version")
+	}
+}
@@ -0,0 +1,82 @@
+package bloomtree
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// Layout tells where the nodes of a tree are kept.
+type Layout uint8
+
+const (
+	// MemoryLayout keeps the nodes in memory.
+	MemoryLayout Layout = iota
+	// StoreLayout keeps the nodes in the store given with WithNodeStore.
+	StoreLayout
+	// SpilledLayout keeps the nodes in a temporary file, as they exceeded the budget of WithMemoryBudget.
+	SpilledLayout
+	// SparseLayout keeps only the nodes above non-empty chunks and of the upper layers, see WithSparse.
+	SparseLayout
+)
+
+func (l Layout) String() string {
+	switch l {
+	case MemoryLayout:
+		return "memory"
+	case StoreLayout:
+		return "store"
+	case SpilledLayout:
+		return "spilled"
+	case SparseLayout:
+		return "sparse"
+	default:
+		return "unknown"
+	}
+}
+
+// WithMemoryBudget limits the memory of the nodes of the tree to the given number of bytes. Trees whose nodes
+// would exceed the budget keep them in a temporary file in dir, or in the default directory for temporary files
+// if dir is empty, instead of failing with an out of memory error. Stats reports the chosen layout. The file is
+// removed right away where the operating system allows it, and closed once the tree is garbage collected.
+// The budget is ignored by trees built with WithNodeStore.
+func WithMemoryBudget(bytes int64, dir string) Option {
+	return func(c *config) error {
+		if bytes <= 0 {
+			return errors.New("the memory budget must be positive")
+		}
+		c.memoryBudget, c.spillDir = bytes, dir
+		return nil
+	}
+}
+
+// spill sets a temporary file store as the store of the configuration if the nodes of a tree with the given
+// number of leafs exceed the memory budget, and returns whether it did.
+func (c *config) spill(leafs int) (bool, error) {
+	if c.store != nil || c.sparse || c.memoryBudget == 0 {
+		return false, nil
+	}
+	leafNum := core.LeafNum(leafs)
+	n := 2*leafNum - 1
+	if int64(n)*32 <= c.memoryBudget {
+		return false, nil
+	}
+	f, err := ioutil.TempFile(c.spillDir, "bloomtree-*.nodes")
+	if err != nil {
+		return false, err
+	}
+	if err := f.Truncate(int64(n) * 32); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return false, err
+	}
+	// the file stays readable until it is closed, except on systems refusing to remove open files
+	os.Remove(f.Name())
+	store := &FileStore{f: f, n: n}
+	runtime.SetFinalizer(store, func(s *FileStore) { s.Close() })
+	c.store = store
+	return true, nil
+}
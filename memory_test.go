@@ -0,0 +1,66 @@
+package bloomtree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeBytes := int64(tree.Stats().NodeBytes)
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var tests = []struct {
+		opts     []Option
+		expected Layout
+	}{
+		{opts: nil, expected: MemoryLayout},
+		{opts: []Option{WithMemoryBudget(nodeBytes, "")}, expected: MemoryLayout},
+		{opts: []Option{WithMemoryBudget(nodeBytes-1, dir)}, expected: SpilledLayout},
+		{opts: []Option{WithMemoryBudget(1, ""), WithNodeStore(NewMemoryStore(tree.Stats().Nodes))}, expected: StoreLayout},
+	}
+	for _, test := range tests {
+		budgeted, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layout := budgeted.Stats().Layout; layout != test.expected {
+			t.Fatalf("expected layout %v, but got %v", test.expected, layout)
+		}
+		if budgeted.Root() != tree.Root() {
+			t.Fatalf("expected root %x with layout %v, but got %x", tree.Root(), test.expected, budgeted.Root())
+		}
+		multiproof, err := budgeted.GenerateCompactMultiProof([]byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, tree.Root(), dbf)
+		if err != nil || !verified {
+			t.Fatalf("expected proof with layout %v to verify, but got %v, %v", test.expected, verified, err)
+		}
+	}
+
+	streamed, err := NewBloomTreeFromReader(bytes.NewReader(filterWords(t, dbf)), uint64(dbf.BitArray().Len()),
+		WithMemoryBudget(32, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.Stats().Layout != SpilledLayout || streamed.Root() != tree.Root() {
+		t.Fatalf("expected spilled streamed tree with root %x, but got %v with root %x", tree.Root(),
+			streamed.Stats().Layout, streamed.Root())
+	}
+	if _, err := NewBloomTree(dbf, WithMemoryBudget(0, "")); err == nil {
+		t.Fatal("expected error for a memory budget of zero")
+	}
+}
@@ -0,0 +1,111 @@
+package bloomtree
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// ExtensibleBloomFilter is a bloom filter elements can be added to.
+type ExtensibleBloomFilter interface {
+	BloomFilter
+	// Add inserts an element.
+	Add(elem []byte)
+}
+
+// ReinsertFunc calls add for every element of the bloom filter a tree is migrated from.
+type ReinsertFunc func(add func(elem []byte)) error
+
+// ElementList returns a ReinsertFunc adding the given elements.
+func ElementList(elements [][]byte) ReinsertFunc {
+	return func(add func(elem []byte)) error {
+		for _, elem := range elements {
+			add(elem)
+		}
+		return nil
+	}
+}
+
+// MigrationStatement links the root of a tree to the root of the tree it was migrated to, so clients
+// holding the old root can move to the new one. It is signed with the key of the migrating party.
+type MigrationStatement struct {
+	From RootAttestation
+	To   RootAttestation
+	// Signature is the ed25519 signature of Message.
+	Signature []byte
+}
+
+// Message returns the signed message of the statement, the RFC 8785 (JCS) canonical JSON of both attestations.
+func (s *MigrationStatement) Message() ([]byte, error) {
+	return canonicalJSON(map[string]interface{}{
+		"from": s.From.object(),
+		"to":   s.To.object(),
+	})
+}
+
+// Verify returns whether the statement was signed with the private key of the given public key.
+func (s *MigrationStatement) Verify(key ed25519.PublicKey) bool {
+	if len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	message, err := s.Message()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, message, s.Signature)
+}
+
+// Migrate builds the tree of the bloom filter to, which was created with the new parameters, e.g. more bits,
+// another number of hash functions or another seed, by adding the elements of reinsert to it. Every element
+// must be present in the bloom filter of the tree, so a migration cannot introduce new elements. The new tree
+// keeps the construction options of the tree, except for those overridden by opts. The returned statement
+// links both roots and is signed with key.
+func (bt *BloomTree) Migrate(to ExtensibleBloomFilter, reinsert ReinsertFunc, key ed25519.PrivateKey,
+	opts ...Option) (*BloomTree, *MigrationStatement, error) {
+	if bt.bf == nil {
+		return nil, nil, ErrNoBloomFilter
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("invalid ed25519 private key")
+	}
+	cfg := bt.cfg
+	cfg.store = nil
+	cfg.crossCheckRoots = nil
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	var missing []byte
+	err := reinsert(func(elem []byte) {
+		if missing != nil {
+			return
+		}
+		if _, present := bt.bf.Proof(elem); !present {
+			missing = append([]byte{}, elem...)
+			return
+		}
+		to.Add(elem)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing != nil {
+		return nil, nil, fmt.Errorf("the element %x is not in the bloom filter of the tree", missing)
+	}
+	migrated, err := newBloomTree(context.Background(), to, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	statement := &MigrationStatement{
+		From: bt.Attestation(),
+		To:   migrated.Attestation(),
+	}
+	message, err := statement.Message()
+	if err != nil {
+		return nil, nil, err
+	}
+	statement.Signature = ed25519.Sign(key, message)
+	return migrated, statement, nil
+}
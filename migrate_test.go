@@ -0,0 +1,101 @@
+package bloomtree
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestMigrate(t *testing.T) {
+	SetChunkSize(64)
+	elements := [][]byte{{1}, {2}, {3}}
+	dbf := generateDBF(200, "old seed", elements...)
+	tree, err := NewBloomTree(dbf, WithHash(SHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		reinsert ReinsertFunc
+		opts     []Option
+	}{
+		{reinsert: ElementList(elements)},
+		{
+			reinsert: func(add func([]byte)) error {
+				for i := len(elements) - 1; i >= 0; i-- {
+					add(elements[i])
+				}
+				return nil
+			},
+			opts: []Option{WithChunkSize(128)},
+		},
+	}
+
+	for _, test := range tests {
+		to := DBF.NewDbf(2000, 0.01, []byte("new seed"))
+		migrated, statement, err := tree.Migrate(to, test.reinsert, private, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statement.From != tree.Attestation() || statement.To != migrated.Attestation() {
+			t.Fatal("the statement does not link the roots of both trees")
+		}
+		if !statement.Verify(public) {
+			t.Fatal("failed to verify the signature of the statement")
+		}
+		if migrated.cfg.hash != SHA256 {
+			t.Fatal("the migrated tree does not keep the hash function")
+		}
+		for _, elem := range elements {
+			multiproof, err := migrated.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := append([]Option{WithHash(SHA256)}, test.opts...)
+			verified, err := VerifyCompactMultiProof(elem, []byte("new seed"), multiproof, statement.To.Root, to, opts...)
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified || !multiproof.ProofType.IsPresence() {
+				t.Fatalf("failed to prove element %v in the migrated tree", elem)
+			}
+		}
+		statement.To.Root[0] ^= 1
+		if statement.Verify(public) {
+			t.Fatal("expected the signature of a modified statement to fail")
+		}
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "old seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errReinsert := errors.New("reinsert failed")
+	var tests = []struct {
+		name     string
+		reinsert ReinsertFunc
+		key      ed25519.PrivateKey
+	}{
+		{name: "new element", reinsert: ElementList([][]byte{{1}, {42}}), key: private},
+		{name: "failing reinsert", reinsert: func(func([]byte)) error { return errReinsert }, key: private},
+		{name: "invalid key", reinsert: ElementList([][]byte{{1}}), key: private[:10]},
+	}
+	for _, test := range tests {
+		to := DBF.NewDbf(2000, 0.01, []byte("new seed"))
+		if _, _, err := tree.Migrate(to, test.reinsert, test.key); err == nil {
+			t.Fatalf("expected error for %s", test.name)
+		}
+	}
+}
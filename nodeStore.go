@@ -0,0 +1,326 @@
+package bloomtree
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// NodeStore holds the nodes of a bloom tree, indexed like the tree: the leafs first and the root last.
+// Reads and writes do not return errors. Like bufio.Writer, a store remembers its first error, which is
+// returned by Err and reported by the tree operations using the store. Nodes at distinct indices must be
+// safe to read and write concurrently.
+type NodeStore interface {
+	// Len returns the number of nodes.
+	Len() int
+	// Node returns the node at index i, or a zero hash after an error.
+	Node(i int) [32]byte
+	// SetNode sets the node at index i.
+	SetNode(i int, h [32]byte)
+	// Err returns the first error of the store.
+	Err() error
+}
+
+// MemoryStore is a NodeStore holding all nodes in memory.
+type MemoryStore [][32]byte
+
+// NewMemoryStore returns a MemoryStore of n nodes.
+func NewMemoryStore(n int) MemoryStore {
+	return make(MemoryStore, n)
+}
+
+// Len returns the number of nodes.
+func (s MemoryStore) Len() int { return len(s) }
+
+// Node returns the node at index i.
+func (s MemoryStore) Node(i int) [32]byte { return s[i] }
+
+// SetNode sets the node at index i.
+func (s MemoryStore) SetNode(i int, h [32]byte) { s[i] = h }
+
+// Err returns nil, as a MemoryStore cannot fail.
+func (s MemoryStore) Err() error { return nil }
+
+// storeErr records the first error of a store.
+type storeErr struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (e *storeErr) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Err returns the first error of the store.
+func (e *storeErr) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// FileStore is a NodeStore keeping the nodes in a file, so only the nodes in use are held in memory,
+// as far as the page cache of the operating system allows.
+type FileStore struct {
+	storeErr
+	f *os.File
+	n int
+}
+
+// CreateFileStore creates or truncates the file at path to hold n nodes. The file is locked exclusively until
+// the store is closed, so it returns ErrStoreLocked instead of truncating a file opened by a SharedFileStore.
+func CreateFileStore(path string, n int) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(n) * 32); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileStore{f: f, n: n}, nil
+}
+
+// OpenFileStore opens the nodes stored in the file at path. Like CreateFileStore, it locks the file exclusively.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size()%32 != 0 {
+		f.Close()
+		return nil, fmt.Errorf("the size %d of %s is not a multiple of the node size", info.Size(), path)
+	}
+	return &FileStore{f: f, n: int(info.Size() / 32)}, nil
+}
+
+// Len returns the number of nodes.
+func (s *FileStore) Len() int { return s.n }
+
+// Node reads the node at index i.
+func (s *FileStore) Node(i int) [32]byte {
+	var h [32]byte
+	if _, err := s.f.ReadAt(h[:], int64(i)*32); err != nil {
+		s.set(fmt.Errorf("reading node %d: %w", i, err))
+	}
+	return h
+}
+
+// SetNode writes the node at index i.
+func (s *FileStore) SetNode(i int, h [32]byte) {
+	if _, err := s.f.WriteAt(h[:], int64(i)*32); err != nil {
+		s.set(fmt.Errorf("writing node %d: %w", i, err))
+	}
+}
+
+// Close closes the file of the store and releases its lock.
+func (s *FileStore) Close() error {
+	return s.f.Close()
+}
+
+// KeyValue is a key-value database, like LevelDB or Badger, holding the nodes of a KVStore.
+type KeyValue interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+}
+
+// KVStore is a NodeStore keeping the nodes in a key-value database. The key of a node is
+// the prefix followed by the big endian node index.
+type KVStore struct {
+	storeErr
+	db     KeyValue
+	prefix []byte
+	n      int
+}
+
+// NewKVStore returns a KVStore of n nodes whose keys start with prefix.
+func NewKVStore(db KeyValue, prefix []byte, n int) *KVStore {
+	return &KVStore{db: db, prefix: append([]byte(nil), prefix...), n: n}
+}
+
+func (s *KVStore) key(i int) []byte {
+	key := make([]byte, len(s.prefix)+8)
+	copy(key, s.prefix)
+	binary.BigEndian.PutUint64(key[len(s.prefix):], uint64(i))
+	return key
+}
+
+// Len returns the number of nodes.
+func (s *KVStore) Len() int { return s.n }
+
+// Node reads the node at index i.
+func (s *KVStore) Node(i int) [32]byte {
+	var h [32]byte
+	v, err := s.db.Get(s.key(i))
+	if err != nil {
+		s.set(fmt.Errorf("reading node %d: %w", i, err))
+	} else if len(v) != len(h) {
+		s.set(fmt.Errorf("reading node %d: invalid size %d", i, len(v)))
+	} else {
+		copy(h[:], v)
+	}
+	return h
+}
+
+// SetNode writes the node at index i.
+func (s *KVStore) SetNode(i int, h [32]byte) {
+	if err := s.db.Put(s.key(i), h[:]); err != nil {
+		s.set(fmt.Errorf("writing node %d: %w", i, err))
+	}
+}
+
+// WithNodeStore builds the tree into the given store instead of memory. The store must hold
+// exactly as many nodes as the tree, see TreeLength. Adaptive trees cannot use a store.
+func WithNodeStore(s NodeStore) Option {
+	return func(c *config) error {
+		if s == nil {
+			return errors.New("the node store is nil")
+		}
+		c.store = s
+		return nil
+	}
+}
+
+// TreeLength returns the number of nodes of a bloom tree built from the bloom filter with the given options.
+// Only the chunk size affects the number of nodes.
+func TreeLength(b BloomFilter, opts ...Option) (int, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return 0, err
+	}
+	return filterTreeLength(b, cfg.chunkSize)
+}
+
+// OpenBloomTree returns the bloom tree of the bloom filter whose nodes were built into the store before,
+// without hashing the bloom filter again. The nodes are not checked against the bloom filter.
+func OpenBloomTree(b BloomFilter, store NodeStore, opts ...Option) (*BloomTree, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := core.CheckTreeLength(store.Len()); err != nil {
+		return nil, err
+	}
+	bt := &BloomTree{store: store, cfg: cfg}
+	bt.cfg.store = nil
+	if err := bt.SetBloomFilter(b); err != nil {
+		return nil, err
+	}
+	if cfg.chunkChecksums {
+		bt.checksums = bt.chunkChecksums(b.BitArray().Bytes())
+	}
+	return bt, nil
+}
+
+// buildStore hashes the leafs, the padding and the internal nodes directly into the store of the
+// configuration, one layer at a time, so the nodes never have to be held in memory.
+// It returns the error of the context once it is done.
+func (bt *BloomTree) buildStore(ctx context.Context, leafs int, leaf func(i int) [32]byte) error {
+	store := bt.cfg.store
+	leafNum := core.LeafNum(leafs)
+	if store.Len() != 2*leafNum-1 {
+		return fmt.Errorf("a tree of %d leafs needs a store of %d nodes, but it has %d", leafNum, 2*leafNum-1, store.Len())
+	}
+	err := parallelRangeCtx(ctx, bt.cfg.workers, 0, leafNum, func(start, end int) {
+		for i := start; i < end; i++ {
+			if i < leafs {
+				store.SetNode(i, leaf(i))
+			} else {
+				store.SetNode(i, paddingLeaf(bt.cfg, i))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for start, size, layer := leafNum, leafNum/2, 1; size > 0; start, size, layer = start+size, size/2, layer+1 {
+		first := start
+		err := parallelRangeCtx(ctx, bt.cfg.workers, start, start+size, func(start, end int) {
+			for i := start; i < end; i++ {
+				store.SetNode(i, bt.cfg.node(layer, uint64(i-first), store.Node(2*(i-leafNum)), store.Node(2*(i-leafNum)+1)))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := store.Err(); err != nil {
+		return err
+	}
+	bt.store = store
+	bt.cfg.store = nil
+	return nil
+}
+
+// node returns the node at index i, read from the store if the tree has one.
+func (bt *BloomTree) node(i int) [32]byte {
+	if bt.store != nil {
+		return bt.store.Node(i)
+	}
+	return bt.nodes[i]
+}
+
+// setNode sets the node at index i.
+func (bt *BloomTree) setNode(i int, h [32]byte) {
+	if bt.nodesShared {
+		bt.unshareNodes()
+	}
+	if bt.store != nil {
+		bt.store.SetNode(i, h)
+		return
+	}
+	bt.nodes[i] = h
+}
+
+// nodeCount returns the number of nodes of the tree.
+func (bt *BloomTree) nodeCount() int {
+	if bt.store != nil {
+		return bt.store.Len()
+	}
+	return len(bt.nodes)
+}
+
+// nodesErr returns the first error of the store of the tree, if it has one.
+func (bt *BloomTree) nodesErr() error {
+	if bt.store != nil {
+		return bt.store.Err()
+	}
+	return nil
+}
+
+// allNodes returns all nodes of the tree, reading them from the store if the tree has one.
+func (bt *BloomTree) allNodes() ([][32]byte, error) {
+	if bt.store == nil {
+		return bt.nodes, nil
+	}
+	nodes := make([][32]byte, bt.store.Len())
+	for i := range nodes {
+		nodes[i] = bt.store.Node(i)
+	}
+	return nodes, bt.store.Err()
+}
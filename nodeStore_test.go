@@ -0,0 +1,138 @@
+package bloomtree
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mapKV is an in-memory KeyValue database.
+type mapKV struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	err  error
+}
+
+func (m *mapKV) Get(key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.data[string(key)], nil
+}
+
+func (m *mapKV) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func TestNodeStores(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := TreeLength(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := CreateFileStore(filepath.Join(dir, "nodes"), n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileStore.Close()
+
+	for _, store := range []NodeStore{NewMemoryStore(n), fileStore, NewKVStore(&mapKV{data: make(map[string][]byte)}, []byte("tree/"), n)} {
+		storeTree, err := NewBloomTree(dbf, WithNodeStore(store), WithWorkers(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if storeTree.nodes != nil {
+			t.Fatal("expected no nodes in memory")
+		}
+		nodes, err := storeTree.allNodes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nodes, tree.nodes) {
+			t.Fatalf("nodes of %T do not match", store)
+		}
+		multiproof, err := storeTree.GenerateCompactMultiProof([]byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, storeTree.Root(), dbf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify proof of %T", store)
+		}
+
+		opened, err := OpenBloomTree(dbf, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened.Root() != tree.Root() {
+			t.Fatalf("root of opened %T does not match", store)
+		}
+	}
+
+	if _, err := NewBloomTree(dbf, WithNodeStore(NewMemoryStore(n+2))); err == nil {
+		t.Fatal("expected error for a store of the wrong size")
+	}
+	if _, err := NewAdaptiveBloomTree(dbf, 64, 256, WithNodeStore(NewMemoryStore(n))); err == nil {
+		t.Fatal("expected error for an adaptive tree in a store")
+	}
+}
+
+func TestNodeStoreUpdate(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	n, err := TreeLength(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := &mapKV{data: make(map[string][]byte)}
+	tree, err := NewBloomTree(dbf, WithNodeStore(NewKVStore(kv, nil, n)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Update([]byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != rebuilt.Root() {
+		t.Fatal("updated root does not match rebuilt root")
+	}
+
+	// the first error of the store is reported by the tree operations
+	errStore := errors.New("store unavailable")
+	kv.err = errStore
+	if _, err := tree.GenerateCompactMultiProof([]byte{1}); !errors.Is(err, errStore) {
+		t.Fatalf("expected error %v, but got %v", errStore, err)
+	}
+	if err := tree.Update([]byte{3}); !errors.Is(err, errStore) {
+		t.Fatalf("expected error %v, but got %v", errStore, err)
+	}
+}
@@ -0,0 +1,166 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// config holds the construction parameters of a bloom tree.
+type config struct {
+	// legacyPadding hashes padding leafs like regular chunks, as done before padding had its own domain.
+	legacyPadding bool
+	// absentIndices is the maximum number of zero indices included in an absence proof.
+	absentIndices int
+	// minAbsentIndices is the number of zero indices a verifier requires in an absence proof.
+	minAbsentIndices int
+	// treeHeight is the height of the tree a verifier expects if pinnedHeight is set.
+	treeHeight   int
+	pinnedHeight bool
+	// hash is the hash function of the leafs and internal nodes.
+	hash Hash
+	// workers is the number of goroutines hashing the tree, GOMAXPROCS if zero.
+	workers int
+	// chunkChecksums keeps a checksum of every chunk to detect stale chunks.
+	chunkChecksums bool
+	// store receives the nodes of a tree under construction, it is moved to the tree once built.
+	store NodeStore
+	// crossCheckRoots are independently built roots that must equal the verified root.
+	crossCheckRoots [][32]byte
+	// chunkSize is the number of bits per chunk, the package chunk size unless set by WithChunkSize.
+	chunkSize int
+	// blindingKey derives the salts of the word commitments of blinded trees, it is nil otherwise.
+	blindingKey []byte
+	// evm hashes the leafs in the layout of the reference Solidity verifier.
+	evm bool
+	// wordTrees hashes every chunk as the root of a Merkle tree over its words.
+	wordTrees bool
+	// smallestAbsence proves absence with the zero index adding the fewest bytes to the proof.
+	smallestAbsence bool
+	// seed is the seed of the bloom filter bound by committed roots, see WithSeed.
+	seed []byte
+	// memoryBudget is the maximum size of the nodes held in memory, unlimited if zero.
+	memoryBudget int64
+	// spillDir is the directory of the temporary files of trees exceeding the memory budget.
+	spillDir string
+	// sparse keeps only the nodes above non-empty chunks and of the upper layers. It does not change the root,
+	// see WithSparse.
+	sparse bool
+	// accessStats counts how often every chunk appears in generated proofs.
+	accessStats bool
+	// provenance records the filter version and build time of every chunk, starting at filterVersion.
+	provenance    bool
+	filterVersion uint64
+	// indexPolicy tells how bloom filter indices past the end of the bit array are treated.
+	indexPolicy IndexPolicy
+}
+
+// Option configures the construction of a bloom tree.
+type Option func(*config) error
+
+// WithLegacyPadding hashes the padding leafs as hashLeaf(0, i), which can collide with the hash of a
+// regular chunk. It exists only to reproduce roots of trees built before padding was domain separated.
+func WithLegacyPadding() Option {
+	return func(c *config) error {
+		c.legacyPadding = true
+		return nil
+	}
+}
+
+// WithAbsentIndices includes up to n zero indices of an absent element in its absence proof,
+// instead of only the first one.
+func WithAbsentIndices(n int) Option {
+	return func(c *config) error {
+		if n < 1 {
+			return errors.New("an absence proof requires at least one zero index")
+		}
+		c.absentIndices = n
+		return nil
+	}
+}
+
+// WithMinAbsentIndices makes verification reject absence proofs with fewer than n zero indices.
+func WithMinAbsentIndices(n int) Option {
+	return func(c *config) error {
+		c.minAbsentIndices = n
+		return nil
+	}
+}
+
+// WithTreeHeight makes verification reject proofs of a tree whose height, derived from the bloom filter and
+// the chunk size, is not h, i.e. whose number of leaves padded to a power of two is not 2^h. Verifiers taking
+// the length of the bloom filter from the prover, e.g. from the metadata of a server, pin the height they
+// expect, so a proof of a smaller or larger tree cannot be substituted.
+func WithTreeHeight(h int) Option {
+	return func(c *config) error {
+		if h < 0 || h > 63 {
+			return fmt.Errorf("invalid tree height %d", h)
+		}
+		c.treeHeight, c.pinnedHeight = h, true
+		return nil
+	}
+}
+
+// WithHash builds or verifies the tree with the hash function h instead of SHA-512/256.
+func WithHash(h Hash) Option {
+	return func(c *config) error {
+		if !h.valid() {
+			return fmt.Errorf("unknown hash function %v", h)
+		}
+		c.hash = h
+		return nil
+	}
+}
+
+// WithWorkers hashes the leafs and every layer of internal nodes on up to n goroutines.
+// By default GOMAXPROCS goroutines are used. The nodes do not depend on the number of workers.
+func WithWorkers(n int) Option {
+	return func(c *config) error {
+		if n < 1 {
+			return errors.New("the number of workers must be at least 1")
+		}
+		c.workers = n
+		return nil
+	}
+}
+
+// WithChunkChecksums keeps an xxhash checksum of every chunk next to the leaf hashes, so stale chunks
+// can be found with StaleChunks and rehashed with Refresh without hashing the whole bloom filter again.
+func WithChunkChecksums() Option {
+	return func(c *config) error {
+		c.chunkChecksums = true
+		return nil
+	}
+}
+
+// WithCrossCheckRoot makes verification require the root to equal the given root, which was built
+// independently, e.g. by a second build pipeline. The option can be given several times, and verification
+// fails with ErrRootMismatch unless all roots match, so a single compromised builder is detected.
+func WithCrossCheckRoot(root [32]byte) Option {
+	return func(c *config) error {
+		c.crossCheckRoots = append(c.crossCheckRoots, root)
+		return nil
+	}
+}
+
+// WithChunkSize builds or verifies the tree with chunks of n bits instead of the chunk size set by
+// SetChunkSize. Larger chunks mean fewer leafs and shorter proofs, but more bloom filter words per chunk.
+// The chunk size must be a multiple of 64, and is part of the proofs, attestations and encodings of the tree.
+func WithChunkSize(n int) Option {
+	return func(c *config) error {
+		if err := checkChunkSize(n); err != nil {
+			return err
+		}
+		c.chunkSize = n
+		return nil
+	}
+}
+
+func newConfig(opts []Option) (config, error) {
+	c := config{chunkSize: chunkSize}
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
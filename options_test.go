@@ -0,0 +1,141 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithLegacyPadding(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyTree, err := NewBloomTree(dbf, WithLegacyPadding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11 chunks are padded to 16 leafs
+	for i := 11; i < 16; i++ {
+		if tree.nodes[i] != SHA512_256.padding(uint64(i)) {
+			t.Fatalf("padding leaf %d is not domain separated", i)
+		}
+		if legacyTree.nodes[i] != hashLeaf(0, uint64(i)) {
+			t.Fatalf("legacy padding leaf %d does not match hashLeaf(0, %d)", i, i)
+		}
+	}
+	if tree.Root() == legacyTree.Root() {
+		t.Fatal("expected roots with different padding to differ")
+	}
+
+	for _, bt := range []*BloomTree{tree, legacyTree} {
+		multiproof, err := bt.GenerateCompactMultiProof([]byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, bt.Root(), dbf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatal("failed to verify proof")
+		}
+	}
+}
+
+func TestPaddingCollision(t *testing.T) {
+	// the legacy padding leaf 3 is indistinguishable from chunk 0 holding the single word 3
+	if hashLeaf(0, 3) == SHA512_256.padding(3) {
+		t.Fatal("padding leaf collides with a regular chunk")
+	}
+}
+
+func TestWithCrossCheckRoot(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second pipeline builds the same tree independently
+	second, err := NewBloomTree(generateDBF(200, seed, []byte{2}, []byte{1}), WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compromised, err := NewBloomTree(generateDBF(200, seed, []byte{1}, []byte{2}, []byte{3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, tree.Root(), dbf, WithCrossCheckRoot(second.Root()))
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify proof against matching roots")
+	}
+	_, err = VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, tree.Root(), dbf,
+		WithCrossCheckRoot(second.Root()), WithCrossCheckRoot(compromised.Root()))
+	if !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("expected error %v, but got %v", ErrRootMismatch, err)
+	}
+
+	batch, err := tree.GenerateCompactMultiProofBatch([][]byte{{1}, {5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyCompactMultiProofBatch([][]byte{{1}, {5}}, []byte(seed), batch, tree.Root(), dbf, WithCrossCheckRoot(compromised.Root()))
+	if !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("expected error %v for batch proof, but got %v", ErrRootMismatch, err)
+	}
+}
+
+func TestWithChunkSize(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithChunkSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tree matches one built with the package chunk size set to 128
+	SetChunkSize(128)
+	global, err := NewBloomTree(dbf)
+	SetChunkSize(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != global.Root() || len(tree.nodes) != len(global.nodes) {
+		t.Fatal("the tree does not match the tree built with SetChunkSize(128)")
+	}
+	if tree.Attestation().ChunkSize != 128 {
+		t.Fatalf("expected attested chunk size 128, but got %d", tree.Attestation().ChunkSize)
+	}
+	for _, elem := range [][]byte{{1}, {42}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if multiproof.ChunkSize != 128 {
+			t.Fatalf("expected proof chunk size 128, but got %d", multiproof.ChunkSize)
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf, WithChunkSize(128))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify proof of element %v", elem)
+		}
+		if _, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf); !errors.Is(err, ErrChunkSizeMismatch) {
+			t.Fatalf("expected error %v, but got %v", ErrChunkSizeMismatch, err)
+		}
+	}
+	for _, size := range []int{0, -64, 100} {
+		if _, err := NewBloomTree(dbf, WithChunkSize(size)); err == nil {
+			t.Fatalf("expected error for chunk size %d", size)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package bloomtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Proofs are generated in a canonical order, so provers given the same tree and elements emit byte-identical
+// proofs, which can be cached and compared in audits:
+//
+//   - Chunks of a proof follow the proven bloom filter indices in increasing order, so repeated chunks are
+//     adjacent. Chunk words and word commitments follow the distinct chunks in the same order.
+//   - Chunks of a batch proof are distinct and in increasing order of their index.
+//   - Proof hashes are ordered layer by layer from the leafs to the root, and by node index within a layer.
+//   - Absent indices are strictly increasing and start with the position given by the proof type.
+//   - Proof types, absent indices and costs of a batch proof follow the order of the elements as given.
+//     CanonicalElements orders a set of elements independently of how it was collected.
+//
+// Decoded proofs violating the parts of the order that can be checked without the tree are rejected.
+
+// CanonicalElements returns the distinct elements in increasing byte-wise order, the canonical order of the
+// elements of a batch proof. The order does not depend on the locale or the platform.
+func CanonicalElements(elems [][]byte) [][]byte {
+	sorted := make([][]byte, len(elems))
+	copy(sorted, elems)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	var ret [][]byte
+	for i, elem := range sorted {
+		if i == 0 || !bytes.Equal(elem, sorted[i-1]) {
+			ret = append(ret, elem)
+		}
+	}
+	return ret
+}
+
+// CheckOrder returns an error if the proof violates the parts of the canonical order that can be checked without
+// the tree, e.g. to reject malformed proofs before hashing them. Decoding checks the order as well.
+func (p *CompactMultiProof) CheckOrder() error {
+	return p.checkOrder()
+}
+
+// checkOrder returns an error if the proof violates the canonical order.
+func (p *CompactMultiProof) checkOrder() error {
+	seen := make(map[[32]byte]bool)
+	runs := 0
+	for i, chunk := range p.Chunks {
+		if i > 0 && chunk == p.Chunks[i-1] {
+			continue
+		}
+		if seen[chunk] {
+			return fmt.Errorf("repeated chunk %d is not adjacent to its first occurrence", i)
+		}
+		seen[chunk] = true
+		runs++
+	}
+	if len(p.ChunkWords) != 0 && len(p.ChunkWords) != runs {
+		return fmt.Errorf("the proof has words of %d chunks, but %d distinct chunks", len(p.ChunkWords), runs)
+	}
+	if len(p.WordCommitments) != 0 && len(p.WordCommitments) != runs {
+		return fmt.Errorf("the proof has word commitments of %d chunks, but %d distinct chunks", len(p.WordCommitments), runs)
+	}
+	if err := checkDistinctHashes(p.Proof); err != nil {
+		return err
+	}
+	return checkAbsentOrder(p.ProofType, p.AbsentIndices)
+}
+
+// checkOrder returns an error if the batch proof violates the canonical order.
+func (p *BatchMultiProof) checkOrder() error {
+	if err := checkDistinctHashes(p.Chunks); err != nil {
+		return fmt.Errorf("chunks: %w", err)
+	}
+	if len(p.ChunkWords) != 0 && len(p.ChunkWords) != len(p.Chunks) {
+		return fmt.Errorf("the proof has words of %d chunks, but %d chunks", len(p.ChunkWords), len(p.Chunks))
+	}
+	if len(p.WordCommitments) != 0 && len(p.WordCommitments) != len(p.Chunks) {
+		return fmt.Errorf("the proof has word commitments of %d chunks, but %d chunks", len(p.WordCommitments), len(p.Chunks))
+	}
+	if err := checkDistinctHashes(p.Proof); err != nil {
+		return err
+	}
+	if p.AbsentIndices == nil {
+		return nil
+	}
+	if len(p.AbsentIndices) != len(p.ProofTypes) {
+		return fmt.Errorf("the proof has absent indices of %d elements, but %d proof types", len(p.AbsentIndices), len(p.ProofTypes))
+	}
+	for i, positions := range p.AbsentIndices {
+		if err := checkAbsentOrder(p.ProofTypes[i], positions); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkDistinctHashes returns an error if a hash occurs more than once.
+func checkDistinctHashes(hashes [][32]byte) error {
+	seen := make(map[[32]byte]bool, len(hashes))
+	for i, h := range hashes {
+		if seen[h] {
+			return fmt.Errorf("hash %d occurs more than once", i)
+		}
+		seen[h] = true
+	}
+	return nil
+}
+
+// checkAbsentOrder returns an error unless the absent indices are strictly increasing and start with the
+// position of the proof type.
+func checkAbsentOrder(proofType ProofType, positions []uint8) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	if Absence(positions[0]) != proofType {
+		return errors.New("the absent indices do not start with the proof type")
+	}
+	for i := 1; i < len(positions); i++ {
+		if positions[i] <= positions[i-1] {
+			return errors.New("the absent indices must be strictly increasing")
+		}
+	}
+	return nil
+}
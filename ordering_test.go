@@ -0,0 +1,107 @@
+package bloomtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCanonicalElements(t *testing.T) {
+	elems := [][]byte{{2}, {1, 0}, {1}, {2}, {}, {0xff}, {1}}
+	expected := [][]byte{{}, {1}, {1, 0}, {2}, {0xff}}
+	sorted := CanonicalElements(elems)
+	if len(sorted) != len(expected) {
+		t.Fatalf("expected %d elements, but got %d", len(expected), len(sorted))
+	}
+	for i := range expected {
+		if !bytes.Equal(sorted[i], expected[i]) {
+			t.Fatalf("expected element %v at position %d, but got %v", expected[i], i, sorted[i])
+		}
+	}
+	if !bytes.Equal(elems[0], []byte{2}) {
+		t.Fatal("the elements were reordered in place")
+	}
+}
+
+func TestDeterministicProofEncodings(t *testing.T) {
+	SetChunkSize(64)
+	elems := [][]byte{{1}, {2}, {3}, {42}, {43}}
+	var encodings [][]byte
+	for i := 0; i < 2; i++ {
+		dbf := generateDBF(200, "secret seed", elems[:3]...)
+		tree, err := NewBloomTree(dbf, WithAbsentIndices(3), WithWorkers(i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var encoding []byte
+		for _, elem := range elems {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoding = append(encoding, multiproof.Encode()...)
+		}
+		batch, err := tree.GenerateCompactMultiProofBatch(CanonicalElements(elems))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodings = append(encodings, append(encoding, data...))
+	}
+	if !bytes.Equal(encodings[0], encodings[1]) {
+		t.Fatal("the provers emitted different proofs")
+	}
+}
+
+func TestDecodeNonCanonicalOrder(t *testing.T) {
+	a, b, c := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	var tests = []struct {
+		name  string
+		proof *CompactMultiProof
+	}{
+		{name: "repeated chunk", proof: &CompactMultiProof{Chunks: [][32]byte{a, b, a}, ProofType: Presence}},
+		{name: "repeated hash", proof: &CompactMultiProof{Chunks: [][32]byte{a}, Proof: [][32]byte{b, c, b}, ProofType: Presence}},
+		{name: "chunk words", proof: &CompactMultiProof{Chunks: [][32]byte{a, a, b}, ChunkWords: [][]uint64{{1}, {2}, {3}},
+			ProofType: Presence}},
+		{name: "absent indices", proof: &CompactMultiProof{Chunks: [][32]byte{a, b}, ProofType: Absence(2),
+			AbsentIndices: []uint8{2, 1}}},
+		{name: "absent proof type", proof: &CompactMultiProof{Chunks: [][32]byte{a, b}, ProofType: Absence(1),
+			AbsentIndices: []uint8{0, 1}}},
+	}
+	for _, test := range tests {
+		if _, err := DecodeCompactMultiProof(test.proof.Encode()); err == nil {
+			t.Fatalf("expected error for a proof with a non-canonical %s", test.name)
+		}
+		data, err := json.Marshal(test.proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, new(CompactMultiProof)); err == nil {
+			t.Fatalf("expected error for the JSON of a proof with a non-canonical %s", test.name)
+		}
+	}
+	valid := &CompactMultiProof{Chunks: [][32]byte{a, a, b}, Proof: [][32]byte{c}, ChunkWords: [][]uint64{{1}, {2}},
+		ProofType: Absence(0), AbsentIndices: []uint8{0, 2}}
+	if _, err := DecodeCompactMultiProof(valid.Encode()); err != nil {
+		t.Fatal(err)
+	}
+
+	batches := []*BatchMultiProof{
+		{Chunks: [][32]byte{a, b, a}, ProofTypes: []ProofType{Presence}},
+		{Chunks: [][32]byte{a}, Proof: [][32]byte{b, b}, ProofTypes: []ProofType{Presence}},
+		{Chunks: [][32]byte{a, b}, ChunkWords: [][]uint64{{1}}, ProofTypes: []ProofType{Presence}},
+		{Chunks: [][32]byte{a, b}, ProofTypes: []ProofType{Presence, Absence(1)}, AbsentIndices: [][]uint8{nil, {1, 1}}},
+	}
+	for i, batch := range batches {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, new(BatchMultiProof)); err == nil {
+			t.Fatalf("expected error for the non-canonical batch proof %d", i)
+		}
+	}
+}
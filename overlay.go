@@ -0,0 +1,117 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OverlayTree commits to a bloom filter of members and a bloom filter of tombstones under a single root,
+// so elements of plain bloom filters can be soft-deleted. An element is a member if it is present in the
+// member filter and absent from the tombstone filter. Deleted elements cannot be added again.
+type OverlayTree struct {
+	members    *BloomTree
+	tombstones *BloomTree
+}
+
+// OverlayProof proves the membership of an element in an overlay tree. It opens the chunks of the element
+// in both filters, together with the roots of both trees.
+type OverlayProof struct {
+	Members        *CompactMultiProof
+	Tombstones     *CompactMultiProof
+	MembersRoot    [32]byte
+	TombstonesRoot [32]byte
+}
+
+// NewOverlayTree creates an overlay tree of the member and tombstone bloom filters, which should
+// use the same seed. Both trees are built with the given options.
+func NewOverlayTree(members, tombstones BloomFilter, opts ...Option) (*OverlayTree, error) {
+	membersTree, err := NewBloomTree(members, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tombstonesTree, err := NewBloomTree(tombstones, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &OverlayTree{members: membersTree, tombstones: tombstonesTree}, nil
+}
+
+// Root returns the root committing to both filters.
+func (ot *OverlayTree) Root() [32]byte {
+	return ot.members.cfg.hash.overlayRoot(ot.members.Root(), ot.tombstones.Root())
+}
+
+// Add adds an element to the member filter.
+func (ot *OverlayTree) Add(elem []byte) error {
+	return ot.members.Update(elem)
+}
+
+// Delete soft-deletes an element by adding it to the tombstone filter.
+func (ot *OverlayTree) Delete(elem []byte) error {
+	return ot.tombstones.Update(elem)
+}
+
+// GenerateOverlayProof returns a proof of the membership of an element in the overlay tree.
+func (ot *OverlayTree) GenerateOverlayProof(elem []byte) (*OverlayProof, error) {
+	members, err := ot.members.GenerateCompactMultiProof(elem)
+	if err != nil {
+		return nil, err
+	}
+	tombstones, err := ot.tombstones.GenerateCompactMultiProof(elem)
+	if err != nil {
+		return nil, err
+	}
+	return &OverlayProof{
+		Members:        members,
+		Tombstones:     tombstones,
+		MembersRoot:    ot.members.Root(),
+		TombstonesRoot: ot.tombstones.Root(),
+	}, nil
+}
+
+// Present returns whether the proof shows the element to be a member, that is present in the
+// member filter and absent from the tombstone filter.
+func (p *OverlayProof) Present() bool {
+	return p.Members.ProofType.IsPresence() && !p.Tombstones.ProofType.IsPresence()
+}
+
+// VerifyOverlayProof returns whether the proof is valid for the overlay tree with the given root.
+// Whether the element is a member is reported by OverlayProof.Present.
+func VerifyOverlayProof(element, seedValue []byte, proof *OverlayProof, root [32]byte, members, tombstones BloomFilter,
+	opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.Members == nil || proof.Tombstones == nil {
+		return false, errors.New("the overlay proof must open both filters")
+	}
+	for _, other := range cfg.crossCheckRoots {
+		if other != root {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, root, other)
+		}
+	}
+	if cfg.hash.overlayRoot(proof.MembersRoot, proof.TombstonesRoot) != root {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the root")
+	}
+	// the cross check roots are overlay roots, the filters are verified against their own roots
+	cfg.crossCheckRoots = nil
+	for _, filter := range []struct {
+		proof *CompactMultiProof
+		root  [32]byte
+		bf    BloomFilter
+	}{
+		{proof: proof.Members, root: proof.MembersRoot, bf: members},
+		{proof: proof.Tombstones, root: proof.TombstonesRoot, bf: tombstones},
+	} {
+		treeLength, err := filterTreeLength(filter.bf, cfg.chunkSize)
+		if err != nil {
+			return false, err
+		}
+		verified, err := verifyCompactMultiProof(element, seedValue, filter.proof, filter.root, filter.bf, treeLength, cfg.chunkIndices, cfg)
+		if err != nil || !verified {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package bloomtree
+
+import (
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestOverlayTree(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	members := generateDBF(200, seed, []byte{1}, []byte{2})
+	tombstones := DBF.NewDbf(200, 0.2, []byte(seed))
+	tree, err := NewOverlayTree(members, tombstones)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Add([]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	before := tree.Root()
+	if err := tree.Delete([]byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() == before {
+		t.Fatal("expected the root to change after a deletion")
+	}
+
+	var tests = []struct {
+		elem    []byte
+		present bool
+	}{
+		{elem: []byte{1}, present: true},
+		{elem: []byte{2}, present: false},
+		{elem: []byte{3}, present: true},
+		{elem: []byte{42}, present: false},
+	}
+	for _, test := range tests {
+		proof, err := tree.GenerateOverlayProof(test.elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Present() != test.present {
+			t.Fatalf("expected membership %t of element %v", test.present, test.elem)
+		}
+		verified, err := VerifyOverlayProof(test.elem, []byte(seed), proof, tree.Root(), members, tombstones, WithCrossCheckRoot(tree.Root()))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify overlay proof of element %v", test.elem)
+		}
+		if verified, _ := VerifyOverlayProof(test.elem, []byte(seed), proof, before, members, tombstones); verified {
+			t.Fatalf("verified overlay proof of element %v against an old root", test.elem)
+		}
+	}
+
+	// hiding the tombstone by swapping in a proof against the empty tombstone tree fails
+	proof, err := tree.GenerateOverlayProof([]byte{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := NewBloomTree(DBF.NewDbf(200, 0.2, []byte(seed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.Tombstones, err = empty.GenerateCompactMultiProof([]byte{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.TombstonesRoot = empty.Root()
+	if verified, _ := VerifyOverlayProof([]byte{2}, []byte(seed), proof, tree.Root(), members, tombstones); verified {
+		t.Fatal("verified overlay proof with a replaced tombstone tree")
+	}
+}
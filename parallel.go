@@ -0,0 +1,73 @@
+package bloomtree
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// minParallelItems is the smallest number of hashes handed to a single worker.
+// Smaller ranges are hashed by fewer workers, as goroutines would cost more than they save.
+const minParallelItems = 1024
+
+// parallelRange calls fn for contiguous subranges covering [start, end) on up to workers goroutines
+// and waits for all of them. A worker count below 1 uses GOMAXPROCS workers. Every index is
+// handled by exactly one call, so the result does not depend on the number of workers.
+func parallelRange(workers, start, end int, fn func(start, end int)) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	n := end - start
+	if max := (n + minParallelItems - 1) / minParallelItems; workers > max {
+		workers = max
+	}
+	if workers <= 1 {
+		if n > 0 {
+			fn(start, end)
+		}
+		return
+	}
+	size := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for s := start; s < end; s += size {
+		e := s + size
+		if e > end {
+			e = end
+		}
+		wg.Add(1)
+		go func(s, e int) {
+			defer wg.Done()
+			fn(s, e)
+		}(s, e)
+	}
+	wg.Wait()
+}
+
+// parallelRangeCtx is parallelRange returning the error of the context once it is done. Workers check the
+// context before every minParallelItems indices, so a canceled range stops after at most that many per worker,
+// and yield in between, so hashing a huge tree does not monopolize the threads of the scheduler.
+func parallelRangeCtx(ctx context.Context, workers, start, end int, fn func(start, end int)) error {
+	parallelRange(workers, start, end, func(start, end int) {
+		for s := start; s < end && yieldPoint(ctx, s-start) == nil; s += minParallelItems {
+			e := s + minParallelItems
+			if e > end {
+				e = end
+			}
+			fn(s, e)
+		}
+	})
+	return ctx.Err()
+}
+
+// yieldInterval is the number of iterations of a long loop between two yields, see yieldPoint.
+const yieldInterval = minParallelItems
+
+// yieldPoint is a cooperative yield point of long loops, called with the number of iterations done. It lets
+// other goroutines run every yieldInterval iterations, so a single giant request does not keep a thread of the
+// scheduler from latency-sensitive work, and returns the error of the context.
+func yieldPoint(ctx context.Context, i int) error {
+	if i > 0 && i%yieldInterval == 0 {
+		runtime.Gosched()
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,126 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestParallelRange(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 8} {
+		for _, n := range []int{0, 1, minParallelItems, 5*minParallelItems + 7} {
+			var mu sync.Mutex
+			counts := make([]int, n)
+			parallelRange(workers, 0, n, func(start, end int) {
+				mu.Lock()
+				defer mu.Unlock()
+				for i := start; i < end; i++ {
+					counts[i]++
+				}
+			})
+			for i, c := range counts {
+				if c != 1 {
+					t.Fatalf("index %d of %d was handled %d times by %d workers", i, n, c, workers)
+				}
+			}
+		}
+	}
+}
+
+func TestWithWorkers(t *testing.T) {
+	SetChunkSize(64)
+	// 20000 elements need more than minParallelItems chunks of 64 bits
+	dbf := generateDBF(20000, "secret seed", []byte{1}, []byte{2}, []byte{3})
+	tree, err := NewBloomTree(dbf, WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.leafCount(dbf.BitArray().Bytes()) <= minParallelItems {
+		t.Fatal("the tree is too small to be hashed in parallel")
+	}
+	adaptiveTree, err := NewAdaptiveBloomTree(dbf, 64, 512, WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 3, 16} {
+		parallelTree, err := NewBloomTree(dbf, WithWorkers(workers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parallelTree.nodes, tree.nodes) {
+			t.Fatalf("nodes hashed by %d workers differ from a single worker", workers)
+		}
+		parallelAdaptiveTree, err := NewAdaptiveBloomTree(dbf, 64, 512, WithWorkers(workers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parallelAdaptiveTree.nodes, adaptiveTree.nodes) {
+			t.Fatalf("adaptive nodes hashed by %d workers differ from a single worker", workers)
+		}
+	}
+	if _, err := NewBloomTree(dbf, WithWorkers(0)); err == nil {
+		t.Fatal("expected error for zero workers")
+	}
+}
+
+func TestParallelRangeCtx(t *testing.T) {
+	n := 5*minParallelItems + 7
+	counts := make([]int, n)
+	var mu sync.Mutex
+	if err := parallelRangeCtx(context.Background(), 3, 0, n, func(start, end int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := start; i < end; i++ {
+			counts[i]++
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range counts {
+		if c != 1 {
+			t.Fatalf("index %d was handled %d times", i, c)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := parallelRangeCtx(ctx, 3, 0, n, func(start, end int) { called = true })
+	if !errors.Is(err, context.Canceled) || called {
+		t.Fatalf("expected context.Canceled without calls, but got %v and called %v", err, called)
+	}
+}
+
+func TestParallelRangeYields(t *testing.T) {
+	// on a single thread, another goroutine only runs while the range yields
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	ran := make(chan struct{})
+	go close(ran)
+	var yielded bool
+	err := parallelRangeCtx(context.Background(), 1, 0, 3*minParallelItems, func(start, end int) {
+		if start == 0 {
+			return
+		}
+		select {
+		case <-ran:
+			yielded = true
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !yielded {
+		t.Fatal("expected the range to let other goroutines run between its blocks")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, i := range []int{0, 1, yieldInterval} {
+		if err := yieldPoint(ctx, i); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the error of the context at iteration %d, but got %v", i, err)
+		}
+	}
+}
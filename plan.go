@@ -0,0 +1,135 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ProofPlan describes the batch proof of a set of elements without generating it, so large jobs can be
+// split into batches of the right size first.
+type ProofPlan struct {
+	// Chunks is the number of distinct chunks of the batch proof of all elements.
+	Chunks int
+	// Hashes is the number of sibling hashes of the batch proof of all elements.
+	Hashes int
+	// Groups partition the elements into groups sharing no chunks, in increasing order of their first chunk.
+	// Splitting a batch between groups never opens a chunk twice.
+	Groups []ProofGroup
+}
+
+// ProofGroup is a group of elements whose proofs share chunks.
+type ProofGroup struct {
+	// Elements are the positions of the elements in the planned set, in increasing order.
+	Elements []int
+	// Chunks are the indices of the distinct chunks of the group, in increasing order.
+	Chunks []uint64
+	// Hashes is the number of sibling hashes of a batch proof of the group alone.
+	Hashes int
+}
+
+// CoverageProofPlan returns the number of chunks and sibling hashes GenerateCompactMultiProofBatch needs to
+// prove the elements, and groups the elements by shared chunks. Only the bloom filter is read, no proof is
+// generated. For a bloom filter without bits, the proof needs no chunks and no hashes, and the plan has a
+// single group of all elements.
+func (bt *BloomTree) CoverageProofPlan(elems [][]byte) (*ProofPlan, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if len(elems) == 0 {
+		return nil, errors.New("the batch has no elements")
+	}
+	if isEmptyFilter(bt.bf) {
+		group := ProofGroup{Elements: make([]int, len(elems))}
+		for i := range group.Elements {
+			group.Elements[i] = i
+		}
+		return &ProofPlan{Groups: []ProofGroup{group}}, nil
+	}
+	_, elemIndices, _, _, err := bt.batchIndices(context.Background(), elems)
+	if err != nil {
+		return nil, err
+	}
+	// elements sharing a chunk are joined into the group of the chunk
+	parent := make([]int, len(elems))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	owners := make(map[uint64]int)
+	for i, indices := range elemIndices {
+		for _, v := range indices {
+			chunk := bt.chunkIndex(v)
+			if owner, ok := owners[chunk]; ok {
+				parent[find(i)] = find(owner)
+			} else {
+				owners[chunk] = i
+			}
+		}
+	}
+	groups := make(map[int]*ProofGroup)
+	for i := range elems {
+		root := find(i)
+		if groups[root] == nil {
+			groups[root] = &ProofGroup{}
+		}
+		groups[root].Elements = append(groups[root].Elements, i)
+	}
+	for chunk, owner := range owners {
+		g := groups[find(owner)]
+		g.Chunks = append(g.Chunks, chunk)
+	}
+
+	plan := &ProofPlan{Chunks: len(owners)}
+	var chunks []uint64
+	for _, g := range groups {
+		sort.Slice(g.Chunks, func(i, j int) bool { return g.Chunks[i] < g.Chunks[j] })
+		hashIndices, err := bt.generateProofIndices(g.Chunks)
+		if err != nil {
+			return nil, err
+		}
+		g.Hashes = len(hashIndices)
+		plan.Groups = append(plan.Groups, *g)
+		chunks = append(chunks, g.Chunks...)
+	}
+	sort.Slice(plan.Groups, func(i, j int) bool { return plan.Groups[i].Chunks[0] < plan.Groups[j].Chunks[0] })
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i] < chunks[j] })
+	hashIndices, err := bt.generateProofIndices(chunks)
+	if err != nil {
+		return nil, err
+	}
+	plan.Hashes = len(hashIndices)
+	return plan, nil
+}
+
+// Batches splits the planned elements into batches of at most maxChunks chunks, returning the positions of
+// the elements of every batch. Consecutive groups are packed into the same batch, as neighboring chunks share
+// most of their sibling hashes. A group of more than maxChunks chunks forms a batch of its own.
+func (p *ProofPlan) Batches(maxChunks int) [][]int {
+	var (
+		batches [][]int
+		batch   []int
+		chunks  int
+	)
+	for _, g := range p.Groups {
+		if batch != nil && chunks+len(g.Chunks) > maxChunks {
+			batches = append(batches, batch)
+			batch, chunks = nil, 0
+		}
+		batch = append(batch, g.Elements...)
+		chunks += len(g.Chunks)
+	}
+	if batch != nil {
+		batches = append(batches, batch)
+	}
+	for _, b := range batches {
+		sort.Ints(b)
+	}
+	return batches
+}
@@ -0,0 +1,155 @@
+package bloomtree
+
+import (
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func TestCoverageProofPlan(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	var elems [][]byte
+	for i := 0; i < 40; i++ {
+		elems = append(elems, []byte{byte(i)})
+	}
+	dbf := generateDBF(2000, seed, elems[:20]...)
+	var tests = []struct {
+		opts []Option
+	}{
+		{},
+		{opts: []Option{WithSmallestAbsenceProofs()}},
+		{opts: []Option{WithChunkSize(512)}},
+	}
+	for _, test := range tests {
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := tree.CoverageProofPlan(elems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, err := tree.GenerateCompactMultiProofBatch(elems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Chunks != len(batch.Chunks) || plan.Hashes != len(batch.Proof) {
+			t.Fatalf("expected %d chunks and %d hashes, but got %d and %d", len(batch.Chunks), len(batch.Proof), plan.Chunks, plan.Hashes)
+		}
+
+		// the groups partition the elements and share no chunks
+		seen := make(map[int]bool)
+		chunks := make(map[uint64]bool)
+		for _, g := range plan.Groups {
+			for _, i := range g.Elements {
+				if seen[i] {
+					t.Fatalf("element %d is in more than one group", i)
+				}
+				seen[i] = true
+			}
+			for _, c := range g.Chunks {
+				if chunks[c] {
+					t.Fatalf("chunk %d is in more than one group", c)
+				}
+				chunks[c] = true
+			}
+			var groupElems [][]byte
+			for _, i := range g.Elements {
+				groupElems = append(groupElems, elems[i])
+			}
+			groupBatch, err := tree.GenerateCompactMultiProofBatch(groupElems)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(g.Chunks) != len(groupBatch.Chunks) || g.Hashes != len(groupBatch.Proof) {
+				t.Fatalf("expected %d chunks and %d hashes of group %v, but got %d and %d", len(groupBatch.Chunks),
+					len(groupBatch.Proof), g.Elements, len(g.Chunks), g.Hashes)
+			}
+		}
+		if len(seen) != len(elems) {
+			t.Fatalf("expected %d grouped elements, but got %d", len(elems), len(seen))
+		}
+
+		group := make(map[int]int)
+		for g, pg := range plan.Groups {
+			for _, i := range pg.Elements {
+				group[i] = g
+			}
+		}
+		for _, maxChunks := range []int{1, 5, plan.Chunks} {
+			batches := plan.Batches(maxChunks)
+			var n int
+			for _, b := range batches {
+				n += len(b)
+				var batchElems [][]byte
+				for _, i := range b {
+					batchElems = append(batchElems, elems[i])
+				}
+				proof, err := tree.GenerateCompactMultiProofBatch(batchElems)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// only a single group may exceed the maximum
+				for _, i := range b {
+					if len(proof.Chunks) > maxChunks && group[i] != group[b[0]] {
+						t.Fatalf("a batch of %d chunks exceeds the maximum of %d", len(proof.Chunks), maxChunks)
+					}
+				}
+				verified, err := VerifyCompactMultiProofBatch(batchElems, []byte(seed), proof, tree.Root(), dbf, test.opts...)
+				if err != nil {
+					t.Fatal(err)
+				} else if !verified {
+					t.Fatal("failed to verify the batch")
+				}
+			}
+			if n != len(elems) {
+				t.Fatalf("expected %d elements in the batches, but got %d", len(elems), n)
+			}
+			if maxChunks == plan.Chunks && len(batches) != 1 {
+				t.Fatalf("expected a single batch, but got %d", len(batches))
+			}
+		}
+	}
+}
+
+func TestCoverageProofPlanErrors(t *testing.T) {
+	SetChunkSize(64)
+	tree, err := NewBloomTree(generateDBF(200, "secret seed", []byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.CoverageProofPlan(nil); err == nil {
+		t.Fatal("expected error for an empty set")
+	}
+	tree.bf = nil
+	if _, err := tree.CoverageProofPlan([][]byte{{1}}); err != ErrNoBloomFilter {
+		t.Fatalf("expected ErrNoBloomFilter, but got %v", err)
+	}
+}
+
+func TestCoverageProofPlanEmptyFilter(t *testing.T) {
+	SetChunkSize(64)
+	tree, err := NewBloomTree(emptyBF{DBF.NewDbf(10, 0.2, []byte("secret seed"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems := [][]byte{{1}, {2}, {3}}
+	plan, err := tree.CoverageProofPlan(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Chunks != 0 || plan.Hashes != 0 || len(plan.Groups) != 1 || len(plan.Groups[0].Elements) != len(elems) {
+		t.Fatalf("expected a plan without chunks and hashes of a single group, but got %+v", plan)
+	}
+	batch, err := tree.GenerateCompactMultiProofBatch(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Chunks) != plan.Chunks || len(batch.Proof) != plan.Hashes {
+		t.Fatalf("expected the batch proof to match the plan, but got %d chunks and %d hashes", len(batch.Chunks), len(batch.Proof))
+	}
+	if batches := plan.Batches(1); len(batches) != 1 || len(batches[0]) != len(elems) {
+		t.Fatalf("expected a single batch of all elements, but got %v", batches)
+	}
+}
@@ -0,0 +1,33 @@
+package bloomtree
+
+import (
+	"sync"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// maxScratchIndices is the largest number of indices a buffer of the scratch space keeps when it is returned
+// to the pool, so a single large batch proof does not pin its buffers for the lifetime of the process.
+const maxScratchIndices = 1 << 16
+
+// proofScratch holds the buffers of proof generation. It is reused across proofs through scratchPool, which
+// saves the allocations, and thereby the garbage collection, of servers generating many proofs.
+type proofScratch struct {
+	// path holds the node indices of the layers of the tree and of the proof hashes.
+	path core.PathBuffers
+}
+
+var scratchPool = sync.Pool{New: func() interface{} { return new(proofScratch) }}
+
+// getScratch returns a scratch space from the pool. It must be returned with putScratch once its buffers
+// are no longer used.
+func getScratch() *proofScratch {
+	return scratchPool.Get().(*proofScratch)
+}
+
+func putScratch(s *proofScratch) {
+	if s.path.Cap() > maxScratchIndices {
+		return
+	}
+	scratchPool.Put(s)
+}
@@ -0,0 +1,58 @@
+package bloomtree
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// maxProofAllocs is the allocation budget of a proof, which guards the pooled buffers of proof generation
+// against regressions. Most of the allocations are the slices of the returned proof and of the bloom filter.
+const maxProofAllocs = 20
+
+func TestMultiproofIndices(t *testing.T) {
+	var tests = []struct {
+		indices  []uint64
+		expected []uint64
+		err      error
+	}{
+		{indices: []uint64{0}, expected: []uint64{1, 17, 25, 29}},
+		{indices: []uint64{0, 1}, expected: []uint64{17, 25, 29}},
+		{indices: []uint64{2, 2, 6}, expected: []uint64{3, 7, 16, 18, 29}},
+		{indices: []uint64{6, 2, 2}, expected: []uint64{3, 7, 16, 18, 29}},
+		{indices: []uint64{0, 0, 1}, expected: []uint64{17, 25, 29}},
+		{indices: []uint64{9, 5, 3, 5}, expected: []uint64{2, 4, 8, 16, 19, 21, 27}},
+		{indices: []uint64{16}, err: ErrLayerIndexOutOfRange},
+	}
+
+	for _, test := range tests {
+		// the scratch space is reused by every run, so leftovers of earlier proofs would change the result
+		for i := 0; i < 2; i++ {
+			hashIndices, err := multiproofIndices(test.indices, 31)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v for indices %v, but got %v", test.err, test.indices, err)
+			}
+			if test.err == nil && !reflect.DeepEqual(hashIndices, test.expected) {
+				t.Fatalf("expected hash indices %v for indices %v, but got %v", test.expected, test.indices, hashIndices)
+			}
+		}
+	}
+}
+
+func TestGenerateCompactMultiProofAllocs(t *testing.T) {
+	SetChunkSize(64)
+	tree, err := NewBloomTree(benchmarkDBF(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range []string{"element 1", "absent element"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, err := tree.GenerateCompactMultiProof([]byte(elem)); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs > maxProofAllocs {
+			t.Fatalf("the proof of %q allocates %v times, but the budget is %d", elem, allocs, maxProofAllocs)
+		}
+	}
+}
@@ -2,9 +2,10 @@ package bloomtree
 
 import (
 	"errors"
-	"math"
+	"fmt"
 	"sort"
 
+	"github.com/labbloom/bloom-tree/core"
 	"github.com/willf/bitset"
 )
 
@@ -13,12 +14,29 @@ type CompactMultiProof struct {
 	Chunks [][32]byte
 	// Proof are the hashes needed to reconstruct the bloom tree root.
 	Proof [][32]byte
-	// ProofType is 255 if the element is present in the bloom filter. it returns the index of the index if the element is not present in the bloom filter.
-	ProofType uint8
+	// ProofType is Presence if the element is present in the bloom filter. Otherwise it is an absence proof type
+	// holding the position of the element index pointing to a zero bit.
+	ProofType ProofType
+	// ChunkWords are the bloom filter words of the distinct chunks of the proof, in increasing chunk order.
+	// They allow verifying the proof without the bloom filter.
+	ChunkWords [][]uint64
+	// AbsentIndices are the positions, among the element indices, of all zero bits covered by an absence proof
+	// with more than one zero index. The first position equals ProofType. It is empty for single index proofs.
+	AbsentIndices []uint8
+	// ChunkSize is the chunk size of the tree the proof was generated from, so verifiers can detect proofs of trees
+	// with another chunk size. It is zero if unknown, e.g. for proofs decoded from encodings without it.
+	ChunkSize int
+	// WordCommitments are set for proofs of trees built with WithBlinding. For every chunk of ChunkWords, they
+	// hold the salt of every revealed word, i.e. a word holding a proven index, and the commitment of every
+	// other word, which is blinded and zero in ChunkWords.
+	WordCommitments [][][32]byte
+	// Provenance is set for proofs of trees built with WithProvenance. It holds the provenance of every chunk of
+	// ChunkWords, which is not committed to by the root, see Builds.
+	Provenance []Provenance
 }
 
 // newMultiProof generates a Merkle proof
-func newCompactMultiProof(chunks [][32]byte, proof [][32]byte, proofType uint8) *CompactMultiProof {
+func newCompactMultiProof(chunks [][32]byte, proof [][32]byte, proofType ProofType) *CompactMultiProof {
 	return &CompactMultiProof{
 		Chunks:    chunks,
 		Proof:     proof,
@@ -26,11 +44,47 @@ func newCompactMultiProof(chunks [][32]byte, proof [][32]byte, proofType uint8)
 	}
 }
 
-func CheckProofType(proofType uint8) bool {
-	if proofType == maxK {
-		return true
+// NewCompactMultiProof creates a compact multiproof from its decoded parts, e.g. after receiving it over the wire.
+// The chunks and hashes are copied.
+func NewCompactMultiProof(chunks [][32]byte, hashes [][32]byte, proofType ProofType) *CompactMultiProof {
+	return newCompactMultiProof(append([][32]byte(nil), chunks...), append([][32]byte(nil), hashes...), proofType)
+}
+
+// Hashes returns the hashes needed to reconstruct the bloom tree root.
+func (p *CompactMultiProof) Hashes() [][32]byte {
+	return p.Proof
+}
+
+// HashChunk returns the SHA-512/256 leaf hash of the chunk at the given index holding the given bloom filter
+// words. Use Hash.Chunk for trees built with another hash function.
+func HashChunk(index uint64, words ...uint64) [32]byte {
+	return hashLeaf(index, words...)
+}
+
+// VerifyChunkHashes returns whether the chunk hashes at the given sorted leaf indices, together with the proof
+// hashes, reconstruct the root of a tree with treeLength nodes. Consecutive duplicate indices and hashes are allowed.
+func VerifyChunkHashes(chunkIndices []uint64, chunkHashes, proof [][32]byte, root [32]byte, treeLength int, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
 	}
-	return false
+	if err := core.CheckTreeLength(treeLength); err != nil {
+		return false, err
+	}
+	if err := checkIndices(chunkIndices, uint64(treeLength+1)/2); err != nil {
+		return false, err
+	}
+	return verifyProof(cfg, chunkIndices, newCompactMultiProof(chunkHashes, proof, Presence), root, treeLength)
+}
+
+// Type returns the proof type, see CompactMultiProof.ProofType.
+func (p *CompactMultiProof) Type() ProofType {
+	return p.ProofType
+}
+
+// CheckProofType returns true for presence proofs and false for absence proofs.
+func CheckProofType(proofType ProofType) bool {
+	return proofType.IsPresence()
 }
 
 func checkChunkPresence(elemIndices []uint, bf *bitset.BitSet) bool {
@@ -43,148 +97,151 @@ func checkChunkPresence(elemIndices []uint, bf *bitset.BitSet) bool {
 	return true
 }
 
-func computeChunkIndices(elemIndices []uint) []uint64 {
+// chunkIndices returns the indices of the chunks holding the given bloom filter indices.
+func (c config) chunkIndices(elemIndices []uint) []uint64 {
 	chunkIndices := make([]uint64, len(elemIndices))
 	for i, v := range elemIndices {
-		index := uint64(math.Floor(float64(v) / float64(chunkSize)))
+		index := uint64(v) / uint64(c.chunkSize)
 		chunkIndices[i] = index
 	}
 	return chunkIndices
 }
 
-func determineOrder2Hash(ind1, indNeighbor int, h1, h2 [32]byte) [32]byte {
-	if ind1 > indNeighbor {
-		return hashChild(h2, h1)
-	}
-	return hashChild(h1, h2)
-}
-
-func verifyProof(chunkIndices []uint64, multiproof *CompactMultiProof, root [32]byte, treeLength int) (bool, error) {
-	var (
-		pairs        []int
-		newIndices   []uint64
-		newBlueNodes [][32]byte
-	)
-
-	proof := multiproof.Proof
-	blueNodes := multiproof.Chunks
-	prevIndices := chunkIndices
-	indMap := make(map[uint64]int)
-	leavesPerLayer := uint64(treeLength + 1)
-	currentLayer := uint64(0)
-	height := int(math.Log2(float64(treeLength / 2)))
-	// remove duplicates of blue nodes
-	var uniqueBlueNodes [][32]byte
-	uniqueBlueNodes = append(uniqueBlueNodes, blueNodes[0])
-	for i := 1; i < len(blueNodes); i++ {
-		if blueNodes[i] != blueNodes[i-1] {
-			uniqueBlueNodes = append(uniqueBlueNodes, blueNodes[i])
+func verifyProof(cfg config, chunkIndices []uint64, multiproof *CompactMultiProof, root [32]byte, treeLength int) (bool, error) {
+	for _, other := range cfg.crossCheckRoots {
+		if other != root {
+			return false, fmt.Errorf("%w: %x and %x", ErrRootMismatch, root, other)
 		}
 	}
-	blueNodes = uniqueBlueNodes
+	if err := cfg.checkTreeHeight(treeLength); err != nil {
+		return false, err
+	}
+	computed, err := proofRoot(cfg, chunkIndices, multiproof, treeLength)
+	if err != nil {
+		return false, err
+	}
+	if computed != root {
+		return false, invalidProof(ReasonRootMismatch, "the proof does not match the root")
+	}
+	return true, nil
+}
 
-	// remove duplicates of proof
-	var uniqueProof [][32]byte
-	if len(proof) != 0 {
-		uniqueProof = append(uniqueProof, proof[0])
-		for i := 1; i < len(proof); i++ {
-			if proof[i] != proof[i-1] {
-				uniqueProof = append(uniqueProof, proof[i])
-			}
-		}
+// checkTreeHeight returns a VerificationError if the height of a tree of treeLength nodes is not the pinned one.
+func (c config) checkTreeHeight(treeLength int) error {
+	if !c.pinnedHeight {
+		return nil
 	}
-	proof = uniqueProof
-	proofNum := 0
-	for i := 0; i <= height; i++ {
-		if len(newIndices) != 0 {
-			for j := 0; j < len(newIndices); j += 2 {
-				prevIndices = append(prevIndices, newIndices[j]/2)
-			}
-			newIndices = nil
-		}
-		for _, val := range prevIndices {
-			neighbor := val ^ 1
-			if _, ok := indMap[val+neighbor]; ok {
-				if indMap[val+neighbor] != int(val) {
-					indMap[val+neighbor] = -1
-				}
-			} else {
-				indMap[val+neighbor] = int(val)
-				pairs = append(pairs, int(val+neighbor))
-			}
-		}
-		for k, v := range indMap {
-			if v == -1 {
-				a, b := order((k-1)/2, (k+1)/2)
-				newIndices = append(newIndices, a, b)
-			} else {
-				a, b := order(uint64(v), k-uint64(v))
-				newIndices = append(newIndices, a, b)
-			}
-		}
-		sort.Ints(pairs)
-		blueNodeNum := 0
-		for _, v := range pairs {
-			value := uint64(v)
-			if indMap[value] == -1 {
-				newBlueNodes = append(newBlueNodes, hashChild(blueNodes[blueNodeNum], blueNodes[blueNodeNum+1]))
-				blueNodeNum += 2
-			} else {
-				newBlueNodes = append(newBlueNodes, determineOrder2Hash(indMap[value], v-indMap[value], blueNodes[blueNodeNum], proof[proofNum]))
-				blueNodeNum++
-				proofNum++
-			}
-		}
-		blueNodes = newBlueNodes
-		newBlueNodes = nil
-		blueNodeNum = 0
-		indMap = make(map[uint64]int)
-		pairs = nil
-		leavesPerLayer /= 2
-		currentLayer += leavesPerLayer
-		prevIndices = nil
+	if height := core.Height(treeLength); height != c.treeHeight {
+		return invalidProof(ReasonTreeHeight, "the proof is of a tree of height %d, but height %d is pinned", height, c.treeHeight)
 	}
-	if blueNodes[0] == root {
-		return true, nil
+	return nil
+}
+
+// proofRoot returns the root reconstructed from the chunks of the multiproof at the given sorted leaf indices
+// and its hashes, in a tree of treeLength nodes.
+func proofRoot(cfg config, chunkIndices []uint64, multiproof *CompactMultiProof, treeLength int) ([32]byte, error) {
+	root, err := core.Root(cfg.node, chunkIndices, multiproof.Chunks, multiproof.Proof, treeLength)
+	var count *core.CountError
+	if errors.As(err, &count) {
+		if count.Hashes {
+			return root, invalidProof(ReasonHashCount, "%s", count)
+		}
+		return root, invalidProof(ReasonChunkCount, "%s", count)
 	}
-	return false, nil
+	return root, err
 }
 
 // VerifyCompactMultiProof return whether the multi proof provided is true or false.
 // The proof type can be absence or presence
-func VerifyCompactMultiProof(element, seedValue []byte, multiproof *CompactMultiProof, root [32]byte, bf BloomFilter) (bool, error) {
-	// find length of the tree
+func VerifyCompactMultiProof(element, seedValue []byte, multiproof *CompactMultiProof, root [32]byte, bf BloomFilter, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if isEmptyFilter(bf) {
+		return verifyEmptyProof(multiproof, root, cfg)
+	}
+	treeLength, err := filterTreeLength(bf, cfg.chunkSize)
+	if err != nil {
+		return false, err
+	}
+	return verifyCompactMultiProof(element, seedValue, multiproof, root, bf, treeLength, cfg.chunkIndices, cfg)
+}
+
+// filterTreeLength returns the number of nodes of the tree built from the bloom filter with the given chunk size.
+func filterTreeLength(bf BloomFilter, chunkSize int) (int, error) {
 	dbfBytes := len(bf.BitArray().Bytes())
 	if dbfBytes == 0 {
-		return false, errors.New("there was no bloom filter provided")
-	}
-	treeLeafs := int(math.Exp2(math.Ceil(math.Log2(float64(dbfBytes) / float64(chunkSize/64)))))
-	treeLength := (treeLeafs * 2) - 1
-	elemIndices := bf.MapElementToBF(element, seedValue)
-	elemIndicesCopy := elemIndices
-	if CheckProofType(multiproof.ProofType) {
-		sort.Slice(elemIndices, func(i, j int) bool { return elemIndices[i] < elemIndices[j] })
-		chunkIndices := computeChunkIndices(elemIndices)
-		present := checkChunkPresence(elemIndices, bf.BitArray())
-		if present != true {
-			return false, errors.New("the element is not inside the provided chunks for a presence proof")
-		}
-		verify, err := verifyProof(chunkIndices, multiproof, root, treeLength)
-		if err != nil {
-			return false, err
-		}
-		return verify, nil //verify, err
+		return 0, errors.New("there was no bloom filter provided")
 	}
-	index := []uint{elemIndicesCopy[int(multiproof.ProofType)]}
-	chunkIndices := computeChunkIndices(index)
+	return core.TreeLength(dbfBytes, chunkSize), nil
+}
 
-	present := checkChunkPresence(index, bf.BitArray())
-	if present == true {
-		return false, errors.New("the element cannot be inside the provided chunk for an absence proof")
+// verifyCompactMultiProof verifies a proof against a tree of treeLength nodes, where
+// chunkIndicesFn maps bloom filter indices to the leaf indices of the tree.
+func verifyCompactMultiProof(element, seedValue []byte, multiproof *CompactMultiProof, root [32]byte, bf BloomFilter,
+	treeLength int, chunkIndicesFn func([]uint) []uint64, cfg config) (bool, error) {
+	if multiproof.ChunkSize != 0 && multiproof.ChunkSize != cfg.chunkSize {
+		return false, chunkSizeMismatch(multiproof.ChunkSize, cfg.chunkSize)
 	}
-	verify, err := verifyProof(chunkIndices, multiproof, root, treeLength)
+	index, err := provenIndices(bf.MapElementToBF(element, seedValue), multiproof.ProofType, multiproof.AbsentIndices, bf, cfg)
+	if err != nil {
+		return false, err
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i] < index[j] })
+	chunkIndices := chunkIndicesFn(index)
+	verify, err := verifyProof(cfg, chunkIndices, multiproof, root, treeLength)
 	if err != nil {
 		return false, err
 	}
 	return verify, nil //verify, err
 }
+
+// provenIndices checks the bloom filter bits of an element against the proof type and
+// returns the bloom filter indices whose chunks the proof has to contain.
+func provenIndices(elemIndices []uint, proofType ProofType, absentIndices []uint8, bf BloomFilter, cfg config) ([]uint, error) {
+	elemIndices, _, err := cfg.fitIndices(elemIndices, uint64(bf.BitArray().Len()))
+	if err != nil {
+		return nil, err
+	}
+	if CheckProofType(proofType) {
+		if !checkChunkPresence(elemIndices, bf.BitArray()) {
+			return nil, invalidProof(ReasonChunkMismatch, "the element is not inside the provided chunks for a presence proof")
+		}
+		return elemIndices, nil
+	}
+	index, err := absenceIndices(elemIndices, proofType, absentIndices, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range index {
+		if bf.BitArray().Test(v) {
+			return nil, invalidProof(ReasonChunkMismatch, "the element cannot be inside the provided chunk for an absence proof")
+		}
+	}
+	return index, nil
+}
+
+// absenceIndices returns the element indices an absence proof claims to point to zero bits.
+func absenceIndices(elemIndices []uint, proofType ProofType, absentIndices []uint8, cfg config) ([]uint, error) {
+	positions := absentIndices
+	if len(positions) == 0 {
+		positions = []uint8{uint8(proofType)}
+	} else if Absence(positions[0]) != proofType {
+		return nil, invalidProof(ReasonProofType, "the absent indices do not start with the proof type")
+	}
+	if len(positions) < cfg.minAbsentIndices {
+		return nil, invalidProof(ReasonProofType, "the absence proof has %d zero indices, but %d are required", len(positions), cfg.minAbsentIndices)
+	}
+	index := make([]uint, len(positions))
+	for i, position := range positions {
+		if int(position) >= len(elemIndices) {
+			return nil, invalidProof(ReasonProofType, "the absent index %d exceeds the number of element indices", position)
+		}
+		if i > 0 && position <= positions[i-1] {
+			return nil, invalidProof(ReasonProofType, "the absent indices must be strictly increasing")
+		}
+		index[i] = elemIndices[position]
+	}
+	return index, nil
+}
@@ -0,0 +1,41 @@
+package bloomtree
+
+import "fmt"
+
+// ProofType tells whether a compact multiproof proves the presence or the absence of an element.
+// An absence proof carries the position, among the element indices, of a zero bit of the bloom filter.
+type ProofType uint8
+
+// Presence is the proof type of presence proofs. Positions of absence proofs are always smaller,
+// as the number of hash functions of the bloom filter must be smaller than maxK.
+const Presence = ProofType(maxK)
+
+// Absence returns the proof type of an absence proof for the zero bit at position i of the element indices.
+func Absence(i uint8) ProofType {
+	return ProofType(i)
+}
+
+// IsPresence returns whether the proof type is a presence proof.
+func (t ProofType) IsPresence() bool {
+	return t == Presence
+}
+
+// IsAbsence returns whether the proof type is an absence proof.
+func (t ProofType) IsAbsence() bool {
+	return t != Presence
+}
+
+// AbsenceIndex returns the position of the zero bit among the element indices, and false for presence proofs.
+func (t ProofType) AbsenceIndex() (uint8, bool) {
+	if t.IsPresence() {
+		return 0, false
+	}
+	return uint8(t), true
+}
+
+func (t ProofType) String() string {
+	if t.IsPresence() {
+		return "presence"
+	}
+	return fmt.Sprintf("absence(%d)", uint8(t))
+}
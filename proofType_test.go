@@ -0,0 +1,32 @@
+package bloomtree
+
+import "testing"
+
+func TestProofType(t *testing.T) {
+	var tests = []struct {
+		proofType ProofType
+		presence  bool
+		index     uint8
+		str       string
+	}{
+		{proofType: Presence, presence: true, str: "presence"},
+		{proofType: Absence(0), presence: false, index: 0, str: "absence(0)"},
+		{proofType: Absence(254), presence: false, index: 254, str: "absence(254)"},
+	}
+
+	for _, test := range tests {
+		if test.proofType.IsPresence() != test.presence || test.proofType.IsAbsence() == test.presence {
+			t.Fatalf("unexpected presence of proof type %v", test.proofType)
+		}
+		if CheckProofType(test.proofType) != test.presence {
+			t.Fatalf("CheckProofType(%v) != %t", test.proofType, test.presence)
+		}
+		index, ok := test.proofType.AbsenceIndex()
+		if ok == test.presence || index != test.index {
+			t.Fatalf("unexpected absence index %d, %t of proof type %v", index, ok, test.proofType)
+		}
+		if test.proofType.String() != test.str {
+			t.Fatalf("expected %s, but got %s", test.str, test.proofType.String())
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package bloomtree
 
 import (
+	"context"
 	"errors"
 	"testing"
+
+	"github.com/labbloom/DBF"
 )
 
 func TestPresenceProofPresentElement(t *testing.T) {
@@ -194,3 +197,250 @@ func TestAbsenceProofPresentElement(t *testing.T) {
 		}
 	}
 }
+
+func TestAbsenceProofMultipleIndices(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{0}, []byte{1})
+	var tests = []struct {
+		absentIndices int
+		element       []byte
+	}{
+		{absentIndices: 2, element: []byte{2}},
+		{absentIndices: 3, element: []byte{3}},
+		{absentIndices: 10, element: []byte{4}},
+	}
+
+	for _, test := range tests {
+		tree, err := NewBloomTree(dbf, WithAbsentIndices(test.absentIndices))
+		if err != nil {
+			t.Fatal(err)
+		}
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zeros := 0
+		for _, v := range dbf.GetElementIndices(test.element) {
+			if !dbf.BitArray().Test(v) {
+				zeros++
+			}
+		}
+		expected := test.absentIndices
+		if zeros < expected {
+			expected = zeros
+		}
+		if len(multiproof.AbsentIndices) != expected {
+			t.Fatalf("expected %d absent indices, but got %v", expected, multiproof.AbsentIndices)
+		}
+
+		absent, err := VerifyCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf, WithMinAbsentIndices(expected))
+		if err != nil {
+			t.Fatal(err)
+		} else if !absent {
+			t.Fatal("expected element to be absent, but is present")
+		}
+		_, err = VerifyCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf, WithMinAbsentIndices(expected+1))
+		if err == nil {
+			t.Fatalf("expected error for proof with fewer than %d zero indices", expected+1)
+		}
+	}
+}
+
+func TestAbsenceProofMalformedAbsentIndices(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{0}, []byte{1})
+	tree, err := NewBloomTree(dbf, WithAbsentIndices(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = [][]uint8{
+		{1, 0},
+		{0, 0},
+		{0, 200},
+	}
+
+	for _, absentIndices := range tests {
+		multiproof, err := tree.GenerateCompactMultiProof([]byte{3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		multiproof.AbsentIndices = absentIndices
+		multiproof.ProofType = Absence(absentIndices[0])
+		if _, err := VerifyCompactMultiProof([]byte{3}, []byte(seed), multiproof, tree.Root(), dbf); err == nil {
+			t.Fatalf("expected error for absent indices %v", absentIndices)
+		}
+	}
+	if _, err := NewBloomTree(dbf, WithAbsentIndices(0)); err == nil {
+		t.Fatal("expected error for absence proofs without zero indices")
+	}
+}
+
+func TestVerificationError(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{0}, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name    string
+		element []byte
+		tamper  func(p *CompactMultiProof)
+		reason  FailureReason
+	}{
+		{"presence claimed for absent element", []byte{9}, func(p *CompactMultiProof) { p.ProofType = Presence }, ReasonChunkMismatch},
+		{"absence claimed for present element", []byte{1}, func(p *CompactMultiProof) { p.ProofType = Absence(0) }, ReasonChunkMismatch},
+		{"proof type out of range", []byte{9}, func(p *CompactMultiProof) { p.ProofType = Absence(100) }, ReasonProofType},
+		{"chunk size of another tree", []byte{1}, func(p *CompactMultiProof) { p.ChunkSize = 128 }, ReasonChunkSize},
+		{"missing hash", []byte{1}, func(p *CompactMultiProof) { p.Proof = p.Proof[1:] }, ReasonHashCount},
+		{"extra hash", []byte{1}, func(p *CompactMultiProof) { p.Proof = append(p.Proof, [32]byte{1}) }, ReasonHashCount},
+		{"extra chunk", []byte{1}, func(p *CompactMultiProof) { p.Chunks = append(p.Chunks, [32]byte{1}) }, ReasonChunkCount},
+		{"no chunks", []byte{1}, func(p *CompactMultiProof) { p.Chunks = nil }, ReasonChunkCount},
+	}
+
+	for _, test := range tests {
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(multiproof)
+		_, err = VerifyCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf)
+		var verr *VerificationError
+		if !errors.As(err, &verr) || verr.Reason != test.reason {
+			t.Fatalf("%s: expected a verification error with reason %v, but got %v", test.name, test.reason, err)
+		}
+		if !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("%s: expected %v to match ErrInvalidProof", test.name, err)
+		}
+	}
+
+	// a well-formed proof against another root is a root mismatch
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	root[0] ^= 1
+	verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, root, dbf)
+	var verr *VerificationError
+	if verified || !errors.As(err, &verr) || verr.Reason != ReasonRootMismatch {
+		t.Fatalf("expected a root mismatch, but got %t, %v", verified, err)
+	}
+}
+
+func TestNewCompactMultiProof(t *testing.T) {
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range [][]byte{{1}, {3}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := NewCompactMultiProof(multiproof.Chunks, multiproof.Hashes(), multiproof.Type())
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), decoded, tree.Root(), dbf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify decoded proof for element %v", elem)
+		}
+		if len(decoded.Chunks) != 0 {
+			decoded.Chunks[0][0]++
+			if decoded.Chunks[0] == multiproof.Chunks[0] {
+				t.Fatal("expected chunks to be copied")
+			}
+		}
+	}
+}
+
+func TestVerifyChunkHashes(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := dbf.BitArray().Bytes()
+	chunkIndices := []uint64{2, 2, 7}
+	chunks := [][32]byte{HashChunk(2, words[2]), HashChunk(7, words[7])}
+	proof, err := tree.generateProof(context.Background(), chunkIndices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		chunkIndices []uint64
+		treeLength   int
+		verified     bool
+		err          bool
+	}{
+		{chunkIndices: chunkIndices, treeLength: len(tree.nodes), verified: true},
+		{chunkIndices: []uint64{2, 2, 6}, treeLength: len(tree.nodes), err: true},
+		{chunkIndices: chunkIndices, treeLength: 30, err: true},
+		{chunkIndices: []uint64{2, 16}, treeLength: len(tree.nodes), err: true},
+	}
+
+	for _, test := range tests {
+		verified, err := VerifyChunkHashes(test.chunkIndices, chunks, proof, tree.Root(), test.treeLength)
+		if (err != nil) != test.err {
+			t.Fatalf("unexpected error %v for chunk indices %v", err, test.chunkIndices)
+		}
+		if verified != test.verified {
+			t.Fatalf("expected verification %t for chunk indices %v", test.verified, test.chunkIndices)
+		}
+	}
+}
+
+func TestPinnedTreeHeight(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	large := generateDBF(1000, seed, []byte{1})
+	small := generateDBF(20, seed, []byte{1})
+	heights := make(map[*DBF.DistBF]int)
+	for _, dbf := range []*DBF.DistBF{large, small} {
+		treeLength, err := filterTreeLength(dbf, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := (treeLength + 1) / 2; n > 1; n /= 2 {
+			heights[dbf]++
+		}
+	}
+	if heights[large] == heights[small] {
+		t.Fatal("expected the trees to have different heights")
+	}
+	if _, err := newConfig([]Option{WithTreeHeight(-1)}); err == nil {
+		t.Fatal("expected error for a negative tree height")
+	}
+
+	for _, dbf := range []*DBF.DistBF{large, small} {
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, elem := range [][]byte{{1}, {42}} {
+			proof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), proof, tree.Root(), dbf, WithTreeHeight(heights[dbf]))
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify the proof of %v with the height of its tree pinned", elem)
+			}
+			// a verifier expecting the large tree rejects the proof of the small one and vice versa
+			other := heights[large] + heights[small] - heights[dbf]
+			var verr *VerificationError
+			_, err = VerifyCompactMultiProof(elem, []byte(seed), proof, tree.Root(), dbf, WithTreeHeight(other))
+			if !errors.As(err, &verr) || verr.Reason != ReasonTreeHeight {
+				t.Fatalf("expected ReasonTreeHeight for a proof of a tree of height %d with height %d pinned, but got %v", heights[dbf], other, err)
+			}
+		}
+	}
+}
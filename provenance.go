@@ -0,0 +1,185 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Provenance tells which build of a bloom filter a chunk of a proof came from. It is metadata of the tree
+// that generated the proof and is not committed to by the root, so it lets caches holding proofs of several
+// versions of a filter spot proofs mixing chunks of different builds, but it is only as trustworthy as the
+// prover.
+type Provenance struct {
+	// Version is the version of the bloom filter when the chunk was hashed, see WithProvenance.
+	Version uint64
+	// Built is the time the chunk was hashed, in UTC.
+	Built time.Time
+}
+
+// WithProvenance records the provenance of every chunk of the tree, i.e. the given version of its bloom filter
+// and the time the chunk was hashed, and annotates the chunks of proofs with it. Chunks rehashed by updates get
+// the version set by SetFilterVersion and the time of the update. Provenance takes 32 bytes per leaf, it is
+// kept by snapshots, but not by the encodings of the tree. Only the JSON encodings of proofs carry it.
+func WithProvenance(version uint64) Option {
+	return func(c *config) error {
+		c.provenance, c.filterVersion = true, version
+		return nil
+	}
+}
+
+// chunkProvenance holds the provenance of every leaf of a tree, and the version of the next updates.
+type chunkProvenance struct {
+	version uint64
+	chunks  []Provenance
+}
+
+// newProvenance returns the provenance of the given number of leafs hashed now, or nil if the tree does not
+// record provenance.
+func (c config) newProvenance(leafs int) *chunkProvenance {
+	if !c.provenance {
+		return nil
+	}
+	p := &chunkProvenance{version: c.filterVersion, chunks: make([]Provenance, leafs)}
+	built := time.Now().UTC()
+	for i := range p.chunks {
+		p.chunks[i] = Provenance{Version: c.filterVersion, Built: built}
+	}
+	return p
+}
+
+// clone returns a copy of the provenance, which may be nil.
+func (p *chunkProvenance) clone() *chunkProvenance {
+	if p == nil {
+		return nil
+	}
+	return &chunkProvenance{version: p.version, chunks: append([]Provenance(nil), p.chunks...)}
+}
+
+// SetFilterVersion sets the version of the bloom filter recorded for the chunks rehashed by later updates,
+// e.g. after applying the changes of a new release of a blocklist. The tree must be built with WithProvenance.
+func (bt *BloomTree) SetFilterVersion(version uint64) error {
+	if bt.frozen {
+		return ErrFrozen
+	}
+	if bt.provenance == nil {
+		return errors.New("the tree does not record provenance, see WithProvenance")
+	}
+	bt.provenance.version = version
+	return nil
+}
+
+// ChunkProvenance returns the provenance of the chunk, and false if the tree does not record provenance or the
+// chunk does not exist.
+func (bt *BloomTree) ChunkProvenance(chunk uint64) (Provenance, bool) {
+	if bt.provenance == nil || chunk >= uint64(len(bt.provenance.chunks)) {
+		return Provenance{}, false
+	}
+	return bt.provenance.chunks[chunk], true
+}
+
+// touchProvenance records the current version and time as the provenance of the rehashed leafs.
+func (bt *BloomTree) touchProvenance(dirty map[uint64]bool) {
+	if bt.provenance == nil {
+		return
+	}
+	built := time.Now().UTC()
+	for leaf := range dirty {
+		if leaf < uint64(len(bt.provenance.chunks)) {
+			bt.provenance.chunks[leaf] = Provenance{Version: bt.provenance.version, Built: built}
+		}
+	}
+}
+
+// proofProvenance returns the provenance of the distinct sorted chunk indices, or nil if the tree does not
+// record provenance.
+func (bt *BloomTree) proofProvenance(chunkIndices []uint64) []Provenance {
+	if bt.provenance == nil {
+		return nil
+	}
+	var ret []Provenance
+	for i, index := range chunkIndices {
+		if i > 0 && index == chunkIndices[i-1] {
+			continue
+		}
+		p, _ := bt.ChunkProvenance(index)
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// Builds returns the distinct builds the chunks of the proof came from, in the order of their first chunk. A
+// proof with more than one build mixes chunks of different versions or updates of the bloom filter, e.g. when
+// a cache assembled it from several versions. It is nil for proofs without provenance.
+func (p *CompactMultiProof) Builds() []Provenance {
+	return distinctBuilds(p.Provenance)
+}
+
+// Builds returns the distinct builds the chunks of the batch proof came from, see CompactMultiProof.Builds.
+func (p *BatchMultiProof) Builds() []Provenance {
+	return distinctBuilds(p.Provenance)
+}
+
+func distinctBuilds(provenance []Provenance) []Provenance {
+	var builds []Provenance
+	for _, p := range provenance {
+		seen := false
+		for _, b := range builds {
+			if b.Version == p.Version && b.Built.Equal(p.Built) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			builds = append(builds, p)
+		}
+	}
+	return builds
+}
+
+// provenanceJSON is the JSON form of a provenance. The version is a decimal string, as canonical JSON numbers
+// cannot exceed 2^53-1.
+type provenanceJSON struct {
+	Version string `json:"version"`
+	Built   string `json:"built"`
+}
+
+// canonicalProvenance returns the provenance in the form of canonical JSON values.
+func canonicalProvenance(provenance []Provenance) []interface{} {
+	ret := make([]interface{}, len(provenance))
+	for i, p := range provenance {
+		ret[i] = map[string]interface{}{
+			"version": strconv.FormatUint(p.Version, 10),
+			"built":   p.Built.UTC().Format(time.RFC3339Nano),
+		}
+	}
+	return ret
+}
+
+func encodeProvenance(provenance []Provenance) []provenanceJSON {
+	var ret []provenanceJSON
+	for _, p := range provenance {
+		ret = append(ret, provenanceJSON{
+			Version: strconv.FormatUint(p.Version, 10),
+			Built:   p.Built.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return ret
+}
+
+func decodeProvenance(aux []provenanceJSON) ([]Provenance, error) {
+	var ret []Provenance
+	for _, p := range aux {
+		version, err := strconv.ParseUint(p.Version, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", p.Version)
+		}
+		built, err := time.Parse(time.RFC3339Nano, p.Built)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build time %q", p.Built)
+		}
+		ret = append(ret, Provenance{Version: version, Built: built.UTC()})
+	}
+	return ret, nil
+}
@@ -0,0 +1,109 @@
+package bloomtree
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithProvenance(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := NewBloomTree(generateDBF(1000, seed, []byte{1}, []byte{2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != plain.Root() {
+		t.Fatal("provenance must not change the root")
+	}
+	if err := plain.SetFilterVersion(2); err == nil {
+		t.Fatal("expected error setting the filter version of a tree without provenance")
+	}
+	built, ok := tree.ChunkProvenance(0)
+	if !ok || built.Version != 1 || built.Built.IsZero() {
+		t.Fatalf("expected version 1 and a build time of chunk 0, got %+v", built)
+	}
+
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Provenance) != len(proof.ChunkWords) {
+		t.Fatalf("expected the provenance of %d chunks, got %d", len(proof.ChunkWords), len(proof.Provenance))
+	}
+	if builds := proof.Builds(); len(builds) != 1 || builds[0].Version != 1 {
+		t.Fatalf("expected a single build of version 1, got %+v", builds)
+	}
+	// the provenance survives the JSON encoding, and is not needed to verify the proof
+	data, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CompactMultiProof
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if builds := decoded.Builds(); len(builds) != 1 || builds[0].Version != 1 || !builds[0].Built.Equal(built.Built) {
+		t.Fatalf("expected the build %+v after decoding, got %+v", built, builds)
+	}
+	verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), &decoded, tree.Root(), dbf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !verified {
+		t.Fatal("failed to verify the proof with provenance")
+	}
+
+	// updated chunks get the new version, snapshots keep the old one
+	snapshot, err := tree.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.SetFilterVersion(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Update([]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	var updated []uint64
+	for _, v := range dbf.GetElementIndices([]byte{3}) {
+		chunk := uint64(v) / 64
+		if p, _ := tree.ChunkProvenance(chunk); p.Version != 2 || p.Built.Before(built.Built) {
+			t.Fatalf("expected version 2 of updated chunk %d, got %+v", chunk, p)
+		}
+		if p, _ := snapshot.ChunkProvenance(chunk); p.Version != 1 {
+			t.Fatalf("expected version 1 of chunk %d in the snapshot, got %+v", chunk, p)
+		}
+		updated = append(updated, chunk)
+	}
+
+	// a batch of an updated and an untouched chunk mixes two builds
+	var untouched []byte
+	for i := 10; i < 255 && untouched == nil; i++ {
+		elem := []byte{byte(i)}
+		fresh := true
+		for _, v := range dbf.GetElementIndices(elem) {
+			for _, chunk := range updated {
+				fresh = fresh && uint64(v)/64 != chunk
+			}
+		}
+		if fresh {
+			untouched = elem
+		}
+	}
+	batch, err := tree.GenerateCompactMultiProofBatch([][]byte{{3}, untouched})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builds := batch.Builds(); len(builds) != 2 {
+		t.Fatalf("expected the batch to mix 2 builds, got %+v", builds)
+	}
+	if frozen, err := tree.Freeze(); err != nil {
+		t.Fatal(err)
+	} else if err := frozen.SetFilterVersion(3); err != ErrFrozen {
+		t.Fatalf("expected ErrFrozen setting the filter version of a frozen tree, got %v", err)
+	}
+}
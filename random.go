@@ -0,0 +1,34 @@
+package bloomtree
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// randomSize is the number of random bytes of generated blinding keys and seeds.
+const randomSize = 32
+
+// NewBlindingKey returns a random key for WithBlinding, read from r. A nil r reads from crypto/rand.Reader, so
+// deterministic tests, HSM-backed generators and FIPS validated sources can be plugged in where needed.
+func NewBlindingKey(r io.Reader) ([]byte, error) {
+	return readRandom(r, randomSize)
+}
+
+// NewSeed returns a random seed for a bloom filter, read from r like by NewBlindingKey. Secret seeds keep
+// others from crafting elements that map to chosen bloom filter indices.
+func NewSeed(r io.Reader) ([]byte, error) {
+	return readRandom(r, randomSize)
+}
+
+// readRandom reads n random bytes from r, or from crypto/rand.Reader if r is nil.
+func readRandom(r io.Reader, n int) ([]byte, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("reading randomness: %w", err)
+	}
+	return b, nil
+}
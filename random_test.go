@@ -0,0 +1,55 @@
+package bloomtree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRandomSource(t *testing.T) {
+	deterministic := bytes.Repeat([]byte{7}, 2*randomSize)
+	var tests = []struct {
+		name string
+		fn   func(r io.Reader) ([]byte, error)
+	}{
+		{"blinding key", NewBlindingKey},
+		{"seed", NewSeed},
+	}
+	for _, test := range tests {
+		a, err := test.fn(bytes.NewReader(deterministic))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := test.fn(bytes.NewReader(deterministic))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) || !bytes.Equal(a, deterministic[:randomSize]) {
+			t.Fatalf("expected the %s to be read from the given reader, but got %x", test.name, a)
+		}
+		if _, err := test.fn(bytes.NewReader(deterministic[:randomSize-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected io.ErrUnexpectedEOF for a short reader of the %s, but got %v", test.name, err)
+		}
+		c, err := test.fn(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := test.fn(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c) != randomSize || bytes.Equal(c, d) {
+			t.Fatalf("expected distinct %s of %d bytes from crypto/rand, but got %x and %x", test.name, randomSize, c, d)
+		}
+	}
+
+	// generated blinding keys are accepted by WithBlinding
+	key, err := NewBlindingKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBloomTree(generateDBF(200, "secret seed", []byte{1}), WithBlinding(key)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,244 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// EmptinessProof proves that the chunks [Start, End) of a bloom tree are all-zero.
+type EmptinessProof struct {
+	Start uint64
+	End   uint64
+	// Proof are the hashes needed to reconstruct the bloom tree root.
+	Proof [][32]byte
+}
+
+// PopcountNode is a node of the popcount sum tree, committing to the number of set bits below it.
+type PopcountNode struct {
+	Count uint64
+	Hash  [32]byte
+}
+
+// SaturationClaim claims the total number of set bits in a bloom filter under a popcount root. The popcount
+// root is published next to the root of the bloom tree and is not part of it, so a claim only shows that the
+// count is the one the publisher committed to, not that it is right. Saturation claims follow a fraud proof
+// model: the popcount root binds the root of the bloom tree and the leafs of the popcount sum tree bind the leaf
+// hashes of the bloom tree, so anyone holding the bloom filter can show a wrong count with a PopcountFraudProof,
+// given the PopcountProof of the chunk, which the publisher has to serve for every chunk.
+type SaturationClaim struct {
+	// Root is the root node of the popcount sum tree.
+	Root PopcountNode
+}
+
+// PopcountProof proves the number of set bits of a single chunk against a popcount root.
+type PopcountProof struct {
+	Chunk uint64
+	Count uint64
+	// Siblings are the sibling nodes on the path from the chunk to the root of the popcount sum tree.
+	Siblings []PopcountNode
+}
+
+// PopcountFraudProof shows that a popcount root commits to a wrong number of set bits of a chunk: the popcount
+// proof of the chunk verifies against the popcount root, but the words of the chunk proven against the root of the
+// bloom tree have another number of set bits.
+type PopcountFraudProof struct {
+	Popcount *PopcountProof
+	// Chunk is the chunk range of the single chunk of the popcount proof.
+	Chunk *ChunkRange
+}
+
+// popcountCache holds the popcount sum tree of a bloom tree, which is computed once per root.
+type popcountCache struct {
+	mu    sync.Mutex
+	root  [32]byte
+	nodes []PopcountNode
+}
+
+// GenerateEmptinessProof returns a proof that the chunks [start, end) of the bloom filter are all-zero.
+func (bt *BloomTree) GenerateEmptinessProof(start, end uint64) (*EmptinessProof, error) {
+	if bt.bounds != nil {
+		return nil, errors.New("emptiness proofs are not supported by adaptive trees")
+	}
+	if bt.cfg.blindingKey != nil {
+		return nil, errors.New("emptiness proofs are not supported by blinded trees")
+	}
+	words := bt.bf.BitArray().Bytes()
+	if start >= end || end > uint64(bt.leafCount(words)) {
+		return nil, fmt.Errorf("invalid chunk range [%d, %d)", start, end)
+	}
+	indices := make([]uint64, 0, end-start)
+	for i := start; i < end; i++ {
+		if popcount(bt.leafWords(words, int(i))) != 0 {
+			return nil, fmt.Errorf("chunk %d is not empty", i)
+		}
+		indices = append(indices, i)
+	}
+	proof, err := bt.generateProof(context.Background(), indices)
+	if err != nil {
+		return nil, err
+	}
+	return &EmptinessProof{
+		Start: start,
+		End:   end,
+		Proof: proof,
+	}, nil
+}
+
+// VerifyEmptinessProof returns whether the proof shows that the chunk range is all-zero
+// in the bloom tree with the given root, built from a bloom filter of filterBits bits.
+func VerifyEmptinessProof(proof *EmptinessProof, root [32]byte, filterBits uint64, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	return verifyChunkRange(proof.Start, proof.End, func(i uint64, n int) []uint64 {
+		return make([]uint64, n)
+	}, proof.Proof, root, filterBits, cfg)
+}
+
+// popcountTree returns the popcount sum tree over the leafs of the bloom tree, using the same node layout as the
+// bloom tree. It is computed once per root of the tree and must not be modified.
+func (bt *BloomTree) popcountTree() []PopcountNode {
+	root := bt.Root()
+	bt.popcounts.mu.Lock()
+	defer bt.popcounts.mu.Unlock()
+	if bt.popcounts.nodes != nil && bt.popcounts.root == root {
+		return bt.popcounts.nodes
+	}
+	words := bt.bf.BitArray().Bytes()
+	leafNum := (bt.nodeCount() + 1) / 2
+	leafs := make([][32]byte, leafNum)
+	counts := make([]uint64, leafNum)
+	for i := range leafs {
+		leafs[i] = bt.node(i)
+		if i < bt.leafCount(words) {
+			counts[i] = popcount(bt.leafWords(words, i))
+		}
+	}
+	bt.popcounts.root, bt.popcounts.nodes = root, bt.cfg.hash.popcountNodes(leafs, counts)
+	return bt.popcounts.nodes
+}
+
+// popcountNodes returns the popcount sum tree of the given leaf hashes of a bloom tree and their popcounts.
+func (h Hash) popcountNodes(leafs [][32]byte, counts []uint64) []PopcountNode {
+	leafNum := len(leafs)
+	nodes := make([]PopcountNode, 2*leafNum-1)
+	for i := range leafs {
+		nodes[i] = PopcountNode{Count: counts[i], Hash: h.popcountLeaf(leafs[i], counts[i])}
+	}
+	for i := leafNum; i < len(nodes); i++ {
+		left, right := nodes[2*(i-leafNum)], nodes[2*(i-leafNum)+1]
+		nodes[i] = PopcountNode{Count: left.Count + right.Count, Hash: h.popcountNode(left, right)}
+	}
+	return nodes
+}
+
+// popcountPath returns the popcount proof of the chunk in the popcount sum tree.
+func popcountPath(nodes []PopcountNode, chunk uint64) *PopcountProof {
+	leafNum := uint64(len(nodes)+1) / 2
+	var siblings []PopcountNode
+	for index := chunk; index < uint64(len(nodes)-1); index = leafNum + index/2 {
+		siblings = append(siblings, nodes[index^1])
+	}
+	return &PopcountProof{
+		Chunk:    chunk,
+		Count:    nodes[chunk].Count,
+		Siblings: siblings,
+	}
+}
+
+// PopcountRoot returns the commitment to the popcount of every chunk of the bloom filter, bound to the root of
+// the tree.
+func (bt *BloomTree) PopcountRoot() [32]byte {
+	nodes := bt.popcountTree()
+	return bt.cfg.hash.popcountRoot(bt.Root(), nodes[len(nodes)-1])
+}
+
+// GenerateSaturationClaim returns the claim of the total number of set bits in the bloom filter under the popcount
+// root of the tree.
+func (bt *BloomTree) GenerateSaturationClaim() *SaturationClaim {
+	nodes := bt.popcountTree()
+	return &SaturationClaim{Root: nodes[len(nodes)-1]}
+}
+
+// VerifySaturationClaim returns whether the claim matches the popcount root of the bloom tree with the given
+// root and claims that the bloom filter has at most maxPopcount set bits. The claim is only as good as the
+// popcount root, which has to be open to PopcountFraudProofs, see SaturationClaim.
+func VerifySaturationClaim(claim *SaturationClaim, root, popcountRoot [32]byte, maxPopcount uint64, opts ...Option) bool {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false
+	}
+	return cfg.hash.popcountRoot(root, claim.Root) == popcountRoot && claim.Root.Count <= maxPopcount
+}
+
+// GeneratePopcountProof returns a proof of the number of set bits in the given chunk.
+func (bt *BloomTree) GeneratePopcountProof(chunk uint64) (*PopcountProof, error) {
+	if chunk >= uint64(bt.leafCount(bt.bf.BitArray().Bytes())) {
+		return nil, fmt.Errorf("chunk %d is out of range", chunk)
+	}
+	return popcountPath(bt.popcountTree(), chunk), nil
+}
+
+// VerifyPopcountProof returns whether the proof shows that the chunk with the given
+// leaf hash has proof.Count set bits under the popcount root of the bloom tree with the given root.
+func VerifyPopcountProof(proof *PopcountProof, leaf, root, popcountRoot [32]byte, opts ...Option) bool {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false
+	}
+	node := PopcountNode{Count: proof.Count, Hash: cfg.hash.popcountLeaf(leaf, proof.Count)}
+	position := proof.Chunk
+	for _, sibling := range proof.Siblings {
+		if position%2 == 0 {
+			node = PopcountNode{Count: node.Count + sibling.Count, Hash: cfg.hash.popcountNode(node, sibling)}
+		} else {
+			node = PopcountNode{Count: node.Count + sibling.Count, Hash: cfg.hash.popcountNode(sibling, node)}
+		}
+		position /= 2
+	}
+	return cfg.hash.popcountRoot(root, node) == popcountRoot
+}
+
+// GeneratePopcountFraudProof returns the fraud proof of a popcount proof served by a publisher, showing that the
+// count of its chunk differs from the chunk of the tree. The tree must have the root the popcount root binds.
+func (bt *BloomTree) GeneratePopcountFraudProof(claimed *PopcountProof) (*PopcountFraudProof, error) {
+	chunk, err := bt.GetChunkRange(claimed.Chunk, claimed.Chunk+1)
+	if err != nil {
+		return nil, err
+	}
+	if popcount(chunk.Words[0]) == claimed.Count {
+		return nil, fmt.Errorf("chunk %d has the claimed popcount %d", claimed.Chunk, claimed.Count)
+	}
+	return &PopcountFraudProof{Popcount: claimed, Chunk: chunk}, nil
+}
+
+// VerifyPopcountFraudProof returns whether the fraud proof shows that the popcount root of the bloom tree with
+// the given root, built from a bloom filter of filterBits bits, commits to a wrong count. An error is returned if
+// the chunk does not verify against the root or the popcount proof does not verify against the popcount root.
+func VerifyPopcountFraudProof(fraud *PopcountFraudProof, root, popcountRoot [32]byte, filterBits uint64, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	chunk, claimed := fraud.Chunk, fraud.Popcount
+	if chunk.Start != claimed.Chunk || chunk.End != claimed.Chunk+1 || len(chunk.Words) != 1 {
+		return false, invalidProof(ReasonChunkCount, "the fraud proof must open chunk %d alone", claimed.Chunk)
+	}
+	if _, err := VerifyChunkRange(chunk, root, filterBits, opts...); err != nil {
+		return false, err
+	}
+	if !VerifyPopcountProof(claimed, cfg.leaf(chunk.Start, chunk.Words[0]...), root, popcountRoot, opts...) {
+		return false, invalidProof(ReasonRootMismatch, "the popcount proof does not match the popcount root")
+	}
+	return popcount(chunk.Words[0]) != claimed.Count, nil
+}
+
+// MaxPopcount returns the largest number of set bits a bloom filter of filterBits bits
+// and numOfHashes hash functions may have without exceeding the false positive rate fpr.
+func MaxPopcount(filterBits uint64, numOfHashes uint, fpr float64) uint64 {
+	return uint64(math.Floor(float64(filterBits) * math.Pow(fpr, 1/float64(numOfHashes))))
+}
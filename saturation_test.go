@@ -0,0 +1,223 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+)
+
+func generateSparseDBF(indices ...int) *DBF.DistBF {
+	dbf := DBF.NewDbf(200, 0.2, []byte("secret seed"))
+	dbf.SetIndices(indices)
+	return dbf
+}
+
+func TestEmptinessProof(t *testing.T) {
+	SetChunkSize(64)
+	var tests = []struct {
+		indices []int
+		start   uint64
+		end     uint64
+	}{
+		{indices: []int{0, 1, 2}, start: 1, end: 11},
+		{indices: []int{0, 640}, start: 1, end: 10},
+		{indices: []int{200}, start: 4, end: 5},
+		{indices: []int{}, start: 0, end: 11},
+	}
+
+	for _, test := range tests {
+		dbf := generateSparseDBF(test.indices...)
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := tree.GenerateEmptinessProof(test.start, test.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyEmptinessProof(proof, tree.Root(), uint64(dbf.BitArray().Len()))
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify emptiness of chunks [%d, %d)", test.start, test.end)
+		}
+	}
+}
+
+func TestEmptinessProofNonEmptyChunk(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateSparseDBF(0, 130)
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GenerateEmptinessProof(1, 4); err == nil {
+		t.Fatal("expected error for non-empty chunk 2")
+	}
+	if _, err := tree.GenerateEmptinessProof(4, 20); err == nil {
+		t.Fatal("expected error for chunk range exceeding the tree")
+	}
+
+	// a proof for empty chunks must not verify against a tree where one of them is set
+	proof, err := tree.GenerateEmptinessProof(3, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.Start, proof.End = 2, 5
+	if verified, err := VerifyEmptinessProof(proof, tree.Root(), uint64(dbf.BitArray().Len())); !errors.Is(err, ErrInvalidProof) || verified {
+		t.Fatalf("expected emptiness proof of a non-empty range to fail, got %t, %v", verified, err)
+	}
+}
+
+func TestSaturationClaim(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", [][]byte{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}...)
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := uint64(dbf.BitArray().Count())
+	claim := tree.GenerateSaturationClaim()
+	if claim.Root.Count != count {
+		t.Fatalf("expected popcount %d, but got %d", count, claim.Root.Count)
+	}
+	if !VerifySaturationClaim(claim, tree.Root(), tree.PopcountRoot(), count) {
+		t.Fatal("failed to verify saturation claim")
+	}
+	if VerifySaturationClaim(claim, tree.Root(), tree.PopcountRoot(), count-1) {
+		t.Fatal("expected saturation claim to exceed the bound")
+	}
+	// the popcount root is bound to the root of the tree
+	if VerifySaturationClaim(claim, [32]byte{1}, tree.PopcountRoot(), count) {
+		t.Fatal("expected saturation claim against another tree root to fail")
+	}
+	other, err := NewBloomTree(generateDBF(200, "secret seed", []byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifySaturationClaim(other.GenerateSaturationClaim(), other.Root(), tree.PopcountRoot(), count) {
+		t.Fatal("expected saturation claim of another tree to fail")
+	}
+	claim.Root.Count--
+	if VerifySaturationClaim(claim, tree.Root(), tree.PopcountRoot(), count) {
+		t.Fatal("expected tampered saturation claim to fail")
+	}
+
+	// the popcount sum tree is computed once per root
+	if nodes := tree.popcountTree(); &nodes[0] != &tree.popcountTree()[0] {
+		t.Fatal("expected the popcount sum tree to be cached")
+	}
+	if err := tree.Update([]byte{9}); err != nil {
+		t.Fatal(err)
+	}
+	if claim := tree.GenerateSaturationClaim(); claim.Root.Count != uint64(dbf.BitArray().Count()) || claim.Root.Count == count {
+		t.Fatalf("expected popcount %d after the update, but got %d", dbf.BitArray().Count(), claim.Root.Count)
+	}
+}
+
+func TestPopcountFraudProof(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", [][]byte{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}...)
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterBits := uint64(dbf.BitArray().Len())
+
+	// a publisher understating the popcount of a chunk under its popcount root
+	nodes := tree.popcountTree()
+	leafNum := (len(nodes) + 1) / 2
+	leafs := make([][32]byte, leafNum)
+	counts := make([]uint64, leafNum)
+	for i := range leafs {
+		leafs[i], counts[i] = tree.node(i), nodes[i].Count
+	}
+	counts[1]--
+	lying := SHA512_256.popcountNodes(leafs, counts)
+	popcountRoot := SHA512_256.popcountRoot(tree.Root(), lying[len(lying)-1])
+	claimed := popcountPath(lying, 1)
+	if !VerifySaturationClaim(&SaturationClaim{Root: lying[len(lying)-1]}, tree.Root(), popcountRoot, nodes[len(nodes)-1].Count-1) {
+		t.Fatal("expected the understated saturation claim to verify")
+	}
+
+	fraud, err := tree.GeneratePopcountFraudProof(claimed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrong, err := VerifyPopcountFraudProof(fraud, tree.Root(), popcountRoot, filterBits); err != nil || !wrong {
+		t.Fatalf("expected the fraud proof to show a wrong popcount, got %t, %v", wrong, err)
+	}
+	if _, err := VerifyPopcountFraudProof(fraud, tree.Root(), tree.PopcountRoot(), filterBits); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected the popcount proof to fail against another popcount root, got %v", err)
+	}
+	if _, err := VerifyPopcountFraudProof(fraud, [32]byte{1}, popcountRoot, filterBits); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected the chunk to fail against another tree root, got %v", err)
+	}
+
+	// proofs of the right popcount are no fraud
+	honest, err := tree.GeneratePopcountProof(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GeneratePopcountFraudProof(honest); err == nil {
+		t.Fatal("expected no fraud proof of the right popcount")
+	}
+	fraud.Popcount = honest
+	if wrong, err := VerifyPopcountFraudProof(fraud, tree.Root(), tree.PopcountRoot(), filterBits); err != nil || wrong {
+		t.Fatalf("expected the right popcount not to be shown wrong, got %t, %v", wrong, err)
+	}
+}
+
+func TestPopcountProof(t *testing.T) {
+	SetChunkSize(128)
+	defer SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", [][]byte{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}...)
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	popcountRoot := tree.PopcountRoot()
+	words := dbf.BitArray().Bytes()
+	for chunk := 0; chunk < tree.leafCount(words); chunk++ {
+		proof, err := tree.GeneratePopcountProof(uint64(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Count != popcount(tree.leafWords(words, chunk)) {
+			t.Fatalf("unexpected popcount %d for chunk %d", proof.Count, chunk)
+		}
+		if !VerifyPopcountProof(proof, tree.nodes[chunk], tree.Root(), popcountRoot) {
+			t.Fatalf("failed to verify popcount of chunk %d", chunk)
+		}
+		if VerifyPopcountProof(proof, tree.nodes[chunk], [32]byte{1}, popcountRoot) {
+			t.Fatalf("expected popcount of chunk %d against another tree root to fail", chunk)
+		}
+		proof.Count++
+		if VerifyPopcountProof(proof, tree.nodes[chunk], tree.Root(), popcountRoot) {
+			t.Fatalf("expected tampered popcount of chunk %d to fail", chunk)
+		}
+	}
+	if _, err := tree.GeneratePopcountProof(uint64(tree.leafCount(words))); err == nil {
+		t.Fatal("expected error for chunk out of range")
+	}
+}
+
+func TestMaxPopcount(t *testing.T) {
+	var tests = []struct {
+		filterBits  uint64
+		numOfHashes uint
+		fpr         float64
+		max         uint64
+	}{
+		{filterBits: 1000, numOfHashes: 1, fpr: 0.1, max: 100},
+		{filterBits: 1000, numOfHashes: 2, fpr: 0.25, max: 500},
+		{filterBits: 670, numOfHashes: 3, fpr: 0.125, max: 335},
+	}
+
+	for _, test := range tests {
+		if max := MaxPopcount(test.filterBits, test.numOfHashes, test.fpr); max != test.max {
+			t.Fatalf("expected max popcount %d, but got %d", test.max, max)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package sbt provides the API of the previous sbt release on top of package bloomtree, so code written
+// against it can be upgraded incrementally. Trees are built from a bit set, and proofs are requested for
+// bit indices rather than elements.
+//
+// Every function logs a deprecation notice naming its replacement the first time it is called, see Notice.
+// Tree returns the underlying *bloomtree.BloomTree, so callers can move to the new API one call at a time.
+// Proofs are bloomtree proofs whose element is the list of proven indices, see Element.
+//
+// Deprecated: use package bloomtree, with a bloom filter implementing bloomtree.BloomFilter, e.g. one of
+// package adapters.
+package sbt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/adapters"
+	"github.com/willf/bitset"
+)
+
+// maxIndices is the maximum number of indices of a proof, as absence proofs point to the unset index by its
+// position, which must be smaller than the maximum number of hash functions.
+const maxIndices = 254
+
+// Notice is called with the deprecation notice of every function of the package on its first call. It
+// defaults to log.Printf, set it to nil to silence the notices.
+var Notice = log.Printf
+
+// notified holds the names of the functions whose notice was given.
+var notified sync.Map
+
+// deprecated gives the notice of the named function once.
+func deprecated(name, replacement string) {
+	if _, done := notified.LoadOrStore(name, true); done || Notice == nil {
+		return
+	}
+	Notice("bloom-tree/sbt: %s is deprecated, use %s instead", name, replacement)
+}
+
+// BloomTree is a bloom tree of a bit set.
+//
+// Deprecated: use bloomtree.BloomTree.
+type BloomTree struct {
+	tree *bloomtree.BloomTree
+	bits *bitset.BitSet
+}
+
+// NewBloomTree returns the tree of the bit set, built with the default chunk size of bloomtree.SetChunkSize.
+// The bit set must not be modified while the tree is used.
+//
+// Deprecated: use bloomtree.NewBloomTree with a bloom filter.
+func NewBloomTree(b *bitset.BitSet) (*BloomTree, error) {
+	deprecated("NewBloomTree", "bloomtree.NewBloomTree")
+	tree, err := bloomtree.NewBloomTree(filter(b))
+	if err != nil {
+		return nil, err
+	}
+	return &BloomTree{tree: tree, bits: b}, nil
+}
+
+// Root returns the root of the tree, which is the root of the bloomtree of the bit set.
+//
+// Deprecated: use bloomtree.BloomTree.Root.
+func (t *BloomTree) Root() [32]byte {
+	deprecated("BloomTree.Root", "bloomtree.BloomTree.Root")
+	return t.tree.Root()
+}
+
+// Tree returns the underlying tree, so callers can migrate to the bloomtree API one call at a time.
+func (t *BloomTree) Tree() *bloomtree.BloomTree {
+	return t.tree
+}
+
+// GenerateMultiProof returns a single proof of the bits at the given indices. It proves the presence of all
+// indices if their bits are set, or the absence of the first index whose bit is unset otherwise. At most
+// 254 indices can be proven at once.
+//
+// Deprecated: use bloomtree.BloomTree.GenerateCompactMultiProof with an element.
+func (t *BloomTree) GenerateMultiProof(indices []int) (*bloomtree.CompactMultiProof, error) {
+	deprecated("BloomTree.GenerateMultiProof", "bloomtree.BloomTree.GenerateCompactMultiProof")
+	return t.generateProof(indices)
+}
+
+// GenerateAbsenceProof returns the proof that the bit at the index is unset. An error is returned if it is set.
+//
+// Deprecated: use bloomtree.BloomTree.GenerateCompactMultiProof with an element.
+func (t *BloomTree) GenerateAbsenceProof(index int) (*bloomtree.CompactMultiProof, error) {
+	deprecated("BloomTree.GenerateAbsenceProof", "bloomtree.BloomTree.GenerateCompactMultiProof")
+	if err := checkIndices([]int{index}, t.bits); err != nil {
+		return nil, err
+	}
+	if t.bits.Test(uint(index)) {
+		return nil, fmt.Errorf("the bit at index %d is set", index)
+	}
+	return t.generateProof([]int{index})
+}
+
+func (t *BloomTree) generateProof(indices []int) (*bloomtree.CompactMultiProof, error) {
+	if err := checkIndices(indices, t.bits); err != nil {
+		return nil, err
+	}
+	return t.tree.GenerateCompactMultiProof(Element(indices))
+}
+
+// VerifyMultiProof returns whether the proof proves the bits at the given indices to be set against the root
+// of the tree of the bit set. It returns false for a valid proof of an unset index.
+//
+// Deprecated: use bloomtree.VerifyCompactMultiProof with an element.
+func VerifyMultiProof(indices []int, proof *bloomtree.CompactMultiProof, root [32]byte, b *bitset.BitSet) (bool, error) {
+	deprecated("VerifyMultiProof", "bloomtree.VerifyCompactMultiProof")
+	valid, err := verify(indices, proof, root, b)
+	return valid && proof.Type().IsPresence(), err
+}
+
+// VerifyAbsenceProof returns whether the proof proves the bit at the index to be unset against the root of
+// the tree of the bit set.
+//
+// Deprecated: use bloomtree.VerifyCompactMultiProof with an element.
+func VerifyAbsenceProof(index int, proof *bloomtree.CompactMultiProof, root [32]byte, b *bitset.BitSet) (bool, error) {
+	deprecated("VerifyAbsenceProof", "bloomtree.VerifyCompactMultiProof")
+	valid, err := verify([]int{index}, proof, root, b)
+	return valid && !proof.Type().IsPresence(), err
+}
+
+// verify returns whether the proof of the indices is valid.
+func verify(indices []int, proof *bloomtree.CompactMultiProof, root [32]byte, b *bitset.BitSet) (bool, error) {
+	if err := checkIndices(indices, b); err != nil {
+		return false, err
+	}
+	return bloomtree.VerifyCompactMultiProof(Element(indices), nil, proof, root, filter(b))
+}
+
+// Element returns the element standing for the indices in the bloomtree API, which proofs of the indices
+// prove, e.g. to verify them with bloomtree.VerifyCompactMultiProof and a bloom filter of the bit set. It
+// holds the indices as unsigned varints.
+func Element(indices []int) []byte {
+	elem := make([]byte, 0, len(indices)*binary.MaxVarintLen64)
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range indices {
+		n := binary.PutUvarint(buf[:], uint64(v))
+		elem = append(elem, buf[:n]...)
+	}
+	return elem
+}
+
+// filter returns the bloom filter of the bit set, which maps the elements returned by Element to their indices.
+func filter(b *bitset.BitSet) *adapters.Filter {
+	return adapters.New(1, nil, func() *bitset.BitSet { return b }, indices, nil)
+}
+
+// indices decodes the indices of an element returned by Element. Malformed elements have no indices.
+func indices(elem, seed []byte) []uint {
+	var ret []uint
+	for len(elem) > 0 {
+		v, n := binary.Uvarint(elem)
+		if n <= 0 {
+			return nil
+		}
+		ret = append(ret, uint(v))
+		elem = elem[n:]
+	}
+	return ret
+}
+
+// checkIndices returns an error unless there are between 1 and maxIndices indices within the bit set.
+func checkIndices(indices []int, b *bitset.BitSet) error {
+	if len(indices) == 0 || len(indices) > maxIndices {
+		return fmt.Errorf("a proof needs between 1 and %d indices, but got %d", maxIndices, len(indices))
+	}
+	for _, v := range indices {
+		if v < 0 || uint(v) >= b.Len() {
+			return fmt.Errorf("%w: %d", bloomtree.ErrIndexOutOfRange, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sbt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/willf/bitset"
+)
+
+func TestBloomTree(t *testing.T) {
+	if err := bloomtree.SetChunkSize(64); err != nil {
+		t.Fatal(err)
+	}
+	var notices []string
+	Notice = func(format string, args ...interface{}) {
+		notices = append(notices, fmt.Sprintf(format, args...))
+	}
+	b := bitset.New(1000)
+	for _, i := range []uint{3, 64, 500, 999} {
+		b.Set(i)
+	}
+	tree, err := NewBloomTree(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+
+	var tests = []struct {
+		indices []int
+		present bool
+	}{
+		{indices: []int{3}, present: true},
+		{indices: []int{3, 64, 500, 999}, present: true},
+		{indices: []int{3, 4, 500}, present: false},
+		{indices: []int{0}, present: false},
+	}
+	for _, test := range tests {
+		proof, err := tree.GenerateMultiProof(test.indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		present, err := VerifyMultiProof(test.indices, proof, root, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present != test.present {
+			t.Fatalf("expected presence %t of %v, but got %t", test.present, test.indices, present)
+		}
+		// the proof is a bloomtree proof of the element of the indices
+		valid, err := bloomtree.VerifyCompactMultiProof(Element(test.indices), nil, proof, tree.Tree().Root(), filter(b))
+		if err != nil || !valid {
+			t.Fatalf("expected a valid bloomtree proof of %v, but got %t, %v", test.indices, valid, err)
+		}
+		if present, err := VerifyMultiProof(test.indices, proof, [32]byte{1}, b); !errors.Is(err, bloomtree.ErrInvalidProof) || present {
+			t.Fatalf("expected verification against another root to fail, but got %t, %v", present, err)
+		}
+	}
+
+	proof, err := tree.GenerateAbsenceProof(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if absent, err := VerifyAbsenceProof(5, proof, root, b); err != nil || !absent {
+		t.Fatalf("expected the absence of index 5, but got %t, %v", absent, err)
+	}
+	if absent, err := VerifyAbsenceProof(700, proof, root, b); err == nil && absent {
+		t.Fatal("expected the proof of index 5 not to prove the absence of an index in another chunk")
+	}
+	presence, err := tree.GenerateMultiProof([]int{64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if absent, err := VerifyAbsenceProof(64, presence, root, b); err != nil || absent {
+		t.Fatalf("expected a presence proof not to prove absence, but got %t, %v", absent, err)
+	}
+
+	for _, indices := range [][]int{nil, {-1}, {1000}, make([]int, maxIndices+1)} {
+		if _, err := tree.GenerateMultiProof(indices); err == nil {
+			t.Fatalf("expected error for indices %v", indices)
+		}
+	}
+	if _, err := tree.GenerateAbsenceProof(3); err == nil {
+		t.Fatal("expected error proving the absence of a set bit")
+	}
+
+	// every function gives its notice once
+	tree.GenerateMultiProof([]int{3})
+	if len(notices) != 6 {
+		t.Fatalf("expected 6 deprecation notices, but got %d: %v", len(notices), notices)
+	}
+}
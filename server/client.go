@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/anchor"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// Client requests proofs from a Server and verifies them locally with pinned parameters. Requests exceeding the
+// budget of the server fail with an error wrapping the *BudgetError of the server.
+type Client struct {
+	// BaseURL is the URL the server is reachable at, e.g. "http://localhost:8080".
+	BaseURL string
+	// HTTPClient sends the requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Seed is the seed of the bloom filter, which is needed to map elements to bloom filter indices.
+	Seed []byte
+	// Params are the trusted parameters proofs are verified with, e.g. verifier.AttestedParams of a signed root
+	// attestation. They are never taken from the server, which could otherwise choose a number of bits or hash
+	// functions giving a tree of the same shape and flip the answers of proofs against a trusted root. Proofs
+	// are rejected while K is zero.
+	Params verifier.Params
+	// Codec is the name of the codec proofs are requested in, see bloomtree.RegisterCodec. It defaults
+	// to bloomtree.CodecJSON. Custom codecs must be registered with the client and the server.
+	Codec string
+	// Compression lists the names of the compressions proofs may be sent with, the preferred one first, e.g.
+	// []string{"zstd", server.CompressionGzip}. Proofs are sent uncompressed if it is empty or the server
+	// supports none of them. Custom compressions must be registered with the client and the server, see
+	// RegisterCompressor.
+	Compression []string
+	// Policy decides which roots of the server NextRoot rotates to.
+	Policy *RootPolicy
+	// AcceptUnproven lets Contains return the unproven answers of servers degrading to their bloom filter,
+	// see SetDegradation. Otherwise Contains fails with ErrUnproven when the server cannot prove its answer.
+	AcceptUnproven bool
+	// MaxResponseBytes limits the size of responses, as sent and after decompression, so a malicious server
+	// cannot exhaust the memory of the client, e.g. with a gzip bomb. It defaults to DefaultMaxResponseBytes.
+	// The built-in gzip compression stops decompressing at the limit, registered compressions are only
+	// checked once they decompressed a response.
+	MaxResponseBytes int64
+}
+
+// ErrUnproven is returned by Contains when the server answers without a proof and the client does not
+// accept unproven answers.
+var ErrUnproven = errors.New("the server answered without a proof")
+
+// Answer is the answer of Contains.
+type Answer struct {
+	// Present is whether the element is in the bloom filter.
+	Present bool
+	// Proven is whether Present was verified against the trusted root. Unproven answers come from the bloom
+	// filter of the server alone and have to be trusted.
+	Proven bool
+	// Reason is why the server could not prove an unproven answer.
+	Reason string
+}
+
+// Metadata are the parameters of the served bloom tree, as attested by the server.
+type Metadata struct {
+	Root        [32]byte
+	ChunkSize   int
+	Hash        bloomtree.Hash
+	NumOfHashes uint
+	FilterBits  uint64
+}
+
+type metadataResponse struct {
+	Root        string `json:"root"`
+	ChunkSize   int    `json:"chunkSize"`
+	Hash        string `json:"hash"`
+	NumOfHashes uint   `json:"numOfHashes"`
+	FilterBits  uint64 `json:"filterBits"`
+}
+
+// Root returns the root the server currently serves. It is not verified, applications should
+// compare it with a root they trust before relying on it.
+func (c *Client) Root(ctx context.Context) ([32]byte, error) {
+	var resp rootResponse
+	if err := c.get(ctx, "/root", nil, &resp); err != nil {
+		return [32]byte{}, err
+	}
+	return decodeRoot(resp.Root)
+}
+
+// Metadata returns the parameters of the served bloom tree. Like the root, they are not verified, proofs are
+// verified with the pinned Params of the client instead.
+func (c *Client) Metadata(ctx context.Context) (*Metadata, error) {
+	var resp metadataResponse
+	if err := c.get(ctx, "/metadata", nil, &resp); err != nil {
+		return nil, err
+	}
+	root, err := decodeRoot(resp.Root)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bloomtree.ParseHash(resp.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{
+		Root:        root,
+		ChunkSize:   resp.ChunkSize,
+		Hash:        hash,
+		NumOfHashes: resp.NumOfHashes,
+		FilterBits:  resp.FilterBits,
+	}, nil
+}
+
+// Prove requests the proof of the element, verifies it against the trusted root with the pinned parameters,
+// and returns whether it proves the presence or the absence of the element. The proof may be served against
+// an earlier root kept by the snapshot store of the server. An error is returned if the server does not hold
+// the root or the proof is invalid.
+func (c *Client) Prove(ctx context.Context, element []byte, root [32]byte) (bool, error) {
+	_, present, err := c.proof(ctx, element, root)
+	return present, err
+}
+
+// Contains requests whether the element is in the bloom filter of the trusted root from the /contains
+// endpoint and verifies the proof of the answer with the pinned parameters. If the server cannot prove its answer, e.g. while its tree
+// is rebuilt, and degrades to its bloom filter, the unproven answer is returned if AcceptUnproven is set and
+// an error wrapping ErrUnproven otherwise.
+func (c *Client) Contains(ctx context.Context, element []byte, root [32]byte) (*Answer, error) {
+	params, err := c.params()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{
+		"element": {hex.EncodeToString(element)},
+		"root":    {hex.EncodeToString(root[:])},
+	}
+	var resp containsResponse
+	if err := c.get(ctx, "/contains", query, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Unproven {
+		if !c.AcceptUnproven {
+			return nil, fmt.Errorf("%w: %s", ErrUnproven, resp.Reason)
+		}
+		return &Answer{Present: resp.Present, Reason: resp.Reason}, nil
+	}
+	var multiproof bloomtree.CompactMultiProof
+	if err := json.Unmarshal(resp.Proof, &multiproof); err != nil {
+		return nil, fmt.Errorf("decoding proof: %w", err)
+	}
+	present, err := verifier.Verify(element, c.Seed, &multiproof, root, params)
+	if err != nil {
+		return nil, err
+	}
+	return &Answer{Present: present, Proven: true}, nil
+}
+
+// ProveBatch requests a single proof of all elements, verifies it against the trusted root, and returns
+// whether it proves the presence or the absence of every element, in the order of the elements. Like Prove,
+// the proof may be served against an earlier root kept by the snapshot store of the server.
+func (c *Client) ProveBatch(ctx context.Context, elements [][]byte, root [32]byte) ([]bool, error) {
+	params, err := c.params()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"root": {hex.EncodeToString(root[:])}}
+	for _, element := range elements {
+		query.Add("element", hex.EncodeToString(element))
+	}
+	var batch bloomtree.BatchMultiProof
+	if err := c.get(ctx, "/batch", query, &batch); err != nil {
+		return nil, err
+	}
+	return verifier.VerifyBatch(elements, c.Seed, &batch, root, params)
+}
+
+// Anchor requests the anchor receipt of the root and checks that its payload anchors the root. Whether the
+// transaction of the receipt was included in its block has to be checked against the chain.
+func (c *Client) Anchor(ctx context.Context, root [32]byte) (*anchor.Receipt, error) {
+	var receipt anchor.Receipt
+	if err := c.get(ctx, "/anchor", url.Values{"root": {hex.EncodeToString(root[:])}}, &receipt); err != nil {
+		return nil, err
+	}
+	if err := receipt.Verify(root); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// proof requests the proof of the element against the root and verifies it with the pinned parameters.
+func (c *Client) proof(ctx context.Context, element []byte, root [32]byte) (*bloomtree.CompactMultiProof, bool, error) {
+	params, err := c.params()
+	if err != nil {
+		return nil, false, err
+	}
+	codecName := c.Codec
+	if codecName == "" {
+		codecName = bloomtree.CodecJSON
+	}
+	codec, err := bloomtree.LookupCodec(codecName)
+	if err != nil {
+		return nil, false, err
+	}
+	query := url.Values{
+		"element": {hex.EncodeToString(element)},
+		"root":    {hex.EncodeToString(root[:])},
+		"codec":   {codecName},
+	}
+	data, err := c.fetch(ctx, "/proof", query)
+	if err != nil {
+		return nil, false, err
+	}
+	multiproof, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decoding %s proof: %w", codecName, err)
+	}
+	present, err := verifier.Verify(element, c.Seed, multiproof, root, params)
+	if err != nil {
+		return nil, false, err
+	}
+	return multiproof, present, nil
+}
+
+// params returns the pinned parameters of the client.
+func (c *Client) params() (verifier.Params, error) {
+	if c.Params.K == 0 {
+		return verifier.Params{}, errors.New("the client has no pinned parameters to verify proofs with")
+	}
+	return c.Params, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	data, err := c.fetch(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// fetch returns the body of the response to the request, decompressed if the server compressed it.
+func (c *Client) fetch(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Compression) > 0 {
+		// setting the header stops the transport from requesting and decompressing gzip on its own
+		req.Header.Set("Accept-Encoding", strings.Join(c.Compression, ", "))
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(path, resp)
+	}
+	limit := c.MaxResponseBytes
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("request %s: the response exceeds %d bytes", path, limit)
+	}
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || resp.Uncompressed {
+		return data, nil
+	}
+	compressor, ok := lookupCompressor(encoding)
+	if !ok || !c.accepts(encoding) {
+		return nil, fmt.Errorf("request %s: unexpected content encoding %q", path, encoding)
+	}
+	if _, ok := compressor.(gzipCompressor); ok {
+		compressor = gzipCompressor{limit: limit}
+	}
+	if data, err = compressor.Decompress(data); err != nil {
+		return nil, fmt.Errorf("request %s: decompressing %s response: %w", path, encoding, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("request %s: the decompressed response exceeds %d bytes", path, limit)
+	}
+	return data, nil
+}
+
+// statusError returns the error of a failed request, with the error answered by the server if it sent one.
+func statusError(path string, resp *http.Response) error {
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("request %s failed with status %s", path, resp.Status)
+	}
+	if e.Budget != nil {
+		return fmt.Errorf("request %s failed with status %s: %w", path, resp.Status, e.Budget)
+	}
+	return fmt.Errorf("request %s failed with status %s: %s", path, resp.Status, e.Error)
+}
+
+// chunkSize returns the chunk size of the parameters.
+func chunkSize(params verifier.Params) int {
+	if params.ChunkSize == 0 {
+		return 64
+	}
+	return params.ChunkSize
+}
+
+// accepts returns whether the client accepts responses compressed with the named compression.
+func (c *Client) accepts(name string) bool {
+	for _, accepted := range c.Compression {
+		if strings.EqualFold(accepted, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeRoot(s string) ([32]byte, error) {
+	var root [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return root, err
+	}
+	if len(b) != len(root) {
+		return root, errors.New("the root must have 32 bytes")
+	}
+	copy(root[:], b)
+	return root, nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/anchor"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// anchorChain includes every transaction in block 7.
+type anchorChain struct{}
+
+func (anchorChain) Submit(ctx context.Context, payload []byte) ([32]byte, error) {
+	return [32]byte{1}, nil
+}
+
+func (anchorChain) Status(ctx context.Context, tx [32]byte) (uint64, uint64, error) {
+	return 7, 1, nil
+}
+
+func TestClient(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	srv := New(tree)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(tree.Attestation())}
+	ctx := context.Background()
+
+	root, err := client.Root(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != tree.Root() {
+		t.Fatal("unexpected root")
+	}
+	metadata, err := client.Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Root != root || metadata.ChunkSize != 64 || metadata.FilterBits != 670 {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+
+	var tests = []struct {
+		element []byte
+		present bool
+	}{
+		{element: []byte{1}, present: true},
+		{element: []byte{2}, present: true},
+		{element: []byte{42}, present: false},
+	}
+	for _, codec := range []string{"", bloomtree.CodecJSON, bloomtree.CodecWire} {
+		client.Codec = codec
+		for _, test := range tests {
+			present, err := client.Prove(ctx, test.element, root)
+			if err != nil {
+				t.Fatalf("codec %q: %v", codec, err)
+			}
+			if present != test.present {
+				t.Fatalf("codec %q: expected presence %t of element %v, but got %t", codec, test.present, test.element, present)
+			}
+		}
+	}
+	// proofs are verified after decompression
+	client.Compression = []string{"br", CompressionGzip}
+	if present, err := client.Prove(ctx, []byte{1}, root); err != nil || !present {
+		t.Fatalf("expected the presence of 1 from a compressed proof, but got %v, %v", present, err)
+	}
+	elements := make([][]byte, len(tests))
+	for i, test := range tests {
+		elements[i] = test.element
+	}
+	present, err := client.ProveBatch(ctx, elements, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		if present[i] != test.present {
+			t.Fatalf("expected presence %t of element %v in the batch, but got %t", test.present, test.element, present[i])
+		}
+	}
+	client.Compression = nil
+	client.Codec = "unknown"
+	if _, err := client.Prove(ctx, []byte{1}, root); !errors.Is(err, bloomtree.ErrUnknownCodec) {
+		t.Fatalf("expected %v, but got %v", bloomtree.ErrUnknownCodec, err)
+	}
+	client.Codec = ""
+
+	// requests exceeding the budget of the server fail with a budget error
+	srv.SetBudget(Budget{MaxChunks: 1, Suggestion: "use batches"})
+	var budgetErr *BudgetError
+	if _, err := client.Prove(ctx, []byte{1}, root); !errors.As(err, &budgetErr) {
+		t.Fatalf("expected a budget error, but got %v", err)
+	}
+	if budgetErr.Resource != ResourceChunks || budgetErr.Limit != 1 || budgetErr.Suggestion != "use batches" {
+		t.Fatalf("unexpected budget error %+v", budgetErr)
+	}
+	srv.SetBudget(Budget{})
+
+	// the anchor receipt of the root is served next to its proofs
+	if _, err := client.Anchor(ctx, root); err == nil {
+		t.Fatal("expected error for a root that is not anchored")
+	}
+	anchorer := anchor.New(anchorChain{}, anchor.Calldata, 1)
+	anchorer.Add(root)
+	if _, err := anchorer.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anchorer.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetReceipts(anchorer)
+	receipt, err := client.Anchor(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Root != root || receipt.Block != 7 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+
+	// a server switching to another tree is detected against the trusted root
+	srv.SetTree(generateTree(t, seed, []byte{1}, []byte{2}, []byte{42}))
+	if _, err := client.Prove(ctx, []byte{42}, root); err == nil {
+		t.Fatal("expected error for a server serving another root")
+	}
+	// proofs against the replaced root are served while the server keeps it in its snapshot store
+	snapshots, err := bloomtree.NewSnapshotStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snapshots.Add(tree); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetSnapshots(snapshots)
+	if present, err := client.Prove(ctx, []byte{42}, root); err != nil || present {
+		t.Fatalf("expected the absence of 42 in the replaced tree, but got %v, %v", present, err)
+	}
+	// a client with the wrong seed cannot verify proofs
+	wrongSeed := &Client{BaseURL: ts.URL, Seed: []byte("other seed"), Params: client.Params}
+	newRoot, err := wrongSeed.Root(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present, err := wrongSeed.Prove(ctx, []byte{42}, newRoot); err == nil && present {
+		t.Fatal("expected the proof to fail with the wrong seed")
+	}
+}
+
+func TestClientPinnedParams(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	srv := New(tree)
+	// the server lies about its parameters, which the client never uses
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata" {
+			a := tree.Attestation()
+			a.FilterBits, a.NumOfHashes = 2*a.FilterBits, a.NumOfHashes+1
+			data, _ := a.CanonicalJSON()
+			w.Write(data)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(tree.Attestation())}
+	for elem, expected := range map[byte]bool{1: true, 42: false} {
+		if present, err := client.Prove(ctx, []byte{elem}, tree.Root()); err != nil || present != expected {
+			t.Fatalf("expected presence %t of element %d with the pinned parameters, got %v, %v", expected, elem, present, err)
+		}
+	}
+	if present, err := client.ProveBatch(ctx, [][]byte{{1}, {42}}, tree.Root()); err != nil || !present[0] || present[1] {
+		t.Fatalf("expected the batch to verify with the pinned parameters, got %v, %v", present, err)
+	}
+	unpinned := &Client{BaseURL: ts.URL, Seed: []byte(seed)}
+	if _, err := unpinned.Prove(ctx, []byte{1}, tree.Root()); err == nil {
+		t.Fatal("expected an error for a client without pinned parameters")
+	}
+	if _, err := unpinned.ProveBatch(ctx, [][]byte{{1}}, tree.Root()); err == nil {
+		t.Fatal("expected an error for a client without pinned parameters")
+	}
+}
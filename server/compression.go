@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressionGzip is the name of the built-in gzip compression.
+const CompressionGzip = "gzip"
+
+// Compressor compresses proof responses, negotiated between the client and the server with the
+// Accept-Encoding and Content-Encoding headers. Other algorithms, e.g. snappy or zstd, are plugged in with
+// RegisterCompressor on both sides. A compressor must be safe for concurrent use.
+type Compressor interface {
+	// Compress returns the compressed data.
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns the data compressed by Compress.
+	Decompress(data []byte) ([]byte, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	byName map[string]Compressor
+}{byName: map[string]Compressor{
+	CompressionGzip: gzipCompressor{},
+}}
+
+// RegisterCompressor makes the compressor available under the name, which is the content coding of the
+// compressed responses, e.g. "zstd". Names are case-insensitive and unique, the built-in compressors cannot be replaced.
+func RegisterCompressor(name string, compressor Compressor) error {
+	name = strings.ToLower(name)
+	if name == "" || name == "identity" || name == "*" {
+		return fmt.Errorf("invalid compressor name %q", name)
+	}
+	if compressor == nil {
+		return fmt.Errorf("the compressor %q is nil", name)
+	}
+	compressors.Lock()
+	defer compressors.Unlock()
+	if _, ok := compressors.byName[name]; ok {
+		return fmt.Errorf("the compressor %q is already registered", name)
+	}
+	compressors.byName[name] = compressor
+	return nil
+}
+
+// Compressors returns the names of the registered compressors in ascending order.
+func Compressors() []string {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	names := make([]string, 0, len(compressors.byName))
+	for name := range compressors.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupCompressor(name string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	compressor, ok := compressors.byName[strings.ToLower(name)]
+	return compressor, ok
+}
+
+// negotiateCompression returns the first registered compressor accepted by the Accept-Encoding header, in
+// the order of the header. Codings with quality zero are not accepted. Quality values are not ranked
+// otherwise, clients list their preferred compression first.
+func negotiateCompression(acceptEncoding string) (string, Compressor, bool) {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if rejected(params[1:]) {
+			continue
+		}
+		if compressor, ok := lookupCompressor(name); ok {
+			return name, compressor, true
+		}
+	}
+	return "", nil, false
+}
+
+// rejected returns whether the parameters of a coding give it quality zero.
+func rejected(params []string) bool {
+	for _, p := range params {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil && q == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DefaultMaxResponseBytes is the default limit of the size of the responses read by a Client, before and after
+// decompression, see Client.MaxResponseBytes.
+const DefaultMaxResponseBytes = 64 << 20
+
+// gzipCompressor is the built-in gzip compression. Decompress stops once the data exceeds the limit, which
+// defaults to DefaultMaxResponseBytes, so a small compressed response cannot exhaust the memory of a client.
+type gzipCompressor struct {
+	limit int64
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	limit := c.limit
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > limit {
+		return nil, fmt.Errorf("the decompressed data exceeds %d bytes", limit)
+	}
+	return decompressed, nil
+}
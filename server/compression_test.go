@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reversingCompressor "compresses" by reversing the data.
+type reversingCompressor struct{}
+
+func (reversingCompressor) Compress(data []byte) ([]byte, error) {
+	reversed := make([]byte, len(data))
+	for i, b := range data {
+		reversed[len(data)-1-i] = b
+	}
+	return reversed, nil
+}
+
+func (c reversingCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.Compress(data)
+}
+
+func TestCompression(t *testing.T) {
+	if err := RegisterCompressor("Reversed", reversingCompressor{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "identity", "reversed", CompressionGzip} {
+		if err := RegisterCompressor(name, reversingCompressor{}); err == nil {
+			t.Fatalf("expected error registering compressor %q", name)
+		}
+	}
+	if err := RegisterCompressor("nil", nil); err == nil {
+		t.Fatal("expected error registering a nil compressor")
+	}
+
+	var tests = []struct {
+		acceptEncoding string
+		name           string
+	}{
+		{acceptEncoding: "", name: ""},
+		{acceptEncoding: "identity", name: ""},
+		{acceptEncoding: "br, gzip", name: CompressionGzip},
+		{acceptEncoding: "REVERSED;q=0.5, gzip", name: "reversed"},
+		{acceptEncoding: "reversed;q=0, gzip;q=1.0", name: CompressionGzip},
+		{acceptEncoding: "reversed; q=0.000, gzip;q=0", name: ""},
+	}
+	for _, test := range tests {
+		name, _, ok := negotiateCompression(test.acceptEncoding)
+		if name != test.name || ok != (test.name != "") {
+			t.Fatalf("expected compression %q for %q, but got %q", test.name, test.acceptEncoding, name)
+		}
+	}
+
+	data := bytes.Repeat([]byte("chunk"), 100)
+	for _, name := range Compressors() {
+		compressor, ok := lookupCompressor(name)
+		if !ok {
+			t.Fatalf("compressor %q is not registered", name)
+		}
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Fatalf("%s: the decompressed data differ", name)
+		}
+	}
+	if _, err := (gzipCompressor{}).Decompress(data); err == nil {
+		t.Fatal("expected error decompressing data that is not gzip")
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	// a megabyte of zeros compresses to about a kilobyte
+	bomb, err := gzipCompressor{}.Compress(make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (gzipCompressor{limit: 1<<20 - 1}).Decompress(bomb); err == nil {
+		t.Fatal("expected error decompressing data beyond the limit")
+	}
+	if data, err := (gzipCompressor{limit: 1 << 20}).Decompress(bomb); err != nil || len(data) != 1<<20 {
+		t.Fatalf("expected the data within the limit, but got %d bytes, %v", len(data), err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", CompressionGzip)
+		w.Write(bomb)
+	}))
+	defer ts.Close()
+	var tests = []struct {
+		limit int64
+		err   string
+	}{
+		{limit: 64 << 10, err: "the decompressed data exceeds"},
+		{limit: 512, err: "the response exceeds"},
+	}
+	for _, test := range tests {
+		client := &Client{BaseURL: ts.URL, Compression: []string{CompressionGzip}, MaxResponseBytes: test.limit}
+		if _, err := client.fetch(context.Background(), "/root", nil); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected an error containing %q for a limit of %d bytes, but got %v", test.err, test.limit, err)
+		}
+	}
+	client := &Client{BaseURL: ts.URL, Compression: []string{CompressionGzip}}
+	if data, err := client.fetch(context.Background(), "/root", nil); err != nil || len(data) != 1<<20 {
+		t.Fatalf("expected the response within the default limit, but got %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// DegradationPolicy decides how the /contains endpoint answers when no proof can be generated for the served
+// tree, e.g. while it is rebuilt or its node store is unavailable.
+type DegradationPolicy int
+
+const (
+	// DegradeNever fails requests that cannot be proven. It is the default.
+	DegradeNever DegradationPolicy = iota
+	// DegradeToFilter answers requests that cannot be proven from the bloom filter alone, flagged as unproven,
+	// for availability-sensitive callers accepting weaker answers.
+	DegradeToFilter
+)
+
+// errRebuilding is answered to proof requests against the served tree while it is rebuilt.
+var errRebuilding = errors.New("the tree is being rebuilt")
+
+type containsResponse struct {
+	Present bool `json:"present"`
+	// Proof is the canonical JSON of the proof, omitted from unproven answers.
+	Proof    json.RawMessage `json:"proof,omitempty"`
+	Unproven bool            `json:"unproven,omitempty"`
+	// Reason is the error that prevented the proof of an unproven answer.
+	Reason string `json:"reason,omitempty"`
+}
+
+// SetDegradation sets the policy of the /contains endpoint for requests that cannot be proven.
+func (s *Server) SetDegradation(policy DegradationPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degradation = policy
+}
+
+// SetRebuilding marks the served tree as being rebuilt, e.g. while its node store is repopulated, until the
+// new tree is installed with SetTree or SetRebuilding is called with nil. Meanwhile, proof requests against
+// the served tree are answered with status 503, and under DegradeToFilter the /contains endpoint answers from
+// the given filter, which must not be updated while it is set. Proofs against snapshot roots are still served.
+func (s *Server) SetRebuilding(filter bloomtree.BloomFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rebuilding = filter
+}
+
+func (s *Server) handleContains(w http.ResponseWriter, r *http.Request) {
+	element, err := hex.DecodeString(r.URL.Query().Get("element"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	release, code, err := s.acquire(r, PriorityInteractive)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	defer release()
+	prover, budget, code, err := s.prover(r)
+	if err == nil {
+		var multiproof *bloomtree.CompactMultiProof
+		if code, err = budget.plan(prover, [][]byte{element}); err != nil && code != http.StatusInternalServerError {
+			// elements that cannot be proven are not answered from the filter either
+			writeError(w, code, err)
+			return
+		}
+		if err == nil {
+			multiproof, err = generateProof(r, prover, element, budget)
+		}
+		if err == nil {
+			if err := budget.check(len(multiproof.Chunks), multiproof.Size()); err != nil {
+				writeError(w, http.StatusUnprocessableEntity, err)
+				return
+			}
+			data, err := multiproof.MarshalJSON()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, containsResponse{Present: multiproof.ProofType.IsPresence(), Proof: data})
+			return
+		}
+		code = http.StatusInternalServerError
+	}
+	if filter, ok := s.degradedFilter(r, err); ok {
+		_, present := filter.Proof(element)
+		writeJSON(w, containsResponse{Present: present, Unproven: true, Reason: err.Error()})
+		return
+	}
+	writeError(w, code, err)
+}
+
+// degradedFilter returns the filter to answer a request that failed with the error from, if the policy of the
+// server allows it. Only failures of the served tree degrade: requests naming other roots, exceeding the
+// budget or canceled by the client fail as usual.
+func (s *Server) degradedFilter(r *http.Request, err error) (bloomtree.BloomFilter, bool) {
+	s.mu.RLock()
+	tree, policy, rebuilding := s.tree, s.degradation, s.rebuilding
+	s.mu.RUnlock()
+	if policy != DegradeToFilter {
+		return nil, false
+	}
+	var budgetErr *BudgetError
+	if errors.As(err, &budgetErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, false
+	}
+	if v := r.URL.Query().Get("root"); v != "" {
+		if root, err := decodeRoot(v); err != nil || root != tree.Root() {
+			return nil, false
+		}
+	}
+	if rebuilding != nil {
+		return rebuilding, true
+	}
+	if errors.Is(err, errRebuilding) {
+		// the tree was installed since the request failed
+		return nil, false
+	}
+	return tree.GetBloomFilter(), true
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+func TestDegradation(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	srv := New(tree)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(tree.Attestation())}
+	root := tree.Root()
+	ctx := context.Background()
+	for elem, expected := range map[byte]bool{1: true, 42: false} {
+		answer, err := client.Contains(ctx, []byte{elem}, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !answer.Proven || answer.Present != expected {
+			t.Fatalf("expected a proven answer %v for element %d, got %+v", expected, elem, answer)
+		}
+	}
+
+	// the rebuilt filter holds another element, which is not proven until the new tree is installed
+	rebuilt := DBF.NewDbf(200, 0.2, []byte(seed))
+	for _, elem := range [][]byte{{1}, {2}, {3}} {
+		rebuilt.Add(elem)
+	}
+	srv.SetRebuilding(rebuilt)
+	if _, err := client.Prove(ctx, []byte{1}, root); err == nil {
+		t.Fatal("expected proofs to fail while the tree is rebuilt")
+	}
+	if _, err := client.Contains(ctx, []byte{3}, root); err == nil || errors.Is(err, ErrUnproven) {
+		t.Fatalf("expected Contains to fail without degradation, got %v", err)
+	}
+	srv.SetDegradation(DegradeToFilter)
+	if _, err := client.Contains(ctx, []byte{3}, root); !errors.Is(err, ErrUnproven) {
+		t.Fatalf("expected ErrUnproven for a client not accepting unproven answers, got %v", err)
+	}
+	client.AcceptUnproven = true
+	answer, err := client.Contains(ctx, []byte{3}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Proven || !answer.Present || answer.Reason == "" {
+		t.Fatalf("expected an unproven answer from the rebuilt filter, got %+v", answer)
+	}
+	if _, err := client.Contains(ctx, []byte{3}, [32]byte{1}); err == nil {
+		t.Fatal("expected requests naming another root not to degrade")
+	}
+
+	// installing the new tree ends the rebuild
+	next, err := bloomtree.NewBloomTree(rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTree(next)
+	if answer, err = client.Contains(ctx, []byte{3}, next.Root()); err != nil || !answer.Proven || !answer.Present {
+		t.Fatalf("expected a proven answer after the rebuild, got %+v, %v", answer, err)
+	}
+}
+
+func TestDegradationNodeStore(t *testing.T) {
+	seed := "secret seed"
+	dbf := DBF.NewDbf(200, 0.2, []byte(seed))
+	dbf.Add([]byte{1})
+	if err := bloomtree.SetChunkSize(64); err != nil {
+		t.Fatal(err)
+	}
+	n, err := bloomtree.TreeLength(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := bloomtree.NewFaultStore(bloomtree.NewMemoryStore(n), bloomtree.Faults{})
+	tree, err := bloomtree.NewBloomTree(dbf, bloomtree.WithNodeStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetFaults(bloomtree.Faults{ReadErrorRate: 1})
+	var tests = []struct {
+		policy DegradationPolicy
+		status int
+	}{
+		{policy: DegradeNever, status: http.StatusInternalServerError},
+		{policy: DegradeToFilter, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		srv := New(tree)
+		srv.SetDegradation(test.policy)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/contains?element=01", nil))
+		if rec.Code != test.status {
+			t.Fatalf("expected status %d under policy %d, got %d", test.status, test.policy, rec.Code)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var resp containsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Unproven || !resp.Present || resp.Proof != nil {
+			t.Fatalf("expected an unproven answer while the node store fails, got %+v", resp)
+		}
+	}
+
+	// the answers are proven again once the store recovers, and proofs exceeding the budget are not degraded
+	store.SetFaults(bloomtree.Faults{})
+	srv := New(tree)
+	srv.SetDegradation(DegradeToFilter)
+	srv.SetBudget(Budget{MaxChunks: 1})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/contains?element=01", nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d for a proof exceeding the budget, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+	srv.SetBudget(Budget{})
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/contains?element=01", nil))
+	var resp containsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Unproven || !resp.Present || resp.Proof == nil {
+		t.Fatalf("expected a proven answer after the store recovered, got %+v", resp)
+	}
+}
+
+func TestContainsPinnedParams(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1})
+	ts := httptest.NewServer(New(tree))
+	defer ts.Close()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed)}
+	if _, err := client.Contains(context.Background(), []byte{1}, tree.Root()); err == nil {
+		t.Fatal("expected an error for a client without pinned parameters")
+	}
+	// parameters of another filter do not verify the proof, whatever the server reports
+	params := verifier.AttestedParams(tree.Attestation())
+	params.K++
+	client.Params = params
+	if answer, err := client.Contains(context.Background(), []byte{1}, tree.Root()); err == nil && answer.Present {
+		t.Fatalf("expected the proof to fail with other pinned parameters, got %+v", answer)
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// ChunkRangeProofHeader is the header of partial /snapshot responses holding the comma separated hex encoded
+// hashes of the chunk range proof of the returned chunks, see bloomtree.ChunkRange.
+const ChunkRangeProofHeader = "Chunk-Range-Proof"
+
+// handleSnapshot answers with the words of the bloom filter of the served tree, or of the tree of the root in
+// the root parameter kept in the snapshot store, as little endian 64 bit words. Range requests of a single byte
+// range starting and ending at chunk boundaries are answered with the bytes of the range and the proof of its
+// chunks against the root, so downloads can be resumed or split and every part verified on its own. The ETag
+// is the root, so If-Range requests only resume the download of the same version.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	prover, _, code, err := s.prover(r)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	tree, ok := prover.(*bloomtree.BloomTree)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the tree of the root cannot be downloaded"))
+		return
+	}
+	root := tree.Root()
+	words := tree.GetBloomFilter().BitArray().Bytes()
+	data := make([]byte, 8*len(words))
+	for i, word := range words {
+		binary.LittleEndian.PutUint64(data[8*i:], word)
+	}
+	etag := `"` + hex.EncodeToString(root[:]) + `"`
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	rangeHeader := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); rangeHeader == "" || (ifRange != "" && ifRange != etag) {
+		w.Write(data)
+		return
+	}
+	chunkBytes := int(tree.Attestation().ChunkSize / 8)
+	first, last, err := parseRange(rangeHeader, len(data))
+	if err == nil && (first%chunkBytes != 0 || ((last+1)%chunkBytes != 0 && last+1 != len(data))) {
+		err = fmt.Errorf("the range must start and end at chunk boundaries of %d bytes", chunkBytes)
+	}
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(data)))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, err)
+		return
+	}
+	chunks, err := tree.GetChunkRange(uint64(first/chunkBytes), uint64((last+chunkBytes)/chunkBytes))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(ChunkRangeProofHeader, strings.Join(hexStrings(chunks.Proof), ","))
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[first : last+1])
+}
+
+// parseRange returns the first and last byte of the single byte range of the Range header, for a body of size
+// bytes.
+func parseRange(header string, size int) (int, int, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, errors.New("only a single byte range is supported")
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid range %q", header)
+	}
+	first, last := size, size-1
+	var err error
+	switch {
+	case i == 0:
+		// the suffix range of the last bytes
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid range %q", header)
+		}
+		if first = size - n; first < 0 {
+			first = 0
+		}
+	case i == len(spec)-1:
+		first, err = strconv.Atoi(spec[:i])
+	default:
+		if first, err = strconv.Atoi(spec[:i]); err == nil {
+			last, err = strconv.Atoi(spec[i+1:])
+		}
+	}
+	if err != nil || first < 0 || last < first {
+		return 0, 0, fmt.Errorf("invalid range %q", header)
+	}
+	if first >= size {
+		return 0, 0, fmt.Errorf("the range %q starts after the %d bytes of the bloom filter", header, size)
+	}
+	if last >= size {
+		last = size - 1
+	}
+	return first, last, nil
+}
+
+// DownloadChunks downloads the words of the chunks [start, end) of the bloom filter of the trusted root with
+// a Range request to the /snapshot endpoint, and verifies them with the chunk range proof of the response
+// against the root with the pinned parameters. Large filters can be downloaded in parts, e.g. concurrently or
+// resuming after an interruption, each part verified on its own.
+func (c *Client) DownloadChunks(ctx context.Context, root [32]byte, start, end uint64) (*bloomtree.ChunkRange, error) {
+	params, err := c.params()
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := chunkSize(params)
+	if chunkSize <= 0 || chunkSize%bloomtree.WordBits != 0 {
+		return nil, fmt.Errorf("invalid pinned chunk size %d", chunkSize)
+	}
+	size := 8 * bloomtree.WordCountFor(params.M)
+	chunkBytes := uint64(chunkSize / 8)
+	if start >= end || end > bloomtree.LeafCountFor(params.M, chunkSize) {
+		return nil, fmt.Errorf("invalid chunk range [%d, %d)", start, end)
+	}
+	first, last := start*chunkBytes, end*chunkBytes-1
+	if last >= size {
+		last = size - 1
+	}
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/snapshot?" + url.Values{"root": {hex.EncodeToString(root[:])}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, statusError("/snapshot", resp)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(last-first+2)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != last-first+1 {
+		return nil, fmt.Errorf("the server sent %d bytes of the range of %d bytes", len(data), last-first+1)
+	}
+	chunks := &bloomtree.ChunkRange{Start: start, End: end}
+	for i := start; i < end; i++ {
+		words := make([]uint64, bloomtree.ChunkWordCount(i, params.M, chunkSize))
+		for w := range words {
+			words[w] = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		}
+		chunks.Words = append(chunks.Words, words)
+	}
+	if proof := resp.Header.Get(ChunkRangeProofHeader); proof != "" {
+		for _, v := range strings.Split(proof, ",") {
+			h, err := decodeRoot(v)
+			if err != nil {
+				return nil, fmt.Errorf("decoding the chunk range proof: %w", err)
+			}
+			chunks.Proof = append(chunks.Proof, h)
+		}
+	}
+	if _, err := bloomtree.VerifyChunkRange(chunks, root, params.M, bloomtree.WithChunkSize(chunkSize), bloomtree.WithHash(params.Hash)); err != nil {
+		return nil, fmt.Errorf("verifying the chunks [%d, %d) against root %x: %w", start, end, root, err)
+	}
+	return chunks, nil
+}
+
+func hexStrings(hashes [][32]byte) []string {
+	s := make([]string, len(hashes))
+	for i, h := range hashes {
+		s[i] = hex.EncodeToString(h[:])
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+func TestDownloadChunks(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	words := tree.GetBloomFilter().BitArray().Bytes()
+	srv := New(tree)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	ctx := context.Background()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(tree.Attestation())}
+	leafs := bloomtree.LeafCountFor(client.Params.M, 64)
+
+	// the filter is downloaded in parts, each verified on its own
+	var downloaded []uint64
+	for start := uint64(0); start < leafs; start += 3 {
+		end := start + 3
+		if end > leafs {
+			end = leafs
+		}
+		chunks, err := client.DownloadChunks(ctx, tree.Root(), start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks.Words {
+			downloaded = append(downloaded, chunk...)
+		}
+	}
+	if len(downloaded) != len(words) {
+		t.Fatalf("expected %d words, got %d", len(words), len(downloaded))
+	}
+	for i := range words {
+		if downloaded[i] != words[i] {
+			t.Fatalf("word %d differs from the bloom filter", i)
+		}
+	}
+	if _, err := client.DownloadChunks(ctx, tree.Root(), 0, leafs+1); err == nil {
+		t.Fatal("expected an error for chunks out of range")
+	}
+	odd := *client
+	odd.Params.ChunkSize = 32
+	if _, err := odd.DownloadChunks(ctx, tree.Root(), 0, 1); err == nil {
+		t.Fatal("expected an error for a chunk size below the word size")
+	}
+
+	var tests = []struct {
+		name    string
+		header  http.Header
+		status  int
+		content string
+	}{
+		{name: "whole filter", status: http.StatusOK},
+		{name: "first chunks", header: http.Header{"Range": {"bytes=0-15"}}, status: http.StatusPartialContent, content: fmt.Sprintf("bytes 0-15/%d", 8*len(words))},
+		{name: "open range", header: http.Header{"Range": {"bytes=8-"}}, status: http.StatusPartialContent, content: fmt.Sprintf("bytes 8-%d/%d", 8*len(words)-1, 8*len(words))},
+		{name: "unaligned range", header: http.Header{"Range": {"bytes=1-15"}}, status: http.StatusRequestedRangeNotSatisfiable, content: fmt.Sprintf("bytes */%d", 8*len(words))},
+		{name: "several ranges", header: http.Header{"Range": {"bytes=0-7,16-23"}}, status: http.StatusRequestedRangeNotSatisfiable},
+		{name: "beyond the filter", header: http.Header{"Range": {fmt.Sprintf("bytes=%d-", 8*len(words))}}, status: http.StatusRequestedRangeNotSatisfiable},
+		{name: "other version", header: http.Header{"Range": {"bytes=0-7"}, "If-Range": {`"00"`}}, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/snapshot", nil)
+		for k, v := range test.header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Fatalf("%s: expected status %d, got %d", test.name, test.status, rec.Code)
+		}
+		if test.content != "" && rec.Header().Get("Content-Range") != test.content {
+			t.Fatalf("%s: expected content range %q, got %q", test.name, test.content, rec.Header().Get("Content-Range"))
+		}
+		if rec.Code == http.StatusOK && rec.Body.Len() != 8*len(words) {
+			t.Fatalf("%s: expected the whole filter, got %d bytes", test.name, rec.Body.Len())
+		}
+	}
+
+	// chunks altered by the server do not verify
+	lying := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		data, _ := ioutil.ReadAll(rec.Body)
+		binary.LittleEndian.PutUint64(data, binary.LittleEndian.Uint64(data)^1)
+		w.WriteHeader(rec.Code)
+		w.Write(data)
+	}))
+	defer lying.Close()
+	liar := *client
+	liar.BaseURL = lying.URL
+	if _, err := liar.DownloadChunks(ctx, tree.Root(), 0, 2); err == nil {
+		t.Fatal("expected altered chunks to fail verification")
+	}
+}
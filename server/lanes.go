@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Priority is the priority class of a proof request. Every class is served by its own lane of workers, so
+// bulk proving jobs cannot starve latency-sensitive requests of single elements.
+type Priority int
+
+const (
+	// PriorityInteractive is the class of /proof and /contains requests.
+	PriorityInteractive Priority = iota
+	// PriorityBatch is the class of /batch requests, and of /proof and /contains requests with the parameter
+	// priority=batch, e.g. of a job proving many elements one by one.
+	PriorityBatch
+)
+
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// Lanes limits the number of proofs the server generates concurrently per priority class. Zero fields are
+// unlimited.
+type Lanes struct {
+	// Interactive is the number of workers generating proofs of interactive requests.
+	Interactive int
+	// Batch is the number of workers generating proofs of batch requests.
+	Batch int
+	// MaxWait is the longest time a request waits for a worker of its lane before it is answered with status
+	// 503. Zero waits until the request is canceled.
+	MaxWait time.Duration
+}
+
+// lanes holds the workers of every priority class as the free slots of a channel. A nil lane is unlimited.
+type lanes struct {
+	workers [2]chan struct{}
+	maxWait time.Duration
+}
+
+// SetLanes limits the proofs generated concurrently by every following request per priority class. Requests
+// waiting for a worker keep waiting in the lanes they entered.
+func (s *Server) SetLanes(l Lanes) {
+	var ls lanes
+	for p, n := range []int{l.Interactive, l.Batch} {
+		if n > 0 {
+			ls.workers[p] = make(chan struct{}, n)
+		}
+	}
+	ls.maxWait = l.MaxWait
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lanes = ls
+}
+
+// requestPriority returns the priority class of a request whose endpoint has the given default class.
+// Requests can lower their class to PriorityBatch, but not raise it.
+func requestPriority(r *http.Request, class Priority) (Priority, error) {
+	switch v := r.URL.Query().Get("priority"); v {
+	case "", class.String():
+		return class, nil
+	case PriorityBatch.String():
+		return PriorityBatch, nil
+	default:
+		return class, fmt.Errorf("invalid priority %q", v)
+	}
+}
+
+// acquire waits for a worker of the lane of the request, and returns the function releasing it. The status
+// code of the response is returned with an error.
+func (s *Server) acquire(r *http.Request, class Priority) (func(), int, error) {
+	priority, err := requestPriority(r, class)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	s.mu.RLock()
+	lane, maxWait := s.lanes.workers[priority], s.lanes.maxWait
+	s.mu.RUnlock()
+	if lane == nil {
+		return func() {}, 0, nil
+	}
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case lane <- struct{}{}:
+		return func() { <-lane }, 0, nil
+	case <-timeout:
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("no worker of the %s lane was free within %v", priority, maxWait)
+	case <-r.Context().Done():
+		return nil, http.StatusServiceUnavailable, r.Context().Err()
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLanes(t *testing.T) {
+	tree := generateTree(t, "secret seed", []byte{1}, []byte{2})
+	srv := New(tree)
+	srv.SetLanes(Lanes{Interactive: 1, Batch: 1, MaxWait: 10 * time.Millisecond})
+
+	// a bulk job holding every batch worker does not delay interactive requests
+	srv.lanes.workers[PriorityBatch] <- struct{}{}
+	var tests = []struct {
+		target string
+		status int
+	}{
+		{target: "/proof?element=01", status: http.StatusOK},
+		{target: "/contains?element=01", status: http.StatusOK},
+		{target: "/proof?element=01&priority=batch", status: http.StatusServiceUnavailable},
+		{target: "/contains?element=01&priority=batch", status: http.StatusServiceUnavailable},
+		{target: "/batch?element=01&element=02", status: http.StatusServiceUnavailable},
+		{target: "/batch?element=01&priority=interactive", status: http.StatusBadRequest},
+		{target: "/proof?element=01&priority=urgent", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if rec.Code != test.status {
+			t.Fatalf("%s: expected status %d, got %d", test.target, test.status, rec.Code)
+		}
+	}
+
+	// the batch lane serves requests again once a worker is free, and finished requests release theirs
+	<-srv.lanes.workers[PriorityBatch]
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch?element=01&element=02", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+	}
+
+	// lanes without a limit never wait
+	srv.SetLanes(Lanes{})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch?element=01", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// NamespaceConfig holds the parameters of the filter of a namespace, so tenants with different workloads, e.g.
+// tiny allow-lists and giant blocklists, can share one deployment.
+type NamespaceConfig struct {
+	// ChunkSize is the chunk size of the tree in bits, the package chunk size if zero.
+	ChunkSize int
+	// Hash is the hash function of the tree.
+	Hash bloomtree.Hash
+	// Rotation is the interval at which the tree is rebuilt with Build, never if zero.
+	Rotation time.Duration
+	// Build builds the tree of the namespace with the given options, which set the chunk size and the hash.
+	Build func(opts ...bloomtree.Option) (*bloomtree.BloomTree, error)
+	// OnError is called with the errors of scheduled rotations, after which the previous tree is still served.
+	OnError func(name string, err error)
+}
+
+// Namespaces serves the trees of several namespaces, each with its own parameters and rotation schedule. The
+// Server of a namespace is reachable below the name of the namespace, e.g. /blocklist/proof?element=hex, so a
+// Client of a namespace has the BaseURL of the deployment followed by the name. Besides the endpoints of a
+// Server, it answers the following GET requests with JSON:
+//
+//	/                        {"namespaces": [name]}
+//	/name/params             the parameters of the namespace and their hash, see ParamsHash
+type Namespaces struct {
+	mu         sync.RWMutex
+	namespaces map[string]*namespace
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// namespace is a served namespace.
+type namespace struct {
+	cfg    NamespaceConfig
+	server *Server
+	// rotateMu serializes rotations, so a slow build does not overlap with the next one.
+	rotateMu sync.Mutex
+}
+
+type namespacesResponse struct {
+	Namespaces []string `json:"namespaces"`
+}
+
+type paramsResponse struct {
+	ChunkSize   int    `json:"chunkSize"`
+	Hash        string `json:"hash"`
+	NumOfHashes uint64 `json:"numOfHashes"`
+	FilterBits  uint64 `json:"filterBits"`
+	// Rotation is the rotation interval in seconds, zero if the tree is not rotated.
+	Rotation   float64 `json:"rotation"`
+	ParamsHash string  `json:"paramsHash"`
+}
+
+// NewNamespaces returns a server without namespaces.
+func NewNamespaces() *Namespaces {
+	return &Namespaces{namespaces: make(map[string]*namespace), done: make(chan struct{})}
+}
+
+// Add builds the tree of a new namespace and serves it, and starts rotating it if the config has a rotation
+// interval. The name must be a non-empty path segment.
+func (n *Namespaces) Add(name string, cfg NamespaceConfig) (*Server, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid namespace name %q", name)
+	}
+	if cfg.Build == nil {
+		return nil, errors.New("the namespace has no build function")
+	}
+	if cfg.Rotation < 0 {
+		return nil, fmt.Errorf("invalid rotation interval %s", cfg.Rotation)
+	}
+	if _, ok := n.namespace(name); ok {
+		return nil, fmt.Errorf("namespace %q already exists", name)
+	}
+	tree, err := cfg.build()
+	if err != nil {
+		return nil, err
+	}
+	ns := &namespace{cfg: cfg, server: New(tree)}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.namespaces[name]; ok {
+		return nil, fmt.Errorf("namespace %q already exists", name)
+	}
+	select {
+	case <-n.done:
+		return nil, errors.New("the namespaces are closed")
+	default:
+	}
+	n.namespaces[name] = ns
+	if cfg.Rotation > 0 {
+		n.wg.Add(1)
+		go n.rotateEvery(name, ns)
+	}
+	return ns.server, nil
+}
+
+// Server returns the server of a namespace.
+func (n *Namespaces) Server(name string) (*Server, bool) {
+	ns, ok := n.namespace(name)
+	if !ok {
+		return nil, false
+	}
+	return ns.server, true
+}
+
+// Rotate rebuilds the tree of a namespace now and serves the new tree. The previous tree is still served if
+// the build fails.
+func (n *Namespaces) Rotate(name string) error {
+	ns, ok := n.namespace(name)
+	if !ok {
+		return fmt.Errorf("unknown namespace %q", name)
+	}
+	return ns.rotate()
+}
+
+// Close stops the rotations of all namespaces and waits for rotations in progress. The namespaces are still
+// served.
+func (n *Namespaces) Close() {
+	n.mu.Lock()
+	select {
+	case <-n.done:
+	default:
+		close(n.done)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (n *Namespaces) namespace(name string) (*namespace, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	ns, ok := n.namespaces[name]
+	return ns, ok
+}
+
+// rotateEvery rotates the namespace at its rotation interval until the namespaces are closed.
+func (n *Namespaces) rotateEvery(name string, ns *namespace) {
+	defer n.wg.Done()
+	ticker := time.NewTicker(ns.cfg.Rotation)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+			if err := ns.rotate(); err != nil && ns.cfg.OnError != nil {
+				ns.cfg.OnError(name, err)
+			}
+		}
+	}
+}
+
+func (ns *namespace) rotate() error {
+	ns.rotateMu.Lock()
+	defer ns.rotateMu.Unlock()
+	tree, err := ns.cfg.build()
+	if err != nil {
+		return err
+	}
+	ns.server.SetTree(tree)
+	return nil
+}
+
+// build builds the tree with the chunk size and hash of the namespace, and checks that Build applied them.
+func (cfg NamespaceConfig) build() (*bloomtree.BloomTree, error) {
+	opts := []bloomtree.Option{bloomtree.WithHash(cfg.Hash)}
+	if cfg.ChunkSize != 0 {
+		opts = append(opts, bloomtree.WithChunkSize(cfg.ChunkSize))
+	}
+	tree, err := cfg.Build(opts...)
+	if err != nil {
+		return nil, err
+	}
+	a := tree.Attestation()
+	if a.Hash != cfg.Hash || (cfg.ChunkSize != 0 && a.ChunkSize != uint64(cfg.ChunkSize)) {
+		return nil, fmt.Errorf("the tree has chunk size %d and hash %s, but the namespace has chunk size %d and hash %s",
+			a.ChunkSize, a.Hash, cfg.ChunkSize, cfg.Hash)
+	}
+	return tree, nil
+}
+
+// ParamsHash returns the SHA-256 of the canonical JSON of the attestation without its root, which changes
+// only when the chunk size, the hash function, the number of hash functions or the number of bits of the
+// bloom filter change, so clients can detect a namespace changing its parameters.
+func ParamsHash(a bloomtree.RootAttestation) ([32]byte, error) {
+	a.Root = [32]byte{}
+	data, err := a.CanonicalJSON()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// ServeHTTP implements http.Handler.
+func (n *Namespaces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET requests are supported"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		n.mu.RLock()
+		resp := namespacesResponse{Namespaces: make([]string, 0, len(n.namespaces))}
+		for name := range n.namespaces {
+			resp.Namespaces = append(resp.Namespaces, name)
+		}
+		n.mu.RUnlock()
+		sort.Strings(resp.Namespaces)
+		writeJSON(w, resp)
+		return
+	}
+	name := path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		name = path[:i]
+	}
+	ns, ok := n.namespace(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown namespace %q", name))
+		return
+	}
+	if path == name+"/params" {
+		ns.handleParams(w)
+		return
+	}
+	http.StripPrefix("/"+name, ns.server).ServeHTTP(w, r)
+}
+
+func (ns *namespace) handleParams(w http.ResponseWriter) {
+	a := ns.server.currentTree().Attestation()
+	hash, err := ParamsHash(a)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, paramsResponse{
+		ChunkSize:   int(a.ChunkSize),
+		Hash:        a.Hash.String(),
+		NumOfHashes: a.NumOfHashes,
+		FilterBits:  a.FilterBits,
+		Rotation:    ns.cfg.Rotation.Seconds(),
+		ParamsHash:  hex.EncodeToString(hash[:]),
+	})
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// buildFunc returns a build function of a tree of n expected elements holding the given elements, and counts
+// its builds.
+func buildFunc(seed string, n uint, builds *int32, elements ...[]byte) func(opts ...bloomtree.Option) (*bloomtree.BloomTree, error) {
+	return func(opts ...bloomtree.Option) (*bloomtree.BloomTree, error) {
+		dbf := DBF.NewDbf(n, 0.2, []byte(seed))
+		for _, elem := range elements {
+			dbf.Add(elem)
+		}
+		// every build adds another element, so rotations change the root
+		dbf.Add([]byte{byte(atomic.AddInt32(builds, 1)), 0xff})
+		return bloomtree.NewBloomTree(dbf, opts...)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	if err := bloomtree.SetChunkSize(64); err != nil {
+		t.Fatal(err)
+	}
+	seed := "secret seed"
+	var allowBuilds, blockBuilds int32
+	ns := NewNamespaces()
+	defer ns.Close()
+	if _, err := ns.Add("allow", NamespaceConfig{Build: buildFunc(seed, 20, &allowBuilds, []byte{1})}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Add("block", NamespaceConfig{ChunkSize: 512, Hash: bloomtree.BLAKE3, Build: buildFunc(seed, 5000, &blockBuilds, []byte{2})}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "a/b", "allow"} {
+		if _, err := ns.Add(name, NamespaceConfig{Build: buildFunc(seed, 20, &allowBuilds)}); err == nil {
+			t.Fatalf("expected an error adding namespace %q", name)
+		}
+	}
+	ignoring := func(opts ...bloomtree.Option) (*bloomtree.BloomTree, error) {
+		return bloomtree.NewBloomTree(DBF.NewDbf(20, 0.2, []byte(seed)))
+	}
+	if _, err := ns.Add("other", NamespaceConfig{Hash: bloomtree.SHA256, Build: ignoring}); err == nil {
+		t.Fatal("expected an error for a build ignoring the parameters of the namespace")
+	}
+
+	ts := httptest.NewServer(ns)
+	defer ts.Close()
+	var list namespacesResponse
+	getJSON(t, ts.URL+"/", &list)
+	if len(list.Namespaces) != 2 || list.Namespaces[0] != "allow" || list.Namespaces[1] != "block" {
+		t.Fatalf("unexpected namespaces %v", list.Namespaces)
+	}
+	var allow, block paramsResponse
+	getJSON(t, ts.URL+"/allow/params", &allow)
+	getJSON(t, ts.URL+"/block/params", &block)
+	if allow.ChunkSize != 64 || allow.Hash != "sha512/256" || block.ChunkSize != 512 || block.Hash != "blake3" {
+		t.Fatalf("unexpected parameters %+v and %+v", allow, block)
+	}
+	if allow.ParamsHash == block.ParamsHash || block.FilterBits <= allow.FilterBits {
+		t.Fatal("expected the namespaces to have their own parameters")
+	}
+	if resp, err := http.Get(ts.URL + "/unknown/root"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404 for an unknown namespace, got %v", err)
+	}
+
+	// clients of a namespace verify proofs with its parameters
+	for name, elem := range map[string][]byte{"allow": {1}, "block": {2}} {
+		srv, _ := ns.Server(name)
+		client := &Client{BaseURL: ts.URL + "/" + name, Seed: []byte(seed), Params: verifier.AttestedParams(srv.currentTree().Attestation())}
+		present, err := client.Prove(context.Background(), elem, srv.currentTree().Root())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !present {
+			t.Fatalf("%s: expected element %v to be present", name, elem)
+		}
+	}
+
+	// rotations keep the parameters, and with them the parameter hash
+	srv, _ := ns.Server("block")
+	root := srv.currentTree().Root()
+	if err := ns.Rotate("block"); err != nil {
+		t.Fatal(err)
+	}
+	var rotated paramsResponse
+	getJSON(t, ts.URL+"/block/params", &rotated)
+	if srv.currentTree().Root() == root || rotated.ParamsHash != block.ParamsHash {
+		t.Fatal("expected a new root with the same parameters after a rotation")
+	}
+	if err := ns.Rotate("unknown"); err == nil {
+		t.Fatal("expected an error rotating an unknown namespace")
+	}
+}
+
+func TestNamespaceRotation(t *testing.T) {
+	if err := bloomtree.SetChunkSize(64); err != nil {
+		t.Fatal(err)
+	}
+	var builds int32
+	failing := errors.New("build failed")
+	errs := make(chan error, 1)
+	build := buildFunc("seed", 20, &builds)
+	ns := NewNamespaces()
+	srv, err := ns.Add("rotating", NamespaceConfig{
+		Rotation: 5 * time.Millisecond,
+		Build: func(opts ...bloomtree.Option) (*bloomtree.BloomTree, error) {
+			if atomic.LoadInt32(&builds) >= 3 {
+				return nil, failing
+			}
+			return build(opts...)
+		},
+		OnError: func(name string, err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, failing) {
+			t.Fatalf("expected the build error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected scheduled rotations")
+	}
+	ns.Close()
+	if atomic.LoadInt32(&builds) != 3 || srv.currentTree() == nil {
+		t.Fatalf("expected 3 builds and the last tree to be served, got %d builds", builds)
+	}
+	if _, err := ns.Add("late", NamespaceConfig{Build: build}); err == nil {
+		t.Fatal("expected an error adding a namespace after Close")
+	}
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 from %s, got %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+// SignedRoot is a root attestation signed by the publisher of the tree, together with the time it was issued.
+// Publishers sign the root of every version, and sign it again before it exceeds the maximum age of the
+// policies of their clients.
+type SignedRoot struct {
+	Attestation bloomtree.RootAttestation
+	// IssuedAt is the time the root was signed, with a precision of seconds.
+	IssuedAt  time.Time
+	Signature []byte
+}
+
+type signedRootJSON struct {
+	// Attestation is the canonical JSON of the attestation.
+	Attestation json.RawMessage `json:"attestation"`
+	// IssuedAt is the time the root was signed, in seconds since the Unix epoch.
+	IssuedAt  int64  `json:"issuedAt"`
+	Signature string `json:"signature"`
+}
+
+// SignRoot signs the attestation, issued at the given time, with the private key of the publisher.
+func SignRoot(attestation bloomtree.RootAttestation, issuedAt time.Time, key ed25519.PrivateKey) (*SignedRoot, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	signed := &SignedRoot{Attestation: attestation, IssuedAt: time.Unix(issuedAt.Unix(), 0)}
+	message, err := signed.message()
+	if err != nil {
+		return nil, err
+	}
+	signed.Signature = ed25519.Sign(key, message)
+	return signed, nil
+}
+
+// message returns the signed message, which binds the issue time to the canonical JSON of the attestation.
+func (r *SignedRoot) message() ([]byte, error) {
+	attestation, err := r.Attestation.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("bloom tree root issued at "+strconv.FormatInt(r.IssuedAt.Unix(), 10)+"\n"), attestation...), nil
+}
+
+// Verify returns whether the root was signed with the private key of the given public key.
+func (r *SignedRoot) Verify(key ed25519.PublicKey) bool {
+	message, err := r.message()
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(key, message, r.Signature)
+}
+
+// MarshalJSON encodes the signed root with the canonical JSON of its attestation and a hex encoded signature.
+func (r *SignedRoot) MarshalJSON() ([]byte, error) {
+	attestation, err := r.Attestation.CanonicalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedRootJSON{
+		Attestation: attestation,
+		IssuedAt:    r.IssuedAt.Unix(),
+		Signature:   hex.EncodeToString(r.Signature),
+	})
+}
+
+// UnmarshalJSON decodes the JSON form of a signed root.
+func (r *SignedRoot) UnmarshalJSON(data []byte) error {
+	var aux signedRootJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var a metadataResponse
+	if err := json.Unmarshal(aux.Attestation, &a); err != nil {
+		return fmt.Errorf("decoding attestation: %w", err)
+	}
+	root, err := decodeRoot(a.Root)
+	if err != nil {
+		return fmt.Errorf("decoding root: %w", err)
+	}
+	hash, err := bloomtree.ParseHash(a.Hash)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(aux.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	*r = SignedRoot{
+		Attestation: bloomtree.RootAttestation{
+			Root:        root,
+			ChunkSize:   uint64(a.ChunkSize),
+			Hash:        hash,
+			NumOfHashes: uint64(a.NumOfHashes),
+			FilterBits:  a.FilterBits,
+		},
+		IssuedAt:  time.Unix(aux.IssuedAt, 0),
+		Signature: signature,
+	}
+	return nil
+}
+
+// SetSignedRoot serves the signed root of the served tree at /signed-root, and consistency proofs from the roots
+// kept in the snapshot store at /consistency, so clients can rotate to the root under a RootPolicy. It has to be
+// set again with the signed root of every tree installed with SetTree.
+func (s *Server) SetSignedRoot(signed *SignedRoot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signed = signed
+}
+
+func (s *Server) handleSignedRoot(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	tree, signed := s.tree, s.signed
+	s.mu.RUnlock()
+	if signed == nil || signed.Attestation.Root != tree.Root() {
+		writeError(w, http.StatusNotFound, errors.New("the served root is not signed"))
+		return
+	}
+	writeJSON(w, signed)
+}
+
+// handleConsistency answers with the diff proof from the tree of the root in the from parameter, kept in the
+// snapshot store, to the served tree.
+func (s *Server) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	from, err := decodeRoot(r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.RLock()
+	tree, snapshots := s.tree, s.snapshots
+	s.mu.RUnlock()
+	old := tree
+	if from != tree.Root() {
+		old = nil
+		if snapshots != nil {
+			prover, _ := snapshots.LookupByRoot(from)
+			old, _ = prover.(*bloomtree.BloomTree)
+		}
+		if old == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("root %x is not served", from))
+			return
+		}
+	}
+	proof, err := bloomtree.GenerateDiffProof(old, tree)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+// RootPolicy decides which roots of the server a Client rotates to, see Client.NextRoot. The zero policy
+// accepts no roots, as it has no key to check signatures with.
+type RootPolicy struct {
+	// Key is the public key of the publisher. Roots are only accepted with a valid signature of it.
+	Key ed25519.PublicKey
+	// MaxAge rejects roots signed longer ago, e.g. replayed by a server withholding newer versions. Zero
+	// accepts roots of any age.
+	MaxAge time.Duration
+	// SkipConsistency accepts new roots without a consistency proof from the pinned root. By default, a new
+	// root is only accepted once its diff proof from the pinned root verifies and shows that no bit was
+	// cleared, so no element of the pinned version was removed.
+	SkipConsistency bool
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NextRoot fetches the signed root the server currently serves and returns it if the root policy of the
+// client accepts it as the successor of the pinned root, which is nil for the first root. The signature must
+// verify with the key of the policy, the parameters of the root must be the pinned Params of the client, the
+// root must be no older than the maximum age and not issued before the pinned root, and unless the policy
+// skips it, the consistency proof from the pinned root must verify. Applications pin the returned root and
+// verify proofs against its root.
+func (c *Client) NextRoot(ctx context.Context, pinned *SignedRoot) (*SignedRoot, error) {
+	policy := c.Policy
+	if policy == nil || len(policy.Key) != ed25519.PublicKeySize {
+		return nil, errors.New("the client has no root policy with a key to check signed roots with")
+	}
+	params, err := c.params()
+	if err != nil {
+		return nil, err
+	}
+	var signed SignedRoot
+	if err := c.get(ctx, "/signed-root", nil, &signed); err != nil {
+		return nil, err
+	}
+	if !signed.Verify(policy.Key) {
+		return nil, fmt.Errorf("root %x has an invalid signature", signed.Attestation.Root)
+	}
+	if !sameParams(verifier.AttestedParams(signed.Attestation), params) {
+		return nil, fmt.Errorf("root %x has other parameters than the pinned ones", signed.Attestation.Root)
+	}
+	now := time.Now
+	if policy.Now != nil {
+		now = policy.Now
+	}
+	if age := now().Sub(signed.IssuedAt); policy.MaxAge > 0 && age > policy.MaxAge {
+		return nil, fmt.Errorf("root %x was signed %v ago, longer than the maximum age of %v", signed.Attestation.Root, age, policy.MaxAge)
+	}
+	if pinned == nil {
+		return &signed, nil
+	}
+	if signed.IssuedAt.Before(pinned.IssuedAt) {
+		return nil, fmt.Errorf("root %x was signed before the pinned root", signed.Attestation.Root)
+	}
+	if signed.Attestation.Root == pinned.Attestation.Root || policy.SkipConsistency {
+		return &signed, nil
+	}
+	if err := c.checkConsistency(ctx, pinned.Attestation.Root, signed.Attestation.Root, params); err != nil {
+		return nil, err
+	}
+	return &signed, nil
+}
+
+// checkConsistency requests the diff proof from the old to the new root, and returns an error unless it
+// verifies and only sets bits.
+func (c *Client) checkConsistency(ctx context.Context, oldRoot, newRoot [32]byte, params verifier.Params) error {
+	var proof bloomtree.DiffProof
+	if err := c.get(ctx, "/consistency", url.Values{"from": {hex.EncodeToString(oldRoot[:])}}, &proof); err != nil {
+		return err
+	}
+	verified, err := bloomtree.VerifyDiffProof(&proof, oldRoot, newRoot, params.M, bloomtree.WithChunkSize(chunkSize(params)), bloomtree.WithHash(params.Hash))
+	if err != nil {
+		return fmt.Errorf("verifying the consistency of root %x with the pinned root: %w", newRoot, err)
+	}
+	if !verified {
+		return fmt.Errorf("root %x is not consistent with the pinned root", newRoot)
+	}
+	for _, chunk := range proof.Chunks {
+		for w := range chunk.Old {
+			if chunk.Old[w]&^chunk.New[w] != 0 {
+				return fmt.Errorf("root %x clears bits of chunk %d of the pinned root", newRoot, chunk.Index)
+			}
+		}
+	}
+	return nil
+}
+
+// sameParams returns whether the parameters describe the same bloom filter and tree.
+func sameParams(a, b verifier.Params) bool {
+	return a.M == b.M && a.K == b.K && chunkSize(a) == chunkSize(b) && a.Hash == b.Hash
+}
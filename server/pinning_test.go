@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+func TestNextRoot(t *testing.T) {
+	seed := "secret seed"
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Unix(1700000000, 0)
+	sign := func(tree *bloomtree.BloomTree, issuedAt time.Time, key ed25519.PrivateKey) *SignedRoot {
+		signed, err := SignRoot(tree.Attestation(), issuedAt, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	v1 := generateTree(t, seed, []byte{1}, []byte{2})
+	v2 := generateTree(t, seed, []byte{1}, []byte{2}, []byte{3})
+	removed := generateTree(t, seed, []byte{1})
+	srv := New(v1)
+	snapshots, err := bloomtree.NewSnapshotStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetSnapshots(snapshots)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	ctx := context.Background()
+	client := &Client{
+		BaseURL: ts.URL,
+		Seed:    []byte(seed),
+		Params:  verifier.AttestedParams(v1.Attestation()),
+		Policy:  &RootPolicy{Key: pub, MaxAge: time.Hour, Now: func() time.Time { return issued.Add(time.Minute) }},
+	}
+
+	// the served root is not signed yet
+	if _, err := client.NextRoot(ctx, nil); err == nil {
+		t.Fatal("expected an error for a server without a signed root")
+	}
+	srv.SetSignedRoot(sign(v1, issued, priv))
+	pinned, err := client.NextRoot(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.Attestation.Root != v1.Root() || !pinned.IssuedAt.Equal(issued) {
+		t.Fatalf("expected the signed root of the first version, got %x issued at %v", pinned.Attestation.Root, pinned.IssuedAt)
+	}
+
+	// the next version only adds elements, which the consistency proof from the pinned root shows
+	if _, err := snapshots.Add(v1); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTree(v2)
+	srv.SetSignedRoot(sign(v2, issued.Add(time.Second), priv))
+	next, err := client.NextRoot(ctx, pinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Attestation.Root != v2.Root() {
+		t.Fatalf("expected to rotate to the root of the next version, got %x", next.Attestation.Root)
+	}
+	if present, err := client.Prove(ctx, []byte{3}, next.Attestation.Root); err != nil || !present {
+		t.Fatalf("expected the presence of the added element under the next root, got %v, %v", present, err)
+	}
+
+	var tests = []struct {
+		name   string
+		tree   *bloomtree.BloomTree
+		signed *SignedRoot
+		pinned *SignedRoot
+		modify func(c *Client)
+	}{
+		{name: "removed elements", tree: removed, signed: sign(removed, issued.Add(time.Second), priv), pinned: next},
+		{name: "another key", tree: v2, signed: sign(v2, issued.Add(time.Second), ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))), pinned: pinned},
+		{name: "exceeded age", tree: v2, signed: sign(v2, issued.Add(-2*time.Hour), priv)},
+		{name: "rollback", tree: v1, signed: sign(v1, issued, priv), pinned: next},
+		{name: "other params", tree: v2, signed: sign(v2, issued, priv), modify: func(c *Client) { c.Params.K++ }},
+		{name: "no policy", tree: v2, signed: sign(v2, issued, priv), modify: func(c *Client) { c.Policy = nil }},
+	}
+	if _, err := snapshots.Add(v2); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		srv.SetTree(test.tree)
+		srv.SetSignedRoot(test.signed)
+		c := *client
+		if test.modify != nil {
+			test.modify(&c)
+		}
+		if _, err := c.NextRoot(ctx, test.pinned); err == nil {
+			t.Fatalf("%s: expected the root to be rejected", test.name)
+		}
+	}
+
+	// a consistency proof without chunks does not hide the removed elements
+	srv.SetTree(removed)
+	srv.SetSignedRoot(sign(removed, issued.Add(time.Second), priv))
+	lying := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/consistency" {
+			w.Write([]byte(`{"ChunkSize":64,"Chunks":null,"Proof":null}`))
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer lying.Close()
+	liar := *client
+	liar.BaseURL = lying.URL
+	if _, err := liar.NextRoot(ctx, next); !errors.Is(err, bloomtree.ErrInvalidProof) {
+		t.Fatalf("expected an empty consistency proof to be rejected, got %v", err)
+	}
+
+	// a policy skipping consistency accepts the root removing elements
+	client.Policy.SkipConsistency = true
+	if signed, err := client.NextRoot(ctx, next); err != nil || signed.Attestation.Root != removed.Root() {
+		t.Fatalf("expected the root to be accepted without a consistency proof, got %v", err)
+	}
+}
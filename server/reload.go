@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// Loader builds the tree of an updated filter file, e.g. by decoding the bloom filter and building its tree
+// with the options of the served tree.
+type Loader func(data []byte) (*bloomtree.BloomTree, error)
+
+// Reloader hot reloads the tree of a server from updated filter files, watched at a path with Watch or
+// pushed to it as an http.Handler. The new tree is built while the server keeps serving proofs under the old
+// root, and is then swapped in with SetTree, so every request is answered by either the old or the new tree.
+// The replaced tree is added to the snapshot store of the server, if it has one, so clients can still request
+// proofs against the old root, see SetSnapshots.
+type Reloader struct {
+	server *Server
+	path   string
+	load   Loader
+	// MaxPushBytes limits the size of pushed filter files. Zero is unlimited.
+	MaxPushBytes int64
+
+	// mu serializes reloads, so a slow build does not overtake a later one.
+	mu sync.Mutex
+	// digest is the SHA-256 of the last file loaded from the path, as files rewritten in place may keep their
+	// size and modification time.
+	digest [32]byte
+	loaded bool
+}
+
+// NewReloader returns a reloader installing the trees loaded from the filter file at the path into the
+// server. The path may be empty if filter files are only pushed.
+func NewReloader(s *Server, path string, load Loader) *Reloader {
+	return &Reloader{server: s, path: path, load: load}
+}
+
+// Reload loads the filter file at the path and installs its tree, unless its content did not change since the
+// last reload. It returns whether a new tree was installed. The served tree is kept if the file cannot be
+// loaded.
+func (r *Reloader) Reload() (bool, error) {
+	if r.path == "" {
+		return false, errors.New("the reloader has no path to watch")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	digest := sha256.Sum256(data)
+	if r.loaded && digest == r.digest {
+		return false, nil
+	}
+	if err := r.install(data); err != nil {
+		return false, fmt.Errorf("reloading %s: %w", r.path, err)
+	}
+	r.digest, r.loaded = digest, true
+	return true, nil
+}
+
+// Watch reloads the filter file at the path every interval until the context is done. Errors of a reload
+// are passed to onError, which may be nil, and the old tree is served until a later reload succeeds.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServeHTTP installs the tree of the filter file in the body of a PUT or POST request, and answers with the
+// new root. It should only be served to the publisher of the filter, e.g. on a separate listener, as anyone
+// reaching it can replace the served tree.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut && req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only PUT and POST requests are supported"))
+		return
+	}
+	body := req.Body
+	if r.MaxPushBytes > 0 {
+		body = http.MaxBytesReader(w, req.Body, r.MaxPushBytes)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	r.mu.Lock()
+	err = r.install(data)
+	r.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	r.server.handleRoot(w, req)
+}
+
+// install builds the tree of the filter file and swaps it into the server.
+func (r *Reloader) install(data []byte) error {
+	tree, err := r.load(data)
+	if err != nil {
+		return err
+	}
+	r.server.mu.RLock()
+	old, snapshots := r.server.tree, r.server.snapshots
+	r.server.mu.RUnlock()
+	if snapshots != nil && old != nil && old.Root() != tree.Root() {
+		if _, err := snapshots.Add(old); err != nil {
+			return fmt.Errorf("keeping the replaced tree: %w", err)
+		}
+	}
+	r.server.SetTree(tree)
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+func TestReloader(t *testing.T) {
+	seed := "secret seed"
+	filter := func(elements ...[]byte) []byte {
+		dbf := DBF.NewDbf(200, 0.2, []byte(seed))
+		for _, elem := range elements {
+			dbf.Add(elem)
+		}
+		data, err := dbf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	load := func(data []byte) (*bloomtree.BloomTree, error) {
+		dbf, err := DBF.UnmarshalBinary(data)
+		if err != nil {
+			return nil, err
+		}
+		return bloomtree.NewBloomTree(dbf)
+	}
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "filter")
+	if err := ioutil.WriteFile(path, filter([]byte{1}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := generateTree(t, seed, []byte{1})
+	srv := New(old)
+	snapshots, err := bloomtree.NewSnapshotStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetSnapshots(snapshots)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	ctx := context.Background()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(old.Attestation())}
+	reloader := NewReloader(srv, path, load)
+
+	// the first reload installs the same filter, a second one finds the file unchanged
+	if reloaded, err := reloader.Reload(); err != nil || !reloaded {
+		t.Fatalf("expected the filter file to be loaded, got %v, %v", reloaded, err)
+	}
+	if reloaded, err := reloader.Reload(); err != nil || reloaded {
+		t.Fatalf("expected the unchanged filter file to be skipped, got %v, %v", reloaded, err)
+	}
+
+	// the updated file is swapped in, even though it keeps its size and modification time, while proofs under
+	// the old root are still served
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, filter([]byte{1}, []byte{2}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := os.Stat(path); err != nil || updated.Size() != info.Size() {
+		t.Fatalf("expected the updated filter file to keep its size, got %v", err)
+	}
+	if reloaded, err := reloader.Reload(); err != nil || !reloaded {
+		t.Fatalf("expected the updated filter file to be loaded, got %v, %v", reloaded, err)
+	}
+	root, err := client.Root(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root == old.Root() {
+		t.Fatal("expected the root of the updated filter to be served")
+	}
+	if present, err := client.Prove(ctx, []byte{2}, root); err != nil || !present {
+		t.Fatalf("expected the presence of the added element, got %v, %v", present, err)
+	}
+	if present, err := client.Prove(ctx, []byte{1}, old.Root()); err != nil || !present {
+		t.Fatalf("expected proofs under the old root, got %v, %v", present, err)
+	}
+
+	// a broken file keeps the served tree
+	if err := ioutil.WriteFile(path, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("expected an error for a broken filter file")
+	}
+	if srv.currentTree().Root() != root {
+		t.Fatal("expected the served tree to be kept")
+	}
+
+	// pushed filter files are installed the same way
+	reloader.MaxPushBytes = 1 << 20
+	var tests = []struct {
+		method string
+		body   []byte
+		status int
+	}{
+		{method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, body: []byte("broken"), status: http.StatusUnprocessableEntity},
+		{method: http.MethodPut, body: make([]byte, 2<<20), status: http.StatusRequestEntityTooLarge},
+		{method: http.MethodPost, body: filter([]byte{1}, []byte{2}, []byte{3}), status: http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		reloader.ServeHTTP(rec, httptest.NewRequest(test.method, "/reload", bytes.NewReader(test.body)))
+		if rec.Code != test.status {
+			t.Fatalf("%s: expected status %d, got %d", test.method, test.status, rec.Code)
+		}
+	}
+	var resp rootResponse
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/root", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if pushed, err := decodeRoot(resp.Root); err != nil || pushed == root {
+		t.Fatalf("expected the root of the pushed filter, got %s, %v", resp.Root, err)
+	}
+}
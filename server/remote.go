@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// RemoteTree is a bloomtree.Prover backed by a Server. Every proof it returns was verified against
+// the trusted root first, so it can be used in place of a local tree.
+type RemoteTree struct {
+	client   *Client
+	metadata *Metadata
+}
+
+// NewRemoteTree returns the tree served by the client's server, which must serve the trusted root. Proofs are
+// verified with the pinned parameters of the client.
+func NewRemoteTree(ctx context.Context, client *Client, root [32]byte) (*RemoteTree, error) {
+	metadata, err := client.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Root != root {
+		return nil, fmt.Errorf("the server serves root %x instead of %x", metadata.Root, root)
+	}
+	return &RemoteTree{client: client, metadata: metadata}, nil
+}
+
+// Root returns the trusted root of the tree.
+func (t *RemoteTree) Root() [32]byte {
+	return t.metadata.Root
+}
+
+// Metadata returns the parameters of the tree, as attested by the server when the tree was opened.
+func (t *RemoteTree) Metadata() Metadata {
+	return *t.metadata
+}
+
+// GenerateCompactMultiProof requests the proof of the element from the server and verifies it.
+func (t *RemoteTree) GenerateCompactMultiProof(elem []byte) (*bloomtree.CompactMultiProof, error) {
+	return t.GenerateCompactMultiProofContext(context.Background(), elem)
+}
+
+// GenerateCompactMultiProofContext is GenerateCompactMultiProof with a context for the request.
+// An error is returned if the proof does not verify against the trusted root, e.g. because the
+// server switched to another tree and does not keep the trusted one in its snapshot store.
+func (t *RemoteTree) GenerateCompactMultiProofContext(ctx context.Context, elem []byte) (*bloomtree.CompactMultiProof, error) {
+	multiproof, _, err := t.client.proof(ctx, elem, t.metadata.Root)
+	if err != nil {
+		return nil, err
+	}
+	return multiproof, nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/verifier"
+)
+
+func TestRemoteTree(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	srv := New(tree)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	client := &Client{BaseURL: ts.URL, Seed: []byte(seed), Params: verifier.AttestedParams(tree.Attestation())}
+	ctx := context.Background()
+
+	if _, err := NewRemoteTree(ctx, client, [32]byte{1}); err == nil {
+		t.Fatal("expected error for an untrusted root")
+	}
+	remote, err := NewRemoteTree(ctx, client, tree.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// local and remote trees are used alike
+	for _, prover := range []bloomtree.Prover{tree, remote} {
+		if prover.Root() != tree.Root() {
+			t.Fatal("unexpected root")
+		}
+		for _, elem := range [][]byte{{1}, {42}} {
+			multiproof, err := prover.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(multiproof, expected) {
+				t.Fatalf("unexpected proof of element %v", elem)
+			}
+		}
+	}
+
+	srv.SetTree(generateTree(t, seed, []byte{1}, []byte{2}, []byte{42}))
+	if _, err := remote.GenerateCompactMultiProof([]byte{1}); err == nil {
+		t.Fatal("expected error for a proof against another root")
+	}
+}
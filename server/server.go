@@ -0,0 +1,486 @@
+// Package server exposes a bloom tree over HTTP, and provides a client verifying the responses locally.
+//
+// The server answers the following GET requests with JSON:
+//
+//	/root                    {"root": hex}
+//	/metadata                the canonical JSON of the root attestation
+//	/proof?element=hex       the canonical JSON of the proof of the element
+//	/proof?element=hex&root=hex  the proof against an earlier root kept in the snapshot store, see SetSnapshots
+//	/proof?element=hex&codec=name  the proof encoded with the codec registered under the name, see bloomtree.RegisterCodec
+//	/proof?element=hex&priority=batch  the proof generated in the lane of batch requests, see SetLanes
+//	/batch?element=hex&element=hex  the JSON of the batch proof of the elements, optionally against an earlier root
+//	/anchor?root=hex         the anchor receipt of the root, by default of the served root
+//	/contains?element=hex    {"present": bool, "proof": proof}, or an unproven answer, see SetDegradation
+//	/signed-root             the signed root of the served tree, see SetSignedRoot
+//	/snapshot                the words of the bloom filter, optionally of an earlier root, with chunk aligned Range support
+//	/consistency?from=hex    the JSON of the diff proof from an earlier root kept in the snapshot store to the served root
+//
+// Proofs are compressed with the first registered compressor named by the Accept-Encoding header of the
+// request, see RegisterCompressor, unless compression does not make them smaller.
+//
+// Errors are answered with {"error": message} and a 4xx or 5xx status code. Requests exceeding the budget
+// of the server are answered with status 422 and the exceeded budget, see Budget.
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/labbloom/bloom-tree/anchor"
+)
+
+// Server serves proofs of a bloom tree over HTTP.
+type Server struct {
+	mu        sync.RWMutex
+	tree      *bloomtree.BloomTree
+	receipts  Receipts
+	budget    Budget
+	snapshots *bloomtree.SnapshotStore
+	mux       *http.ServeMux
+	// degradation and rebuilding decide how /contains answers requests that cannot be proven.
+	degradation DegradationPolicy
+	rebuilding  bloomtree.BloomFilter
+	// signed is the signed root of the served tree, see SetSignedRoot.
+	signed *SignedRoot
+	// lanes limits the proofs generated concurrently per priority class, see SetLanes.
+	lanes lanes
+}
+
+// Budget limits the work the server spends on a single proof request, protecting it from pathological
+// queries. Zero fields are unlimited.
+type Budget struct {
+	// MaxChunks is the maximum number of chunks of a proof. Proofs of trees planned to exceed it, see
+	// bloomtree.BloomTree.CoverageProofPlan, are rejected before they are generated.
+	MaxChunks int
+	// MaxProofBytes is the maximum size of the wire format of a proof.
+	MaxProofBytes int
+	// MaxDuration is the maximum time spent generating a proof. The generation of the proof is canceled
+	// once it is exceeded, which only applies to provers generating proofs with a context, like
+	// bloomtree.BloomTree. Proofs of other provers, and the plans checked against MaxChunks, run to completion.
+	MaxDuration time.Duration
+	// Suggestion is sent to clients exceeding the budget. It defaults to DefaultSuggestion.
+	Suggestion string
+}
+
+// DefaultSuggestion is the suggestion sent to clients exceeding the budget of a server.
+const DefaultSuggestion = "request the proofs of several elements from a batch endpoint, which shares chunks and hashes between them"
+
+// Resources limited by a Budget, as reported by BudgetError.
+const (
+	ResourceChunks     = "chunks"
+	ResourceProofBytes = "proofBytes"
+	ResourceDuration   = "duration"
+)
+
+// BudgetError reports a request exceeding the budget of the server. It is sent as the budget field
+// of the error response.
+type BudgetError struct {
+	// Resource is the exceeded resource, e.g. ResourceChunks.
+	Resource string `json:"resource"`
+	// Limit is the budget of the resource, in milliseconds for ResourceDuration.
+	Limit int64 `json:"limit"`
+	// Used is the amount the request needed. It is zero for ResourceDuration, as the request was aborted.
+	Used int64 `json:"used,omitempty"`
+	// Suggestion tells the client how to stay within the budget.
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (e *BudgetError) Error() string {
+	msg := fmt.Sprintf("the request exceeds the %s budget of %d", e.Resource, e.Limit)
+	if e.Used != 0 {
+		msg += fmt.Sprintf(", it needs %d", e.Used)
+	}
+	if e.Suggestion != "" {
+		msg += "; " + e.Suggestion
+	}
+	return msg
+}
+
+// Receipts returns the anchor receipts of roots, e.g. an *anchor.Anchorer.
+type Receipts interface {
+	Receipt(root [32]byte) (*anchor.Receipt, bool)
+}
+
+// New returns a server of the given tree. The tree must not be updated while it is served,
+// a new version has to be installed with SetTree instead.
+func New(tree *bloomtree.BloomTree) *Server {
+	s := &Server{tree: tree, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/root", s.handleRoot)
+	s.mux.HandleFunc("/metadata", s.handleMetadata)
+	s.mux.HandleFunc("/proof", s.handleProof)
+	s.mux.HandleFunc("/batch", s.handleBatch)
+	s.mux.HandleFunc("/anchor", s.handleAnchor)
+	s.mux.HandleFunc("/contains", s.handleContains)
+	s.mux.HandleFunc("/signed-root", s.handleSignedRoot)
+	s.mux.HandleFunc("/consistency", s.handleConsistency)
+	s.mux.HandleFunc("/snapshot", s.handleSnapshot)
+	return s
+}
+
+// SetReceipts serves the anchor receipts of the given source next to the proofs.
+func (s *Server) SetReceipts(receipts Receipts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receipts = receipts
+}
+
+// SetBudget limits the work spent on every following proof request.
+func (s *Server) SetBudget(budget Budget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if budget.Suggestion == "" {
+		budget.Suggestion = DefaultSuggestion
+	}
+	s.budget = budget
+}
+
+// SetSnapshots serves proofs against the earlier roots held by the store, e.g. of the versions replaced by
+// SetTree during a rotation window. Proof requests naming a root that is neither served nor held by the store
+// are answered with status 404.
+func (s *Server) SetSnapshots(snapshots *bloomtree.SnapshotStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots = snapshots
+}
+
+// SetTree replaces the served tree and ends a rebuild. Requests in progress finish with the previous tree.
+func (s *Server) SetTree(tree *bloomtree.BloomTree) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tree = tree
+	s.rebuilding = nil
+}
+
+func (s *Server) currentTree() *bloomtree.BloomTree {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET requests are supported"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	root := s.currentTree().Root()
+	writeJSON(w, rootResponse{Root: hex.EncodeToString(root[:])})
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	data, err := s.currentTree().Attestation().CanonicalJSON()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) handleProof(w http.ResponseWriter, r *http.Request) {
+	element, err := hex.DecodeString(r.URL.Query().Get("element"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	codecName := r.URL.Query().Get("codec")
+	if codecName == "" {
+		codecName = bloomtree.CodecJSON
+	}
+	codec, err := bloomtree.LookupCodec(codecName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	prover, budget, code, err := s.prover(r)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	if code, err := budget.plan(prover, [][]byte{element}); err != nil {
+		writeError(w, code, err)
+		return
+	}
+	release, code, err := s.acquire(r, PriorityInteractive)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	multiproof, err := generateProof(r, prover, element, budget)
+	release()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := budget.check(len(multiproof.Chunks), multiproof.Size()); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	data, err := codec.Marshal(multiproof)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeProof(w, r, codec.ContentType(), data)
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()["element"]
+	if len(values) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("the batch needs at least one element"))
+		return
+	}
+	elements := make([][]byte, len(values))
+	for i, v := range values {
+		var err error
+		if elements[i], err = hex.DecodeString(v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	prover, budget, code, err := s.prover(r)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	batchProver, ok := prover.(interface {
+		GenerateCompactMultiProofBatchCtx(ctx context.Context, elems [][]byte) (*bloomtree.BatchMultiProof, error)
+	})
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the tree of the root does not support batch proofs"))
+		return
+	}
+	if code, err := budget.plan(prover, elements); err != nil {
+		writeError(w, code, err)
+		return
+	}
+	release, code, err := s.acquire(r, PriorityBatch)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	ctx, cancel := budget.context(r)
+	defer cancel()
+	batch, err := batchProver.GenerateCompactMultiProofBatchCtx(ctx, elements)
+	release()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, budget.deadline(r, err))
+		return
+	}
+	if err := budget.checkBatch(batch); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeProof(w, r, "application/json", data)
+}
+
+// prover returns the prover of the root requested by the root parameter, by default the served tree, together
+// with the budget of the request. The status code of the response is returned with an error.
+func (s *Server) prover(r *http.Request) (bloomtree.Prover, Budget, int, error) {
+	s.mu.RLock()
+	tree, budget, snapshots, rebuilding := s.tree, s.budget, s.snapshots, s.rebuilding != nil
+	s.mu.RUnlock()
+	v := r.URL.Query().Get("root")
+	if v == "" {
+		if rebuilding {
+			return nil, budget, http.StatusServiceUnavailable, errRebuilding
+		}
+		return tree, budget, 0, nil
+	}
+	root, err := decodeRoot(v)
+	if err != nil {
+		return nil, budget, http.StatusBadRequest, err
+	}
+	if root == tree.Root() {
+		if rebuilding {
+			return nil, budget, http.StatusServiceUnavailable, errRebuilding
+		}
+		return tree, budget, 0, nil
+	}
+	if snapshots != nil {
+		if prover, ok := snapshots.LookupByRoot(root); ok {
+			return prover, budget, 0, nil
+		}
+	}
+	return nil, budget, http.StatusNotFound, fmt.Errorf("root %x is not served", root)
+}
+
+func (s *Server) handleAnchor(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	tree, receipts := s.tree, s.receipts
+	s.mu.RUnlock()
+	root := tree.Root()
+	if v := r.URL.Query().Get("root"); v != "" {
+		var err error
+		if root, err = decodeRoot(v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	var receipt *anchor.Receipt
+	if receipts != nil {
+		receipt, _ = receipts.Receipt(root)
+	}
+	if receipt == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("root %x is not anchored", root))
+		return
+	}
+	writeJSON(w, receipt)
+}
+
+// generateProof generates the proof of the element, aborting once the request is canceled or its
+// budget is exceeded.
+func generateProof(r *http.Request, prover bloomtree.Prover, element []byte, budget Budget) (*bloomtree.CompactMultiProof, error) {
+	ctx, cancel := budget.context(r)
+	defer cancel()
+	var (
+		multiproof *bloomtree.CompactMultiProof
+		err        error
+	)
+	if tree, ok := prover.(*bloomtree.BloomTree); ok {
+		multiproof, err = tree.GenerateCompactMultiProofCtx(ctx, element)
+	} else {
+		multiproof, err = prover.GenerateCompactMultiProof(element)
+	}
+	return multiproof, budget.deadline(r, err)
+}
+
+// context returns the context of the request, canceled once the duration budget is exceeded.
+func (b Budget) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if b.MaxDuration > 0 {
+		return context.WithTimeout(r.Context(), b.MaxDuration)
+	}
+	return r.Context(), func() {}
+}
+
+// deadline returns a *BudgetError if the error reports an exceeded duration budget rather than a canceled
+// request, and the error otherwise.
+func (b Budget) deadline(r *http.Request, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil {
+		return &BudgetError{
+			Resource:   ResourceDuration,
+			Limit:      int64(b.MaxDuration / time.Millisecond),
+			Suggestion: b.Suggestion,
+		}
+	}
+	return err
+}
+
+// plan returns a *BudgetError if the proof of the elements is planned to exceed the chunk budget, so proofs
+// of pathological queries are rejected before they are generated. The distinct chunks of the plan are a lower
+// bound of the chunks of a single proof, which repeats the chunks of indices sharing them, so generated proofs
+// are checked again. Provers that cannot plan their proofs are only checked once the proof is generated. The
+// status code of the response is returned with an error: elements the bloom filter maps to no indices or to
+// indices out of its range cannot be proven, so they are answered like proofs exceeding the budget.
+func (b Budget) plan(prover bloomtree.Prover, elements [][]byte) (int, error) {
+	planner, ok := prover.(interface {
+		CoverageProofPlan(elems [][]byte) (*bloomtree.ProofPlan, error)
+	})
+	if b.MaxChunks <= 0 || !ok {
+		return 0, nil
+	}
+	plan, err := planner.CoverageProofPlan(elements)
+	if errors.Is(err, bloomtree.ErrIndexOutOfRange) || errors.Is(err, bloomtree.ErrNoIndices) {
+		return http.StatusUnprocessableEntity, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := b.check(plan.Chunks, 0); err != nil {
+		return http.StatusUnprocessableEntity, err
+	}
+	return 0, nil
+}
+
+// check returns a *BudgetError if a proof of the given number of chunks and size exceeds the budget.
+func (b Budget) check(chunks, size int) error {
+	if b.MaxChunks > 0 && chunks > b.MaxChunks {
+		return &BudgetError{
+			Resource:   ResourceChunks,
+			Limit:      int64(b.MaxChunks),
+			Used:       int64(chunks),
+			Suggestion: b.Suggestion,
+		}
+	}
+	if b.MaxProofBytes > 0 {
+		if size > b.MaxProofBytes {
+			return &BudgetError{
+				Resource:   ResourceProofBytes,
+				Limit:      int64(b.MaxProofBytes),
+				Used:       int64(size),
+				Suggestion: b.Suggestion,
+			}
+		}
+	}
+	return nil
+}
+
+// checkBatch returns a *BudgetError if the batch proof exceeds the budget. The size of a batch proof is the
+// sum of the costs of its elements.
+func (b Budget) checkBatch(batch *bloomtree.BatchMultiProof) error {
+	size := 0
+	for _, cost := range batch.Costs {
+		size += cost.Bytes
+	}
+	return b.check(len(batch.Chunks), size)
+}
+
+type rootResponse struct {
+	Root string `json:"root"`
+}
+
+type errorResponse struct {
+	Error  string       `json:"error"`
+	Budget *BudgetError `json:"budget,omitempty"`
+}
+
+// writeProof answers with the encoded proof, compressed if the client accepts a registered compression and
+// compression makes it smaller.
+func writeProof(w http.ResponseWriter, r *http.Request, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept-Encoding")
+	if name, compressor, ok := negotiateCompression(r.Header.Get("Accept-Encoding")); ok {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(compressed) < len(data) {
+			w.Header().Set("Content-Encoding", name)
+			data = compressed
+		}
+	}
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the error. Budget errors are always answered with status 422.
+func writeError(w http.ResponseWriter, code int, err error) {
+	resp := errorResponse{Error: err.Error()}
+	if errors.As(err, &resp.Budget) {
+		code = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
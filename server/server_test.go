@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+func generateTree(t *testing.T, seed string, elements ...[]byte) *bloomtree.BloomTree {
+	if err := bloomtree.SetChunkSize(64); err != nil {
+		t.Fatal(err)
+	}
+	dbf := DBF.NewDbf(200, 0.2, []byte(seed))
+	for _, elem := range elements {
+		dbf.Add(elem)
+	}
+	tree, err := bloomtree.NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestServer(t *testing.T) {
+	tree := generateTree(t, "secret seed", []byte{1}, []byte{2})
+	srv := New(tree)
+	var tests = []struct {
+		method string
+		target string
+		status int
+	}{
+		{method: http.MethodGet, target: "/root", status: http.StatusOK},
+		{method: http.MethodGet, target: "/metadata", status: http.StatusOK},
+		{method: http.MethodGet, target: "/proof?element=01", status: http.StatusOK},
+		{method: http.MethodGet, target: "/proof?element=01&codec=wire", status: http.StatusOK},
+		{method: http.MethodGet, target: "/proof?element=01&codec=unknown", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/proof?element=zz", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/proof?element=01&root=zz", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/proof?element=01&root=" + strings.Repeat("00", 32), status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/batch?element=01&element=2a", status: http.StatusOK},
+		{method: http.MethodGet, target: "/batch", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/batch?element=01&element=zz", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/batch?element=01&root=" + strings.Repeat("00", 32), status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/anchor", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/anchor?root=zz", status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/root", status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/unknown", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+		if rec.Code != test.status {
+			t.Fatalf("expected status %d for %s %s, but got %d", test.status, test.method, test.target, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/root", nil))
+	var resp rootResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	if resp.Root != hex.EncodeToString(root[:]) {
+		t.Fatalf("expected root %x, but got %s", root, resp.Root)
+	}
+
+	// proofs are compressed if the client accepts it
+	for _, target := range []string{"/proof?element=01", "/batch?element=01&element=02&element=2a"} {
+		plain := httptest.NewRecorder()
+		srv.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, target, nil))
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Encoding", "br, gzip")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != CompressionGzip || rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: expected a gzip response, but got status %d and headers %v", target, rec.Code, rec.Header())
+		}
+		if plain.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("%s: expected an uncompressed response without Accept-Encoding", target)
+		}
+		data, err := gzipCompressor{}.Decompress(rec.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, plain.Body.Bytes()) || len(rec.Body.Bytes()) >= len(data) {
+			t.Fatalf("%s: expected the compressed proof to be smaller than the proof", target)
+		}
+	}
+}
+
+func TestServerBudget(t *testing.T) {
+	tree := generateTree(t, "secret seed", []byte{1}, []byte{2})
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, size := len(multiproof.Chunks), multiproof.Size()
+	var tests = []struct {
+		budget   Budget
+		resource string
+	}{
+		{budget: Budget{}},
+		{budget: Budget{MaxChunks: chunks, MaxProofBytes: size, MaxDuration: time.Minute}},
+		{budget: Budget{MaxChunks: chunks - 1}, resource: ResourceChunks},
+		{budget: Budget{MaxProofBytes: size - 1}, resource: ResourceProofBytes},
+	}
+	for _, test := range tests {
+		srv := New(tree)
+		srv.SetBudget(test.budget)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proof?element=01", nil))
+		if test.resource == "" {
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d within budget %+v, but got %d", http.StatusOK, test.budget, rec.Code)
+			}
+			continue
+		}
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected status %d for budget %+v, but got %d", http.StatusUnprocessableEntity, test.budget, rec.Code)
+		}
+		var resp errorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Budget == nil || resp.Budget.Resource != test.resource || resp.Budget.Suggestion != DefaultSuggestion {
+			t.Fatalf("unexpected budget error %+v", resp.Budget)
+		}
+	}
+
+	// batch proofs are limited by the same budget
+	batch, err := tree.GenerateCompactMultiProofBatch([][]byte{{1}, {2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for maxChunks, status := range map[int]int{
+		len(batch.Chunks):     http.StatusOK,
+		len(batch.Chunks) - 1: http.StatusUnprocessableEntity,
+	} {
+		srv := New(tree)
+		srv.SetBudget(Budget{MaxChunks: maxChunks})
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch?element=01&element=02", nil))
+		if rec.Code != status {
+			t.Fatalf("expected status %d of the batch proof for at most %d chunks, but got %d", status, maxChunks, rec.Code)
+		}
+	}
+
+	// proofs planned to exceed the budget are rejected before they read a node
+	dbf := DBF.NewDbf(200, 0.2, []byte("secret seed"))
+	dbf.Add([]byte{1})
+	n, err := bloomtree.TreeLength(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := bloomtree.NewFaultStore(bloomtree.NewMemoryStore(n), bloomtree.Faults{})
+	stored, err := bloomtree.NewBloomTree(dbf, bloomtree.WithNodeStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetFaults(bloomtree.Faults{ReadErrorRate: 1})
+	srv := New(stored)
+	srv.SetDegradation(DegradeToFilter)
+	srv.SetBudget(Budget{MaxChunks: 1})
+	for _, target := range []string{"/proof?element=01", "/contains?element=01", "/batch?element=01&element=02"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected status %d for a proof planned to exceed the budget, but got %d", target, http.StatusUnprocessableEntity, rec.Code)
+		}
+	}
+
+	// elements the filter cannot prove fail the plan as requests that cannot be processed
+	broken, err := bloomtree.NewBloomTree(&outOfRangeBF{DistBF: dbf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = New(broken)
+	srv.SetDegradation(DegradeToFilter)
+	srv.SetBudget(Budget{MaxChunks: 10})
+	for _, target := range []string{"/proof?element=01", "/contains?element=01", "/batch?element=01&element=02"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected status %d for an element out of range, but got %d", target, http.StatusUnprocessableEntity, rec.Code)
+		}
+	}
+}
+
+// outOfRangeBF is a bloom filter mapping every element past the end of its bit array.
+type outOfRangeBF struct {
+	*DBF.DistBF
+}
+
+func (f *outOfRangeBF) Proof([]byte) ([]uint64, bool) {
+	return []uint64{uint64(f.BitArray().Len())}, true
+}
+
+func TestServerSnapshotsOfServedTree(t *testing.T) {
+	seed := "secret seed"
+	tree := generateTree(t, seed, []byte{1}, []byte{2})
+	srv := New(tree)
+	snapshots, err := bloomtree.NewSnapshotStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetSnapshots(snapshots)
+
+	// the served tree is added to the store while its proofs are generated
+	var wg sync.WaitGroup
+	codes := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				rec := httptest.NewRecorder()
+				srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proof?element=01", nil))
+				if rec.Code != http.StatusOK {
+					codes <- rec.Code
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 20; j++ {
+		if _, err := snapshots.Add(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		t.Fatalf("expected proofs while the served tree is snapshotted, got status %d", code)
+	}
+	if roots := snapshots.Roots(); len(roots) != 1 || roots[0] != tree.Root() {
+		t.Fatalf("expected the store to hold the served root, got %x", roots)
+	}
+}
@@ -0,0 +1,93 @@
+package bloomtree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errReadOnlyStore is recorded by a SharedFileStore when a node is written.
+var errReadOnlyStore = errors.New("the shared file store is read-only")
+
+// SharedFileStore is a read-only NodeStore of a file written by a FileStore. Several processes on a host, e.g.
+// a prover, a sidecar verifier and admin tooling, can open the same file: the file is mapped into memory where
+// the platform supports it, so the processes share the page cache instead of each reading the nodes, and it is
+// locked shared until the store is closed, so CreateFileStore and OpenFileStore return ErrStoreLocked instead of
+// truncating or changing a file in use. A rebuilder should write a new file and rename it over the old one:
+// readers keep the nodes of the old file until they reopen the path.
+type SharedFileStore struct {
+	storeErr
+	f    *os.File
+	n    int
+	data []byte
+}
+
+// OpenSharedFileStore opens the nodes stored in the file at path read-only. It returns ErrStoreLocked while the
+// file is opened by a FileStore, e.g. while it is being rebuilt.
+func OpenSharedFileStore(path string) (*SharedFileStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// the size is read once the file is locked, as it cannot change afterwards
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size()%32 != 0 {
+		f.Close()
+		return nil, fmt.Errorf("the size %d of %s is not a multiple of the node size", info.Size(), path)
+	}
+	s := &SharedFileStore{f: f, n: int(info.Size() / 32)}
+	if s.n > 0 {
+		if s.data, err = mapFile(f, int(info.Size())); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("mapping %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of nodes.
+func (s *SharedFileStore) Len() int { return s.n }
+
+// Node reads the node at index i.
+func (s *SharedFileStore) Node(i int) [32]byte {
+	var h [32]byte
+	if i < 0 || i >= s.n {
+		s.set(fmt.Errorf("reading node %d of %d", i, s.n))
+		return h
+	}
+	if s.data != nil {
+		copy(h[:], s.data[i*32:])
+		return h
+	}
+	if _, err := s.f.ReadAt(h[:], int64(i)*32); err != nil {
+		s.set(fmt.Errorf("reading node %d: %w", i, err))
+	}
+	return h
+}
+
+// SetNode records an error, as the store is read-only.
+func (s *SharedFileStore) SetNode(i int, h [32]byte) {
+	s.set(fmt.Errorf("writing node %d: %w", i, errReadOnlyStore))
+}
+
+// Close unmaps and closes the file of the store and releases its lock. The store and the trees opened from it
+// must not be used afterwards.
+func (s *SharedFileStore) Close() error {
+	var err error
+	if s.data != nil {
+		err = unmapFile(s.data)
+		s.data = nil
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
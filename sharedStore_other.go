@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package bloomtree
+
+import "os"
+
+// lockingSupported tells whether the files of node stores are locked on this platform.
+const lockingSupported = false
+
+// lockFile does nothing, files are not locked on this platform.
+func lockFile(f *os.File, shared bool) error {
+	return nil
+}
+
+// mapFile returns no mapping, so the nodes are read from the file.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return nil, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package bloomtree
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSharedFileStore(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dir, err := ioutil.TempDir("", "bloomtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nodes")
+
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	n, err := TreeLength(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := CreateFileStore(path, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewBloomTree(dbf, WithNodeStore(fileStore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	if lockingSupported {
+		if _, err := OpenSharedFileStore(path); !errors.Is(err, ErrStoreLocked) {
+			t.Fatalf("expected ErrStoreLocked opening a file being built, but got %v", err)
+		}
+	}
+	if err := fileStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// several readers share the file
+	var readers []*SharedFileStore
+	for i := 0; i < 2; i++ {
+		store, err := OpenSharedFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		readers = append(readers, store)
+
+		opened, err := OpenBloomTree(dbf, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened.Root() != root {
+			t.Fatal("root of the shared file store does not match")
+		}
+		multiproof, err := opened.GenerateCompactMultiProof([]byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyCompactMultiProof([]byte{1}, []byte(seed), multiproof, opened.Root(), dbf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatal("failed to verify proof of the shared file store")
+		}
+		if store.SetNode(0, [32]byte{}); !errors.Is(store.Err(), errReadOnlyStore) {
+			t.Fatalf("expected an error writing to a read-only store, but got %v", store.Err())
+		}
+	}
+
+	// a rebuilder cannot truncate or open the file while it is read
+	if lockingSupported {
+		if _, err := CreateFileStore(path, n); !errors.Is(err, ErrStoreLocked) {
+			t.Fatalf("expected ErrStoreLocked creating a file in use, but got %v", err)
+		}
+		if _, err := OpenFileStore(path); !errors.Is(err, ErrStoreLocked) {
+			t.Fatalf("expected ErrStoreLocked opening a file in use, but got %v", err)
+		}
+		if info, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if info.Size() != int64(n)*32 {
+			t.Fatalf("expected the file in use to keep its size %d, but got %d", n*32, info.Size())
+		}
+	}
+	for _, store := range readers {
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rebuilt, err := CreateFileStore(path, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt.Close()
+}
@@ -0,0 +1,156 @@
+package bloomtree
+
+import (
+	"errors"
+
+	"github.com/willf/bitset"
+)
+
+// snapshotPageNodes is the number of nodes per copy-on-write page of trees with snapshots.
+const snapshotPageNodes = 1024
+
+// pagedNodes is a NodeStore of copy-on-write pages. Pages shared with a snapshot are
+// copied on their first write, so snapshots only cost memory for the pages changed since.
+type pagedNodes struct {
+	pages [][][32]byte
+	// owned reports whether a page is private to the store and can be written in place.
+	owned []bool
+	n     int
+}
+
+// newPagedNodes returns a store of the nodes, whose pages are written in place.
+func newPagedNodes(nodes [][32]byte) *pagedNodes {
+	s := &pagedNodes{n: len(nodes)}
+	for start := 0; start < len(nodes); start += snapshotPageNodes {
+		end := start + snapshotPageNodes
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		s.pages = append(s.pages, nodes[start:end:end])
+		s.owned = append(s.owned, true)
+	}
+	return s
+}
+
+// newSharedPages returns a store of the nodes, whose pages are copied before they are written, so the nodes
+// are never modified by the store.
+func newSharedPages(nodes [][32]byte) *pagedNodes {
+	s := newPagedNodes(nodes)
+	for p := range s.owned {
+		s.owned[p] = false
+	}
+	return s
+}
+
+func (s *pagedNodes) Len() int { return s.n }
+
+func (s *pagedNodes) Node(i int) [32]byte {
+	return s.pages[i/snapshotPageNodes][i%snapshotPageNodes]
+}
+
+func (s *pagedNodes) SetNode(i int, h [32]byte) {
+	p := i / snapshotPageNodes
+	if !s.owned[p] {
+		s.pages[p] = append([][32]byte(nil), s.pages[p]...)
+		s.owned[p] = true
+	}
+	s.pages[p][i%snapshotPageNodes] = h
+}
+
+func (s *pagedNodes) Err() error { return nil }
+
+// share returns a store sharing all pages with s. Both stores copy a page before writing it. It only
+// writes the ownership of the pages, which Node does not read, so it may run next to reads of s, but not
+// next to writes or other calls of share.
+func (s *pagedNodes) share() *pagedNodes {
+	for p := range s.owned {
+		if s.owned[p] {
+			s.owned[p] = false
+		}
+	}
+	return &pagedNodes{
+		pages: append([][][32]byte(nil), s.pages...),
+		owned: make([]bool, len(s.owned)),
+		n:     s.n,
+	}
+}
+
+// snapshotFilter is a bloom filter with a frozen copy of the bits of another bloom filter.
+type snapshotFilter struct {
+	BloomFilter
+	bits *bitset.BitSet
+}
+
+func (f *snapshotFilter) BitArray() *bitset.BitSet {
+	return f.bits
+}
+
+// Proof works like the Proof of DBF bloom filters on the frozen bits.
+func (f *snapshotFilter) Proof(elem []byte) ([]uint64, bool) {
+	var ret []uint64
+	for _, v := range f.GetElementIndices(elem) {
+		if !f.bits.Test(v) {
+			return []uint64{uint64(v)}, false
+		}
+		ret = append(ret, uint64(v))
+	}
+	return ret, true
+}
+
+// Snapshot returns a copy of the tree and its bloom filter bits, which can still generate proofs against
+// the current root after the tree has been updated. The nodes are shared in copy-on-write pages, so a
+// snapshot only costs memory for a copy of the bloom filter bits and the pages changed afterwards.
+// Updating the snapshot does not affect the tree, and vice versa. Snapshot only reads the tree, so it may
+// be called while the tree generates proofs, but not while it is updated. Trees whose nodes are kept in a
+// NodeStore cannot be snapshotted.
+func (bt *BloomTree) Snapshot() (*BloomTree, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	bt.snapshotMu.Lock()
+	defer bt.snapshotMu.Unlock()
+	var store *pagedNodes
+	if bt.store == nil {
+		// the tree keeps reading its nodes in place, and moves to shared pages on its next write
+		store = newSharedPages(bt.nodes)
+		bt.nodesShared = true
+	} else if paged, ok := bt.store.(*pagedNodes); ok {
+		store = paged.share()
+	} else {
+		return nil, errors.New("trees kept in a node store cannot be snapshotted")
+	}
+	return &BloomTree{
+		bf:         &snapshotFilter{BloomFilter: bt.bf, bits: bt.bf.BitArray().Clone()},
+		bounds:     bt.bounds,
+		checksums:  append([]uint64(nil), bt.checksums...),
+		store:      store,
+		cfg:        bt.cfg,
+		access:     bt.access,
+		provenance: bt.provenance.clone(),
+		manifest:   bt.manifest,
+	}, nil
+}
+
+// unshareNodes moves the nodes of the tree, shared with a snapshot, to copy-on-write pages before a write.
+func (bt *BloomTree) unshareNodes() {
+	bt.snapshotMu.Lock()
+	defer bt.snapshotMu.Unlock()
+	if bt.store == nil {
+		bt.store, bt.nodes = newSharedPages(bt.nodes), nil
+	}
+	bt.nodesShared = false
+}
+
+// Freeze returns an immutable view of the tree at its current root. The view holds a copy of the bloom
+// filter bits, so it is not affected by later updates of the tree or direct changes to its bloom filter,
+// and it can generate proofs concurrently while the tree is modified. All modifications of the view fail
+// with ErrFrozen; the bloom filter returned by its GetBloomFilter must not be modified either. Like
+// snapshots, trees whose nodes are kept in a NodeStore cannot be frozen.
+func (bt *BloomTree) Freeze() (*BloomTree, error) {
+	frozen, err := bt.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	frozen.frozen = true
+	return frozen, nil
+}
@@ -0,0 +1,86 @@
+package bloomtree
+
+import (
+	"errors"
+	"sync"
+)
+
+// SnapshotStore keeps frozen versions of a tree addressed by their root, so proofs against a recently
+// replaced root can still be served while clients rotate to the new one. The store holds a bounded number
+// of versions and evicts the oldest first. It is safe for concurrent use.
+type SnapshotStore struct {
+	mu       sync.RWMutex
+	capacity int
+	trees    map[[32]byte]*BloomTree
+	// roots are the roots of the trees, oldest first.
+	roots [][32]byte
+}
+
+// NewSnapshotStore returns a store holding up to capacity versions.
+func NewSnapshotStore(capacity int) (*SnapshotStore, error) {
+	if capacity < 1 {
+		return nil, errors.New("the snapshot store must hold at least one version")
+	}
+	return &SnapshotStore{capacity: capacity, trees: make(map[[32]byte]*BloomTree)}, nil
+}
+
+// Add freezes the current version of the tree, see Freeze, and adds it to the store, evicting the oldest
+// version if the store is full. It returns the root of the version. Adding a root that is already held makes
+// it the newest version. Freezing only reads the tree, so a served tree may be added while it generates
+// proofs, but not while it is updated. The tree may be updated afterwards without affecting the stored version.
+func (s *SnapshotStore) Add(bt *BloomTree) ([32]byte, error) {
+	frozen, err := bt.Freeze()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	root := frozen.Root()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(root)
+	s.trees[root] = frozen
+	s.roots = append(s.roots, root)
+	for len(s.roots) > s.capacity {
+		delete(s.trees, s.roots[0])
+		s.roots = s.roots[1:]
+	}
+	return root, nil
+}
+
+// LookupByRoot returns the version of the tree with the given root, or false if the store does not hold it.
+// The returned prover is a frozen tree.
+func (s *SnapshotStore) LookupByRoot(root [32]byte) (Prover, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tree, ok := s.trees[root]
+	if !ok {
+		return nil, false
+	}
+	return tree, true
+}
+
+// Remove drops the version with the given root, e.g. once it must no longer be served.
+func (s *SnapshotStore) Remove(root [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(root)
+}
+
+func (s *SnapshotStore) remove(root [32]byte) {
+	if _, ok := s.trees[root]; !ok {
+		return
+	}
+	delete(s.trees, root)
+	for i, r := range s.roots {
+		if r == root {
+			s.roots = append(s.roots[:i:i], s.roots[i+1:]...)
+			break
+		}
+	}
+}
+
+// Roots returns the roots of the held versions, oldest first.
+func (s *SnapshotStore) Roots() [][32]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([][32]byte(nil), s.roots...)
+}
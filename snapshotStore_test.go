@@ -0,0 +1,79 @@
+package bloomtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSnapshotStore(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roots [][32]byte
+	for _, elem := range [][]byte{{2}, {3}, {4}} {
+		root, err := store.Add(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+		if err := tree.Update(elem); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.LookupByRoot(roots[0]); ok {
+		t.Fatal("expected the oldest version to be evicted")
+	}
+	if !reflect.DeepEqual(store.Roots(), roots[1:]) {
+		t.Fatalf("expected roots %x, but got %x", roots[1:], store.Roots())
+	}
+	// the version of root 1 holds {1} and {2}, but not {3}, which was added afterwards
+	prover, ok := store.LookupByRoot(roots[1])
+	if !ok {
+		t.Fatal("expected the version to be held")
+	}
+	if prover.Root() != roots[1] {
+		t.Fatalf("expected root %x, but got %x", roots[1], prover.Root())
+	}
+	for _, test := range []struct {
+		elem    []byte
+		present bool
+	}{
+		{elem: []byte{2}, present: true},
+		{elem: []byte{3}, present: false},
+	} {
+		multiproof, err := prover.GenerateCompactMultiProof(test.elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present := multiproof.Type() == Presence; present != test.present {
+			t.Fatalf("expected presence %t of %v in the stale version, but got %t", test.present, test.elem, present)
+		}
+		verified, err := VerifyCompactMultiProof(test.elem, []byte(seed), multiproof, roots[1], prover.(*BloomTree).GetBloomFilter())
+		if err != nil || !verified {
+			t.Fatalf("expected the proof of %v to verify against the stale root, but got %v, %v", test.elem, verified, err)
+		}
+	}
+
+	// adding a held root makes it the newest version
+	if _, err := store.Add(prover.(*BloomTree)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := [][32]byte{roots[2], roots[1]}; !reflect.DeepEqual(store.Roots(), expected) {
+		t.Fatalf("expected roots %x, but got %x", expected, store.Roots())
+	}
+	store.Remove(roots[1])
+	if _, ok := store.LookupByRoot(roots[1]); ok || len(store.Roots()) != 1 {
+		t.Fatal("expected the removed version to be dropped")
+	}
+	if _, err := NewSnapshotStore(0); err == nil {
+		t.Fatal("expected error for a store without capacity")
+	}
+}
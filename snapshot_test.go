@@ -0,0 +1,216 @@
+package bloomtree
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(20000, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := tree.Root()
+	snapshot, err := tree.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range [][]byte{{3}, {4}} {
+		if err := tree.Update(elem); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snapshot.Root() != oldRoot || tree.Root() == oldRoot {
+		t.Fatal("expected the snapshot to keep the old root")
+	}
+
+	// only the pages holding updated nodes were copied
+	live, shared := tree.store.(*pagedNodes), snapshot.store.(*pagedNodes)
+	var copied int
+	for p := range live.pages {
+		if &live.pages[p][0] != &shared.pages[p][0] {
+			copied++
+		}
+	}
+	if copied == 0 || copied > 6 {
+		t.Fatalf("expected a few copied pages, but got %d of %d", copied, len(live.pages))
+	}
+
+	for _, test := range []struct {
+		bt      *BloomTree
+		elem    []byte
+		present bool
+	}{
+		{bt: snapshot, elem: []byte{1}, present: true},
+		{bt: snapshot, elem: []byte{3}, present: false},
+		{bt: tree, elem: []byte{3}, present: true},
+	} {
+		multiproof, err := test.bt.GenerateCompactMultiProof(test.elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if multiproof.ProofType.IsPresence() != test.present {
+			t.Fatalf("expected presence %t of element %v", test.present, test.elem)
+		}
+		verified, err := VerifyCompactMultiProof(test.elem, []byte(seed), multiproof, test.bt.Root(), test.bt.GetBloomFilter())
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify proof of element %v", test.elem)
+		}
+	}
+
+	// updating the snapshot does not affect the tree
+	root := tree.Root()
+	if err := snapshot.SetBits([]uint64{5}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != root {
+		t.Fatal("updating the snapshot changed the tree")
+	}
+}
+
+func TestSnapshotConcurrentProofs(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(2000, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+
+	// snapshots only read the tree, so they can be taken while it is proven
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				multiproof, err := tree.GenerateCompactMultiProof([]byte{byte(j)})
+				if err == nil {
+					var verified bool
+					verified, err = VerifyCompactMultiProof([]byte{byte(j)}, []byte(seed), multiproof, root, dbf)
+					if err == nil && !verified {
+						err = errors.New("failed to verify proof while the tree is snapshotted")
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var snapshots []*BloomTree
+	for j := 0; j < 20; j++ {
+		snapshot, err := tree.Freeze()
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// the tree moves to copy-on-write pages on its next write, so the snapshots keep their root
+	if tree.store != nil {
+		t.Fatal("expected snapshots not to change the storage of the tree")
+	}
+	if err := tree.Update([]byte{42}); err != nil {
+		t.Fatal(err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Root() != root {
+			t.Fatal("updating the tree changed a snapshot")
+		}
+	}
+	if tree.Root() == root {
+		t.Fatal("expected the update to change the root of the tree")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(2000, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithChunkChecksums())
+	if err != nil {
+		t.Fatal(err)
+	}
+	frozen, err := tree.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := frozen.Root()
+	filter := frozen.GetBloomFilter()
+
+	// proofs of the frozen view verify while the tree and its bloom filter are modified
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, elem := range [][]byte{{1}, {2}, {byte(j + 3)}} {
+					multiproof, err := frozen.GenerateCompactMultiProof(elem)
+					if err == nil {
+						var verified bool
+						verified, err = VerifyCompactMultiProof(elem, []byte(seed), multiproof, root, filter)
+						if err == nil && !verified {
+							err = errors.New("failed to verify proof of the frozen tree")
+						}
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		if err := tree.Update([]byte{byte(j + 3)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if frozen.Root() != root || tree.Root() == root {
+		t.Fatal("expected the frozen view to keep its root")
+	}
+
+	for _, modify := range []func() error{
+		func() error { return frozen.Update([]byte{42}) },
+		func() error { return frozen.SetBits([]uint64{0}) },
+		func() error { _, err := frozen.Refresh(); return err },
+		func() error { return frozen.SetBloomFilter(dbf) },
+	} {
+		if err := modify(); !errors.Is(err, ErrFrozen) {
+			t.Fatalf("expected error %v, but got %v", ErrFrozen, err)
+		}
+	}
+	// snapshots of a frozen view can be modified again
+	snapshot, err := frozen.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Update([]byte{42}); err != nil {
+		t.Fatal(err)
+	}
+	if frozen.Root() != root {
+		t.Fatal("updating a snapshot changed the frozen view")
+	}
+}
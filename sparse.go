@@ -0,0 +1,208 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"sync"
+
+	"github.com/labbloom/bloom-tree/core"
+)
+
+// WithSparse builds a sparse tree, for bloom filters with few set bits like negative caches. Sparse trees hash
+// like dense trees, so they have the root and the proofs of the dense tree of the same bloom filter and are
+// verified without any option, but they only keep the nodes above non-empty chunks and the nodes of the layers
+// with subtrees of 64 leafs and up. The hash of another subtree of empty chunks is computed from its at most 64
+// leafs when a proof needs it, so the empty chunks of a tree need a 64th of the memory of a dense tree.
+//
+// Sparse trees cannot use the EVM layout, word trees, blinding, legacy padding or a node store.
+func WithSparse() Option {
+	return func(c *config) error {
+		c.sparse = true
+		return nil
+	}
+}
+
+// sparseLayer is the lowest layer of sparse trees whose nodes are all kept, so computing the hash of an empty
+// subtree hashes at most 64 leafs.
+const sparseLayer = 6
+
+// checkSparse returns an error if the configuration cannot build a sparse tree.
+func (c config) checkSparse() error {
+	if !c.sparse {
+		return nil
+	}
+	if c.evm || c.wordTrees || c.blindingKey != nil || c.legacyPadding {
+		return errors.New("sparse trees cannot use the EVM layout, word trees, blinding or legacy padding")
+	}
+	if c.store != nil {
+		return errors.New("sparse trees cannot use a node store")
+	}
+	return nil
+}
+
+// node hashes the children of the node at the given index of a layer, the leafs being layer 0.
+func (c config) node(layer int, index uint64, left, right [32]byte) [32]byte {
+	return c.hash.child(left, right)
+}
+
+// importedLeaf returns the leaf function of buildSparse for the given leaf hashes, whose empty chunks are told by
+// their hashes.
+func importedLeaf(leafs [][32]byte) func(i int) ([32]byte, bool) {
+	return func(i int) ([32]byte, bool) { return leafs[i], true }
+}
+
+// zeroWords returns whether all words are zero.
+func zeroWords(words []uint64) bool {
+	for _, w := range words {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sparseNodes is a NodeStore keeping only the nodes of its dense layers and of non-empty subtrees below.
+type sparseNodes struct {
+	mu    sync.RWMutex
+	nodes map[int][32]byte
+	cfg   config
+	// leafNum is the number of leafs including padding, leafs the number of leafs holding chunks of a bloom
+	// filter of filterBits bits.
+	leafNum    int
+	leafs      int
+	filterBits uint64
+	// denseLayer is the lowest layer whose nodes are all kept, sparseLayer unless the tree is lower.
+	denseLayer int
+}
+
+// newSparseNodes returns the store of a sparse tree of the given number of leafs with empty chunks only.
+func newSparseNodes(cfg config, filterBits uint64, leafs int) *sparseNodes {
+	leafNum := core.LeafNum(leafs)
+	denseLayer := sparseLayer
+	if height := bits.Len(uint(leafNum)) - 1; height < denseLayer {
+		denseLayer = height
+	}
+	return &sparseNodes{nodes: make(map[int][32]byte), cfg: cfg, leafNum: leafNum, leafs: leafs, filterBits: filterBits, denseLayer: denseLayer}
+}
+
+// layerStart returns the index of the first node of a layer.
+func (s *sparseNodes) layerStart(layer int) int {
+	return 2*s.leafNum - 2*(s.leafNum>>uint(layer))
+}
+
+// position returns the layer of node i and its index in the layer.
+func (s *sparseNodes) position(i int) (int, uint64) {
+	layer := 0
+	for i >= s.layerStart(layer+1) {
+		layer++
+	}
+	return layer, uint64(i - s.layerStart(layer))
+}
+
+// emptyLeaf returns the hash of leaf i of an empty chunk, or of the padding leaf i.
+func (s *sparseNodes) emptyLeaf(i uint64) [32]byte {
+	if i >= uint64(s.leafs) {
+		return paddingLeaf(s.cfg, int(i))
+	}
+	return s.cfg.leaf(i, make([]uint64, ChunkWordCount(i, s.filterBits, s.cfg.chunkSize))...)
+}
+
+// emptyNode returns the hash of the subtree of empty chunks at node i, hashing all of its leafs.
+func (s *sparseNodes) emptyNode(i int) [32]byte {
+	layer, index := s.position(i)
+	hashes := make([][32]byte, 1<<uint(layer))
+	for j := range hashes {
+		hashes[j] = s.emptyLeaf(index<<uint(layer) + uint64(j))
+	}
+	for len(hashes) > 1 {
+		for j := 0; j < len(hashes)/2; j++ {
+			hashes[j] = s.cfg.hash.child(hashes[2*j], hashes[2*j+1])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+	return hashes[0]
+}
+
+// Len returns the number of nodes.
+func (s *sparseNodes) Len() int { return 2*s.leafNum - 1 }
+
+// Node returns the node at index i.
+func (s *sparseNodes) Node(i int) [32]byte {
+	s.mu.RLock()
+	h, ok := s.nodes[i]
+	s.mu.RUnlock()
+	if !ok {
+		return s.emptyNode(i)
+	}
+	return h
+}
+
+// SetNode sets the node at index i, dropping it if it lies below the dense layers and is the hash of an empty
+// subtree.
+func (s *sparseNodes) SetNode(i int, h [32]byte) {
+	drop := false
+	if layer, _ := s.position(i); layer < s.denseLayer {
+		drop = h == s.emptyNode(i)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if drop {
+		delete(s.nodes, i)
+		return
+	}
+	s.nodes[i] = h
+}
+
+// Err returns nil, as sparse nodes are held in memory.
+func (s *sparseNodes) Err() error { return nil }
+
+// buildSparse hashes the tree of a bloom filter of filterBits bits into a sparse store. leaf returns the hash of a
+// leaf, or false for an empty chunk. The leafs are hashed in blocks of the subtrees of the dense layer, keeping
+// only their non-empty nodes, before the dense layers are hashed. It returns the error of the context once it is
+// done.
+func (bt *BloomTree) buildSparse(ctx context.Context, filterBits uint64, leafs int, leaf func(i int) ([32]byte, bool)) error {
+	store := newSparseNodes(bt.cfg, filterBits, leafs)
+	block := 1 << uint(store.denseLayer)
+	hashes := make([][32]byte, block)
+	nonEmpty := make([]bool, block)
+	for first := 0; first < store.leafNum; first += block {
+		for j := range hashes {
+			i := first + j
+			empty := store.emptyLeaf(uint64(i))
+			hashes[j], nonEmpty[j] = empty, false
+			if i >= leafs {
+				continue
+			}
+			if h, ok := leaf(i); ok && h != empty {
+				hashes[j], nonEmpty[j] = h, true
+			}
+			if nonEmpty[j] || store.denseLayer == 0 {
+				store.nodes[i] = hashes[j]
+			}
+			if i%yieldInterval == 0 {
+				if err := yieldPoint(ctx, i); err != nil {
+					return err
+				}
+			}
+		}
+		for layer, n := 1, block/2; n > 0; layer, n = layer+1, n/2 {
+			start := store.layerStart(layer) + first>>uint(layer)
+			for j := 0; j < n; j++ {
+				hashes[j] = bt.cfg.hash.child(hashes[2*j], hashes[2*j+1])
+				nonEmpty[j] = nonEmpty[2*j] || nonEmpty[2*j+1]
+				if nonEmpty[j] || layer == store.denseLayer {
+					store.nodes[start+j] = hashes[j]
+				}
+			}
+		}
+	}
+	for layer := store.denseLayer + 1; store.leafNum>>uint(layer) > 0; layer++ {
+		start, children := store.layerStart(layer), store.layerStart(layer-1)
+		for j := 0; j < store.leafNum>>uint(layer); j++ {
+			store.nodes[start+j] = bt.cfg.hash.child(store.nodes[children+2*j], store.nodes[children+2*j+1])
+		}
+	}
+	bt.store = store
+	return ctx.Err()
+}
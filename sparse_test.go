@@ -0,0 +1,115 @@
+package bloomtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSparseBloomTree(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	// a bloom filter for 20000 elements holding 3 has few non-empty chunks
+	dbf := generateDBF(20000, seed, []byte{1}, []byte{2}, []byte{3})
+	tree, err := NewBloomTree(dbf, WithSparse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dense, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dense.Root() != tree.Root() {
+		t.Fatalf("expected the root %x of the dense tree, but got %x", dense.Root(), tree.Root())
+	}
+	stats := tree.Stats()
+	if stats.Layout != SparseLayout || stats.NodeBytes*10 > stats.Nodes*32 {
+		t.Fatalf("expected a sparse tree keeping less than a tenth of its nodes, but got %+v", stats)
+	}
+
+	// proofs of present elements and of empty chunks equal the proofs of the dense tree and verify without options
+	for _, elem := range [][]byte{{1}, {4}, {42}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		denseProof, err := dense.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(multiproof, denseProof) {
+			t.Fatalf("expected the proof of %v to equal the proof of the dense tree", elem)
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, dense.Root(), dbf)
+		if err != nil || !verified {
+			t.Fatalf("expected the proof of %v to verify, but got %v, %v", elem, verified, err)
+		}
+	}
+
+	if err := tree.Update([]byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := NewBloomTree(dbf, WithSparse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != rebuilt.Root() {
+		t.Fatalf("expected root %x after the update, but got %x", rebuilt.Root(), tree.Root())
+	}
+	imported, err := ImportLeaves(dbf, tree.ExportLeaves(), WithSparse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Root() != tree.Root() || imported.Stats().NodeBytes != tree.Stats().NodeBytes {
+		t.Fatalf("expected imported root %x with %d node bytes, but got %x with %d", tree.Root(),
+			tree.Stats().NodeBytes, imported.Root(), imported.Stats().NodeBytes)
+	}
+}
+
+func TestSparseBloomTreeErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	var tests = [][]Option{
+		{WithSparse(), WithEVM()},
+		{WithSparse(), WithWordTrees()},
+		{WithSparse(), WithBlinding([]byte("0123456789abcdef"))},
+		{WithSparse(), WithLegacyPadding()},
+		{WithSparse(), WithNodeStore(NewMemoryStore(31))},
+	}
+	for i, opts := range tests {
+		if _, err := NewBloomTree(dbf, opts...); err == nil {
+			t.Fatalf("expected error for the options of test %d", i)
+		}
+	}
+	if _, err := NewAdaptiveBloomTree(dbf, 64, 512, WithSparse()); err == nil {
+		t.Fatal("expected error for a sparse adaptive tree")
+	}
+}
+
+func TestSparseBloomTreeEncoding(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(2000, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf, WithSparse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BloomTree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.SetBloomFilter(dbf); err != nil {
+		t.Fatal(err)
+	}
+	// updates of the decoded tree hash like the sparse tree
+	for _, updated := range []*BloomTree{tree, &decoded} {
+		if err := updated.Update([]byte{2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decoded.Root() != tree.Root() {
+		t.Fatalf("expected decoded root %x, but got %x", tree.Root(), decoded.Root())
+	}
+}
@@ -0,0 +1,109 @@
+package bloomtree
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// Stats describes the shape of a bloom tree.
+type Stats struct {
+	// Leafs is the number of leafs holding bloom filter chunks.
+	Leafs int
+	// PaddedLeafs is the number of leafs including the padding up to a power of two.
+	PaddedLeafs int
+	// Height is the number of layers above the leafs.
+	Height int
+	// Nodes is the number of nodes of the tree.
+	Nodes int
+	// NodeBytes is the size of all nodes in bytes, or of the nodes kept by a sparse tree.
+	NodeBytes int
+	// ChunkSize is the number of bits per chunk, or zero for adaptive trees.
+	ChunkSize int
+	// FilterBits is the number of bits of the bloom filter.
+	FilterBits int
+	// Layout tells where the nodes are kept.
+	Layout Layout
+}
+
+// Stats returns the statistics of the tree.
+func (bt *BloomTree) Stats() Stats {
+	paddedLeafs := (bt.nodeCount() + 1) / 2
+	stats := Stats{
+		PaddedLeafs: paddedLeafs,
+		Height:      bits.TrailingZeros(uint(paddedLeafs)),
+		Nodes:       bt.nodeCount(),
+		NodeBytes:   bt.nodeCount() * 32,
+	}
+	if bt.bounds == nil {
+		stats.ChunkSize = bt.cfg.chunkSize
+	}
+	_, paged := bt.store.(*pagedNodes)
+	switch sparse, isSparse := bt.store.(*sparseNodes); {
+	case bt.spilled:
+		stats.Layout = SpilledLayout
+	case isSparse:
+		stats.Layout = SparseLayout
+		sparse.mu.RLock()
+		stats.NodeBytes = len(sparse.nodes) * 32
+		sparse.mu.RUnlock()
+	case bt.store != nil && !paged:
+		stats.Layout = StoreLayout
+	}
+	if bt.bf != nil {
+		stats.Leafs = bt.leafCount(bt.bf.BitArray().Bytes())
+		stats.FilterBits = int(bt.bf.BitArray().Len())
+	}
+	return stats
+}
+
+// EstimateProofSize returns the expected number of bytes of the wire encoding of a presence proof,
+// see CompactMultiProof.Size, for k bloom filter indices drawn uniformly at random.
+func (bt *BloomTree) EstimateProofSize(k int) int {
+	if bt.bf == nil || k <= 0 {
+		return 0
+	}
+	if isEmptyFilter(bt.bf) {
+		return emptyProof(bt.cfg).Size()
+	}
+	words := bt.bf.BitArray().Bytes()
+	leafs := bt.leafCount(words)
+	leafNum := (bt.nodeCount() + 1) / 2
+	// weights holds the share of the bloom filter words below every node, per layer
+	weights := make([]float64, leafNum)
+	var chunks, chunkWords, hashes float64
+	for i := 0; i < leafs; i++ {
+		n := len(bt.leafWords(words, i))
+		weights[i] = float64(n) / float64(len(words))
+		// the words of a chunk are included if at least one index falls into it
+		chunks += covered(weights[i], k)
+		chunkWords += covered(weights[i], k) * float64(uvarintLen(uint64(n))+8*n)
+	}
+	for len(weights) > 1 {
+		parents := make([]float64, len(weights)/2)
+		for i := range parents {
+			left, right := weights[2*i], weights[2*i+1]
+			// a sibling hash is needed if its node is not covered, but the other child is
+			uncovered := math.Pow(math.Max(0, 1-left-right), float64(k))
+			hashes += math.Pow(1-left, float64(k)) - uncovered
+			hashes += math.Pow(1-right, float64(k)) - uncovered
+			parents[i] = left + right
+		}
+		weights = parents
+	}
+	size := 2 + uvarintLen(uint64(k)) + 32*k
+	size += uvarintLen(uint64(math.Round(hashes))) + 1 + uvarintLen(uint64(math.Round(chunks)))
+	size += uvarintLen(uint64(bt.cfg.chunkSize))
+	return size + int(math.Ceil(32*hashes+chunkWords))
+}
+
+// covered returns the probability that at least one of k uniformly drawn indices falls into a share p.
+func covered(p float64, k int) float64 {
+	return 1 - math.Pow(1-p, float64(k))
+}
+
+// uvarintLen returns the number of bytes of the uvarint encoding of v.
+func uvarintLen(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
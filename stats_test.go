@@ -0,0 +1,59 @@
+package bloomtree
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf, WithChunkSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 670 bits are 11 words in 6 chunks of 2 words, padded to 8 leafs
+	expected := Stats{
+		Leafs:       6,
+		PaddedLeafs: 8,
+		Height:      3,
+		Nodes:       15,
+		NodeBytes:   15 * 32,
+		ChunkSize:   128,
+		FilterBits:  670,
+	}
+	if stats := tree.Stats(); stats != expected {
+		t.Fatalf("expected stats %+v, but got %+v", expected, stats)
+	}
+}
+
+func TestEstimateProofSize(t *testing.T) {
+	SetChunkSize(64)
+	var elements [][]byte
+	for i := 0; i < 200; i++ {
+		elements = append(elements, []byte{byte(i), byte(i >> 8), 1})
+	}
+	for _, size := range []int{64, 256} {
+		dbf := generateDBF(2000, "secret seed", elements...)
+		tree, err := NewBloomTree(dbf, WithChunkSize(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var total int
+		for _, elem := range elements {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += multiproof.Size()
+		}
+		average := float64(total) / float64(len(elements))
+		estimate := tree.EstimateProofSize(int(dbf.NumOfHashes()))
+		if math.Abs(float64(estimate)-average) > 0.05*average {
+			t.Fatalf("estimated proof size %d is off the average proof size %.1f with chunk size %d", estimate, average, size)
+		}
+	}
+	if size := new(BloomTree).EstimateProofSize(3); size != 0 {
+		t.Fatalf("expected no estimate without bloom filter, but got %d", size)
+	}
+}
@@ -0,0 +1,91 @@
+package bloomtree
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamChunks is the number of chunks read from a reader before they are hashed in parallel.
+const streamChunks = 1024
+
+// NewBloomTreeFromReader builds the bloom tree of a bloom filter of m bits, streaming its bit array from r
+// in batches of chunks instead of holding all words in memory, e.g. for filters kept in files or object
+// storage. r holds the ceil(m/64) words of the bit array as big-endian uint64, as written by
+// bitset.BitSet.WriteTo after its 8 byte length. The tree equals the tree NewBloomTree builds from the
+// filter with the same options.
+//
+// The tree has no bloom filter, so it cannot generate proofs until the filter is attached with SetBloomFilter.
+func NewBloomTreeFromReader(r io.Reader, m uint64, opts ...Option) (*BloomTree, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkEVM(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkWordTrees(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkSparse(); err != nil {
+		return nil, err
+	}
+	if m == 0 {
+		return nil, errors.New("tree must have at least 1 leaf")
+	}
+	words := (m + 63) / 64
+	step := uint64(cfg.chunkSize / 64)
+	leafs := make([][32]byte, (words+step-1)/step)
+	var checksums []uint64
+	if cfg.chunkChecksums {
+		checksums = make([]uint64, len(leafs))
+	}
+	buf := make([]byte, 8*streamChunks*step)
+	batch := make([]uint64, streamChunks*step)
+	for first := uint64(0); first*step < words; first += streamChunks {
+		n := words - first*step
+		if n > uint64(len(batch)) {
+			n = uint64(len(batch))
+		}
+		if _, err := io.ReadFull(r, buf[:8*n]); err != nil {
+			return nil, fmt.Errorf("reading the words of chunk %d: %w", first, err)
+		}
+		for i := range batch[:n] {
+			batch[i] = binary.BigEndian.Uint64(buf[8*i:])
+		}
+		if first*step+n == words && m%64 != 0 && batch[n-1]>>(m%64) != 0 {
+			return nil, fmt.Errorf("bits beyond the %d bits of the bloom filter are set", m)
+		}
+		parallelRange(cfg.workers, 0, int((n+step-1)/step), func(start, end int) {
+			for i := uint64(start); i < uint64(end); i++ {
+				last := (i + 1) * step
+				if last > n {
+					last = n
+				}
+				chunk := batch[i*step : last]
+				leafs[first+i] = cfg.leaf(first+i, chunk...)
+				if checksums != nil {
+					checksums[first+i] = chunkChecksum(chunk)
+				}
+			}
+		})
+	}
+	bt := &BloomTree{cfg: cfg, checksums: checksums, provenance: cfg.newProvenance(len(leafs))}
+	if bt.spilled, err = bt.cfg.spill(len(leafs)); err != nil {
+		return nil, err
+	}
+	if cfg.sparse {
+		if err := bt.buildSparse(context.Background(), m, len(leafs), importedLeaf(leafs)); err != nil {
+			return nil, err
+		}
+	} else if bt.cfg.store != nil {
+		if err := bt.buildStore(context.Background(), len(leafs), func(i int) [32]byte { return leafs[i] }); err != nil {
+			return nil, err
+		}
+	} else {
+		bt.nodes = buildNodes(leafs, cfg)
+	}
+	return bt, nil
+}
@@ -0,0 +1,103 @@
+package bloomtree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// filterWords returns the words of the bit array of the bloom filter as read by NewBloomTreeFromReader.
+func filterWords(t *testing.T, bf BloomFilter) []byte {
+	var buf bytes.Buffer
+	if _, err := bf.BitArray().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// skip the length of the bit array
+	return buf.Bytes()[8:]
+}
+
+func TestNewBloomTreeFromReader(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	var tests = []struct {
+		elements uint
+		opts     []Option
+	}{
+		{elements: 2},
+		{elements: 20, opts: []Option{WithChunkSize(128)}},
+		{elements: 20, opts: []Option{WithChunkChecksums(), WithWorkers(1)}},
+		{elements: 20, opts: []Option{WithWordTrees(), WithChunkSize(256)}},
+		{elements: 20, opts: []Option{WithNodeStore(NewMemoryStore(31))}},
+		{elements: 20, opts: []Option{WithSparse()}},
+		// more chunks than are read at once
+		{elements: 20000},
+	}
+	for _, test := range tests {
+		var elements [][]byte
+		for i := uint(0); i < test.elements; i++ {
+			elements = append(elements, []byte{byte(i), byte(i >> 8)})
+		}
+		n := test.elements
+		if n < 200 {
+			n = 200
+		}
+		dbf := generateDBF(n, seed, elements...)
+		streamed, err := NewBloomTreeFromReader(bytes.NewReader(filterWords(t, dbf)), uint64(dbf.BitArray().Len()), test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := NewBloomTree(dbf, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streamed.Root() != tree.Root() {
+			t.Fatalf("expected root %x of %d elements, but got %x", tree.Root(), test.elements, streamed.Root())
+		}
+		if len(streamed.ChunkChecksums()) != len(tree.ChunkChecksums()) {
+			t.Fatalf("expected %d checksums, but got %d", len(tree.ChunkChecksums()), len(streamed.ChunkChecksums()))
+		}
+		for i, v := range tree.ChunkChecksums() {
+			if streamed.ChunkChecksums()[i] != v {
+				t.Fatalf("expected checksum %x of chunk %d, but got %x", v, i, streamed.ChunkChecksums()[i])
+			}
+		}
+
+		// proofs need the bloom filter
+		if _, err := streamed.GenerateCompactMultiProof(elements[0]); !errors.Is(err, ErrNoBloomFilter) {
+			t.Fatalf("expected ErrNoBloomFilter, but got %v", err)
+		}
+		if err := streamed.SetBloomFilter(dbf); err != nil {
+			t.Fatal(err)
+		}
+		multiproof, err := streamed.GenerateCompactMultiProof(elements[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !multiproof.ProofType.IsPresence() {
+			t.Fatalf("expected a presence proof of element %v", elements[0])
+		}
+	}
+}
+
+func TestNewBloomTreeFromReaderErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1}, []byte{2})
+	m := uint64(dbf.BitArray().Len())
+	words := filterWords(t, dbf)
+	if _, err := NewBloomTreeFromReader(bytes.NewReader(words[:len(words)-1]), m); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF for a short reader, but got %v", err)
+	}
+	if _, err := NewBloomTreeFromReader(bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("expected error for an empty bloom filter")
+	}
+	// the last word holds bits beyond m
+	corrupted := append([]byte(nil), words...)
+	corrupted[len(corrupted)-8] |= 0x80
+	if _, err := NewBloomTreeFromReader(bytes.NewReader(corrupted), m); err == nil {
+		t.Fatal("expected error for bits beyond the bloom filter")
+	}
+	if _, err := NewBloomTreeFromReader(bytes.NewReader(words), m, WithChunkSize(100)); err == nil {
+		t.Fatal("expected error for an invalid chunk size")
+	}
+}
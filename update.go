@@ -0,0 +1,131 @@
+package bloomtree
+
+import (
+	"errors"
+)
+
+// CopiedBitsFilter is a bloom filter whose BitArray may return a copy of its bits, e.g. an adapter of a library
+// not exposing them. Bits set on the copy would be lost, so trees of filters returning a copy reject SetBits,
+// and Update adds elements with Add instead.
+type CopiedBitsFilter interface {
+	ExtensibleBloomFilter
+	// BitsCopied returns whether BitArray returns a copy of the bits.
+	BitsCopied() bool
+}
+
+// Update adds an element to the bloom filter of the tree, and recomputes only the leafs
+// holding its indices and their ancestors. The counters of counting bloom filters are incremented.
+func (bt *BloomTree) Update(elem []byte) error {
+	if bt.bf == nil {
+		return ErrNoBloomFilter
+	}
+	if isEmptyFilter(bt.bf) {
+		return ErrEmptyFilter
+	}
+	cbf, ok := bt.bf.(CountingBloomFilter)
+	var elemIndices []uint
+	if ok {
+		// the counters of counting bloom filters cannot be clamped, so checkUpdate rejects indices past the end
+		elemIndices = bt.bf.GetElementIndices(elem)
+	} else {
+		var err error
+		if elemIndices, err = bt.elementIndices(elem); err != nil {
+			return err
+		}
+	}
+	var indices []uint64
+	for _, v := range elemIndices {
+		indices = append(indices, uint64(v))
+	}
+	if !ok {
+		if cf, copied := bt.bf.(CopiedBitsFilter); copied && cf.BitsCopied() {
+			if err := bt.checkUpdate(indices); err != nil {
+				return err
+			}
+			cf.Add(elem)
+			return bt.rehashChunks(indices)
+		}
+		return bt.SetBits(indices)
+	}
+	if err := bt.checkUpdate(indices); err != nil {
+		return err
+	}
+	cbf.Add(elem)
+	return bt.rehashChunks(indices)
+}
+
+// SetBits sets the given bits of the bloom filter of the tree, and recomputes only the affected leafs
+// and their ancestors, which takes O(k log n) hashes instead of rebuilding the tree. The bits of counting
+// bloom filters cannot be set directly, as their counters would not match.
+func (bt *BloomTree) SetBits(indices []uint64) error {
+	if err := bt.checkUpdate(indices); err != nil {
+		return err
+	}
+	if _, ok := bt.bf.(CountingBloomFilter); ok {
+		return errors.New("the bits of counting bloom filters cannot be set directly")
+	}
+	if cf, ok := bt.bf.(CopiedBitsFilter); ok && cf.BitsCopied() {
+		return errors.New("the bloom filter only returns a copy of its bits, which cannot be set directly")
+	}
+	bf := bt.bf.BitArray()
+	for _, v := range indices {
+		bf.Set(uint(v))
+	}
+	return bt.rehashChunks(indices)
+}
+
+// checkUpdate returns an error if the tree cannot be updated at the given bloom filter indices.
+func (bt *BloomTree) checkUpdate(indices []uint64) error {
+	if bt.bf == nil {
+		return ErrNoBloomFilter
+	}
+	if bt.frozen {
+		return ErrFrozen
+	}
+	if isEmptyFilter(bt.bf) {
+		return ErrEmptyFilter
+	}
+	if bt.bounds != nil {
+		return errors.New("incremental updates are not supported by adaptive trees")
+	}
+	return checkIndices(indices, uint64(bt.bf.BitArray().Len()))
+}
+
+// rehashChunks recomputes the leafs holding the given bloom filter indices and their ancestors.
+func (bt *BloomTree) rehashChunks(indices []uint64) error {
+	dirty := make(map[uint64]bool)
+	for _, v := range indices {
+		dirty[bt.chunkIndex(v)] = true
+	}
+	words := bt.bf.BitArray().Bytes()
+	for leaf := range dirty {
+		leafWords := bt.leafWords(words, int(leaf))
+		bt.setNode(int(leaf), bt.cfg.leaf(leaf, leafWords...))
+		if bt.checksums != nil {
+			bt.checksums[leaf] = chunkChecksum(leafWords)
+		}
+	}
+	bt.updateAncestors(dirty)
+	bt.touchProvenance(dirty)
+	return bt.nodesErr()
+}
+
+// updateAncestors recomputes the ancestors of the given leafs, one layer at a time.
+func (bt *BloomTree) updateAncestors(dirty map[uint64]bool) {
+	leafNum := uint64(bt.nodeCount()+1) / 2
+	root := uint64(bt.nodeCount() - 1)
+	for layer, start := 1, leafNum; len(dirty) != 0; layer, start = layer+1, start+(leafNum>>uint(layer)) {
+		parents := make(map[uint64]bool)
+		for index := range dirty {
+			if index == root {
+				continue
+			}
+			parents[leafNum+index/2] = true
+		}
+		for parent := range parents {
+			child := 2 * (parent - leafNum)
+			bt.setNode(int(parent), bt.cfg.node(layer, parent-start, bt.node(int(child)), bt.node(int(child+1))))
+		}
+		dirty = parents
+	}
+}
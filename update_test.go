@@ -0,0 +1,67 @@
+package bloomtree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	for _, size := range []int{64, 512} {
+		SetChunkSize(size)
+		seed := "secret seed"
+		dbf := generateDBF(200, seed, []byte{0}, []byte{1})
+		tree, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, elem := range [][]byte{{2}, {3}, {100}} {
+			if err := tree.Update(elem); err != nil {
+				t.Fatal(err)
+			}
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(elem, []byte(seed), multiproof, tree.Root(), dbf)
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified || !CheckProofType(multiproof.ProofType) {
+				t.Fatalf("expected updated element %v to be present", elem)
+			}
+		}
+		rebuilt, err := NewBloomTree(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range rebuilt.nodes {
+			if rebuilt.nodes[i] != tree.nodes[i] {
+				t.Fatalf("node %d of the updated tree differs from the rebuilt tree", i)
+			}
+		}
+	}
+	SetChunkSize(64)
+}
+
+func TestSetBitsErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{0})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+	if err := tree.SetBits([]uint64{1, uint64(dbf.BitArray().Len())}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected error %v, but got %v", ErrIndexOutOfRange, err)
+	}
+	if tree.Root() != root {
+		t.Fatal("expected failed update to leave the tree unchanged")
+	}
+
+	adaptiveTree, err := NewAdaptiveBloomTree(dbf, 64, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := adaptiveTree.SetBits([]uint64{1}); err == nil {
+		t.Fatal("expected error for adaptive tree")
+	}
+}
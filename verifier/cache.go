@@ -0,0 +1,145 @@
+package verifier
+
+import (
+	"container/list"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// ErrRootNotPinned is returned by a Cache for proofs against a root outside of its pinned roots.
+var ErrRootNotPinned = errors.New("the root is not pinned")
+
+// Cache memoizes the results of Verify, e.g. for gateways verifying the same forwarded proofs repeatedly.
+// Results are keyed by a digest of the element, the seed, the proof and the root, and proofs are only
+// verified against the pinned roots of the cache. Results of roots that are no longer pinned are dropped
+// when the pinned roots change. The cache holds a bounded number of results and evicts the least recently
+// used first. It is safe for concurrent use.
+type Cache struct {
+	params   Params
+	mu       sync.Mutex
+	capacity int
+	roots    map[[32]byte]bool
+	entries  map[[32]byte]*list.Element
+	// order holds the entries, most recently used first.
+	order  *list.List
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	digest  [32]byte
+	root    [32]byte
+	present bool
+	err     error
+}
+
+// NewCache returns a cache of up to capacity results of proofs verified with the params against the given roots.
+func NewCache(capacity int, params Params, roots ...[32]byte) (*Cache, error) {
+	if capacity < 1 {
+		return nil, errors.New("the cache must hold at least one result")
+	}
+	if _, err := params.chunkSize(); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		params:   params,
+		capacity: capacity,
+		entries:  make(map[[32]byte]*list.Element),
+		order:    list.New(),
+	}
+	c.SetRoots(roots...)
+	return c, nil
+}
+
+// SetRoots replaces the pinned roots, and drops the results of proofs against roots that are no longer pinned.
+func (c *Cache) SetRoots(roots ...[32]byte) {
+	pinned := make(map[[32]byte]bool, len(roots))
+	for _, root := range roots {
+		pinned[root] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roots = pinned
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*cacheEntry); !pinned[entry.root] {
+			c.order.Remove(e)
+			delete(c.entries, entry.digest)
+		}
+		e = next
+	}
+}
+
+// Verify returns the result of Verify for the proof against the root, verifying the proof only if its result
+// is not cached. ErrRootNotPinned is returned for roots that are not pinned.
+func (c *Cache) Verify(element, seed []byte, proof *bloomtree.CompactMultiProof, root [32]byte) (bool, error) {
+	digest, err := proofDigest(element, seed, proof, root)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	if !c.roots[root] {
+		c.mu.Unlock()
+		return false, fmt.Errorf("%w: %x", ErrRootNotPinned, root)
+	}
+	if e, ok := c.entries[digest]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		entry := e.Value.(*cacheEntry)
+		c.mu.Unlock()
+		return entry.present, entry.err
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	present, err := Verify(element, seed, proof, root, c.params)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the root may have been unpinned while verifying, or another goroutine cached the same proof
+	if _, ok := c.entries[digest]; ok || !c.roots[root] {
+		return present, err
+	}
+	c.entries[digest] = c.order.PushFront(&cacheEntry{digest: digest, root: root, present: present, err: err})
+	for c.order.Len() > c.capacity {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*cacheEntry).digest)
+	}
+	return present, err
+}
+
+// Len returns the number of cached results.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the number of proofs whose result was cached, and the number of proofs that were verified.
+func (c *Cache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// proofDigest returns the SHA-512/256 digest of the length-prefixed element and seed, the root and the
+// canonical JSON of the proof.
+func proofDigest(element, seed []byte, proof *bloomtree.CompactMultiProof, root [32]byte) ([32]byte, error) {
+	encoded, err := proof.CanonicalJSON()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var buf []byte
+	var n [binary.MaxVarintLen64]byte
+	for _, b := range [][]byte{element, seed, root[:], encoded} {
+		buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(b)))]...)
+		buf = append(buf, b...)
+	}
+	return sha512.Sum512_256(buf), nil
+}
@@ -0,0 +1,90 @@
+package verifier
+
+import (
+	"errors"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+func TestCache(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	root := tree.Root()
+	other := root
+	other[0] ^= 1
+
+	if _, err := NewCache(0, params, root); err == nil {
+		t.Fatal("expected error for a cache without capacity")
+	}
+	cache, err := NewCache(2, params, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := make(map[byte]*bloomtree.CompactMultiProof)
+	for _, elem := range []byte{1, 2, 9} {
+		if proofs[elem], err = tree.GenerateCompactMultiProof([]byte{elem}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		element byte
+		present bool
+		hits    uint64
+		misses  uint64
+	}{
+		{element: 1, present: true, misses: 1},
+		{element: 1, present: true, hits: 1, misses: 1},
+		{element: 9, present: false, hits: 1, misses: 2},
+		{element: 1, present: true, hits: 2, misses: 2},
+		// evicts 9, the least recently used
+		{element: 2, present: true, hits: 2, misses: 3},
+		{element: 9, present: false, hits: 2, misses: 4},
+	}
+	for i, test := range tests {
+		present, err := cache.Verify([]byte{test.element}, []byte(seed), proofs[test.element], root)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if present != test.present {
+			t.Fatalf("%d: expected presence %t, but got %t", i, test.present, present)
+		}
+		if hits, misses := cache.Stats(); hits != test.hits || misses != test.misses {
+			t.Fatalf("%d: expected %d hits and %d misses, but got %d and %d", i, test.hits, test.misses, hits, misses)
+		}
+		if cache.Len() > 2 {
+			t.Fatalf("%d: the cache holds %d results, but its capacity is 2", i, cache.Len())
+		}
+	}
+
+	// invalid proofs are cached with their error
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Verify([]byte{2}, []byte(seed), proofs[1], root); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("expected %v for the proof of another element, but got %v", ErrInvalidProof, err)
+		}
+	}
+	if hits, _ := cache.Stats(); hits != 3 {
+		t.Fatalf("expected the result of the invalid proof to be cached, got %d hits", hits)
+	}
+
+	if _, err := cache.Verify([]byte{1}, []byte(seed), proofs[1], other); !errors.Is(err, ErrRootNotPinned) {
+		t.Fatalf("expected %v, but got %v", ErrRootNotPinned, err)
+	}
+	cache.SetRoots(root, other)
+	if cache.Len() != 2 {
+		t.Fatalf("expected results of still pinned roots to be kept, got %d", cache.Len())
+	}
+	if _, err := cache.Verify([]byte{1}, []byte(seed), proofs[1], other); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected %v for a proof against another root, but got %v", ErrInvalidProof, err)
+	}
+	cache.SetRoots(other)
+	if cache.Len() != 1 {
+		t.Fatalf("expected only the result against the pinned root to be kept, got %d", cache.Len())
+	}
+	if _, err := cache.Verify([]byte{1}, []byte(seed), proofs[1], root); !errors.Is(err, ErrRootNotPinned) {
+		t.Fatalf("expected %v after unpinning the root, but got %v", ErrRootNotPinned, err)
+	}
+}
@@ -0,0 +1,133 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// Job is a proof verified by a VerifierPool.
+type Job struct {
+	Element []byte
+	Seed    []byte
+	Proof   *bloomtree.CompactMultiProof
+	Root    [32]byte
+	// Tag is passed through to the result untouched, e.g. the message the proof came with.
+	Tag interface{}
+}
+
+// Result is the outcome of Verify for a job.
+type Result struct {
+	Job     Job
+	Present bool
+	Err     error
+}
+
+// VerifierPool verifies streams of proofs on several goroutines, e.g. in message processing pipelines. Results
+// are emitted in the order of their jobs. At most queue jobs are in flight, i.e. verified or waiting for the
+// results of earlier jobs to be received, so a pool stops receiving jobs while its results are not received:
+// slow consumers apply backpressure to the producers instead of queueing unbounded results in memory.
+type VerifierPool struct {
+	params  Params
+	workers int
+	queue   int
+}
+
+// poolTask is a job handed to a worker, with the channel its result is sent to.
+type poolTask struct {
+	job    Job
+	result chan Result
+}
+
+// NewVerifierPool returns a pool verifying proofs with the params on the given number of workers, GOMAXPROCS if
+// zero, with at most queue jobs in flight. The queue must hold at least one job per worker to use all of them.
+func NewVerifierPool(params Params, workers, queue int) (*VerifierPool, error) {
+	if workers < 0 {
+		return nil, errors.New("the number of workers must not be negative")
+	}
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queue < 1 {
+		return nil, errors.New("the queue must hold at least one job")
+	}
+	if _, err := params.chunkSize(); err != nil {
+		return nil, err
+	}
+	return &VerifierPool{params: params, workers: workers, queue: queue}, nil
+}
+
+// Run verifies the jobs received from the channel until it is closed, and returns the channel of their results
+// in the order of the jobs. The results channel is closed once the result of the last job was sent, or once the
+// context is done, which drops the results of the jobs in flight. Either way, the goroutines of the run have
+// stopped verifying when it is closed. A pool can run several streams at once.
+func (p *VerifierPool) Run(ctx context.Context, jobs <-chan Job) <-chan Result {
+	results := make(chan Result)
+	// pending holds the result channels of the jobs in flight, in the order of the jobs
+	pending := make(chan chan Result, p.queue)
+	tasks := make(chan poolTask)
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				present, err := Verify(task.job.Element, task.job.Seed, task.job.Proof, task.job.Root, p.params)
+				task.result <- Result{Job: task.job, Present: present, Err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(tasks)
+		for {
+			var job Job
+			var ok bool
+			select {
+			case job, ok = <-jobs:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			// the result channel is buffered, so workers never wait for the results of earlier jobs
+			task := poolTask{job: job, result: make(chan Result, 1)}
+			select {
+			case pending <- task.result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case tasks <- task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		// the workers stop once the jobs in flight are verified, as no more tasks are sent after the context
+		// is done
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+		for result := range pending {
+			var r Result
+			select {
+			case r = <-result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case results <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
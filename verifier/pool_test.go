@@ -0,0 +1,102 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+func TestVerifierPool(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	if _, err := NewVerifierPool(params, 2, 0); err == nil {
+		t.Fatal("expected error for a pool without queue")
+	}
+	pool, err := NewVerifierPool(params, 4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := make(chan Job)
+	go func() {
+		defer close(jobs)
+		for i := 0; i < 100; i++ {
+			elem := []byte{byte(i % 20)}
+			proof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				panic(err)
+			}
+			root := tree.Root()
+			// every third proof is against another root
+			if i%3 == 0 {
+				root[0] ^= 1
+			}
+			jobs <- Job{Element: elem, Seed: []byte(seed), Proof: proof, Root: root, Tag: i}
+		}
+	}()
+	var n int
+	for result := range pool.Run(context.Background(), jobs) {
+		if result.Job.Tag != n {
+			t.Fatalf("expected the result of job %d, got job %v", n, result.Job.Tag)
+		}
+		if n%3 == 0 {
+			if !errors.Is(result.Err, ErrInvalidProof) {
+				t.Fatalf("expected ErrInvalidProof for job %d, got %v", n, result.Err)
+			}
+		} else if result.Err != nil {
+			t.Fatal(result.Err)
+		} else if result.Present != (n%20 <= 8) {
+			t.Fatalf("expected presence %t of job %d", n%20 <= 8, n)
+		}
+		n++
+	}
+	if n != 100 {
+		t.Fatalf("expected 100 results, got %d", n)
+	}
+}
+
+func TestVerifierPoolBackpressure(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	queue := 4
+	pool, err := NewVerifierPool(params, 2, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Job{Element: []byte{1}, Seed: []byte(seed), Proof: proof, Root: tree.Root()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan Job)
+	results := pool.Run(ctx, jobs)
+	// without a consumer of the results, the pool stops receiving jobs once its queue is full, holding at most
+	// one more job waiting for the queue and one result waiting for the consumer
+	var sent int
+	for sent < 100 {
+		select {
+		case jobs <- job:
+			sent++
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		break
+	}
+	if sent > queue+2 {
+		t.Fatalf("expected at most %d jobs to be received without a consumer, got %d", queue+2, sent)
+	}
+
+	// once cancelled, the results channel is closed
+	cancel()
+	for range results {
+	}
+}
@@ -0,0 +1,110 @@
+package verifier
+
+import (
+	"fmt"
+	"math/bits"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+// VerifyStructural checks the internal consistency of a proof for a bloom filter with the given params, without
+// the root, the element or any hashing: the chunk size, the proof type and absent indices against the number
+// of hash functions, the canonical order, the number of chunks and chunk words against the proven indices, and
+// the number of hashes against the height of the tree, which must be Params.Height if it is pinned. Message
+// queues can use it to drop garbage before spending hashes on it. A proof passing it may still be invalid, it
+// has to be verified with Verify.
+//
+// Invalid proofs are reported like by Verify, with a *bloomtree.VerificationError matching ErrInvalidProof. The
+// proof must carry the words of its chunks, or their leaf hashes.
+func VerifyStructural(proof *bloomtree.CompactMultiProof, params Params) error {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return err
+	}
+	if params.K == 0 || params.K >= uint(bloomtree.Presence) {
+		return fmt.Errorf("the number of hash functions must be between 1 and %d", bloomtree.Presence-1)
+	}
+	if proof.ChunkSize != 0 && proof.ChunkSize != chunkSize {
+		return &bloomtree.VerificationError{Reason: bloomtree.ReasonChunkSize, Err: fmt.Errorf(
+			"%w: the proof has chunk size %d, but the chunk size is %d", bloomtree.ErrChunkSizeMismatch, proof.ChunkSize, chunkSize)}
+	}
+
+	// proven is the number of element indices the proof opens
+	proven := int(params.K)
+	if proof.ProofType.IsPresence() {
+		if len(proof.AbsentIndices) != 0 {
+			return invalidProof(bloomtree.ReasonProofType, "a presence proof has no absent indices")
+		}
+	} else {
+		if uint(proof.ProofType) >= params.K {
+			return invalidProof(bloomtree.ReasonProofType, "the proof type %d exceeds the number of hash functions", proof.ProofType)
+		}
+		for _, position := range proof.AbsentIndices {
+			if uint(position) >= params.K {
+				return invalidProof(bloomtree.ReasonProofType, "the absent index %d exceeds the number of hash functions", position)
+			}
+		}
+		proven = 1
+		if len(proof.AbsentIndices) != 0 {
+			proven = len(proof.AbsentIndices)
+		}
+	}
+	if err := proof.CheckOrder(); err != nil {
+		return &bloomtree.VerificationError{Reason: bloomtree.ReasonNonCanonical, Err: err}
+	}
+	if params.M == 0 {
+		if proof.ProofType.IsPresence() {
+			return invalidProof(bloomtree.ReasonProofType, "the bloom filter has no bits, so no element is present")
+		}
+		if params.Height != 0 {
+			return invalidProof(bloomtree.ReasonTreeHeight, "the bloom filter has no bits, but height %d is pinned", params.Height)
+		}
+		if len(proof.Chunks) != 0 || len(proof.ChunkWords) != 0 || len(proof.Proof) != 0 {
+			return invalidProof(bloomtree.ReasonChunkCount, "the bloom filter has no bits, but the proof opens chunks")
+		}
+		return nil
+	}
+
+	if len(proof.Chunks) != 0 && len(proof.Chunks) != proven {
+		return invalidProof(bloomtree.ReasonChunkCount, "the proof has %d chunks, but opens %d indices", len(proof.Chunks), proven)
+	}
+	// distinct is the number of distinct chunks, whose repetitions are adjacent in canonical proofs
+	distinct := len(proof.ChunkWords)
+	if distinct == 0 {
+		for i, chunk := range proof.Chunks {
+			if i == 0 || chunk != proof.Chunks[i-1] {
+				distinct++
+			}
+		}
+	}
+	step := uint64(chunkSize / bloomtree.WordBits)
+	leaves := bloomtree.LeafCountFor(params.M, chunkSize)
+	if distinct == 0 || distinct > proven || uint64(distinct) > leaves {
+		return invalidProof(bloomtree.ReasonChunkCount, "the proof has %d distinct chunks, but opens %d indices of %d chunks",
+			distinct, proven, leaves)
+	}
+	if len(proof.WordCommitments) != 0 && len(proof.WordCommitments) != len(proof.ChunkWords) {
+		return invalidProof(bloomtree.ReasonChunkCount, "the proof has word commitments of %d chunks, but words of %d chunks",
+			len(proof.WordCommitments), len(proof.ChunkWords))
+	}
+	for i, words := range proof.ChunkWords {
+		if len(words) == 0 || uint64(len(words)) > step {
+			return invalidProof(bloomtree.ReasonChunkCount, "chunk %d has %d words, but chunks have up to %d", i, len(words), step)
+		}
+		if len(proof.WordCommitments) != 0 && len(proof.WordCommitments[i]) != len(words) {
+			return invalidProof(bloomtree.ReasonChunkCount, "chunk %d has %d word commitments, but %d words", i,
+				len(proof.WordCommitments[i]), len(words))
+		}
+	}
+
+	// every chunk needs at most one hash per layer below the root
+	height := bits.Len64(leaves - 1)
+	if params.Height != 0 && height != params.Height {
+		return invalidProof(bloomtree.ReasonTreeHeight, "the tree has height %d, but height %d is pinned", height, params.Height)
+	}
+	if len(proof.Proof) > distinct*height {
+		return invalidProof(bloomtree.ReasonHashCount, "the proof has %d hashes, but %d chunks in a tree of height %d need at most %d",
+			len(proof.Proof), distinct, height, distinct*height)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package verifier
+
+import (
+	"errors"
+	"testing"
+
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+func TestVerifyStructural(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	for _, chunkSize := range []int{64, 192, 512} {
+		dbf, tree := generateTree(t, seed, chunkSize, bloomtree.WithAbsentIndices(3))
+		params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: chunkSize}
+		for _, element := range [][]byte{{1}, {9}, {42}} {
+			proof, err := tree.GenerateCompactMultiProof(element)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyStructural(proof, params); err != nil {
+				t.Fatalf("chunk size %d, element %v: %v", chunkSize, element, err)
+			}
+			// empty word commitments are no commitments
+			proof.WordCommitments = [][][32]byte{}
+			if err := VerifyStructural(proof, params); err != nil {
+				t.Fatalf("chunk size %d, element %v with empty word commitments: %v", chunkSize, element, err)
+			}
+			// proofs without chunk words are checked by their leaf hashes
+			proof.ChunkWords = nil
+			if err := VerifyStructural(proof, params); err != nil {
+				t.Fatalf("chunk size %d, element %v without words: %v", chunkSize, element, err)
+			}
+		}
+	}
+
+	dbf, tree := generateTree(t, seed, 64, bloomtree.WithAbsentIndices(3))
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	var tests = []struct {
+		name    string
+		element []byte
+		modify  func(p *bloomtree.CompactMultiProof)
+		reason  bloomtree.FailureReason
+	}{
+		{"chunk size of another tree", []byte{1}, func(p *bloomtree.CompactMultiProof) { p.ChunkSize = 128 }, bloomtree.ReasonChunkSize},
+		{"proof type out of range", []byte{9}, func(p *bloomtree.CompactMultiProof) {
+			p.ProofType = bloomtree.Absence(uint8(params.K))
+			p.AbsentIndices = nil
+		}, bloomtree.ReasonProofType},
+		{"absent index out of range", []byte{9}, func(p *bloomtree.CompactMultiProof) {
+			p.AbsentIndices = []uint8{uint8(p.ProofType), uint8(params.K)}
+		}, bloomtree.ReasonProofType},
+		{"presence proof with absent indices", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			p.AbsentIndices = []uint8{0}
+		}, bloomtree.ReasonProofType},
+		{"decreasing absent indices", []byte{9}, func(p *bloomtree.CompactMultiProof) {
+			p.AbsentIndices = []uint8{uint8(p.ProofType), 0}
+		}, bloomtree.ReasonNonCanonical},
+		{"repeated hash", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			p.Proof = append(p.Proof, p.Proof[0])
+		}, bloomtree.ReasonNonCanonical},
+		{"missing chunk", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			p.Chunks = p.Chunks[1:]
+		}, bloomtree.ReasonChunkCount},
+		{"no chunk words", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			p.Chunks, p.ChunkWords = nil, nil
+		}, bloomtree.ReasonChunkCount},
+		{"chunk with too many words", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			p.ChunkWords[0] = append(p.ChunkWords[0], 0)
+		}, bloomtree.ReasonChunkCount},
+		{"too many hashes", []byte{1}, func(p *bloomtree.CompactMultiProof) {
+			for i := 0; i < 100; i++ {
+				p.Proof = append(p.Proof, [32]byte{byte(i), 1})
+			}
+		}, bloomtree.ReasonHashCount},
+	}
+	for _, test := range tests {
+		proof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.modify(proof)
+		err = VerifyStructural(proof, params)
+		var verr *bloomtree.VerificationError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("%s: expected a verification error, but got %v", test.name, err)
+		}
+		if verr.Reason != test.reason {
+			t.Fatalf("%s: expected reason %v, but got %v", test.name, test.reason, verr.Reason)
+		}
+	}
+
+	// proofs of empty bloom filters open no chunks
+	empty := &bloomtree.CompactMultiProof{ProofType: bloomtree.Absence(0)}
+	if err := VerifyStructural(empty, Params{M: 0, K: 3}); err != nil {
+		t.Fatal(err)
+	}
+	empty.ChunkWords = [][]uint64{{0}}
+	if err := VerifyStructural(empty, Params{M: 0, K: 3}); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected an invalid proof, but got %v", err)
+	}
+	if err := VerifyStructural(empty, Params{M: 64}); err == nil || errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("expected an error for params without hash functions, but got %v", err)
+	}
+}
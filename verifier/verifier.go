@@ -0,0 +1,506 @@
+// Package verifier verifies compact multiproofs of a bloom tree without holding the bloom filter or the tree.
+// A light client only needs the 32 byte root and the parameters of the bloom filter.
+package verifier
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+	"github.com/willf/bitset"
+)
+
+// ErrInvalidProof is matched by the errors of invalid proofs, which are *bloomtree.VerificationError telling
+// why the proof failed, e.g. bloomtree.ReasonRootMismatch if its chunks and hashes do not reconstruct the root.
+var ErrInvalidProof = bloomtree.ErrInvalidProof
+
+// defaultChunkSize is the default chunk size of bloom trees.
+const defaultChunkSize = 64
+
+// IndexFunc maps an element to its bloom filter indices, in the order of the hash functions.
+type IndexFunc func(element, seed []byte) []uint
+
+// Params are the parameters of the bloom filter a bloom tree was built from.
+type Params struct {
+	// M is the number of bits of the bloom filter.
+	M uint64
+	// K is the number of hash functions of the bloom filter.
+	K uint
+	// ChunkSize is the number of bits per chunk of the tree. It defaults to 64.
+	ChunkSize int
+	// Hash is the hash function the tree was built with. It defaults to SHA-512/256.
+	Hash bloomtree.Hash
+	// Indices maps elements to bloom filter indices. It defaults to the indices of a DBF bloom filter of M bits.
+	Indices IndexFunc
+	// Sparse is ignored, as trees built with bloomtree.WithSparse have the roots and proofs of dense trees.
+	//
+	// Deprecated: proofs of sparse trees are verified like proofs of dense trees.
+	Sparse bool
+	// Height pins the height of the tree, see bloomtree.WithTreeHeight. If set, proofs are rejected with
+	// bloomtree.ReasonTreeHeight unless M and the chunk size give a tree of this height, so verifiers taking M
+	// from the prover cannot be handed a proof of a smaller or larger tree. Zero pins nothing, trees of a single
+	// chunk need no pin as their proofs have no hashes.
+	Height int
+}
+
+// AttestedParams returns the parameters of the attestation, e.g. of a root whose signature was verified. The
+// indices default to the indices of a DBF bloom filter.
+func AttestedParams(a bloomtree.RootAttestation) Params {
+	return Params{
+		M:         a.FilterBits,
+		K:         uint(a.NumOfHashes),
+		ChunkSize: int(a.ChunkSize),
+		Hash:      a.Hash,
+	}
+}
+
+// DBFIndices returns the index function of a DBF bloom filter with m bits and k hash functions.
+func DBFIndices(m uint64, k uint) (IndexFunc, error) {
+	b, err := bitset.New(0).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(DBF.DEncode{B: b, M: uint(m), K: k}); err != nil {
+		return nil, err
+	}
+	dbf, err := DBF.UnmarshalBinary(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return dbf.MapElementToBF, nil
+}
+
+// Verify checks the proof against the root, and returns whether it proves the presence or the absence of the element.
+// An error is returned if the proof is invalid. The proof must carry the words of its chunks.
+func Verify(element, seed []byte, proof *bloomtree.CompactMultiProof, root [32]byte, params Params) (bool, error) {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return false, err
+	}
+	if proof.ChunkSize != 0 && proof.ChunkSize != chunkSize {
+		return false, &bloomtree.VerificationError{Reason: bloomtree.ReasonChunkSize, Err: fmt.Errorf(
+			"%w: the proof has chunk size %d, but the chunk size is %d", bloomtree.ErrChunkSizeMismatch, proof.ChunkSize, chunkSize)}
+	}
+	if params.M == 0 {
+		return false, verifyEmpty([]bloomtree.ProofType{proof.ProofType}, proof.ChunkWords, proof.Proof, root, params)
+	}
+	elemIndices, err := params.elementIndices(element, seed)
+	if err != nil {
+		return false, err
+	}
+
+	present := proof.ProofType.IsPresence()
+	indices, err := provenIndices(elemIndices, proof.ProofType, proof.AbsentIndices)
+	if err != nil {
+		return false, err
+	}
+	set := make([]bool, len(indices))
+	for i := range set {
+		set[i] = present
+	}
+	if err := verifyBits(indices, set, proof.ChunkWords, proof.WordCommitments, proof.Proof, root, params, chunkSize); err != nil {
+		return false, err
+	}
+	return present, nil
+}
+
+// VerifyCommitted checks that the root together with the params and the seed matches the committed root, as
+// returned by BloomTree.CommittedRoot, and verifies the proof against the root like Verify. An error wrapping
+// bloomtree.ErrCommittedRootMismatch is returned if the root was built with other parameters.
+func VerifyCommitted(element, seed []byte, proof *bloomtree.CompactMultiProof, root, committedRoot [32]byte, params Params) (bool, error) {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return false, err
+	}
+	attestation := bloomtree.RootAttestation{
+		Root:        root,
+		ChunkSize:   uint64(chunkSize),
+		Hash:        params.Hash,
+		NumOfHashes: uint64(params.K),
+		FilterBits:  params.M,
+	}
+	if attestation.CommittedRoot(seed) != committedRoot {
+		return false, fmt.Errorf("%w %x", bloomtree.ErrCommittedRootMismatch, committedRoot)
+	}
+	return Verify(element, seed, proof, root, params)
+}
+
+// VerifyForest checks that the element belongs to the shard of the proof, that the tree root of the proof belongs
+// to the forest with the given root, as returned by bloomtree.BloomForest.Root, and verifies the proof of the
+// element against the tree root like Verify. The params are those of the tree of the shard of the proof.
+func VerifyForest(element, seed []byte, proof *bloomtree.ForestProof, root [32]byte, params Params) (bool, error) {
+	if proof.Proof == nil {
+		return false, invalidProof(bloomtree.ReasonProofType, "the forest proof does not open the tree of its shard")
+	}
+	if err := bloomtree.VerifyForestShard(element, proof, bloomtree.WithHash(params.Hash)); err != nil {
+		return false, err
+	}
+	if _, err := bloomtree.VerifyForestPath(proof, root, bloomtree.WithHash(params.Hash)); err != nil {
+		return false, err
+	}
+	return Verify(element, seed, proof.Proof, proof.TreeRoot, params)
+}
+
+// VerifyBatch checks a batch proof against the root, and returns whether it proves the presence or the absence
+// of every element, in the order of the elements. An error is returned if the proof is invalid. The proof must
+// carry the words of its chunks.
+func VerifyBatch(elements [][]byte, seed []byte, proof *bloomtree.BatchMultiProof, root [32]byte, params Params) ([]bool, error) {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBatch(elements, proof); err != nil {
+		return nil, err
+	}
+	if params.M == 0 {
+		if err := verifyEmpty(proof.ProofTypes, proof.ChunkWords, proof.Proof, root, params); err != nil {
+			return nil, err
+		}
+		return make([]bool, len(elements)), nil
+	}
+	elemIndices, present, err := batchIndices(elements, seed, proof, params)
+	if err != nil {
+		return nil, err
+	}
+	type provenBit struct {
+		index uint
+		set   bool
+	}
+	var bits []provenBit
+	for i, indices := range elemIndices {
+		for _, v := range indices {
+			bits = append(bits, provenBit{index: v, set: present[i]})
+		}
+	}
+	sort.Slice(bits, func(i, j int) bool { return bits[i].index < bits[j].index })
+	indices := make([]uint, len(bits))
+	set := make([]bool, len(bits))
+	for i, b := range bits {
+		indices[i], set[i] = b.index, b.set
+	}
+	if err := verifyBits(indices, set, proof.ChunkWords, proof.WordCommitments, proof.Proof, root, params, chunkSize); err != nil {
+		return nil, err
+	}
+	return present, nil
+}
+
+// ElementVerdict is the verdict of VerifyBatchElements on a single element of a batch proof.
+type ElementVerdict struct {
+	// Present is whether the proof claims the presence of the element.
+	Present bool
+	// Err is nil if the claim of the element verified, and otherwise a *bloomtree.VerificationError matching
+	// ErrInvalidProof that tells why it failed.
+	Err error
+}
+
+// VerifyBatchElements checks a batch proof against the root like VerifyBatch, but returns a verdict for every
+// element, in the order of the elements, so callers learn which claims failed without verifying the elements
+// one by one. The chunks of the proof are verified against the root first: an error is returned if they do not
+// reconstruct the root, or if the proof is malformed, as no claim can be attributed then. Afterwards, the claim
+// of every element is checked against the bits of its indices on its own.
+func VerifyBatchElements(elements [][]byte, seed []byte, proof *bloomtree.BatchMultiProof, root [32]byte, params Params) ([]ElementVerdict, error) {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBatch(elements, proof); err != nil {
+		return nil, err
+	}
+	verdicts := make([]ElementVerdict, len(elements))
+	if params.M == 0 {
+		if err := verifyEmpty(nil, proof.ChunkWords, proof.Proof, root, params); err != nil {
+			return nil, err
+		}
+		for i, proofType := range proof.ProofTypes {
+			if verdicts[i].Present = proofType.IsPresence(); verdicts[i].Present {
+				verdicts[i].Err = invalidProof(bloomtree.ReasonProofType, "the bloom filter has no bits, so element %d is not present", i)
+			}
+		}
+		return verdicts, nil
+	}
+	elemIndices, present, err := batchIndices(elements, seed, proof, params)
+	if err != nil {
+		return nil, err
+	}
+	var indices []uint
+	for _, elem := range elemIndices {
+		indices = append(indices, elem...)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	chunkIndices, leafs, err := chunkLeafs(indices, proof.ChunkWords, proof.WordCommitments, params, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChunkRoot(chunkIndices, leafs, proof.Proof, root, params, chunkSize); err != nil {
+		return nil, err
+	}
+	for i, elem := range elemIndices {
+		verdicts[i].Present = present[i]
+		for _, v := range elem {
+			if bitSet(v, chunkIndices, proof.ChunkWords, chunkSize) != present[i] {
+				verdicts[i].Err = invalidProof(bloomtree.ReasonChunkMismatch, "bit %d does not match the proof type of element %d", v, i)
+				break
+			}
+		}
+	}
+	return verdicts, nil
+}
+
+// checkBatch checks that the batch proof covers the elements.
+func checkBatch(elements [][]byte, proof *bloomtree.BatchMultiProof) error {
+	if len(elements) == 0 {
+		return errors.New("the batch has no elements")
+	}
+	if len(proof.ProofTypes) != len(elements) {
+		return invalidProof(bloomtree.ReasonProofType, "the proof covers %d elements, but %d were given", len(proof.ProofTypes), len(elements))
+	}
+	if proof.AbsentIndices != nil && len(proof.AbsentIndices) != len(elements) {
+		return invalidProof(bloomtree.ReasonProofType, "the proof has absent indices for %d elements, but %d were given", len(proof.AbsentIndices), len(elements))
+	}
+	return nil
+}
+
+// batchIndices returns the indices the batch proof opens for every element, and whether it claims the presence
+// of every element.
+func batchIndices(elements [][]byte, seed []byte, proof *bloomtree.BatchMultiProof, params Params) ([][]uint, []bool, error) {
+	elemIndices := make([][]uint, len(elements))
+	present := make([]bool, len(elements))
+	for i, element := range elements {
+		indices, err := params.elementIndices(element, seed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		var absentIndices []uint8
+		if proof.AbsentIndices != nil {
+			absentIndices = proof.AbsentIndices[i]
+		}
+		if elemIndices[i], err = provenIndices(indices, proof.ProofTypes[i], absentIndices); err != nil {
+			return nil, nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		present[i] = proof.ProofTypes[i].IsPresence()
+	}
+	return elemIndices, present, nil
+}
+
+// verifyEmpty checks the proof of a bloom filter without bits, which shows the absence of every element without
+// chunks or hashes against the empty root, see bloomtree.EmptyRoot.
+func verifyEmpty(proofTypes []bloomtree.ProofType, chunkWords [][]uint64, hashes [][32]byte, root [32]byte, params Params) error {
+	for _, proofType := range proofTypes {
+		if proofType.IsPresence() {
+			return invalidProof(bloomtree.ReasonProofType, "the bloom filter has no bits, so no element is present")
+		}
+	}
+	if params.Height != 0 {
+		return invalidProof(bloomtree.ReasonTreeHeight, "the bloom filter has no bits, but height %d is pinned", params.Height)
+	}
+	if len(chunkWords) != 0 {
+		return invalidProof(bloomtree.ReasonChunkCount, "the bloom filter has no bits, but the proof has %d chunks", len(chunkWords))
+	}
+	if len(hashes) != 0 {
+		return invalidProof(bloomtree.ReasonHashCount, "the bloom filter has no bits, but the proof has %d hashes", len(hashes))
+	}
+	empty, err := bloomtree.EmptyRoot(0, bloomtree.WithHash(params.Hash))
+	if err != nil {
+		return err
+	}
+	if empty != root {
+		return invalidProof(bloomtree.ReasonRootMismatch, "the proof does not match the root")
+	}
+	return nil
+}
+
+// verifyBits checks that the words of the chunks holding the sorted indices reconstruct the root together with
+// the hashes, and that the bit at every index is set as given.
+func verifyBits(indices []uint, set []bool, chunkWords [][]uint64, wordCommitments [][][32]byte, hashes [][32]byte,
+	root [32]byte, params Params, chunkSize int) error {
+	chunkIndices, leafs, err := chunkLeafs(indices, chunkWords, wordCommitments, params, chunkSize)
+	if err != nil {
+		return err
+	}
+	for j, v := range indices {
+		if bitSet(v, chunkIndices, chunkWords, chunkSize) != set[j] {
+			return invalidProof(bloomtree.ReasonChunkMismatch, "bit %d does not match the proof type of its element", v)
+		}
+	}
+	return verifyChunkRoot(chunkIndices, leafs, hashes, root, params, chunkSize)
+}
+
+// chunkLeafs returns the indices of the chunks holding the sorted indices, and their leaf hashes from the words
+// of the chunks.
+func chunkLeafs(indices []uint, chunkWords [][]uint64, wordCommitments [][][32]byte, params Params, chunkSize int) ([]uint64, [][32]byte, error) {
+	step := uint64(chunkSize / bloomtree.WordBits)
+	var chunkIndices []uint64
+	for i, v := range indices {
+		index := bloomtree.ChunkIndexOf(uint64(v), chunkSize)
+		if i == 0 || index != chunkIndices[len(chunkIndices)-1] {
+			chunkIndices = append(chunkIndices, index)
+		}
+	}
+	if len(chunkWords) != len(chunkIndices) {
+		return nil, nil, invalidProof(bloomtree.ReasonChunkCount, "the proof has words of %d chunks, but %d are needed", len(chunkWords), len(chunkIndices))
+	}
+	blinded := wordCommitments != nil
+	if blinded && len(wordCommitments) != len(chunkIndices) {
+		return nil, nil, invalidProof(bloomtree.ReasonChunkCount, "the proof has word commitments of %d chunks, but %d are needed", len(wordCommitments), len(chunkIndices))
+	}
+	revealed := make(map[uint64]bool)
+	for _, v := range indices {
+		revealed[uint64(v)/64] = true
+	}
+	leafs := make([][32]byte, len(chunkIndices))
+	for i, index := range chunkIndices {
+		expected := bloomtree.ChunkWordCount(index, params.M, chunkSize)
+		if len(chunkWords[i]) != expected {
+			return nil, nil, invalidProof(bloomtree.ReasonChunkCount, "chunk %d has %d words, but must have %d", index, len(chunkWords[i]), expected)
+		}
+		if !blinded {
+			leafs[i] = params.Hash.SizedChunk(chunkSize, index, chunkWords[i]...)
+			continue
+		}
+		if len(wordCommitments[i]) != expected {
+			return nil, nil, invalidProof(bloomtree.ReasonChunkCount, "chunk %d has %d word commitments, but must have %d", index, len(wordCommitments[i]), expected)
+		}
+		commitments := make([][32]byte, expected)
+		for w, word := range chunkWords[i] {
+			// revealed words are committed with their salt, blinded words are given by their commitment
+			commitments[w] = wordCommitments[i][w]
+			if revealed[index*step+uint64(w)] {
+				commitments[w] = params.Hash.WordCommitment(commitments[w], word)
+			}
+		}
+		leafs[i] = params.Hash.BlindedChunk(index, commitments...)
+	}
+	return chunkIndices, leafs, nil
+}
+
+// bitSet returns whether the bit at the index is set in the words of its chunk, one of the chunk indices.
+func bitSet(v uint, chunkIndices []uint64, chunkWords [][]uint64, chunkSize int) bool {
+	index := bloomtree.ChunkIndexOf(uint64(v), chunkSize)
+	i := sort.Search(len(chunkIndices), func(i int) bool { return chunkIndices[i] >= index })
+	word := chunkWords[i][(uint64(v)-index*uint64(chunkSize))/64]
+	return word&(1<<(v%64)) != 0
+}
+
+// verifyChunkRoot checks that the leafs of the chunks reconstruct the root together with the hashes.
+func verifyChunkRoot(chunkIndices []uint64, leafs [][32]byte, hashes [][32]byte, root [32]byte, params Params, chunkSize int) error {
+	opts := params.options()
+	_, err := bloomtree.VerifyChunkHashes(chunkIndices, leafs, hashes, root, bloomtree.NodeCountFor(params.M, chunkSize), opts...)
+	return err
+}
+
+// VerifyBundle checks the signature of the attestation of the bundle with the public key of the publisher and
+// the batch proof of its elements against the attested root, and returns whether every element is present.
+// indices maps the elements to bloom filter indices, it defaults to the indices of a DBF bloom filter.
+func VerifyBundle(bundle *bloomtree.VerificationBundle, key ed25519.PublicKey, indices IndexFunc) ([]bool, error) {
+	if bundle.Proof == nil {
+		return nil, errors.New("the bundle has no proof")
+	}
+	if !bundle.Attestation.VerifySignature(key, bundle.Signature) {
+		return nil, errors.New("invalid signature of the root attestation")
+	}
+	params := AttestedParams(bundle.Attestation)
+	params.Indices = indices
+	return VerifyBatch(bundle.Elements, bundle.Seed, bundle.Proof, bundle.Attestation.Root, params)
+}
+
+// VerifyWords checks a word proof of a tree built with WithWordTrees against the root, and returns whether it
+// proves the presence or the absence of the element. An error is returned if the proof is invalid.
+func VerifyWords(element, seed []byte, proof *bloomtree.WordProof, root [32]byte, params Params) (bool, error) {
+	chunkSize, err := params.chunkSize()
+	if err != nil {
+		return false, err
+	}
+	elemIndices, err := params.elementIndices(element, seed)
+	if err != nil {
+		return false, err
+	}
+	opts := []bloomtree.Option{bloomtree.WithHash(params.Hash), bloomtree.WithChunkSize(chunkSize)}
+	if params.Height != 0 {
+		opts = append(opts, bloomtree.WithTreeHeight(params.Height))
+	}
+	return bloomtree.VerifyWordProof(elemIndices, proof, root, params.M, opts...)
+}
+
+// chunkSize returns the chunk size of the params, or the default chunk size if it is not set.
+func (params Params) chunkSize() (int, error) {
+	chunkSize := params.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	if chunkSize < 0 || chunkSize%64 != 0 {
+		return 0, errors.New("The chunk size must be divisible by 64")
+	}
+	return chunkSize, nil
+}
+
+// options returns the options verifying proofs of a tree with the params.
+func (params Params) options() []bloomtree.Option {
+	opts := []bloomtree.Option{bloomtree.WithHash(params.Hash)}
+	if params.Height != 0 {
+		opts = append(opts, bloomtree.WithTreeHeight(params.Height))
+	}
+	return opts
+}
+
+// elementIndices returns the bloom filter indices of the element, in the order of the hash functions.
+func (params Params) elementIndices(element, seed []byte) ([]uint, error) {
+	if params.M == 0 {
+		return nil, errors.New("the bloom filter must have at least one bit")
+	}
+	indicesFn := params.Indices
+	if indicesFn == nil {
+		var err error
+		if indicesFn, err = DBFIndices(params.M, params.K); err != nil {
+			return nil, err
+		}
+	}
+	// the DBF index function appends to the seed, which must not write to spare capacity shared with
+	// concurrent verifications of the same seed
+	elemIndices := indicesFn(element, seed[:len(seed):len(seed)])
+	if uint(len(elemIndices)) != params.K {
+		return nil, fmt.Errorf("expected %d element indices, but got %d", params.K, len(elemIndices))
+	}
+	for _, v := range elemIndices {
+		if uint64(v) >= params.M {
+			return nil, &bloomtree.IndexError{Index: uint64(v), Length: params.M}
+		}
+	}
+	return elemIndices, nil
+}
+
+// provenIndices returns the sorted element indices covered by a proof of the given type.
+func provenIndices(elemIndices []uint, proofType bloomtree.ProofType, absentIndices []uint8) ([]uint, error) {
+	var indices []uint
+	if proofType.IsPresence() {
+		indices = append(indices, elemIndices...)
+	} else {
+		positions := absentIndices
+		if len(positions) == 0 {
+			positions = []uint8{uint8(proofType)}
+		} else if bloomtree.Absence(positions[0]) != proofType {
+			return nil, invalidProof(bloomtree.ReasonProofType, "the absent indices do not start with the proof type")
+		}
+		for i, position := range positions {
+			if int(position) >= len(elemIndices) {
+				return nil, invalidProof(bloomtree.ReasonProofType, "the absent index %d exceeds the number of element indices", position)
+			}
+			if i > 0 && position <= positions[i-1] {
+				return nil, invalidProof(bloomtree.ReasonProofType, "the absent indices must be strictly increasing")
+			}
+			indices = append(indices, elemIndices[position])
+		}
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices, nil
+}
+
+// invalidProof returns a VerificationError of the reason with a formatted cause.
+func invalidProof(reason bloomtree.FailureReason, format string, args ...interface{}) error {
+	return &bloomtree.VerificationError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
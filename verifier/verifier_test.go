@@ -0,0 +1,518 @@
+package verifier
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/labbloom/DBF"
+	bloomtree "github.com/labbloom/bloom-tree"
+)
+
+func generateTree(t *testing.T, seed string, chunkSize int, opts ...bloomtree.Option) (*DBF.DistBF, *bloomtree.BloomTree) {
+	if err := bloomtree.SetChunkSize(chunkSize); err != nil {
+		t.Fatal(err)
+	}
+	dbf := DBF.NewDbf(200, 0.2, []byte(seed))
+	for _, elem := range [][]byte{{0}, {1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}} {
+		dbf.Add(elem)
+	}
+	tree, err := bloomtree.NewBloomTree(dbf, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbf, tree
+}
+
+func TestVerify(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	var tests = []struct {
+		chunkSize int
+		hash      bloomtree.Hash
+		sparse    bool
+		element   []byte
+		present   bool
+	}{
+		{chunkSize: 64, element: []byte{1}, present: true},
+		{chunkSize: 64, element: []byte{9}, present: false},
+		{chunkSize: 512, element: []byte{8}, present: true},
+		{chunkSize: 512, element: []byte{17}, present: false},
+		{chunkSize: 192, element: []byte{0}, present: true},
+		{chunkSize: 192, element: []byte{42}, present: false},
+		{chunkSize: 64, hash: bloomtree.Keccak256, element: []byte{1}, present: true},
+		{chunkSize: 128, hash: bloomtree.BLAKE3, element: []byte{9}, present: false},
+		{chunkSize: 64, sparse: true, element: []byte{1}, present: true},
+		{chunkSize: 64, sparse: true, element: []byte{9}, present: false},
+	}
+
+	for _, test := range tests {
+		opts := []bloomtree.Option{bloomtree.WithAbsentIndices(3), bloomtree.WithHash(test.hash)}
+		if test.sparse {
+			opts = append(opts, bloomtree.WithSparse())
+		}
+		dbf, tree := generateTree(t, seed, test.chunkSize, opts...)
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// proofs of sparse trees verify like proofs of dense trees
+		params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: test.chunkSize, Hash: test.hash}
+		present, err := Verify(test.element, []byte(seed), multiproof, tree.Root(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present != test.present {
+			t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+		}
+	}
+}
+
+func TestVerifyBlinded(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 512, bloomtree.WithAbsentIndices(3), bloomtree.WithBlinding([]byte("0123456789abcdef")))
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: 512}
+	for _, test := range []struct {
+		element []byte
+		present bool
+	}{
+		{element: []byte{8}, present: true},
+		{element: []byte{17}, present: false},
+	} {
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		present, err := Verify(test.element, []byte(seed), multiproof, tree.Root(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present != test.present {
+			t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+		}
+		// a blinded word cannot be changed without breaking its commitment
+		for w := range multiproof.WordCommitments[0] {
+			multiproof.WordCommitments[0][w][0] ^= 1
+		}
+		if _, err := Verify(test.element, []byte(seed), multiproof, tree.Root(), params); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("expected error %v, but got %v", ErrInvalidProof, err)
+		}
+	}
+}
+
+func TestVerifyCommitted(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 128, bloomtree.WithChunkSize(128), bloomtree.WithSeed([]byte(seed)))
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: 128}
+	present, err := VerifyCommitted([]byte{1}, []byte(seed), multiproof, tree.Root(), tree.CommittedRoot(), params)
+	if err != nil {
+		t.Fatal(err)
+	} else if !present {
+		t.Fatal("expected a presence proof")
+	}
+	params.K++
+	if _, err := VerifyCommitted([]byte{1}, []byte(seed), multiproof, tree.Root(), tree.CommittedRoot(), params); !errors.Is(err, bloomtree.ErrCommittedRootMismatch) {
+		t.Fatalf("expected ErrCommittedRootMismatch for another k, but got %v", err)
+	}
+}
+
+func TestVerifyForest(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	// every shard holds all elements, so any element has a tree for its shard
+	dbf, tree := generateTree(t, seed, 64)
+	forest, err := bloomtree.NewBloomForest(tree, tree, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	for _, test := range []struct {
+		elem    byte
+		present bool
+	}{{elem: 1, present: true}, {elem: 42, present: false}} {
+		proof, err := forest.GenerateCompactMultiProof([]byte{test.elem})
+		if err != nil {
+			t.Fatal(err)
+		}
+		present, err := VerifyForest([]byte{test.elem}, []byte(seed), proof, forest.Root(), params)
+		if err != nil {
+			t.Fatal(err)
+		} else if present != test.present {
+			t.Fatalf("expected presence %t of element %d, but got %t", test.present, test.elem, present)
+		}
+	}
+
+	proof, err := forest.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := *proof
+	moved.Shard = (proof.Shard + 1) % proof.Shards
+	var verr *bloomtree.VerificationError
+	if _, err := VerifyForest([]byte{1}, []byte(seed), &moved, forest.Root(), params); !errors.As(err, &verr) ||
+		verr.Reason != bloomtree.ReasonChunkMismatch {
+		t.Fatalf("expected a chunk mismatch for a proof of another shard, but got %v", err)
+	}
+	tampered := *proof
+	tampered.TreeRoot[0] ^= 1
+	if _, err := VerifyForest([]byte{1}, []byte(seed), &tampered, forest.Root(), params); !errors.As(err, &verr) ||
+		verr.Reason != bloomtree.ReasonRootMismatch {
+		t.Fatalf("expected a root mismatch for a proof of another tree, but got %v", err)
+	}
+}
+
+func TestVerifyBatch(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	elements := [][]byte{{1}, {9}, {8}, {17}, {42}, {0}}
+	expected := []bool{true, false, true, false, false, true}
+	var tests = []struct {
+		chunkSize int
+		opts      []bloomtree.Option
+	}{
+		{chunkSize: 64},
+		{chunkSize: 512, opts: []bloomtree.Option{bloomtree.WithAbsentIndices(3)}},
+		{chunkSize: 192, opts: []bloomtree.Option{bloomtree.WithHash(bloomtree.Keccak256)}},
+		{chunkSize: 512, opts: []bloomtree.Option{bloomtree.WithBlinding([]byte("0123456789abcdef"))}},
+	}
+	for _, test := range tests {
+		dbf, tree := generateTree(t, seed, test.chunkSize, test.opts...)
+		proof, err := tree.GenerateCompactMultiProofBatch(elements)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: test.chunkSize,
+			Hash: tree.Attestation().Hash}
+		present, err := VerifyBatch(elements, []byte(seed), proof, tree.Root(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range expected {
+			if present[i] != expected[i] {
+				t.Fatalf("expected presence %t of element %v, but got %t", expected[i], elements[i], present[i])
+			}
+		}
+		// the proof does not cover the elements in another order
+		swapped := append([][]byte{elements[1], elements[0]}, elements[2:]...)
+		if _, err := VerifyBatch(swapped, []byte(seed), proof, tree.Root(), params); err == nil {
+			t.Fatal("expected error for swapped elements")
+		}
+		if _, err := VerifyBatch(elements[1:], []byte(seed), proof, tree.Root(), params); err == nil {
+			t.Fatal("expected error for missing elements")
+		}
+	}
+}
+
+func TestVerifyBatchElements(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	elements := [][]byte{{1}, {9}, {8}, {17}, {42}, {0}}
+	expected := []bool{true, false, true, false, false, true}
+	// a single chunk holds every bit, so the proof opens the same chunk for other elements
+	dbf, tree := generateTree(t, seed, 1024)
+	proof, err := tree.GenerateCompactMultiProofBatch(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: 1024}
+	verdicts, err := VerifyBatchElements(elements, []byte(seed), proof, tree.Root(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, verdict := range verdicts {
+		if verdict.Err != nil || verdict.Present != expected[i] {
+			t.Fatalf("expected presence %t of element %v, but got %+v", expected[i], elements[i], verdict)
+		}
+	}
+
+	// only the element with a wrong claim fails, while VerifyBatch rejects the whole proof
+	tampered := append([][]byte{}, elements...)
+	tampered[1] = []byte{2}
+	if _, err := VerifyBatch(tampered, []byte(seed), proof, tree.Root(), params); !errors.Is(err, bloomtree.ErrInvalidProof) {
+		t.Fatalf("expected an invalid proof, but got %v", err)
+	}
+	verdicts, err = VerifyBatchElements(tampered, []byte(seed), proof, tree.Root(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, verdict := range verdicts {
+		var verr *bloomtree.VerificationError
+		if i == 1 && (!errors.As(verdict.Err, &verr) || verr.Reason != bloomtree.ReasonChunkMismatch) {
+			t.Fatalf("expected a chunk mismatch for the tampered element, but got %v", verdict.Err)
+		}
+		if i != 1 && verdict.Err != nil {
+			t.Fatalf("expected element %v to verify, but got %v", tampered[i], verdict.Err)
+		}
+	}
+
+	// chunks not matching the root fail the whole proof
+	if _, err := VerifyBatchElements(elements, []byte(seed), proof, [32]byte{1}, params); !errors.Is(err, bloomtree.ErrInvalidProof) {
+		t.Fatalf("expected an invalid proof for another root, but got %v", err)
+	}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	_, tree := generateTree(t, seed, 128)
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := tree.ExportVerificationBundle([][]byte{{1}, {42}}, []byte(seed), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	present, err := VerifyBundle(bundle, pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(present) != 2 || !present[0] || present[1] {
+		t.Fatalf("expected presence [true false], but got %v", present)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBundle(bundle, otherPub, nil); err == nil {
+		t.Fatal("expected error for the key of another publisher")
+	}
+	bundle.Attestation.Root[0] ^= 1
+	if _, err := VerifyBundle(bundle, pub, nil); err == nil {
+		t.Fatal("expected error for another root")
+	}
+}
+
+func TestVerifyWords(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 1024, bloomtree.WithAbsentIndices(3), bloomtree.WithWordTrees())
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes(), ChunkSize: 1024}
+	for _, test := range []struct {
+		element []byte
+		present bool
+	}{
+		{element: []byte{8}, present: true},
+		{element: []byte{17}, present: false},
+	} {
+		proof, err := tree.GenerateWordProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		present, err := VerifyWords(test.element, []byte(seed), proof, tree.Root(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present != test.present {
+			t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+		}
+		if _, err := VerifyWords([]byte{100}, []byte(seed), proof, tree.Root(), params); err == nil {
+			t.Fatal("expected error for the proof of another element")
+		}
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	root, err := bloomtree.EmptyRoot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := Params{M: 0, K: 3}
+	proof := &bloomtree.CompactMultiProof{ProofType: bloomtree.Absence(0), ChunkSize: 64}
+	present, err := Verify([]byte{1}, []byte("seed"), proof, root, params)
+	if err != nil {
+		t.Fatal(err)
+	} else if present {
+		t.Fatal("expected every element to be absent from an empty bloom filter")
+	}
+	batch := &bloomtree.BatchMultiProof{ProofTypes: []bloomtree.ProofType{bloomtree.Absence(0), bloomtree.Absence(0)}}
+	if present, err := VerifyBatch([][]byte{{1}, {2}}, []byte("seed"), batch, root, params); err != nil || present[0] || present[1] {
+		t.Fatalf("expected both elements to be absent, got %v and %v", present, err)
+	}
+
+	other := root
+	other[0] ^= 1
+	var verr *bloomtree.VerificationError
+	if _, err := Verify([]byte{1}, []byte("seed"), proof, other, params); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonRootMismatch {
+		t.Fatalf("expected a root mismatch, but got %v", err)
+	}
+	proof.ProofType = bloomtree.Presence
+	if _, err := Verify([]byte{1}, []byte("seed"), proof, root, params); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonProofType {
+		t.Fatalf("expected an invalid proof type, but got %v", err)
+	}
+}
+
+func TestVerifyPinnedHeight(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	leaves := (params.M + 63) / 64
+	for leaves&(leaves-1) != 0 {
+		leaves++
+	}
+	for n := leaves; n > 1; n /= 2 {
+		params.Height++
+	}
+	proof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := tree.GenerateCompactMultiProofBatch([][]byte{{1}, {42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present, err := Verify([]byte{1}, []byte(seed), proof, tree.Root(), params); err != nil || !present {
+		t.Fatalf("expected the element to be present with the height of its tree pinned, got %v", err)
+	}
+	if _, err := VerifyBatch([][]byte{{1}, {42}}, []byte(seed), batch, tree.Root(), params); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyStructural(proof, params); err != nil {
+		t.Fatal(err)
+	}
+
+	// a verifier pinning another height rejects the proof
+	params.Height++
+	var verr *bloomtree.VerificationError
+	if _, err := Verify([]byte{1}, []byte(seed), proof, tree.Root(), params); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonTreeHeight {
+		t.Fatalf("expected a tree height mismatch, but got %v", err)
+	}
+	if _, err := VerifyBatch([][]byte{{1}, {42}}, []byte(seed), batch, tree.Root(), params); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonTreeHeight {
+		t.Fatalf("expected a tree height mismatch of the batch, but got %v", err)
+	}
+	if err := VerifyStructural(proof, params); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonTreeHeight {
+		t.Fatalf("expected a structural tree height mismatch, but got %v", err)
+	}
+	empty, err := bloomtree.EmptyRoot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent := &bloomtree.CompactMultiProof{ProofType: bloomtree.Absence(0)}
+	if _, err := Verify([]byte{1}, []byte(seed), absent, empty, Params{K: 3, Height: 1}); !errors.As(err, &verr) || verr.Reason != bloomtree.ReasonTreeHeight {
+		t.Fatalf("expected a tree height mismatch of an empty bloom filter, but got %v", err)
+	}
+}
+
+func TestVerifyInvalidProof(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	params := Params{M: uint64(dbf.BitArray().Len()), K: dbf.NumOfHashes()}
+	var tests = []struct {
+		name    string
+		element []byte
+		tamper  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params)
+		err     error
+		reason  bloomtree.FailureReason
+	}{
+		{
+			name:    "wrong root",
+			element: []byte{1},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { root[0] ^= 1 },
+			err:     ErrInvalidProof,
+			reason:  bloomtree.ReasonRootMismatch,
+		},
+		{
+			name:    "flipped word claimed absent",
+			element: []byte{9},
+			tamper: func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) {
+				p.ChunkWords[0] = append([]uint64(nil), p.ChunkWords[0]...)
+				for i := range p.ChunkWords[0] {
+					p.ChunkWords[0][i] = 0
+				}
+			},
+			err:    ErrInvalidProof,
+			reason: bloomtree.ReasonRootMismatch,
+		},
+		{
+			name:    "missing chunk words",
+			element: []byte{1},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { p.ChunkWords = p.ChunkWords[1:] },
+			reason:  bloomtree.ReasonChunkCount,
+		},
+		{
+			name:    "presence claimed for absent element",
+			element: []byte{9},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { p.ProofType = bloomtree.Presence },
+			reason:  bloomtree.ReasonChunkCount,
+		},
+		{
+			name:    "proof type out of range",
+			element: []byte{9},
+			tamper: func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) {
+				p.ProofType = bloomtree.Absence(100)
+			},
+			reason: bloomtree.ReasonProofType,
+		},
+		{
+			name:    "wrong number of hash functions",
+			element: []byte{1},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { params.K++ },
+		},
+		{
+			name:    "wrong chunk size",
+			element: []byte{1},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { params.ChunkSize = 100 },
+		},
+		{
+			name:    "chunk size of another tree",
+			element: []byte{1},
+			tamper:  func(p *bloomtree.CompactMultiProof, root *[32]byte, params *Params) { params.ChunkSize = 128 },
+			err:     bloomtree.ErrChunkSizeMismatch,
+			reason:  bloomtree.ReasonChunkSize,
+		},
+	}
+
+	for _, test := range tests {
+		multiproof, err := tree.GenerateCompactMultiProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tree.Root()
+		p := params
+		test.tamper(multiproof, &root, &p)
+		_, err = Verify(test.element, []byte(seed), multiproof, root, p)
+		if err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected error %v, but got %v", test.name, test.err, err)
+		}
+		var verr *bloomtree.VerificationError
+		if test.reason != 0 && (!errors.As(err, &verr) || verr.Reason != test.reason) {
+			t.Fatalf("%s: expected a verification error with reason %v, but got %v", test.name, test.reason, err)
+		}
+	}
+}
+
+func TestVerifyCustomIndices(t *testing.T) {
+	defer bloomtree.SetChunkSize(64)
+	seed := "secret seed"
+	dbf, tree := generateTree(t, seed, 64)
+	calls := 0
+	params := Params{
+		M: uint64(dbf.BitArray().Len()),
+		K: dbf.NumOfHashes(),
+		Indices: func(element, seed []byte) []uint {
+			calls++
+			return dbf.MapElementToBF(element, seed)
+		},
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	present, err := Verify([]byte{3}, []byte(seed), multiproof, tree.Root(), params)
+	if err != nil {
+		t.Fatal(err)
+	} else if !present || calls != 1 {
+		t.Fatalf("expected element to be present using the custom index function, got %t after %d calls", present, calls)
+	}
+}
@@ -0,0 +1,74 @@
+package bloomtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// proofWireVersion is the version of the wire format of proofs written by Encode.
+// Version 2 added the chunk size and version 3 the word commitments of blinded proofs. Every proof
+// is encoded with the lowest version able to hold it, e.g. proofs with an unknown chunk size as version 1.
+const proofWireVersion = 3
+
+// Encode returns the canonical wire format of the proof, meant for implementations in other languages.
+// It is the format version byte, followed by the MarshalBinary encoding:
+//
+//	version       byte (3 with word commitments, 1 if the chunk size is unknown, 2 otherwise)
+//	proofType     byte
+//	chunks        uvarint count, then 32 bytes per leaf hash
+//	proof         uvarint count, then 32 bytes per hash
+//	absentIndices uvarint count, then 1 byte per position
+//	chunkWords    uvarint count, then per chunk a uvarint count and 8 little endian bytes per word
+//	chunkSize     uvarint, only present from version 2
+//	commitments   only in version 3, uvarint count, then per chunk a uvarint count and 32 bytes per commitment
+//
+// Uvarints are the minimal unsigned LEB128 encoding, as written by encoding/binary.
+func (p *CompactMultiProof) Encode() []byte {
+	data := []byte{p.wireVersion()}
+	if p.checkBinary() != nil {
+		// proofs MarshalBinary fails for are encoded as their version alone
+		return data
+	}
+	return p.appendBinary(append(make([]byte, 0, 1+p.binarySize()), data...))
+}
+
+// wireVersion returns the lowest wire format version able to encode the proof.
+func (p *CompactMultiProof) wireVersion() byte {
+	switch {
+	case len(p.WordCommitments) != 0:
+		return 3
+	case p.ChunkSize != 0:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// DecodeCompactMultiProof decodes a proof in the wire format written by Encode. Encodings of unknown
+// versions and non-canonical encodings, e.g. uvarints with redundant bytes, are rejected, so every proof
+// has exactly one encoding.
+func DecodeCompactMultiProof(data []byte) (*CompactMultiProof, error) {
+	if len(data) == 0 {
+		return nil, errors.New("decoding version: empty proof encoding")
+	}
+	if data[0] < 1 || data[0] > proofWireVersion {
+		return nil, fmt.Errorf("unsupported proof encoding version %d", data[0])
+	}
+	p := new(CompactMultiProof)
+	if err := p.UnmarshalBinary(data[1:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p.Encode(), data) {
+		return nil, errors.New("non-canonical proof encoding")
+	}
+	return p, nil
+}
+
+// Size returns the number of bytes of the wire format of the proof.
+func (p *CompactMultiProof) Size() int {
+	if p.checkBinary() != nil {
+		return 1
+	}
+	return 1 + p.binarySize()
+}
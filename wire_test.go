@@ -0,0 +1,131 @@
+package bloomtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeCompactMultiProof(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithAbsentIndices(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range [][]byte{{1}, {42}} {
+		multiproof, err := tree.GenerateCompactMultiProof(elem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := multiproof.Encode()
+		if data[0] != 2 || multiproof.Size() != len(data) {
+			t.Fatal("unexpected version byte or size")
+		}
+		decoded, err := DecodeCompactMultiProof(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded.Encode(), data) || decoded.ProofType != multiproof.ProofType {
+			t.Fatalf("decoded proof of element %v does not match", elem)
+		}
+		verified, err := VerifyCompactMultiProof(elem, []byte(seed), decoded, tree.Root(), dbf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !verified {
+			t.Fatalf("failed to verify decoded proof of element %v", elem)
+		}
+	}
+}
+
+func TestDecodeCompactMultiProofErrors(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := multiproof.Encode()
+	// the chunk count at offset 2 fits a single byte, and is padded with a redundant byte
+	nonCanonical := append([]byte{data[0], data[1], data[2] | 0x80, 0}, data[3:]...)
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "unknown version", data: append([]byte{proofWireVersion + 1}, data[1:]...)},
+		{name: "truncated", data: data[:len(data)-1]},
+		{name: "trailing data", data: append(append([]byte(nil), data...), 0)},
+		{name: "non-canonical uvarint", data: nonCanonical},
+		{name: "version 1 with chunk size", data: append([]byte{1}, data[1:]...)},
+	}
+	for _, test := range tests {
+		if _, err := DecodeCompactMultiProof(test.data); err == nil {
+			t.Fatalf("expected error for %s encoding", test.name)
+		}
+	}
+}
+
+func TestEncodeUnknownChunkSize(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(200, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiproof, err := tree.GenerateCompactMultiProof([]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSize := multiproof.Encode()
+	multiproof.ChunkSize = 0
+	data := multiproof.Encode()
+	// proofs without a chunk size are encoded as version 1, which lacks the trailing chunk size byte
+	if data[0] != 1 || !reflect.DeepEqual(data[1:], withSize[1:len(withSize)-1]) {
+		t.Fatal("unexpected encoding of a proof without chunk size")
+	}
+	decoded, err := DecodeCompactMultiProof(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ChunkSize != 0 {
+		t.Fatalf("expected unknown chunk size, but got %d", decoded.ChunkSize)
+	}
+	if _, err := DecodeCompactMultiProof(append([]byte{2}, data[1:]...)); err == nil {
+		t.Fatal("expected error for version 2 encoding without chunk size")
+	}
+}
+
+func TestProofSize(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(200, seed, []byte{1}, []byte{2})
+	var proofs []*CompactMultiProof
+	for _, opts := range [][]Option{nil, {WithAbsentIndices(3)}, {WithBlinding([]byte("sixteen byte key"))}} {
+		tree, err := NewBloomTree(dbf, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, elem := range [][]byte{{1}, {42}} {
+			multiproof, err := tree.GenerateCompactMultiProof(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proofs = append(proofs, multiproof)
+		}
+	}
+	// the sizes of uvarints grow with the number of hashes and the chunk size
+	proofs = append(proofs, &CompactMultiProof{Chunks: make([][32]byte, 200), Proof: make([][32]byte, 20000), ChunkSize: 1 << 20},
+		&CompactMultiProof{ChunkSize: -1}, &CompactMultiProof{WordCommitments: [][][32]byte{{{1}}}})
+
+	for i, multiproof := range proofs {
+		if size := len(multiproof.Encode()); multiproof.Size() != size {
+			t.Fatalf("proof %d: expected size %d, but got %d", i, size, multiproof.Size())
+		}
+	}
+}
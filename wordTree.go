@@ -0,0 +1,238 @@
+package bloomtree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WordProof proves the presence or absence of an element in a tree built with WithWordTrees. It opens only
+// the words holding the proven indices, each with the hashes needed to reconstruct the word tree of its chunk,
+// instead of the whole chunks, so it reveals fewer bits of other elements and stays small for large chunks.
+type WordProof struct {
+	// ProofType is Presence if the element is present in the bloom filter. Otherwise it is an absence proof type
+	// holding the position of the element index pointing to a zero bit.
+	ProofType ProofType
+	// AbsentIndices are the positions of all zero bits of an absence proof, see CompactMultiProof.AbsentIndices.
+	AbsentIndices []uint8
+	// ChunkSize is the chunk size of the tree the proof was generated from.
+	ChunkSize int
+	// Chunks are the distinct chunks holding the proven indices, in increasing order.
+	Chunks []WordChunk
+	// Proof are the hashes needed to reconstruct the bloom tree root from the leafs of the chunks.
+	Proof [][32]byte
+}
+
+// WordChunk holds the opened words of a chunk of a WordProof.
+type WordChunk struct {
+	// Index is the leaf index of the chunk.
+	Index uint64
+	// Words are the distinct words of the chunk holding proven indices, in increasing order.
+	Words []uint64
+	// Proof are the hashes needed to reconstruct the root of the word tree of the chunk from the words.
+	Proof [][32]byte
+}
+
+// WithWordTrees hashes every chunk as the root of a Merkle tree over its 64 bit words, so GenerateWordProof
+// can open single words of a chunk. The leaf of a chunk commits to its index and the root of its word tree,
+// whose leafs commit to the chunk index, the position and the value of a word. Word trees have the same
+// height in every chunk, the missing words of the last chunk being padding. Trees with word trees cannot be
+// blinded, adaptive or use the EVM layout. Compact multiproofs of such trees verify with VerifyCompactMultiProof
+// and this option, but do not carry verifiable words.
+func WithWordTrees() Option {
+	return func(c *config) error {
+		c.wordTrees = true
+		return nil
+	}
+}
+
+// checkWordTrees returns an error if the options conflict with word trees.
+func (c config) checkWordTrees() error {
+	if !c.wordTrees {
+		return nil
+	}
+	if c.blindingKey != nil {
+		return errors.New("trees with word trees cannot be blinded")
+	}
+	if c.evm {
+		return errors.New("trees with word trees cannot use the EVM layout")
+	}
+	return nil
+}
+
+// wordTreeLeafs returns the number of leafs of the word tree of a chunk of step words, a power of two.
+func wordTreeLeafs(step int) int {
+	n := 1
+	for n < step {
+		n *= 2
+	}
+	return n
+}
+
+// wordTreeNodes returns the nodes of the word tree of the chunk at the given index holding the given words,
+// in the layout of the bloom tree with the root last.
+func wordTreeNodes(h Hash, index uint64, words []uint64, step int) [][32]byte {
+	leafNum := wordTreeLeafs(step)
+	nodes := make([][32]byte, 2*leafNum-1)
+	for i := 0; i < leafNum; i++ {
+		if i < len(words) {
+			nodes[i] = h.word(index, i, words[i])
+		} else {
+			nodes[i] = h.wordPadding(index, i)
+		}
+	}
+	for i := leafNum; i < len(nodes); i++ {
+		nodes[i] = h.child(nodes[2*(i-leafNum)], nodes[2*(i-leafNum)+1])
+	}
+	return nodes
+}
+
+// GenerateWordProof returns a proof of the presence or absence of an element that opens only the words holding
+// its proven indices. The tree must have been built with WithWordTrees.
+func (bt *BloomTree) GenerateWordProof(elem []byte) (*WordProof, error) {
+	if bt.bf == nil {
+		return nil, ErrNoBloomFilter
+	}
+	if !bt.cfg.wordTrees {
+		return nil, errors.New("the tree was not built with word trees")
+	}
+	indices, proofType, absentIndices, err := bt.proofIndices(elem)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	chunkIndices := make([]uint64, len(indices))
+	for i, v := range indices {
+		chunkIndices[i] = bt.chunkIndex(v)
+	}
+	proof, err := bt.generateProof(context.Background(), chunkIndices)
+	if err != nil {
+		return nil, err
+	}
+	words := bt.bf.BitArray().Bytes()
+	step := bt.cfg.chunkSize / 64
+	var chunks []WordChunk
+	for _, group := range wordGroups(indices, bt.cfg.chunkSize) {
+		chunkWords := bt.leafWords(words, int(group.chunk))
+		nodes := wordTreeNodes(bt.cfg.hash, group.chunk, chunkWords, step)
+		chunk := WordChunk{Index: group.chunk}
+		for _, position := range group.positions {
+			chunk.Words = append(chunk.Words, chunkWords[position])
+		}
+		if len(nodes) > 1 {
+			hashIndices, err := multiproofIndices(group.positions, len(nodes))
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range hashIndices {
+				chunk.Proof = append(chunk.Proof, nodes[i])
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return &WordProof{
+		ProofType:     proofType,
+		AbsentIndices: absentIndices,
+		ChunkSize:     bt.cfg.chunkSize,
+		Chunks:        chunks,
+		Proof:         proof,
+	}, nil
+}
+
+// wordGroup holds the distinct positions of the words of a chunk holding proven indices.
+type wordGroup struct {
+	chunk     uint64
+	positions []uint64
+}
+
+// wordGroups groups the sorted bloom filter indices by chunk and word.
+func wordGroups(indices []uint64, chunkSize int) []wordGroup {
+	var groups []wordGroup
+	for _, v := range indices {
+		chunk, position := v/uint64(chunkSize), v%uint64(chunkSize)/64
+		if len(groups) == 0 || groups[len(groups)-1].chunk != chunk {
+			groups = append(groups, wordGroup{chunk: chunk})
+		}
+		g := &groups[len(groups)-1]
+		if len(g.positions) == 0 || g.positions[len(g.positions)-1] != position {
+			g.positions = append(g.positions, position)
+		}
+	}
+	return groups
+}
+
+// VerifyWordProof verifies the proof against the root of a tree built with WithWordTrees from a bloom filter
+// of filterBits bits, and returns whether it proves the presence or the absence of the element with the given
+// bloom filter indices, e.g. as returned by the MapElementToBF method of the bloom filter. Unlike
+// VerifyCompactMultiProof, it checks the bits of the element in the opened words, so the bloom filter is not
+// needed. An error is returned if the proof is invalid.
+func VerifyWordProof(elemIndices []uint, proof *WordProof, root [32]byte, filterBits uint64, opts ...Option) (bool, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if proof.ChunkSize != 0 && proof.ChunkSize != cfg.chunkSize {
+		return false, chunkSizeMismatch(proof.ChunkSize, cfg.chunkSize)
+	}
+	if filterBits == 0 {
+		return false, errors.New("the bloom filter must have at least one bit")
+	}
+	present := proof.ProofType.IsPresence()
+	index := elemIndices
+	if !present {
+		if index, err = absenceIndices(elemIndices, proof.ProofType, proof.AbsentIndices, cfg); err != nil {
+			return false, err
+		}
+	}
+	indices := make([]uint64, len(index))
+	for i, v := range index {
+		indices[i] = uint64(v)
+	}
+	if err := checkIndices(indices, filterBits); err != nil {
+		return false, err
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	groups := wordGroups(indices, cfg.chunkSize)
+	if len(proof.Chunks) != len(groups) {
+		return false, invalidProof(ReasonChunkCount, "the proof has %d chunks, but %d are needed", len(proof.Chunks), len(groups))
+	}
+	step := cfg.chunkSize / 64
+	wordTreeLength := 2*wordTreeLeafs(step) - 1
+	chunkIndices := make([]uint64, len(groups))
+	leafs := make([][32]byte, len(groups))
+	for i, group := range groups {
+		chunk := proof.Chunks[i]
+		if chunk.Index != group.chunk {
+			return false, invalidProof(ReasonChunkMismatch, "the proof has chunk %d, but chunk %d is needed", chunk.Index, group.chunk)
+		}
+		if len(chunk.Words) != len(group.positions) {
+			return false, invalidProof(ReasonChunkCount, "chunk %d has %d words, but %d are needed", chunk.Index, len(chunk.Words), len(group.positions))
+		}
+		words := make([][32]byte, len(chunk.Words))
+		for j, position := range group.positions {
+			words[j] = cfg.hash.word(chunk.Index, int(position), chunk.Words[j])
+		}
+		wordRoot := words[0]
+		if wordTreeLength > 1 {
+			if wordRoot, err = proofRoot(cfg, group.positions, newCompactMultiProof(words, chunk.Proof, Presence), wordTreeLength); err != nil {
+				return false, fmt.Errorf("chunk %d: %w", chunk.Index, err)
+			}
+		}
+		chunkIndices[i] = chunk.Index
+		leafs[i] = cfg.hash.wordTreeLeaf(chunk.Index, wordRoot)
+	}
+	for _, v := range indices {
+		i := sort.Search(len(groups), func(i int) bool { return groups[i].chunk >= v/uint64(cfg.chunkSize) })
+		position := v % uint64(cfg.chunkSize) / 64
+		j := sort.Search(len(groups[i].positions), func(j int) bool { return groups[i].positions[j] >= position })
+		if set := proof.Chunks[i].Words[j]&(1<<(v%64)) != 0; set != present {
+			return false, invalidProof(ReasonChunkMismatch, "bit %d does not match the proof type %v", v, proof.ProofType)
+		}
+	}
+	treeLength := NodeCountFor(filterBits, cfg.chunkSize)
+	if _, err := verifyProof(cfg, chunkIndices, newCompactMultiProof(leafs, proof.Proof, Presence), root, treeLength); err != nil {
+		return false, err
+	}
+	return present, nil
+}
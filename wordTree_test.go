@@ -0,0 +1,143 @@
+package bloomtree
+
+import (
+	"testing"
+)
+
+func TestGenerateWordProof(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2}, []byte{3})
+	for _, size := range []int{64, 192, 1024} {
+		tree, err := NewBloomTree(dbf, WithWordTrees(), WithChunkSize(size), WithAbsentIndices(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			element []byte
+			present bool
+		}{
+			{element: []byte{1}, present: true},
+			{element: []byte{3}, present: true},
+			{element: []byte{42}, present: false},
+		} {
+			proof, err := tree.GenerateWordProof(test.element)
+			if err != nil {
+				t.Fatal(err)
+			}
+			elemIndices := dbf.MapElementToBF(test.element, []byte(seed))
+			present, err := VerifyWordProof(elemIndices, proof, tree.Root(), uint64(dbf.BitArray().Len()), WithChunkSize(size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if present != test.present {
+				t.Fatalf("expected presence %t of element %v, but got %t", test.present, test.element, present)
+			}
+			// only the words holding proven indices are opened
+			var words int
+			for _, chunk := range proof.Chunks {
+				words += len(chunk.Words)
+			}
+			if words > len(elemIndices) {
+				t.Fatalf("expected at most %d words, but got %d", len(elemIndices), words)
+			}
+			// compact multiproofs of trees with word trees verify as well
+			multiproof, err := tree.GenerateCompactMultiProof(test.element)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := VerifyCompactMultiProof(test.element, []byte(seed), multiproof, tree.Root(), dbf,
+				WithWordTrees(), WithChunkSize(size), WithAbsentIndices(2))
+			if err != nil {
+				t.Fatal(err)
+			} else if !verified {
+				t.Fatalf("failed to verify compact multiproof of element %v", test.element)
+			}
+		}
+	}
+}
+
+func TestVerifyWordProofErrors(t *testing.T) {
+	SetChunkSize(64)
+	seed := "secret seed"
+	dbf := generateDBF(1000, seed, []byte{1}, []byte{2})
+	tree, err := NewBloomTree(dbf, WithWordTrees(), WithChunkSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterBits := uint64(dbf.BitArray().Len())
+	var tests = []struct {
+		name      string
+		element   []byte
+		chunkSize int
+		tamper    func(p *WordProof)
+	}{
+		{name: "flipped word", element: []byte{1}, tamper: func(p *WordProof) { p.Chunks[0].Words[0] ^= 1 << 63 }},
+		{name: "flipped word hash", element: []byte{1}, tamper: func(p *WordProof) { p.Chunks[0].Proof[0][0] ^= 1 }},
+		{name: "flipped hash", element: []byte{1}, tamper: func(p *WordProof) { p.Proof[0][0] ^= 1 }},
+		{name: "missing chunk", element: []byte{1}, tamper: func(p *WordProof) { p.Chunks = p.Chunks[1:] }},
+		{name: "missing word", element: []byte{1}, tamper: func(p *WordProof) { p.Chunks[0].Words = p.Chunks[0].Words[1:] }},
+		{name: "other chunk", element: []byte{1}, tamper: func(p *WordProof) { p.Chunks[0].Index++ }},
+		{name: "presence claimed for absent element", element: []byte{42}, tamper: func(p *WordProof) { p.ProofType = Presence }},
+		{name: "wrong chunk size", element: []byte{1}, chunkSize: 1024, tamper: func(p *WordProof) {}},
+	}
+	for _, test := range tests {
+		proof, err := tree.GenerateWordProof(test.element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(proof)
+		chunkSize := test.chunkSize
+		if chunkSize == 0 {
+			chunkSize = 512
+		}
+		elemIndices := dbf.MapElementToBF(test.element, []byte(seed))
+		if _, err := VerifyWordProof(elemIndices, proof, tree.Root(), filterBits, WithChunkSize(chunkSize)); err == nil {
+			t.Fatalf("expected error for %s", test.name)
+		}
+	}
+
+	if _, err := NewBloomTree(dbf, WithWordTrees(), WithBlinding([]byte("0123456789abcdef"))); err == nil {
+		t.Fatal("expected error for a blinded tree with word trees")
+	}
+	if _, err := NewAdaptiveBloomTree(dbf, 64, 512, WithWordTrees()); err == nil {
+		t.Fatal("expected error for an adaptive tree with word trees")
+	}
+	plain, err := NewBloomTree(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.GenerateWordProof([]byte{1}); err == nil {
+		t.Fatal("expected error for a tree without word trees")
+	}
+}
+
+func TestWordTreeEncoding(t *testing.T) {
+	SetChunkSize(64)
+	dbf := generateDBF(1000, "secret seed", []byte{1})
+	tree, err := NewBloomTree(dbf, WithWordTrees(), WithChunkSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BloomTree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.SetBloomFilter(dbf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.GenerateWordProof([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tree.GetChunkRange(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyChunkRange(r, tree.Root(), uint64(dbf.BitArray().Len()), WithWordTrees(), WithChunkSize(256)); err != nil || !ok {
+		t.Fatalf("failed to verify chunk range of a tree with word trees: %v", err)
+	}
+}